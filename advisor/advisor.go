@@ -0,0 +1,220 @@
+// Optimization advisor for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Cthulhu doesn't rewrite code, but if asked, it looks at the finished program
+// and points out code that could be shorter or faster. The suggestions are
+// notes with the bytes and cycles they would save. They don't know what the
+// program needs, such as the value of A after storing a zero, so the user
+// has to decide if they can be used.
+//
+// Instructions are only looked at together if nothing can jump between them,
+// so a label between two instructions keeps us from suggesting to merge them.
+
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+const errTag = "ADVISOR"
+
+// advisor holds the state of one run, so several can run at the same time
+type advisor struct {
+	m     *data.Machine
+	ops   map[string]data.Opcode
+	spans map[int]data.Span // status of the MPU by address
+	diags []data.Diagnostic
+}
+
+// Advise takes the machine after the analyzer is done and returns the
+// suggestions for the program. Tests are left alone
+func Advise(m *data.Machine) []data.Diagnostic {
+
+	a := &advisor{m: m, ops: data.OpcodesSAN[m.MPU], spans: map[int]data.Span{}}
+
+	for _, s := range m.Spans {
+		a.spans[s.Addr] = s
+	}
+
+	var prev *node.Node // instruction before this one, if nothing is in between
+
+	for _, n := range m.AST.Kids {
+
+		switch n.Type {
+
+		case token.OPC_0, token.OPC_1, token.OPC_2:
+			a.single(n)
+			if prev != nil {
+				a.pair(prev, n)
+			}
+			prev = n
+
+		case token.DIREC:
+			a.status(n)
+			if len(n.Code) > 0 {
+				prev = nil
+			}
+
+		case token.DIREC_PARA:
+			if len(n.Code) > 0 || n.Text == ".origin" || n.Text == ".segment" {
+				prev = nil
+			}
+
+		case token.LABEL, token.LOCAL_LABEL, token.ANON_LABEL:
+			prev = nil
+		}
+	}
+
+	return data.SortDiagnostics(a.diags)
+}
+
+// suggest takes the node the suggestion is about, what to do, and the bytes
+// and cycles saved, and adds a note
+func (a *advisor) suggest(n *node.Node, msg string, bytes, cycles int) {
+	d := data.At(errTag, n.Token, msg)
+	d.Severity = data.Note
+	d.Hint = fmt.Sprintf("Saves %d byte(s) and %d cycle(s)", bytes, cycles)
+	a.diags = append(a.diags, d)
+}
+
+// single takes an instruction and looks at it on its own
+func (a *advisor) single(n *node.Node) {
+
+	if n.Text == "rep" || n.Text == "sep" {
+		a.status(n)
+	}
+
+	// Absolute addresses in the zero page can use the shorter direct page
+	// mode. Indexed modes wrap around in the zero page and absolute ones
+	// don't, so we leave them alone. In object files, the address isn't
+	// final yet
+	if a.m.Object || len(n.Code) != 3 || strings.Contains(n.Text, ".") {
+		return
+	}
+
+	oc, ok := a.ops[n.Text]
+	dp, okDP := a.ops[n.Text+".d"]
+	if !ok || !okDP {
+		return
+	}
+
+	addr := int(n.Code[1]) | int(n.Code[2])<<8
+
+	if a.m.MPU != "65816" {
+		if addr < 0x100 {
+			msg := fmt.Sprintf("Address $%04X is in the zero page, '%s' can be '%s'", addr, n.Text, dp.SAN)
+			a.suggest(n, msg, oc.Length-dp.Length, oc.Cycles-dp.Cycles)
+		}
+		return
+	}
+
+	// On the 65816, the direct page can be anywhere in bank 0, so we need
+	// to know where it is from .dp. Absolute addresses are in the data
+	// bank, which must be bank 0 as far as we know
+	s, ok := a.spans[n.Addr]
+	if !ok || !s.DPSet || (s.DBRSet && s.DBR != 0) || addr < s.DP || addr > s.DP+0xff {
+		return
+	}
+
+	// A direct page that doesn't start at a page boundary costs a cycle
+	cycles := oc.Cycles - dp.Cycles
+	if s.DP&0xff != 0 {
+		cycles--
+	}
+
+	msg := fmt.Sprintf("Address $%04X is in the direct page at $%04X, '%s' can be '%s'", addr, s.DP, n.Text, dp.SAN)
+	a.suggest(n, msg, oc.Length-dp.Length, cycles)
+}
+
+// pair takes two instructions that follow each other and looks at them
+// together
+func (a *advisor) pair(n1, n2 *node.Node) {
+
+	switch {
+
+	// A subroutine that ends by calling another one can jump there
+	// instead, and that one returns for both
+	case n1.Text == "jsr" && n2.Text == "rts":
+		jmp := a.ops["jmp"]
+		msg := "Tail call: 'jsr' followed by 'rts' can be 'jmp'"
+		a.suggest(n1, msg, len(n2.Code), a.ops["jsr"].Cycles+a.ops["rts"].Cycles-jmp.Cycles)
+
+	// Storing a zero doesn't need A on the 65c02 and 65816
+	case n1.Text == "lda.#" && strings.HasPrefix(n2.Text, "sta") && isZero(n1):
+		stz, ok := a.ops["stz"+strings.TrimPrefix(n2.Text, "sta")]
+		if !ok {
+			return
+		}
+		msg := fmt.Sprintf("'lda.# 0' and '%s' can be '%s' if A isn't needed afterwards", n2.Text, stz.SAN)
+		a.suggest(n1, msg, len(n1.Code), a.ops["lda.#"].Cycles+a.ops[n2.Text].Cycles-stz.Cycles)
+
+	// Adding or subtracting one with the carry cleared or set is the
+	// same as inc.a or dec.a, except for the carry and overflow flags
+	case n1.Text == "clc" && n2.Text == "adc.#" && isOne(n2),
+		n1.Text == "sec" && n2.Text == "sbc.#" && isOne(n2):
+
+		alt := "inc.a"
+		if n2.Text == "sbc.#" {
+			alt = "dec.a"
+		}
+
+		oc, ok := a.ops[alt]
+		if !ok {
+			return
+		}
+
+		msg := fmt.Sprintf("'%s' and '%s 1' can be '%s' if the carry isn't needed afterwards", n1.Text, n2.Text, alt)
+		a.suggest(n1, msg, len(n1.Code)+len(n2.Code)-oc.Length, a.ops[n1.Text].Cycles+a.ops[n2.Text].Cycles-oc.Cycles)
+	}
+}
+
+// status takes a rep or sep instruction, or a directive such as .a16 that
+// becomes one, and reports it if the registers already have the sizes it
+// sets, as far as the assembler knows
+func (a *advisor) status(n *node.Node) {
+
+	if len(n.Code) != 2 || (n.Code[0] != 0xc2 && n.Code[0] != 0xe2) {
+		return
+	}
+
+	s, ok := a.spans[n.Addr]
+	bits := int(n.Code[1])
+
+	// Other bits of the status register change more than the sizes
+	if !ok || s.Emulated || bits&^0x30 != 0 || bits == 0 {
+		return
+	}
+
+	set := n.Code[0] == 0xe2 // sep
+
+	if (bits&0x20 == 0 || s.A8 == set) && (bits&0x10 == 0 || s.XY8 == set) {
+		msg := fmt.Sprintf("Registers already have the sizes '%s' sets", n.Text)
+		a.suggest(n, msg, 2, a.ops["rep"].Cycles)
+	}
+}
+
+// isZero takes an instruction with an immediate operand and returns true if
+// the operand is zero
+func isZero(n *node.Node) bool {
+	for _, b := range n.Code[1:] {
+		if b != 0 {
+			return false
+		}
+	}
+	return len(n.Code) > 1
+}
+
+// isOne takes an instruction with an immediate operand and returns true if
+// the operand is one
+func isOne(n *node.Node) bool {
+	if len(n.Code) < 2 || n.Code[1] != 1 {
+		return false
+	}
+	return len(n.Code) == 2 || n.Code[2] == 0
+}
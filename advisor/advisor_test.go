@@ -0,0 +1,109 @@
+// Test file for the advisor of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package advisor
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"cthulhu/analyzer"
+	"cthulhu/data"
+	"cthulhu/generator"
+	"cthulhu/lexer"
+	"cthulhu/parser"
+)
+
+// advise takes the MPU and the source code of "main.asm", assembles it and
+// returns the diagnostics with the suggestions
+func advise(t *testing.T, mpu, src string) []data.Diagnostic {
+
+	open := func(string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(src)), nil
+	}
+
+	ts, ds := lexer.Scan(mpu, "main.asm", open)
+	ast, pds := parser.Parse(ts)
+	ds = append(ds, pds...)
+
+	m := &data.Machine{MPU: mpu, AST: analyzer.Purge(mpu, ast)}
+	ds = append(ds, analyzer.Analyze(m)...)
+
+	if data.CountErrors(ds) != 0 {
+		t.Fatalf("got diagnostics %v", ds)
+	}
+
+	generator.Generator(m)
+
+	return Advise(m)
+}
+
+func TestAdvise(t *testing.T) {
+	var tests = []struct {
+		name  string
+		mpu   string
+		src   string
+		diags []string
+	}{
+		{"dec.a", "65c02", `        .origin $8000
+        sec
+        sbc.# 1
+`, []string{"ADVISOR NOTE (main.asm, 2, 9): 'sec' and 'sbc.# 1' can be 'dec.a' if the carry isn't needed afterwards\n    Hint: Saves 2 byte(s) and 2 cycle(s)"}},
+		{"no inc.a on 6502", "6502", `        .origin $8000
+        clc
+        adc.# 1
+`, nil},
+		{"label in between", "65c02", `        .origin $8000
+        lda.# 0
+here:   sta $2000
+        jsr sub
+done:   rts
+sub:    rts
+`, nil},
+		{"no stz.l", "65816", `        .origin $8000
+        lda.# 0
+        sta.l $012000
+`, nil},
+		{"zero page", "65c02", `        .origin $8000
+        .equ ptr $00FE
+        sta ptr
+        sta.y ptr
+        sta $0100
+`, []string{"ADVISOR NOTE (main.asm, 3, 9): Address $00FE is in the zero page, 'sta' can be 'sta.d'\n    Hint: Saves 1 byte(s) and 1 cycle(s)"}},
+		{"direct page", "65816", `        .origin $8000
+        lda $0010
+        .dp $2000
+        lda $2010
+        lda $2110
+        .dp $2080
+        sta $2100
+        .databank $7E
+        lda $2010
+`, []string{
+			"ADVISOR NOTE (main.asm, 4, 9): Address $2010 is in the direct page at $2000, 'lda' can be 'lda.d'\n    Hint: Saves 1 byte(s) and 1 cycle(s)",
+			"ADVISOR NOTE (main.asm, 7, 9): Address $2100 is in the direct page at $2080, 'sta' can be 'sta.d'\n    Hint: Saves 1 byte(s) and 0 cycle(s)",
+		}},
+		{"status only in native mode", "65816", `        .origin $8000
+        sep $30
+        clc
+        xce
+        rep $10
+        .xy16
+`, []string{
+			"ADVISOR NOTE (main.asm, 6, 9): Registers already have the sizes '.xy16' sets\n    Hint: Saves 2 byte(s) and 3 cycle(s)",
+		}},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, d := range advise(t, test.mpu, test.src) {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.diags, "\n") {
+			t.Errorf("%s: got diagnostics %q, want %q", test.name, got, test.diags)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 // Analyzer package for the Cthulhu Assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 12. May 2018
-// This version: 21. May 2018
+// This version: 19. Oct 2026
 
 // The analyzer is where the main processing happens. As the core of the back
 // end part of the assembler, it is nicknamed "Azathoth, ruler of the Outer
@@ -11,8 +11,6 @@ package analyzer
 
 import (
 	"fmt"
-	"log"
-	"os"
 	"strconv"
 	"strings"
 
@@ -25,39 +23,99 @@ const (
 	errTag = "ANALYZER"
 )
 
-var (
-	errCount int
-)
+// analyzer holds the state of one run of the analyzer, so that several can
+// run at the same time
+type analyzer struct {
+	diags   []data.Diagnostic
+	symbols map[string]data.Symbol
+
+	// Scopes are numbered in the order they appear in the source. The
+	// stack holds the numbers of the scopes we are currently in, the
+	// innermost one last
+	scopes     []int
+	scopeCount int
+	counts     []cycleCount // one for each open scope, innermost last
+
+	pc        int   // address of the node we are working on
+	anons     []int // addresses of the anonymous labels
+	anonCount int   // number of anonymous labels we have passed
+
+	// Status of the 65816. The 6502 and 65c02 are always "emulated" with
+	// 8 bit registers
+	emulated bool
+	a8       bool
+	xy8      bool
+	carry    int // -1 if we don't know, otherwise 0 or 1 for "xce"
+
+	// Where the direct page is, from .dp. Without it, operands of the
+	// direct page modes are the offset as on the 6502
+	dp    int
+	dpSet bool
+
+	// Which bank DBR points to, from .databank. Without it, we don't
+	// check the bank of absolute addresses
+	dbr    int
+	dbrSet bool
+	banked map[string]bool     // .equ symbols with a bank, see bankKnown
+	wide   map[*node.Node]bool // numbers written with a bank, such as $00:4200
+
+	enc     encoding // active encoding for strings
+	encName string
+
+	// Object files have segments the linker places, so values that
+	// depend on where they go need relocations
+	object   bool
+	base     data.Base // what addresses in the segment we are in are relative to
+	seg      int       // index of the segment we are in, -1 before the first
+	segStart int
+	relocs   []data.Reloc
+}
+
+// reportErr takes a string and the current node and adds an error to the list
+func (az *analyzer) reportErr(s string, n *node.Node) {
+	az.report(data.At(errTag, n.Token, s))
+}
 
-// reportErr takes a string and the current node and prints an error report to the standard
-// error output
-func reportErr(s string, n *node.Node) {
-	fmt.Fprintf(os.Stderr, "%s ERROR (%s, %d, %d): %s\n",
-		errTag, n.File, n.Line, n.Index, s)
-	errCount++
+// report takes a diagnostic and adds it to the list
+func (az *analyzer) report(d data.Diagnostic) {
+	az.diags = append(az.diags, d)
 }
 
-// The analyzer walks the Abstract Syntax Tree (AST) created by the parser and
-// modifies it in various ways
-func Analyzer(m *data.Machine) {
+// Analyze walks the Abstract Syntax Tree (AST) created by the parser and
+// modifies it in various ways. The symbol table ends up in the machine, and
+// the errors found are returned. The symbol table is complete even if there
+// are errors
+func Analyze(m *data.Machine) []data.Diagnostic {
+
+	az := analyzer{symbols: map[string]data.Symbol{}, banked: map[string]bool{}, wide: map[*node.Node]bool{}, object: m.Object}
+	m.Symbols = az.symbols
 
 	// FIRST PASS
-	walk(m.AST, m.MPU)
+	az.walk(m.AST, m.MPU)
 
 	// SECOND PASS
-	// TODO
-
-	if errCount != 0 {
-		log.Fatalf("ANALYZER FATAL: Found %d error(s).", errCount)
+	// Give the nodes their addresses and define the labels
+	az.layout(m)
+
+	// THIRD PASS
+	// Fill in the operands and data now that all labels are known
+	az.encode(m)
+	m.Relocs = az.relocs
+
+	// FOURTH PASS
+	// Follow the subroutines to see if they leave the stack as they found
+	// it. This needs all operands, so only without errors
+	if len(az.diags) == 0 {
+		az.checkStack(m)
 	}
 
-	fmt.Println()
+	return az.diags
 }
 
 // Walk is the main internal routine that visits every node and does something
 // depending on type. We break out what we do into little functions to allow
 // easier testing and possibly concurrency once we know what we are doing.
-func walk(n *node.Node, mpu string) {
+func (az *analyzer) walk(n *node.Node, mpu string) {
 
 	var ok bool
 
@@ -75,19 +133,19 @@ func walk(n *node.Node, mpu string) {
 			// string part
 			if len(n.Kids) != 1 {
 				es := fmt.Sprintf("Directive '.mpu' takes one parameter, got %d", len(n.Kids))
-				reportErr(es, n)
+				az.reportErr(es, n)
 			}
 			k := n.Kids[0]
 
 			if k.Text != "65816" && k.Text != "65c02" && k.Text != "6502" {
 				es := fmt.Sprintf("MPU type '%s' not supported", k.Text)
-				reportErr(es, n)
+				az.reportErr(es, n)
 			}
 
 			if mpu != k.Text {
 				es := fmt.Sprintf("Requested MPU type '%s', .mpu in '%s' is '%s'",
 					mpu, k.File, k.Text)
-				reportErr(es, n)
+				az.reportErr(es, n)
 			}
 
 			n.Kids = nil
@@ -123,8 +181,9 @@ func walk(n *node.Node, mpu string) {
 		n.Value, ok = convertNum(n.Text, 2)
 		if !ok {
 			es := fmt.Sprintf("Can't convert binary number string '%s' to number", n.Text)
-			reportErr(es, n)
+			az.reportErr(es, n)
 		}
+		az.wide[n] = digits(n.Text) > 16
 
 		n.Type = token.DEC_NUM
 
@@ -134,7 +193,7 @@ func walk(n *node.Node, mpu string) {
 		v, err := strconv.Atoi(n.Text)
 		if err != nil {
 			es := fmt.Sprintf("Can't convert decimal number string '%s' to number", n.Text)
-			reportErr(es, n)
+			az.reportErr(es, n)
 		}
 		n.Value = int(v)
 
@@ -142,25 +201,21 @@ func walk(n *node.Node, mpu string) {
 		n.Value, ok = convertNum(n.Text, 16)
 		if !ok {
 			es := fmt.Sprintf("Can't convert hex number string '%s' to number", n.Text)
-			reportErr(es, n)
+			az.reportErr(es, n)
 		}
+		az.wide[n] = digits(n.Text) > 4
 
 		n.Type = token.DEC_NUM
 
-	// STRING CONVERSION: Convert string from node.Text to a sequence of
-	// bytes. Store them in node.Code. Mark node as done. Note that Go
-	// converts strings as unicode, which not all assembler programs are
-	// equipped to handle
-	case token.STRING:
-		n.Code = []byte(n.Text)
-		n.Done = true
+	// Strings are converted to bytes by the layout pass, since that is
+	// where we know which encoding is active
 
 	// Convert all opcodes
 	case token.OPC_0, token.OPC_1, token.OPC_2:
 		oc, ok := getOpcode(mpu, n.Text)
 		if !ok {
 			es := fmt.Sprintf("Opcode '%s' not recognized for MPU %s", n.Text, mpu)
-			reportErr(es, n)
+			az.reportErr(es, n)
 		}
 
 		n.Code = append(n.Code, oc)
@@ -194,7 +249,7 @@ func walk(n *node.Node, mpu string) {
 
 	// We've got good kids now, let's walk them recursively
 	for _, k := range n.Kids {
-		walk(k, mpu)
+		az.walk(k, mpu)
 	}
 }
 
@@ -204,8 +259,7 @@ func walk(n *node.Node, mpu string) {
 func convertNum(s string, base int) (int, bool) {
 
 	if base != 2 && base != 16 {
-		log.Fatalf("ANALYZER FATAL: Internal error: Received base %d to convert, must be binary, hex or decimal",
-			base)
+		panic(fmt.Sprintf("Received base %d to convert, must be binary, hex or decimal", base))
 	}
 
 	ok := true
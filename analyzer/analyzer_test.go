@@ -0,0 +1,269 @@
+// Test file for the analyzer of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package analyzer
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"cthulhu/data"
+	"cthulhu/generator"
+	"cthulhu/lexer"
+	"cthulhu/parser"
+)
+
+// analyze takes the MPU, a flag for object files and the source code of
+// "main.asm", and returns the machine after the generator and the
+// diagnostics. The generator only runs if there are no errors
+func analyze(mpu string, object bool, src string) (*data.Machine, []data.Diagnostic) {
+
+	open := func(string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(src)), nil
+	}
+
+	ts, ds := lexer.Scan(mpu, "main.asm", open)
+	ast, pds := parser.Parse(ts)
+	ds = append(ds, pds...)
+
+	m := &data.Machine{MPU: mpu, Object: object, AST: Purge(mpu, ast)}
+	ds = append(ds, Analyze(m)...)
+
+	if data.CountErrors(ds) == 0 {
+		generator.Generator(m)
+	}
+
+	return m, ds
+}
+
+// The passes of the analyzer that check the program, with the diagnostics they
+// report
+func TestAnalyze(t *testing.T) {
+	var tests = []struct {
+		name  string
+		mpu   string
+		src   string
+		diags []string
+	}{
+		// Stack balance
+		{"merging depths", "65c02", `        .origin $8000
+        jsr sub
+        stp
+sub:    bcc skip
+        pha
+skip:   rts
+`, []string{"ANALYZER WARNING (main.asm, 6, 9): Subroutine 'sub' returns with 1 byte(s) still on the stack\n    (main.asm, 2, 9): Called with 'jsr' here"}},
+		{"merging the same depth", "65c02", `        .origin $8000
+        jsr sub
+        stp
+sub:    pha
+        bcc skip
+        nop
+skip:   pla
+        rts
+`, nil},
+		{"pulled more than pushed", "65c02", `        .origin $8000
+        jsr sub
+        stp
+sub:    bcc skip
+        pla
+skip:   rts
+`, []string{"ANALYZER WARNING (main.asm, 6, 9): Subroutine 'sub' returns after pulling 1 byte(s) more than it pushed\n    (main.asm, 2, 9): Called with 'jsr' here"}},
+		{"rtl after jsr", "65816", `        .origin $8000
+        jsr sub
+        jsr.l far
+        stp
+sub:    rts.l
+far:    rts
+`, []string{
+			"ANALYZER WARNING (main.asm, 5, 9): Subroutine 'sub' is called with 'jsr', but returns with 'rts.l'\n    (main.asm, 2, 9): Called with 'jsr' here",
+			"ANALYZER WARNING (main.asm, 6, 9): Subroutine 'far' is called with 'jsr.l', but returns with 'rts'\n    (main.asm, 3, 9): Called with 'jsr.l' here",
+		}},
+		{"16 bit push and 8 bit pull", "65816", `        .origin $8000
+        .native
+        .a16
+        jsr sub
+        stp
+sub:    pha
+        .!a8
+        pla
+        rts
+`, []string{"ANALYZER WARNING (main.asm, 9, 9): Subroutine 'sub' returns with 1 byte(s) still on the stack\n    (main.asm, 4, 9): Called with 'jsr' here"}},
+		{"16 bit push and pull", "65816", `        .origin $8000
+        .native
+        .axy16
+        jsr sub
+        stp
+sub:    phx
+        phe.# $1234
+        pld
+        ply
+        rts
+`, nil},
+
+		// Direct page and data bank
+		{"outside of direct page", "65816", `        .origin $8000
+        .dp $2000
+        lda.d $2010
+        lda.d $2110
+        .dp $012000
+`, []string{
+			"ANALYZER ERROR (main.asm, 4, 9): Address $2110 of 'lda.d' is outside of the direct page ($2000-$20FF)",
+			"ANALYZER ERROR (main.asm, 5, 9): Direct page $12000 of '.dp' must be in bank 0",
+		}},
+		{"outside of data bank", "65816", `        .origin $8000
+        .databank $7E
+        lda $7E:1234
+        lda $7F:1234
+        lda.l $7F:1234
+        .databank $100
+`, []string{
+			"ANALYZER ERROR (main.asm, 4, 9): Address $7F:1234 of 'lda' is not in the data bank $7E\n    Hint: Use 'lda.l' for a long address",
+			"ANALYZER ERROR (main.asm, 6, 9): Data bank $100 of '.databank' out of range ($0 to $FF)",
+		}},
+
+		// Data and padding
+		{"data out of range", "65c02", `        .origin $8000
+        .byte 256
+        .long $1000000
+        .pstring "` + strings.Repeat("a", 256) + `"
+        .hstring "a` + "\\x80" + `"
+`, []string{
+			"ANALYZER ERROR (main.asm, 2, 15): Value 256 doesn't fit in a byte",
+			"ANALYZER ERROR (main.asm, 3, 15): Value 16777216 doesn't fit in a long",
+			"ANALYZER ERROR (main.asm, 4, 9): String of '.pstring' too long by 1 byte(s)",
+			"ANALYZER ERROR (main.asm, 5, 9): Last byte $80 of '.hstring' already has bit 7 set",
+		}},
+		{"padding errors", "65c02", `        .origin $8000
+        .align 3
+        .skip {0 1 -}
+`, []string{
+			"ANALYZER ERROR (main.asm, 2, 9): Alignment 3 of '.align' must be a power of two",
+			"ANALYZER ERROR (main.asm, 3, 9): Directive '.skip' can't skip -1 bytes",
+		}},
+		{"charmap out of range", "65c02", `        .origin $8000
+        .charmap "a" $100
+`, []string{"ANALYZER ERROR (main.asm, 2, 22): Characters of '.charmap' must map to bytes, got $100"}},
+
+		// Segments
+		{"segment defined twice", "65c02", `        .origin $8000
+        .segment "data" $9000
+        .segment "data" $A000
+`, []string{"ANALYZER ERROR (main.asm, 3, 18): Segment 'data' already defined\n    (main.asm, 2, 9): First defined here"}},
+	}
+
+	for _, test := range tests {
+		_, ds := analyze(test.mpu, false, test.src)
+
+		var got []string
+		for _, d := range data.SortDiagnostics(ds) {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.diags, "\n") {
+			t.Errorf("%s: got diagnostics %q, want %q", test.name, got, test.diags)
+		}
+	}
+}
+
+// A routine that calls itself, directly or through another one, has no depth
+// we can know. The others get the return address and depth of the routines
+// they call
+func TestCallGraph(t *testing.T) {
+
+	src := `        .origin $8000
+main:   jsr one
+        jsr ping
+        stp
+one:    pha
+        jsr two
+        pla
+        rts
+two:    phx
+        phy
+        plx
+        ply
+        rts
+ping:   jsr pong
+        rts
+pong:   jsr ping
+        rts
+self:   jsr self
+        rts
+`
+
+	m, ds := analyze("65c02", false, src)
+	if data.CountErrors(ds) != 0 {
+		t.Fatalf("got diagnostics %v", ds)
+	}
+
+	want := map[string]struct {
+		depth   int
+		unknown string
+	}{
+		"main": {7, "recursion"},
+		"one":  {5, ""},
+		"two":  {2, ""},
+		"ping": {2, "recursion"},
+		"pong": {0, "recursion"},
+		"self": {0, "recursion"},
+	}
+
+	g := CallGraph(m)
+
+	for _, r := range g.Routines {
+		w, ok := want[r.Name]
+		if !ok {
+			t.Errorf("unexpected routine %s", r.Name)
+			continue
+		}
+		if r.Depth != w.depth || r.Unknown != w.unknown {
+			t.Errorf("%s: got depth %d (%q), want %d (%q)", r.Name, r.Depth, r.Unknown, w.depth, w.unknown)
+		}
+		delete(want, r.Name)
+	}
+
+	for name := range want {
+		t.Errorf("missing routine %s", name)
+	}
+
+	if len(g.Vectors) != 1 || g.Vectors[0].Name != "start" || g.Vectors[0].Stack != 7 ||
+		g.Vectors[0].Unknown != "recursion" {
+		t.Errorf("got vectors %+v, want only start with 7 bytes and recursion", g.Vectors)
+	}
+}
+
+// Object files keep the places that use imported symbols or addresses in
+// relocatable segments for the linker
+func TestRelocs(t *testing.T) {
+
+	src := `        .import print
+        .segment "code"
+start:  jsr print
+        lda.# .lsb start
+        .word print + 2
+`
+
+	m, ds := analyze("65c02", true, src)
+	if data.CountErrors(ds) != 0 {
+		t.Fatalf("got diagnostics %v", ds)
+	}
+
+	want := []data.Reloc{
+		{Offset: 1, Width: 2, Operand: true, Base: data.Base{Import: "print"}, File: "main.asm", Line: 3, Column: 13},
+		{Offset: 4, Width: 1, Kind: ".lsb", Operand: true, Base: data.Base{Segment: "code"}, File: "main.asm", Line: 4, Column: 15},
+		{Offset: 5, Width: 2, Base: data.Base{Import: "print"}, Addend: 2, File: "main.asm", Line: 5, Column: 15},
+	}
+
+	if len(m.Relocs) != len(want) {
+		t.Fatalf("got relocs %+v, want %+v", m.Relocs, want)
+	}
+
+	for i, r := range m.Relocs {
+		if r != want[i] {
+			t.Errorf("reloc %d: got %+v, want %+v", i, r, want[i])
+		}
+	}
+}
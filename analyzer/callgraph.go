@@ -0,0 +1,315 @@
+// Call graph for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The call graph shows which routines call which other ones, from the jsr,
+// jsr.l and jmp instructions with addresses we know. Routines start where a
+// jsr or jsr.l goes, at the handlers in the interrupt vectors, and at the
+// start of the program if it has no reset vector. A jmp to the start of a
+// routine is an edge of the graph, one to anywhere else stays inside the
+// routine.
+//
+// With the graph, we get the most bytes each routine can put on the stack,
+// following the paths through it as for the stack balance and adding the
+// return address and depth of each routine it calls. txs and tcs set up a new
+// stack, so the count starts over after them. For the handlers, the
+// bytes the interrupt pushes come on top, so we know how much of page 1 a
+// program needs in emulated mode. Recursion and loops that push have no
+// depth we can know.
+
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+
+	"cthulhu/data"
+	"cthulhu/node"
+)
+
+// Graph is the call graph of a program
+type Graph struct {
+	Routines []Routine // sorted by address
+	Vectors  []Vector  // in the order of memory
+}
+
+// Routine is a routine of the call graph. Depth is the most bytes it and the
+// routines it calls can put on the stack, without its own return address. If
+// Unknown isn't empty, it says why we can't know the depth
+type Routine struct {
+	Name    string
+	Addr    int
+	Calls   []Call // in the order of addresses
+	Depth   int
+	Unknown string
+}
+
+// Call is an edge of the call graph
+type Call struct {
+	From int    // address of the instruction
+	To   int    // address of the routine called
+	Kind string // SAN mnemonic: "jsr", "jsr.l", "jmp" or "jmp.l"
+	File string
+	Line int
+}
+
+// Vector is an interrupt vector with a handler in the program. Frame is what
+// the MPU pushes before it gets to the handler, and Stack the most bytes that
+// can be on the stack because of the interrupt. The start of a program
+// without a reset vector has the address -1
+type Vector struct {
+	Name    string
+	Addr    int
+	Native  bool // one of the vectors of the 65816 in native mode
+	Handler int
+	Frame   int
+	Stack   int
+	Unknown string
+}
+
+// vectorDef is where to find a vector and what the MPU pushes for it
+type vectorDef struct {
+	name   string
+	addr   int
+	native bool
+	frame  int
+}
+
+// Vectors of the MPUs. The return address and status take three bytes, and
+// the 65816 in native mode adds the program bank
+var (
+	vectors6502 = []vectorDef{
+		{"nmi", 0xfffa, false, 3},
+		{"reset", 0xfffc, false, 0},
+		{"irq", 0xfffe, false, 3},
+	}
+
+	vectors65816 = []vectorDef{
+		{"cop", 0xffe4, true, 4},
+		{"brk", 0xffe6, true, 4},
+		{"abort", 0xffe8, true, 4},
+		{"nmi", 0xffea, true, 4},
+		{"irq", 0xffee, true, 4},
+		{"cop", 0xfff4, false, 3},
+		{"abort", 0xfff8, false, 3},
+		{"nmi", 0xfffa, false, 3},
+		{"reset", 0xfffc, false, 0},
+		{"irq", 0xfffe, false, 3},
+	}
+)
+
+// Kinds of jumps that are edges of the graph if they go to a routine
+var jumps = map[string]bool{"jmp": true, "jmp.l": true}
+
+// Visiting routines
+const (
+	notVisited = iota
+	visiting
+	visited
+)
+
+// grapher holds the state while we build the graph
+type grapher struct {
+	f        *flow
+	routines map[int]*Routine
+	state    map[int]int
+}
+
+// CallGraph takes the machine after the generator is done and returns its
+// call graph. Object files have none, since their addresses aren't final
+func CallGraph(m *data.Machine) Graph {
+	var g Graph
+
+	if m.Object {
+		return g
+	}
+
+	gr := &grapher{f: newFlow(m), routines: map[int]*Routine{}, state: map[int]int{}}
+
+	g.Vectors = gr.vectors(m)
+	for _, v := range g.Vectors {
+		gr.add(v.Handler)
+	}
+
+	for _, n := range gr.f.ins {
+		if n != nil && isCall(n) {
+			gr.add(target(n))
+		}
+	}
+
+	// In the order of addresses, so the graph is the same each time
+	var addrs []int
+	for addr := range gr.routines {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+
+	for _, addr := range addrs {
+		g.Routines = append(g.Routines, *gr.visit(addr))
+	}
+
+	for i, v := range g.Vectors {
+		r := gr.routines[v.Handler]
+		g.Vectors[i].Stack = v.Frame + r.Depth
+		g.Vectors[i].Unknown = r.Unknown
+	}
+
+	return g
+}
+
+// vectors takes the machine and returns the vectors that point to an
+// instruction of the program. Without a reset vector, the program starts
+// with its first instruction
+func (gr *grapher) vectors(m *data.Machine) []Vector {
+	var vs []Vector
+
+	defs := vectors6502
+	if m.MPU == "65816" {
+		defs = vectors65816
+	}
+
+	reset := false
+
+	for _, d := range defs {
+		i := d.addr - m.Origin
+		if i < 0 || i+1 >= len(m.Code) {
+			continue
+		}
+
+		handler := int(m.Code[i]) | int(m.Code[i+1])<<8
+		if _, ok := gr.f.at[handler]; !ok {
+			continue
+		}
+
+		vs = append(vs, Vector{Name: d.name, Addr: d.addr, Native: d.native, Handler: handler, Frame: d.frame})
+		reset = reset || d.name == "reset"
+	}
+
+	if !reset {
+		for _, n := range gr.f.ins {
+			if n != nil {
+				vs = append([]Vector{{Name: "start", Addr: -1, Handler: n.Addr}}, vs...)
+				break
+			}
+		}
+	}
+
+	return vs
+}
+
+// add takes an address and makes it the start of a routine, if there is an
+// instruction there
+func (gr *grapher) add(addr int) {
+	if _, ok := gr.f.at[addr]; !ok {
+		return
+	}
+	if _, ok := gr.routines[addr]; ok {
+		return
+	}
+
+	name, ok := gr.f.labels[addr]
+	if !ok {
+		name = fmt.Sprintf("$%04X", addr)
+	}
+
+	gr.routines[addr] = &Routine{Name: name, Addr: addr}
+}
+
+// visit takes the address of a routine and follows it to find its calls and
+// depth, after the routines it calls. Returns nil if we are already following
+// the routine, which means it calls itself
+func (gr *grapher) visit(addr int) *Routine {
+
+	r := gr.routines[addr]
+
+	switch gr.state[addr] {
+	case visited:
+		return r
+	case visiting:
+		return nil
+	}
+	gr.state[addr] = visiting
+
+	seen := map[stackState]bool{}
+	edges := map[string]bool{}
+	work := []stackState{{i: gr.f.at[addr]}}
+
+	// callee takes the address of a routine we go to, the bytes on the
+	// stack when we get there, and the node that goes there
+	callee := func(to, depth int, n *node.Node) {
+		if k := fmt.Sprintf("%d %s", to, n.Text); !edges[k] {
+			edges[k] = true
+			r.Calls = append(r.Calls, Call{From: n.Addr, To: to, Kind: n.Text, File: n.File, Line: n.Line})
+		}
+
+		c := gr.visit(to)
+		if c == nil {
+			r.Unknown = "recursion"
+			return
+		}
+
+		if c.Unknown != "" && r.Unknown == "" {
+			r.Unknown = c.Unknown
+		}
+		if depth+c.Depth > r.Depth {
+			r.Depth = depth + c.Depth
+		}
+	}
+
+	for len(work) > 0 {
+		s := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if seen[s] {
+			continue
+		}
+		if s.depth > maxPushed {
+			if r.Unknown == "" {
+				r.Unknown = "a loop pushes"
+			}
+			continue
+		}
+		seen[s] = true
+
+		n := gr.f.ins[s.i]
+		depth := s.depth + gr.f.pushed(n)
+		if depth > r.Depth {
+			r.Depth = depth
+		}
+
+		if isCall(n) {
+			if _, ok := gr.routines[target(n)]; ok {
+				ret := 2
+				if n.Text == "jsr.l" {
+					ret = 3
+				}
+				callee(target(n), depth+ret, n)
+			}
+		}
+
+		if jumps[n.Text] {
+			if _, ok := gr.routines[target(n)]; ok && target(n) != addr {
+				callee(target(n), depth, n)
+				continue
+			}
+		}
+
+		// Setting up a new stack, as the reset handler does, starts the
+		// count over. The stack balance can't follow these
+		if wdc := gr.f.ops[n.Text].WDC; wdc == "txs" || wdc == "tcs" {
+			if s.i+1 < len(gr.f.ins) && gr.f.ins[s.i+1] != nil {
+				work = append(work, stackState{i: s.i + 1})
+			}
+			continue
+		}
+
+		for _, j := range gr.f.next(s.i) {
+			work = append(work, stackState{i: j, depth: depth})
+		}
+	}
+
+	sort.Slice(r.Calls, func(i, j int) bool { return r.Calls[i].From < r.Calls[j].From })
+
+	gr.state[addr] = visited
+	return r
+}
@@ -0,0 +1,119 @@
+// Cycles: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// While the layout pass walks through the program, it knows the size of the
+// registers and if the 65816 is in emulated mode, so it can count the cycles
+// of each instruction. What it can't know is if a branch is taken, if indexing
+// crosses a page, or if decimal mode is on, so each instruction gets the
+// fewest and the most cycles it can take. The direct page costs one more
+// cycle unless .dp says it is page-aligned, and block moves count for a
+// single byte. The totals of a .scope are the sums of its instructions, each
+// counted once, and can be limited with the .cycles directive
+
+package analyzer
+
+import (
+	"fmt"
+
+	"cthulhu/data"
+	"cthulhu/node"
+)
+
+// cycleCount holds the cycles of a scope we are in
+type cycleCount struct {
+	min, max int
+	limit    *node.Node // the .cycles directive of the scope, if any
+}
+
+// countCycles takes an instruction and its opcode, and adds the fewest and
+// most cycles it can take to the node and the open scopes
+func (az *analyzer) countCycles(n *node.Node, oc data.Opcode) {
+
+	min, extra := oc.Cycles, 0
+	p := oc.Penalties
+
+	if !az.emulated {
+		if p&data.CycM != 0 && !az.a8 {
+			min++
+		}
+		if p&data.CycRMW != 0 && !az.a8 {
+			min += 2
+		}
+		if p&data.CycX != 0 && !az.xy8 {
+			min++
+		}
+		if p&data.CycNative != 0 {
+			min++
+		}
+	}
+
+	switch {
+	case p&data.CycIndex != 0 && !az.emulated && !az.xy8:
+		min++ // always with 16-bit index registers
+	case p&data.CycIndex != 0:
+		extra++
+	}
+
+	if p&data.CycTaken != 0 {
+		extra++
+	}
+	if p&data.CycCross != 0 && az.emulated {
+		extra++
+	}
+	if p&data.CycDecimal != 0 {
+		extra++
+	}
+	if p&data.CycDirect != 0 && (!az.dpSet || az.dp&0xff != 0) {
+		extra++
+	}
+
+	n.Cycles, n.MaxCycles = min, min+extra
+
+	for i := range az.counts {
+		az.counts[i].min += min
+		az.counts[i].max += min + extra
+	}
+}
+
+// limitCycles takes a .cycles directive and makes it the limit of the scope
+// it is in
+func (az *analyzer) limitCycles(n *node.Node) {
+
+	if len(az.counts) == 0 {
+		az.reportErr("Directive '.cycles' outside of a scope", n)
+		return
+	}
+
+	c := &az.counts[len(az.counts)-1]
+	if c.limit != nil {
+		az.reportErr("Only one '.cycles' directive allowed per scope", n)
+		return
+	}
+
+	c.limit = n
+}
+
+// endCycles takes a .scend directive, adds the totals of the scope it ends
+// and checks them against the limit
+func (az *analyzer) endCycles(n *node.Node) {
+
+	if len(az.counts) == 0 {
+		return
+	}
+
+	c := az.counts[len(az.counts)-1]
+	az.counts = az.counts[:len(az.counts)-1]
+
+	n.Cycles, n.MaxCycles = c.min, c.max
+
+	if c.limit == nil {
+		return
+	}
+
+	max, ok := az.eval(c.limit.Kids[0], true)
+	if ok && c.max > max {
+		es := fmt.Sprintf("Scope can take up to %d cycles, limit is %d", c.max, max)
+		az.reportErr(es, c.limit)
+	}
+}
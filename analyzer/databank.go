@@ -0,0 +1,152 @@
+// Data bank: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// On the 65816, absolute addresses only have 16 bits, and the MPU takes the
+// bank from the data bank register (DBR). Programs change it with plb, which
+// the assembler can't follow, so ".databank" tells it which bank DBR points
+// to from there on. An address in another bank as the operand of an absolute
+// mode is then an error, because the instruction would go to the same
+// address in the data bank instead. This includes bank 0, so we only check
+// addresses whose bank we know: labels, and numbers and .equ symbols written
+// with the bank, such as $00:4200. Without ".databank", the bank byte is
+// dropped as before.
+
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// setDataBank takes a .databank directive and the MPU, and makes its value
+// the bank of absolute addresses
+func (az *analyzer) setDataBank(n *node.Node, mpu string) {
+
+	if mpu != "65816" {
+		return // already reported by the layout pass
+	}
+
+	v, ok := az.eval(n.Kids[0], true)
+	if !ok {
+		return
+	}
+
+	if v < 0 || v > 0xff {
+		es := fmt.Sprintf("Data bank $%X of '%s' out of range ($0 to $FF)", v, n.Text)
+		az.reportErr(es, n)
+		return
+	}
+
+	az.dbr, az.dbrSet = v, true
+}
+
+// Addressing modes whose address is in the data bank, by the suffix of the
+// SAN mnemonic: absolute, and absolute indexed with X or Y
+var dataBankModes = map[string]bool{"": true, "x": true, "y": true}
+
+// usesDataBank takes an opcode and returns true if its absolute address is in
+// the data bank. Jumps use the program bank instead, and block moves have
+// banks as operands. The length leaves out brk, rep and such, which have no
+// suffix either
+func usesDataBank(oc data.Opcode) bool {
+	switch oc.WDC {
+	case "jmp", "jsr", "mvn", "mvp":
+		return false
+	}
+
+	mode := ""
+	if i := strings.Index(oc.SAN, "."); i >= 0 {
+		mode = oc.SAN[i+1:]
+	}
+
+	return dataBankModes[mode] && oc.Length == 3
+}
+
+// bankKnown takes an operand and returns true if we know its bank: it uses
+// a label, or a number or .equ symbol written with a bank. Other addresses
+// are in whatever bank DBR points to
+func (az *analyzer) bankKnown(n *node.Node) bool {
+	switch n.Type {
+
+	case token.DEC_NUM:
+		return az.wide[n] || n.Value > 0xffff
+
+	case token.SYMBOL:
+		k, ok := az.lookup(n.Text)
+		if !ok {
+			return false
+		}
+		t := az.symbols[k].Type
+		return t == "label" || t == "local" || az.banked[k]
+
+	// Anonymous labels, unless they are operators, see evalExpr
+	case token.MINUS, token.PLUS:
+		return true
+
+	case token.EXPR:
+		switch len(n.Kids) {
+		case 1:
+			return az.bankKnown(n.Kids[0])
+		case 2:
+			return az.bankKnown(n.Kids[1])
+		case 3:
+			return az.bankKnown(n.Kids[0]) || az.bankKnown(n.Kids[2])
+		}
+
+	case token.RPN:
+		for _, k := range n.Kids {
+			if k.Type != token.MINUS && k.Type != token.PLUS && az.bankKnown(k) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// dataBank takes an instruction with an absolute address, the value of its
+// operand and the MPU, and returns false if the address is in another bank
+// than the one .databank says DBR points to
+func (az *analyzer) dataBank(n *node.Node, v int, mpu string) bool {
+
+	// Addresses without a bank are in whatever bank DBR points to, and
+	// in object files, the bank isn't known before linking
+	if !az.dbrSet || !az.bankKnown(n.Kids[0]) || az.relative(n.Kids[0]) {
+		return true
+	}
+
+	oc, ok := data.OpcodesSAN[mpu][n.Text]
+	if !ok || !usesDataBank(oc) || v>>16 == az.dbr {
+		return true
+	}
+
+	es := fmt.Sprintf("Address $%02X:%04X of '%s' is not in the data bank $%02X", v>>16, v&0xffff, n.Text, az.dbr)
+	d := data.At(errTag, n.Token, es)
+
+	if long, ok := data.OpcodesSAN[mpu][longForm(n.Text)]; ok {
+		d.Hint = fmt.Sprintf("Use '%s' for a long address", long.SAN)
+	}
+
+	az.report(d)
+	return false
+}
+
+// digits takes a binary or hex number as the lexer has it and returns the
+// number of its digits, without the separators
+func digits(s string) int {
+	return len(strings.NewReplacer(":", "", ".", "").Replace(s))
+}
+
+// longForm takes the SAN mnemonic of an absolute mode and returns the one
+// with a long address, such as "lda.l" for "lda" and "lda.lx" for "lda.x"
+func longForm(s string) string {
+	if i := strings.Index(s, "."); i >= 0 {
+		return s[:i] + ".l" + s[i+1:]
+	}
+	return s + ".l"
+}
@@ -0,0 +1,72 @@
+// Direct page: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// On the 65816, the direct page can be anywhere in bank 0, and programs move
+// it with pld and tcd. The assembler can't follow that, so ".dp" tells it where
+// the direct page is from there on. Operands of the direct page modes are then
+// full addresses, which we turn into the offset, and it is an error if they
+// are outside of the direct page. Without ".dp", the operands are the offset
+// as on the 6502.
+
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/node"
+)
+
+// setDirect takes a .dp or .direct directive and the MPU, and makes its
+// address the start of the direct page
+func (az *analyzer) setDirect(n *node.Node, mpu string) {
+
+	if mpu != "65816" {
+		return // already reported by the layout pass
+	}
+
+	v, ok := az.eval(n.Kids[0], true)
+	if !ok {
+		return
+	}
+
+	if v < 0 || v > 0xffff {
+		es := fmt.Sprintf("Direct page $%X of '%s' must be in bank 0", v, n.Text)
+		az.reportErr(es, n)
+		return
+	}
+
+	az.dp, az.dpSet = v, true
+}
+
+// isDirect takes a SAN mnemonic and returns true if it uses one of the direct
+// page modes, such as "lda.d", "lda.dx" or "lda.diy"
+func isDirect(s string) bool {
+	i := strings.Index(s, ".")
+	return i >= 0 && strings.HasPrefix(s[i+1:], "d")
+}
+
+// direct takes an instruction with a direct page mode, the value of its
+// operand and the machine. It remembers the access and returns the offset
+// into the direct page, and false if the address is outside of it
+func (az *analyzer) direct(n *node.Node, v int, m *data.Machine) (int, bool) {
+
+	off := v
+	if az.dpSet {
+		off = v - az.dp
+
+		if off < 0 || off > 0xff {
+			es := fmt.Sprintf("Address $%04X of '%s' is outside of the direct page ($%04X-$%04X)", v, n.Text, az.dp, az.dp+0xff)
+			az.reportErr(es, n)
+			return 0, false
+		}
+	}
+
+	m.Direct = append(m.Direct, data.Access{
+		Addr: n.Addr, Target: (az.dp + off) & 0xffff, Text: n.Text, File: n.File, Line: n.Line,
+	})
+
+	return off, true
+}
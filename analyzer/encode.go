@@ -0,0 +1,499 @@
+// Encode: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Encode is the third pass of the analyzer. Now that all labels and symbols
+// are known, it evaluates the operands and data, checks if they fit, and adds
+// the bytes to node.Code. The layout pass has already made room for them
+
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// encode takes the machine and fills in the operands of all instructions and
+// the data of the directives, first of the program, then of the tests
+func (az *analyzer) encode(m *data.Machine) {
+
+	az.scopes = nil
+	az.scopeCount = 0
+	az.anonCount = 0
+	az.dp, az.dpSet = 0, false
+	az.dbr, az.dbrSet = 0, false
+	az.enterSegment(m, -1)
+	m.Direct = nil
+
+	seg := -1
+
+	for _, n := range m.AST.Kids {
+		if n.Type == token.DIREC_PARA && (n.Text == ".origin" || n.Text == ".segment") {
+			seg++
+			az.enterSegment(m, seg)
+		}
+		az.encodeNode(n, m)
+	}
+
+	// Tests are never part of an object file. They start with the direct
+	// page and data bank where they are after a reset
+	az.scopes = nil
+	az.dp, az.dpSet = 0, false
+	az.dbr, az.dbrSet = 0, false
+	az.enterSegment(m, -1)
+
+	// The accesses of the tests are not part of the program
+	direct := m.Direct
+	defer func() { m.Direct = direct }()
+
+	for i, t := range m.Tests {
+		for _, n := range t.Node.Kids[1:] {
+			if n.Type == token.DIREC_PARA && n.Text == ".expect" {
+				az.pc = n.Addr
+				m.Tests[i].Expects = append(m.Tests[i].Expects, az.encodeExpect(n))
+				continue
+			}
+			az.encodeNode(n, m)
+		}
+	}
+}
+
+// encodeNode takes a node of the program or a test and the machine, and fills
+// in the bytes of the node
+func (az *analyzer) encodeNode(n *node.Node, m *data.Machine) {
+
+	az.pc = n.Addr
+
+	switch n.Type {
+
+	case token.ANON_LABEL:
+		az.anonCount++
+
+	case token.DIREC:
+		switch n.Text {
+		case ".scope":
+			az.scopeCount++
+			az.scopes = append(az.scopes, az.scopeCount)
+		case ".scend":
+			if len(az.scopes) > 0 {
+				az.scopes = az.scopes[:len(az.scopes)-1]
+			}
+		}
+
+	case token.DIREC_PARA:
+		switch n.Text {
+		case ".byte", ".word", ".long", ".asciiz", ".pstring", ".hstring":
+			az.encodeBytes(n)
+		case ".advance", ".skip", ".align":
+			az.encodeFill(n)
+		case ".ram":
+			m.RAM = append(m.RAM, az.encodeAreas(n)...)
+		case ".rom":
+			m.ROM = append(m.ROM, az.encodeAreas(n)...)
+		case ".dp", ".direct":
+			az.setDirect(n, m.MPU)
+		case ".databank":
+			az.setDataBank(n, m.MPU)
+		}
+
+	case token.OPC_1:
+		az.encodeOperand(n, m)
+
+	case token.OPC_2:
+		az.encodeMove(n)
+	}
+}
+
+// encodeOperand takes an instruction with a single operand and adds the
+// operand to the opcode
+func (az *analyzer) encodeOperand(n *node.Node, m *data.Machine) {
+
+	mpu := m.MPU
+
+	// The first pass has already complained if this opcode doesn't exist
+	if len(n.Code) < 2 {
+		return
+	}
+
+	v, ok := az.eval(n.Kids[0], true)
+	if !ok {
+		return
+	}
+
+	width := len(n.Code) - 1
+
+	// Branches are relative to the address of the next instruction
+	if data.Relative[n.Text] {
+		if r, _ := az.relocOf(n.Kids[0]); az.object && az.seg >= 0 && r.base != az.base {
+			az.reportErr("Branch target must be in the same segment of the object file", n)
+			return
+		}
+
+		offset := v - (n.Addr + len(n.Code))
+		max := 1 << uint(8*width-1)
+
+		if offset < -max || offset >= max {
+			es := fmt.Sprintf("Branch target out of range by %d byte(s)", outOfRange(offset, -max, max-1))
+			az.reportErr(es, n)
+			return
+		}
+
+		putLittleEndian(n.Code[1:], offset)
+		return
+	}
+
+	if isDirect(n.Text) {
+		if v, ok = az.direct(n, v, m); !ok {
+			return
+		}
+	}
+
+	min, max := 0, 1<<uint(8*width)-1
+
+	switch {
+
+	// Immediate values and signatures may be negative
+	case strings.HasSuffix(n.Text, ".#") || n.Text == "brk" || n.Text == "cop" ||
+		n.Text == "wdm" || n.Text == "rep" || n.Text == "sep":
+		if n.Text != "phe.#" {
+			min = -(1 << uint(8*width-1))
+		}
+
+	// Absolute addresses on the 65816 may include the bank byte. The
+	// instruction only uses the lower 16 bits
+	case width == 2 && mpu == "65816":
+		if !az.dataBank(n, v, mpu) {
+			return
+		}
+		max = 0xffffff
+	}
+
+	if v < min || v > max {
+		es := fmt.Sprintf("Operand $%X of '%s' out of range ($%X to $%X)", v, n.Text, min, max)
+		if min < 0 {
+			es = fmt.Sprintf("Operand %d of '%s' out of range (%d to %d)", v, n.Text, min, max)
+		}
+		az.reportErr(es, n)
+		return
+	}
+
+	putLittleEndian(n.Code[1:], v)
+	az.relocate(n.Kids[0], n.Addr+1, width, true)
+}
+
+// encodeMove takes a move instruction and adds the two banks. Note that the
+// destination bank comes first in machine code
+func (az *analyzer) encodeMove(n *node.Node) {
+
+	if len(n.Code) != 3 || len(n.Kids) != 2 {
+		return
+	}
+
+	for i, k := range n.Kids {
+		v, ok := az.eval(k, true)
+		if !ok {
+			continue
+		}
+
+		if v < 0 || v > 0xff {
+			es := fmt.Sprintf("Bank $%X of '%s' out of range, use '.bank'", v, n.Text)
+			az.reportErr(es, n)
+			continue
+		}
+
+		n.Code[2-i] = byte(v)
+		az.relocate(k, n.Addr+2-i, 1, true)
+	}
+}
+
+// encodeBytes takes a .byte, .word or .long directive or one of the string
+// directives that build on .byte, and adds the data in little endian. Values
+// can be signed or unsigned. Each parameter keeps its own bytes as well
+func (az *analyzer) encodeBytes(n *node.Node) {
+	var bs []byte
+
+	width := dataWidth(n)
+	min, max := -(1 << uint(8*width-1)), 1<<uint(8*width)-1
+
+	// Where the data starts, for relocations. The length of a .pstring
+	// comes first
+	start := n.Addr
+	if n.Text == ".pstring" {
+		start++
+	}
+
+	add := func(v int, k *node.Node) {
+		if v < min || v > max {
+			es := fmt.Sprintf("Value %d doesn't fit in %s", v, widthNames[width])
+			az.reportErr(es, k)
+		}
+		w := make([]byte, width)
+		putLittleEndian(w, v)
+		k.Code = append(k.Code, w...)
+	}
+
+	for _, k := range n.Kids {
+
+		switch k.Type {
+
+		case token.STRING:
+			// Already converted by the first pass. With .word and
+			// .long, each character becomes a value of its own
+			for _, b := range k.Code {
+				w := make([]byte, width)
+				w[0] = b
+				bs = append(bs, w...)
+			}
+			continue
+
+		case token.RANGE:
+			k.Code = nil
+
+			v1, ok1 := az.eval(k.Kids[0], true)
+			v2, ok2 := az.eval(k.Kids[1], true)
+			if !ok1 || !ok2 {
+				continue
+			}
+
+			for v := v1; v <= v2; v++ {
+				add(v, k)
+			}
+
+		default:
+			k.Code = nil
+			v, _ := az.eval(k, true)
+			add(v, k)
+			az.relocate(k, start+len(bs), width, false)
+		}
+
+		bs = append(bs, k.Code...)
+	}
+
+	bs = az.terminate(n, bs)
+
+	// If something went wrong, we have already reported it, but make
+	// sure the length stays the same
+	copy(n.Code, bs)
+}
+
+// encodeFill takes an .advance, .skip or .align directive and fills the bytes
+// it reserved with its pattern, which repeats. Without a pattern, they stay
+// zero
+func (az *analyzer) encodeFill(n *node.Node) {
+	var pattern []byte
+
+	for _, k := range n.Kids[1:] {
+
+		if k.Type == token.STRING {
+			pattern = append(pattern, k.Code...)
+			continue
+		}
+
+		v, ok := az.eval(k, true)
+		if !ok {
+			continue
+		}
+		if v < -128 || v > 0xff {
+			es := fmt.Sprintf("Value %d doesn't fit in a byte", v)
+			az.reportErr(es, k)
+		}
+		pattern = append(pattern, byte(v))
+	}
+
+	if len(pattern) == 0 {
+		return
+	}
+
+	for i := range n.Code {
+		n.Code[i] = pattern[i%len(pattern)]
+	}
+}
+
+// Data directives and how many bytes each value takes
+var dataWidths = map[string]int{".word": 2, ".long": 3}
+
+var widthNames = map[int]string{1: "a byte", 2: "a word", 3: "a long"}
+
+// dataWidth takes a data directive and returns how many bytes each value
+// takes. Everything that isn't a .word or .long is made of bytes
+func dataWidth(n *node.Node) int {
+	if w, ok := dataWidths[n.Text]; ok {
+		return w
+	}
+	return 1
+}
+
+// terminate takes a directive for data and its bytes, and returns the bytes
+// with the end or length the directive asks for. ".asciiz" adds a zero,
+// ".pstring" puts the length in front, and ".hstring" sets bit 7 of the last
+// byte
+func (az *analyzer) terminate(n *node.Node, bs []byte) []byte {
+
+	switch n.Text {
+
+	case ".asciiz":
+		bs = append(bs, 0)
+
+	case ".pstring":
+		if len(bs) > 0xff {
+			es := fmt.Sprintf("String of '.pstring' too long by %d byte(s)", len(bs)-0xff)
+			az.reportErr(es, n)
+		}
+		bs = append([]byte{byte(len(bs))}, bs...)
+
+	case ".hstring":
+		switch {
+		case len(bs) == 0:
+			az.reportErr("Directive '.hstring' needs at least one byte", n)
+		case bs[len(bs)-1]&0x80 != 0:
+			es := fmt.Sprintf("Last byte $%02X of '.hstring' already has bit 7 set", bs[len(bs)-1])
+			az.reportErr(es, n)
+		default:
+			bs[len(bs)-1] |= 0x80
+		}
+	}
+
+	return bs
+}
+
+// encodeAreas takes a .ram or .rom directive and returns the first and last
+// address of each area. A single address is an area of one byte
+func (az *analyzer) encodeAreas(n *node.Node) [][2]int {
+	var as [][2]int
+
+	for _, k := range n.Kids {
+		var v1, v2 int
+		var ok1, ok2 bool
+
+		if k.Type == token.RANGE {
+			v1, ok1 = az.eval(k.Kids[0], true)
+			v2, ok2 = az.eval(k.Kids[1], true)
+		} else {
+			v1, ok1 = az.eval(k, true)
+			v2, ok2 = v1, ok1
+		}
+
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		if v1 < 0 || v2 > 0xffffff || v1 > v2 {
+			es := fmt.Sprintf("Bad memory area $%X to $%X for '%s'", v1, v2, n.Text)
+			az.reportErr(es, n)
+			continue
+		}
+
+		as = append(as, [2]int{v1, v2})
+	}
+
+	return as
+}
+
+// Registers and other things an .expect directive can check besides memory
+var expectTargets = map[string]bool{
+	"a": true, "x": true, "y": true, "s": true, "d": true, "dbr": true,
+	"pbr": true, "p": true, "cycles": true,
+}
+
+// encodeExpect takes an .expect directive and returns what the test has to
+// check. The flags are given as a string such as "Zc", where upper case
+// letters must be set and lower case letters clear
+func (az *analyzer) encodeExpect(n *node.Node) data.Expect {
+
+	e := data.Expect{File: n.File, Line: n.Line}
+	target, value := n.Kids[0], n.Kids[1]
+
+	if name, ok := expectName(target); ok {
+		e.Target = name
+
+		if value.Type == token.STRING {
+			if name != "p" {
+				es := fmt.Sprintf("Can't expect a string for '%s'", name)
+				az.reportErr(es, n)
+				return e
+			}
+
+			e.Target = "flags"
+			e.Flags = value.Text
+
+			for _, f := range value.Text {
+				if !strings.ContainsRune("nvmxdizceNVMXDIZCE", f) {
+					es := fmt.Sprintf("Unknown flag '%c', use one of 'nvmxdizce'", f)
+					az.reportErr(es, n)
+				}
+			}
+			return e
+		}
+
+		e.Value, _ = az.eval(value, true)
+		if e.Value < 0 || (name != "cycles" && e.Value > 0xffff) {
+			es := fmt.Sprintf("Value $%X for '%s' out of range", e.Value, name)
+			az.reportErr(es, n)
+		}
+		return e
+	}
+
+	// Everything else is an address in memory
+	e.Target = "memory"
+	e.Addr, _ = az.eval(target, true)
+
+	if value.Type == token.STRING {
+		e.Bytes = value.Code
+		return e
+	}
+
+	v, _ := az.eval(value, true)
+
+	switch {
+	case v < 0 || v > 0xffffff:
+		es := fmt.Sprintf("Value $%X for memory out of range", v)
+		az.reportErr(es, n)
+	case v > 0xffff:
+		e.Bytes = make([]byte, 3)
+	case v > 0xff:
+		e.Bytes = make([]byte, 2)
+	default:
+		e.Bytes = make([]byte, 1)
+	}
+
+	putLittleEndian(e.Bytes, v)
+
+	return e
+}
+
+// expectName takes the first parameter of an .expect directive and returns
+// the name of the register or other thing it checks, and true. If it is an
+// address, it returns false
+func expectName(n *node.Node) (string, bool) {
+
+	if n.Type == token.EXPR && len(n.Kids) == 1 {
+		n = n.Kids[0]
+	}
+
+	if n.Type == token.SYMBOL && expectTargets[n.Text] {
+		return n.Text, true
+	}
+
+	return "", false
+}
+
+// putLittleEndian takes a slice of bytes and a value, and stores the value
+// with the least significant byte first
+func putLittleEndian(bs []byte, v int) {
+	for i := range bs {
+		bs[i] = byte(v >> uint(8*i))
+	}
+}
+
+// outOfRange takes a value and the limits, and returns by how much the value
+// misses them
+func outOfRange(v, min, max int) int {
+	if v < min {
+		return min - v
+	}
+	return v - max
+}
@@ -0,0 +1,317 @@
+// Character encodings for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Strings are turned into bytes with the encoding that is active where they
+// appear in the source. The ".encoding" directive selects one of the tables
+// below, ".charmap" changes single characters of the active one. We start with
+// ASCII. Every character becomes one byte, and characters the encoding doesn't
+// have are errors instead of being quietly turned into UTF-8.
+//
+// Strings can contain the escapes \n, \r, \t, \\, \" and \xHH. The first ones
+// are characters like any other and go through the encoding, so "\n" is $0D in
+// PETSCII. \xHH and \0 are bytes that are used as they are.
+
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// encoding maps the characters of a string to bytes
+type encoding map[rune]byte
+
+// Encodings we know by name. Each call returns a new table, since .charmap
+// changes the one that is active
+var encodings = map[string]func() encoding{
+	"ascii":   ascii,
+	"petscii": petscii,
+	"screen":  screen,
+	"apple2":  apple2,
+	"custom":  func() encoding { return encoding{} },
+}
+
+const defaultEncoding = "ascii"
+
+// ascii is plain 7-bit ASCII
+func ascii() encoding {
+	e := encoding{}
+	for r := rune(0); r < 0x80; r++ {
+		e[r] = byte(r)
+	}
+	return e
+}
+
+// petscii is the encoding of the Commodore 64 in the mode with upper and
+// lower case letters. Lower case letters are $41 to $5A, upper case ones $C1
+// to $DA, and the end of a line is $0D
+func petscii() encoding {
+	e := encoding{'\n': 0x0d, '\r': 0x0d, '£': 0x5c, '↑': 0x5e, '←': 0x5f}
+
+	for r := rune(0x20); r <= 0x40; r++ {
+		e[r] = byte(r)
+	}
+	for r := 'a'; r <= 'z'; r++ {
+		e[r] = byte(r-'a') + 0x41
+	}
+	for r := 'A'; r <= 'Z'; r++ {
+		e[r] = byte(r-'A') + 0xc1
+	}
+	e['['] = 0x5b
+	e[']'] = 0x5d
+
+	return e
+}
+
+// screen are the screen codes of the Commodore 64 that are stored in video
+// memory, in the mode with upper and lower case letters
+func screen() encoding {
+	e := encoding{'@': 0x00, '[': 0x1b, '£': 0x1c, ']': 0x1d, '↑': 0x1e, '←': 0x1f}
+
+	for r := rune(0x20); r < 0x40; r++ {
+		e[r] = byte(r)
+	}
+	for r := 'a'; r <= 'z'; r++ {
+		e[r] = byte(r-'a') + 0x01
+	}
+	for r := 'A'; r <= 'Z'; r++ {
+		e[r] = byte(r-'A') + 0x41
+	}
+
+	return e
+}
+
+// apple2 is ASCII with the high bit set, as the Apple II uses it, with the
+// end of a line as carriage return
+func apple2() encoding {
+	e := encoding{}
+	for r := rune(0); r < 0x80; r++ {
+		e[r] = byte(r) | 0x80
+	}
+	e['\n'] = 0x8d
+	return e
+}
+
+// char is a character of a string after the escapes are resolved. Raw
+// characters are bytes that don't go through the encoding. The position and
+// width are in runes of the string as it is in the source
+type char struct {
+	r     rune
+	raw   bool
+	pos   int
+	width int
+}
+
+// unescape takes the text of a string as it is in the source and returns
+// its characters. If there is a bad escape, it returns its position and width
+// and what is wrong with it
+func unescape(s string) ([]char, *char, string) {
+	var cs []char
+
+	rs := []rune(s)
+
+	for i := 0; i < len(rs); i++ {
+
+		if rs[i] != '\\' {
+			cs = append(cs, char{r: rs[i], pos: i, width: 1})
+			continue
+		}
+
+		if i+1 >= len(rs) {
+			return nil, &char{pos: i, width: 1}, "String ends with a backslash"
+		}
+
+		switch rs[i+1] {
+		case 'n':
+			cs = append(cs, char{r: '\n', pos: i, width: 2})
+		case 'r':
+			cs = append(cs, char{r: '\r', pos: i, width: 2})
+		case 't':
+			cs = append(cs, char{r: '\t', pos: i, width: 2})
+		case '\\', '"':
+			cs = append(cs, char{r: rs[i+1], pos: i, width: 2})
+		case '0':
+			cs = append(cs, char{r: 0, raw: true, pos: i, width: 2})
+
+		case 'x':
+			if i+3 >= len(rs) {
+				return nil, &char{pos: i, width: len(rs) - i}, "Escape '\\x' needs two hex digits"
+			}
+			v, err := strconv.ParseUint(string(rs[i+2:i+4]), 16, 8)
+			if err != nil {
+				return nil, &char{pos: i, width: 4}, "Escape '\\x' needs two hex digits"
+			}
+			cs = append(cs, char{r: rune(v), raw: true, pos: i, width: 4})
+			i += 2
+
+		default:
+			es := fmt.Sprintf("Unknown escape '\\%c'", rs[i+1])
+			return nil, &char{pos: i, width: 2}, es
+		}
+
+		i++
+	}
+
+	return cs, nil, ""
+}
+
+// charErr takes a STRING node, a character of it and a message, and reports
+// an error that points at the character
+func (az *analyzer) charErr(n *node.Node, c char, s string) {
+	d := data.At(errTag, n.Token, s)
+
+	// The node starts with the quote
+	d.Column = n.Index + 1 + c.pos
+	d.EndLine = n.Line
+	d.EndColumn = d.Column + c.width
+
+	az.report(d)
+}
+
+// encodeString takes a STRING node and puts its bytes in the active encoding
+// in its code. Characters without a byte are reported, and become zeros so
+// the length stays the same
+func (az *analyzer) encodeString(n *node.Node) {
+	cs, bad, es := unescape(n.Text)
+	if bad != nil {
+		az.charErr(n, *bad, es)
+		n.Code = nil
+		n.Done = true
+		return
+	}
+
+	n.Code = make([]byte, 0, len(cs))
+
+	for _, c := range cs {
+		if c.raw {
+			n.Code = append(n.Code, byte(c.r))
+			continue
+		}
+
+		b, ok := az.enc[c.r]
+		if !ok {
+			es := fmt.Sprintf("Character %q has no mapping in encoding '%s'", c.r, az.encName)
+			az.charErr(n, c, es)
+		}
+		n.Code = append(n.Code, b)
+	}
+
+	n.Done = true
+}
+
+// encodeKids takes a node and encodes all strings in it
+func (az *analyzer) encodeKids(n *node.Node) {
+	for _, k := range n.Kids {
+		if k.Type == token.STRING {
+			az.encodeString(k)
+			continue
+		}
+		az.encodeKids(k)
+	}
+}
+
+// convertStrings takes a node of the program and turns the strings it has as
+// data into bytes. This is also where we switch the encoding. Other strings,
+// such as the name of a test, are left alone
+func (az *analyzer) convertStrings(n *node.Node) {
+
+	switch n.Type {
+
+	case token.OPC_1, token.OPC_2:
+		az.encodeKids(n)
+
+	case token.DIREC_PARA:
+		switch n.Text {
+
+		case ".byte", ".word", ".long", ".asciiz", ".pstring", ".hstring",
+			".advance", ".skip", ".align":
+			az.encodeKids(n)
+
+		case ".expect":
+			// Flags are given as a string, memory can be
+			if _, ok := expectName(n.Kids[0]); !ok {
+				az.encodeKids(n)
+			}
+
+		case ".encoding":
+			az.setEncoding(n)
+
+		case ".charmap":
+			az.charmap(n)
+
+		case ".test":
+			// Changes of the encoding inside a test stay there
+			saved, name := encoding{}, az.encName
+			for r, b := range az.enc {
+				saved[r] = b
+			}
+
+			for _, k := range n.Kids[1:] {
+				az.convertStrings(k)
+			}
+
+			az.enc, az.encName = saved, name
+		}
+	}
+}
+
+// setEncoding takes an .encoding directive and makes its encoding the active
+// one
+func (az *analyzer) setEncoding(n *node.Node) {
+	name := strings.ToLower(n.Kids[0].Text)
+
+	f, ok := encodings[name]
+	if !ok {
+		var names []string
+		for k := range encodings {
+			names = append(names, k)
+		}
+
+		d := data.At(errTag, n.Kids[0].Token, fmt.Sprintf("Unknown encoding '%s'", n.Kids[0].Text))
+		if sug := data.Suggest(name, names); sug != "" {
+			d.Hint = fmt.Sprintf("Did you mean '%s'?", sug)
+		}
+		az.report(d)
+		return
+	}
+
+	az.enc, az.encName = f(), name
+}
+
+// charmap takes a .charmap directive with a string and a value, and maps the
+// characters of the string to the value and the ones after it in the active
+// encoding
+func (az *analyzer) charmap(n *node.Node) {
+	s := n.Kids[0]
+
+	cs, bad, es := unescape(s.Text)
+	if bad != nil {
+		az.charErr(s, *bad, es)
+		return
+	}
+
+	v, ok := az.eval(n.Kids[1], true)
+	if !ok {
+		return
+	}
+
+	if v < 0 || v+len(cs)-1 > 0xff {
+		es := fmt.Sprintf("Characters of '.charmap' must map to bytes, got $%X", v)
+		az.reportErr(es, n.Kids[1])
+		return
+	}
+
+	for i, c := range cs {
+		if c.raw {
+			az.charErr(s, c, "Can't map a byte given as '\\x' or '\\0'")
+			continue
+		}
+		az.enc[c.r] = byte(v + i)
+	}
+}
@@ -0,0 +1,270 @@
+// Evaluation of expressions for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Operands are either a single value, a simple math term with a unary or
+// binary operator, or a Reverse Polish Notation (RPN) term that can contain
+// further RPN terms. Values are numbers, symbols, single-character strings,
+// the ".here" directive and the anonymous labels "-" and "+"
+
+package analyzer
+
+import (
+	"fmt"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// eval takes a node with a value and returns the value and a flag for success.
+// If report is false, errors are not reported; this is used for the layout
+// pass where labels further down are not known yet
+func (az *analyzer) eval(n *node.Node, report bool) (int, bool) {
+
+	fail := func(s string) (int, bool) {
+		if report {
+			az.reportErr(s, n)
+		}
+		return 0, false
+	}
+
+	switch n.Type {
+
+	case token.DEC_NUM:
+		return n.Value, true
+
+	case token.STRING:
+		// The layout pass has put the string in the active encoding
+		if len(n.Code) != 1 {
+			return fail(fmt.Sprintf("String '%s' used as value must be a single character", n.Text))
+		}
+		return int(n.Code[0]), true
+
+	case token.SYMBOL:
+		k, ok := az.lookup(n.Text)
+		if !ok {
+			if !report {
+				return 0, false
+			}
+			d := data.At(errTag, n.Token, fmt.Sprintf("Symbol '%s' not defined", n.Text))
+			if sug := az.suggest(n.Text); sug != "" {
+				d.Hint = fmt.Sprintf("Did you mean '%s'?", sug)
+			}
+			az.report(d)
+			return 0, false
+		}
+		az.use(k, n)
+		return az.symbols[k].Value, true
+
+	case token.DIREC:
+		if n.Text != ".here" {
+			return fail(fmt.Sprintf("Directive '%s' is not a value", n.Text))
+		}
+		return az.pc, true
+
+	// Anonymous labels: "-" is the last one before this node, "+" the
+	// next one after it
+	case token.MINUS:
+		if az.anonCount == 0 {
+			return fail("No anonymous label before this line")
+		}
+		return az.anons[az.anonCount-1], true
+
+	case token.PLUS:
+		if az.anonCount >= len(az.anons) {
+			return fail("No anonymous label after this line")
+		}
+		return az.anons[az.anonCount], true
+
+	case token.EXPR:
+		return az.evalExpr(n, report)
+
+	case token.RPN:
+		return az.evalRPN(n, report)
+	}
+
+	return fail(fmt.Sprintf("Can't use '%s' as a value", n.Text))
+}
+
+// evalExpr takes an EXPR node, which has a single value, a unary operator and
+// a value, or a value, a binary operator and a value, and returns the result
+func (az *analyzer) evalExpr(n *node.Node, report bool) (int, bool) {
+
+	switch len(n.Kids) {
+
+	case 1:
+		return az.eval(n.Kids[0], report)
+
+	case 2:
+		v, ok := az.eval(n.Kids[1], report)
+		if !ok {
+			return 0, false
+		}
+		return az.unary(n.Kids[0], v, report)
+
+	case 3:
+		v1, ok1 := az.eval(n.Kids[0], report)
+		v2, ok2 := az.eval(n.Kids[2], report)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return az.binary(n.Kids[1], v1, v2, report)
+	}
+
+	if report {
+		az.reportErr("Malformed expression", n)
+	}
+	return 0, false
+}
+
+// evalRPN takes a RPN node and runs the terms on a stack. There must be
+// exactly one value left on the stack at the end
+func (az *analyzer) evalRPN(n *node.Node, report bool) (int, bool) {
+	var stack []int
+
+	fail := func(s string) (int, bool) {
+		if report {
+			az.reportErr(s, n)
+		}
+		return 0, false
+	}
+
+	for _, k := range n.Kids {
+
+		if !isOperator(k) {
+			v, ok := az.eval(k, report)
+			if !ok {
+				return 0, false
+			}
+			stack = append(stack, v)
+			continue
+		}
+
+		switch k.Text {
+
+		case ".dup", ".drop", ".lsb", ".msb", ".bank", ".not", ".invert":
+			if len(stack) < 1 {
+				return fail(fmt.Sprintf("RPN stack underflow at '%s'", k.Text))
+			}
+
+			tos := stack[len(stack)-1]
+
+			switch k.Text {
+			case ".dup":
+				stack = append(stack, tos)
+			case ".drop":
+				stack = stack[:len(stack)-1]
+			default:
+				v, ok := az.unary(k, tos, report)
+				if !ok {
+					return 0, false
+				}
+				stack[len(stack)-1] = v
+			}
+
+		default:
+			if len(stack) < 2 {
+				return fail(fmt.Sprintf("RPN stack underflow at '%s'", k.Text))
+			}
+
+			nos, tos := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-2]
+
+			if k.Text == ".swap" {
+				stack = append(stack, tos, nos)
+				continue
+			}
+
+			v, ok := az.binary(k, nos, tos, report)
+			if !ok {
+				return 0, false
+			}
+			stack = append(stack, v)
+		}
+	}
+
+	if len(stack) != 1 {
+		return fail(fmt.Sprintf("RPN term leaves %d values on the stack, must be one", len(stack)))
+	}
+
+	return stack[0], true
+}
+
+// isOperator takes a node that is part of an RPN term and returns true if it is
+// an operator and not a value
+func isOperator(n *node.Node) bool {
+	switch n.Type {
+	case token.PLUS, token.MINUS, token.STAR, token.SLASH, token.DIREC_PARA:
+		return true
+	case token.DIREC:
+		return n.Text != ".here"
+	}
+	return false
+}
+
+// unary takes the node of a unary operator and a value, and returns the result
+func (az *analyzer) unary(op *node.Node, v int, report bool) (int, bool) {
+
+	switch op.Text {
+	case ".lsb":
+		return v & 0xff, true
+	case ".msb":
+		return (v >> 8) & 0xff, true
+	case ".bank":
+		return (v >> 16) & 0xff, true
+	case ".lshift":
+		return v << 1, true
+	case ".rshift":
+		return v >> 1, true
+	case ".invert":
+		return ^v, true
+	case ".not":
+		if v == 0 {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if report {
+		az.reportErr(fmt.Sprintf("Unknown unary operator '%s'", op.Text), op)
+	}
+	return 0, false
+}
+
+// binary takes the node of a binary operator and two values, and returns the
+// result
+func (az *analyzer) binary(op *node.Node, v1, v2 int, report bool) (int, bool) {
+
+	switch op.Text {
+	case "+":
+		return v1 + v2, true
+	case "-":
+		return v1 - v2, true
+	case "*":
+		return v1 * v2, true
+	case "/":
+		if v2 == 0 {
+			if report {
+				az.reportErr("Division by zero", op)
+			}
+			return 0, false
+		}
+		return v1 / v2, true
+	case ".and":
+		return v1 & v2, true
+	case ".or":
+		return v1 | v2, true
+	case ".xor":
+		return v1 ^ v2, true
+	case ".lshift":
+		return v1 << uint(v2), true
+	case ".rshift":
+		return v1 >> uint(v2), true
+	}
+
+	if report {
+		az.reportErr(fmt.Sprintf("Unknown binary operator '%s'", op.Text), op)
+	}
+	return 0, false
+}
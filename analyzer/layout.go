@@ -0,0 +1,563 @@
+// Layout: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Layout is the second pass of the analyzer. It walks through the program in
+// order, gives every node the address it will have in memory and defines the
+// labels and symbols. To know how long the immediate instructions of the 65816
+// are, it keeps track of the size of the registers. Operands are only
+// evaluated here when we need their value to continue, for example for
+// ".origin" or "rep"
+
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// Code for the directives that switch the status of the 65816
+var statusCode = map[string][]byte{
+	".native":   {0x18, 0xfb}, // clc xce
+	".emulated": {0x38, 0xfb}, // sec xce
+	".a8":       {0xe2, 0x20}, // sep.# $20
+	".a16":      {0xc2, 0x20}, // rep.# $20
+	".xy8":      {0xe2, 0x10}, // sep.# $10
+	".xy16":     {0xc2, 0x10}, // rep.# $10
+	".axy8":     {0xe2, 0x30}, // sep.# $30
+	".axy16":    {0xc2, 0x30}, // rep.# $30
+}
+
+// Versions of the status directives that only tell the assembler what
+// status the MPU is in, without producing code. We map them to the version
+// that produces code
+var statusHints = map[string]string{
+	".!native": ".native", ".!emulated": ".emulated",
+	".!a8": ".a8", ".!a16": ".a16", ".!xy8": ".xy8", ".!xy16": ".xy16",
+	".!axy8": ".axy8", ".!axy16": ".axy16",
+}
+
+// resetStatus puts the MPU in the state it has after a reset
+func (az *analyzer) resetStatus() {
+	az.emulated = true
+	az.a8 = true
+	az.xy8 = true
+	az.carry = -1
+
+	// D and DBR are zero after a reset, but programs can change them
+	// without telling us, so we only know them from .dp and .databank
+	az.dp, az.dpSet = 0, false
+	az.dbr, az.dbrSet = 0, false
+}
+
+// layout takes the machine and walks the top level of the AST, adding
+// addresses to the nodes and the labels to the symbol table. Opcodes are given
+// their final length by adding zeros as placeholders for the operand, which
+// are filled in by the next pass
+func (az *analyzer) layout(m *data.Machine) {
+
+	var pending []*node.Node // .equ directives that have to wait
+	var tests []*node.Node   // .test blocks, which come after the program
+	var exports []*node.Node // .export directives, once all symbols are known
+
+	early := false // code before the first .origin
+	m.Segments = nil
+	az.resetStatus()
+
+	az.scopes = nil
+	az.scopeCount = 0
+	az.counts = nil
+	az.anons = nil
+	az.anonCount = 0
+	az.pc = 0
+	az.base = data.Base{}
+	az.enc, az.encName = encodings[defaultEncoding](), defaultEncoding
+
+	m.Spans = nil
+
+	for i, n := range m.AST.Kids {
+
+		n.Addr = az.pc
+		az.convertStrings(n)
+
+		// Directives such as .native have code, so we need the status
+		// from before the node
+		span := data.Span{Addr: az.pc, File: n.File, Line: n.Line, Column: n.Index,
+			A8: az.a8, XY8: az.xy8, Emulated: az.emulated,
+			DP: az.dp, DPSet: az.dpSet, DBR: az.dbr, DBRSet: az.dbrSet}
+
+		switch {
+
+		case n.Type == token.DIREC && n.Text == ".end":
+			// Everything after .end is ignored
+			m.AST.Kids = m.AST.Kids[:i+1]
+
+		case n.Type == token.DIREC_PARA && (n.Text == ".origin" || n.Text == ".segment"):
+			az.startSegment(n, m)
+
+		case n.Type == token.DIREC_PARA && n.Text == ".test":
+			tests = append(tests, n)
+
+		case n.Type == token.DIREC_PARA && n.Text == ".import":
+			az.importSymbols(n)
+
+		case n.Type == token.DIREC_PARA && n.Text == ".export":
+			exports = append(exports, n)
+
+		default:
+			az.place(n, m.MPU, &pending)
+		}
+
+		if len(n.Code) > 0 && len(m.Segments) == 0 && !early {
+			az.reportErr("Code before '.origin' directive", n)
+			early = true // only report this once
+		}
+
+		if len(n.Code) > 0 {
+			span.Size = len(n.Code)
+			m.Spans = append(m.Spans, span)
+		}
+
+		az.pc += len(n.Code)
+
+		// The loop must also end after .end
+		if n.Type == token.DIREC && n.Text == ".end" {
+			break
+		}
+	}
+
+	if len(az.scopes) != 0 {
+		es := fmt.Sprintf("Found %d '.scope' directive(s) without '.scend'", len(az.scopes))
+		az.reportErr(es, m.AST)
+	}
+
+	az.endSegment(m)
+	az.checkSegments(m)
+
+	// The tests come after the program, so they don't change its addresses
+	m.Tests = nil
+	az.scopes = nil
+	az.counts = nil
+	az.pc = testsAddr(m)
+	az.base = data.Base{}
+
+	for _, t := range tests {
+		az.layoutTest(t, m, &pending)
+	}
+
+	az.checkTests(m)
+
+	// Now we can try to define the remaining symbols. Because symbols can
+	// be defined with other symbols, we do this until we don't find any
+	// new ones
+	for len(pending) > 0 {
+		var waiting []*node.Node
+
+		for _, n := range pending {
+			az.pc = n.Addr
+			v, ok := az.eval(n.Kids[1], false)
+			if ok {
+				az.defineEqu(n, v)
+			} else {
+				waiting = append(waiting, n)
+			}
+		}
+
+		// No progress, so we report the errors
+		if len(waiting) == len(pending) {
+			for _, n := range waiting {
+				az.pc = n.Addr
+				az.eval(n.Kids[1], true)
+			}
+			break
+		}
+
+		pending = waiting
+	}
+
+	for _, n := range exports {
+		az.exportSymbols(n)
+	}
+}
+
+// place takes a node of the program or a test and the MPU, and gives the node
+// its address and length. It defines labels, and adds .equ directives it
+// can't resolve yet to the pending list
+func (az *analyzer) place(n *node.Node, mpu string, pending *[]*node.Node) {
+
+	switch n.Type {
+
+	case token.LABEL:
+		az.define(n.Text, az.pc, "label", n)
+
+	case token.LOCAL_LABEL:
+		if len(az.scopes) == 0 {
+			es := fmt.Sprintf("Local label '%s' outside of a scope", n.Text)
+			az.reportErr(es, n)
+			return
+		}
+		az.define(LocalName(n.Text, az.scopes[len(az.scopes)-1]), az.pc, "local", n)
+
+	case token.ANON_LABEL:
+		az.anons = append(az.anons, az.pc)
+
+	case token.SYMBOL:
+		// The lexer only knows the mnemonics of our MPU, so anything
+		// else on a line of its own ends up as a symbol
+		az.unknownMnemonic(n, mpu)
+
+	case token.DIREC:
+		switch n.Text {
+
+		case ".scope":
+			az.scopeCount++
+			az.scopes = append(az.scopes, az.scopeCount)
+			az.counts = append(az.counts, cycleCount{})
+
+		case ".scend":
+			if len(az.scopes) == 0 {
+				az.reportErr("Directive '.scend' without '.scope'", n)
+				return
+			}
+			az.scopes = az.scopes[:len(az.scopes)-1]
+			az.endCycles(n)
+
+		default:
+			az.setStatus(n, mpu)
+		}
+
+	case token.DIREC_PARA:
+		switch n.Text {
+
+		case ".equ":
+			// Symbols can be defined with labels that come later
+			// in the source, so we might have to wait with those
+			v, ok := az.eval(n.Kids[1], false)
+			if ok {
+				az.defineEqu(n, v)
+			} else {
+				*pending = append(*pending, n)
+			}
+
+		case ".byte", ".word", ".long":
+			n.Code = make([]byte, az.byteCount(n))
+
+		case ".asciiz", ".pstring":
+			// One more byte for the zero or the length
+			n.Code = make([]byte, az.byteCount(n)+1)
+
+		case ".hstring":
+			n.Code = make([]byte, az.byteCount(n))
+
+		case ".advance", ".skip", ".align":
+			n.Code = make([]byte, az.padding(n))
+
+		case ".expect":
+			az.reportErr("Directive '.expect' outside of a test", n)
+
+		case ".cycles":
+			az.limitCycles(n)
+
+		case ".dp", ".direct", ".databank":
+			if mpu != "65816" {
+				es := fmt.Sprintf("Directive '%s' requires the 65816", n.Text)
+				az.reportErr(es, n)
+				break
+			}
+
+			// The cycles depend on where the direct page is, and
+			// the advisor needs both. The encode pass checks the
+			// values
+			if n.Text == ".databank" {
+				az.dbr, az.dbrSet = az.eval(n.Kids[0], false)
+			} else {
+				az.dp, az.dpSet = az.eval(n.Kids[0], false)
+			}
+		}
+
+	case token.OPC_0, token.OPC_1, token.OPC_2:
+		oc, ok := data.OpcodesSAN[mpu][n.Text]
+		if !ok {
+			return // already reported by the first pass
+		}
+
+		length := oc.Length
+
+		if oc.Embiggens && mpu == "65816" {
+			if (data.IndexImmediates[n.Text] && !az.xy8) ||
+				(!data.IndexImmediates[n.Text] && !az.a8) {
+				length++
+			}
+		}
+
+		// Keep the opcode, add room for the operand
+		n.Code = append(n.Code[:1], make([]byte, length-1)...)
+
+		az.countCycles(n, oc)
+		az.trackStatus(n, mpu)
+	}
+}
+
+// layoutTest takes a .test block, the machine and the pending list, and lays
+// out the code of the test at the current address. Each test starts with the
+// MPU in the state it has after a reset
+func (az *analyzer) layoutTest(t *node.Node, m *data.Machine, pending *[]*node.Node) {
+
+	az.resetStatus()
+	depth := len(az.scopes)
+	t.Addr = az.pc
+
+	for _, n := range t.Kids[1:] {
+
+		n.Addr = az.pc
+
+		switch {
+
+		case n.Type == token.DIREC_PARA && n.Text == ".expect":
+			// Checked after the test has run
+
+		case n.Type == token.DIREC && n.Text == ".end",
+			n.Type == token.DIREC_PARA && (n.Text == ".origin" ||
+				n.Text == ".segment" || n.Text == ".test" || n.Text == ".ram" ||
+				n.Text == ".rom"):
+			es := fmt.Sprintf("Directive '%s' not allowed in a test", n.Text)
+			az.reportErr(es, n)
+
+		default:
+			az.place(n, m.MPU, pending)
+		}
+
+		az.pc += len(n.Code)
+	}
+
+	if len(az.scopes) != depth {
+		es := fmt.Sprintf("Test '%s' has '.scope' without '.scend'", t.Kids[0].Text)
+		az.reportErr(es, t)
+		az.scopes = az.scopes[:depth]
+		az.counts = az.counts[:depth]
+	}
+
+	m.Tests = append(m.Tests, data.Test{Name: t.Kids[0].Text, Addr: t.Addr, Node: t})
+}
+
+// unknownMnemonic takes a symbol on a line of its own and the MPU, and
+// reports it. If another MPU has the instruction, we say which one,
+// otherwise we suggest one of ours
+func (az *analyzer) unknownMnemonic(n *node.Node, mpu string) {
+	d := data.At(errTag, n.Token, fmt.Sprintf("Unknown mnemonic '%s'", n.Text))
+
+	for _, other := range []string{"6502", "65c02", "65816"} {
+		if _, ok := data.OpcodesSAN[other][n.Text]; ok && other != mpu {
+			d.Message = fmt.Sprintf("Unknown mnemonic '%s', which is an instruction of the %s, not the %s", n.Text, other, mpu)
+			az.report(d)
+			return
+		}
+	}
+
+	var names []string
+	for k := range data.OpcodesSAN[mpu] {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	if sug := data.Suggest(n.Text, names); sug != "" {
+		d.Hint = fmt.Sprintf("Did you mean '%s'?", sug)
+	}
+	az.report(d)
+}
+
+// defineEqu takes a .equ directive and its value, and defines the symbol. In
+// object files, the symbol is relative to what its expression is relative to
+func (az *analyzer) defineEqu(n *node.Node, v int) {
+	if !az.define(equName(n), v, "symbol", n.Kids[0]) {
+		return
+	}
+	az.banked[equName(n)] = az.bankKnown(n.Kids[1])
+
+	if !az.relative(n.Kids[1]) {
+		return
+	}
+
+	r, es := az.relocOf(n.Kids[1])
+	if es == "" && r.kind != "" {
+		es = fmt.Sprintf("Symbol '%s' can't be defined as part of a relocatable value", equName(n))
+	}
+	if es != "" {
+		az.reportErr(es, n)
+		return
+	}
+
+	sym := az.symbols[equName(n)]
+	sym.Base = r.base
+	az.symbols[equName(n)] = sym
+}
+
+// equName takes a .equ node and returns the name of the symbol. This is
+// always global, because we don't know the scope the symbol is defined in when
+// we get to define it later
+func equName(n *node.Node) string {
+	return n.Kids[0].Text
+}
+
+// byteCount takes a data node such as .byte and returns the number of bytes
+// it produces. Ranges must be known at this point, everything else can wait
+func (az *analyzer) byteCount(n *node.Node) int {
+	var sum int
+
+	for _, k := range n.Kids {
+		switch k.Type {
+		case token.STRING:
+			sum += len(k.Code)
+		case token.RANGE:
+			v1, ok1 := az.eval(k.Kids[0], true)
+			v2, ok2 := az.eval(k.Kids[1], true)
+			if ok1 && ok2 && v2 >= v1 {
+				sum += v2 - v1 + 1
+			} else if ok1 && ok2 {
+				az.reportErr("Range must start with the smaller value", k)
+			}
+		default:
+			sum++
+		}
+	}
+
+	return sum * dataWidth(n)
+}
+
+// padding takes an .advance, .skip or .align node and returns the number of
+// bytes it fills. The parameter must be known at this point
+func (az *analyzer) padding(n *node.Node) int {
+
+	v, ok := az.eval(n.Kids[0], true)
+	if !ok {
+		return 0
+	}
+
+	switch n.Text {
+
+	case ".advance":
+		if v < az.pc {
+			es := fmt.Sprintf("Address $%X of '.advance' already passed by %d byte(s)", v, az.pc-v)
+			az.reportErr(es, n)
+			return 0
+		}
+		return v - az.pc
+
+	case ".skip":
+		if v < 0 {
+			es := fmt.Sprintf("Directive '.skip' can't skip %d bytes", v)
+			az.reportErr(es, n)
+			return 0
+		}
+		return v
+
+	case ".align":
+		if v < 1 || v&(v-1) != 0 {
+			es := fmt.Sprintf("Alignment %d of '.align' must be a power of two", v)
+			az.reportErr(es, n)
+			return 0
+		}
+		return (v - az.pc%v) % v
+	}
+
+	return 0
+}
+
+// setStatus handles the directives that switch the status of the 65816
+func (az *analyzer) setStatus(n *node.Node, mpu string) {
+
+	d, hint := statusHints[n.Text]
+	if !hint {
+		d = n.Text
+	}
+
+	code, ok := statusCode[d]
+	if !ok {
+		return
+	}
+
+	if mpu != "65816" {
+		es := fmt.Sprintf("Directive '%s' requires the 65816", n.Text)
+		az.reportErr(es, n)
+		return
+	}
+
+	switch d {
+	case ".native":
+		az.emulated = false
+	case ".emulated":
+		az.emulated, az.a8, az.xy8 = true, true, true
+	default:
+		if az.emulated && (d == ".a16" || d == ".xy16" || d == ".axy16") {
+			es := fmt.Sprintf("Directive '%s' not possible in emulated mode", n.Text)
+			az.reportErr(es, n)
+			return
+		}
+		az.applyStatus(code[0], int(code[1]))
+	}
+
+	if !hint {
+		n.Code = append([]byte{}, code...)
+	}
+}
+
+// applyStatus takes the opcode of rep or sep and the bits to change, and sets
+// the register sizes accordingly
+func (az *analyzer) applyStatus(op byte, bits int) {
+
+	set := op == 0xe2 // sep
+
+	if az.emulated {
+		return // registers are always 8 bit
+	}
+
+	if bits&0x20 != 0 {
+		az.a8 = set
+	}
+	if bits&0x10 != 0 {
+		az.xy8 = set
+	}
+}
+
+// trackStatus takes an instruction and tracks the changes it makes to the
+// status of the 65816
+func (az *analyzer) trackStatus(n *node.Node, mpu string) {
+
+	if mpu != "65816" {
+		return
+	}
+
+	switch n.Text {
+
+	case "clc":
+		az.carry = 0
+		return
+
+	case "sec":
+		az.carry = 1
+		return
+
+	case "xce":
+		switch az.carry {
+		case 0:
+			az.emulated = false
+		case 1:
+			az.emulated, az.a8, az.xy8 = true, true, true
+		}
+
+	case "rep", "sep":
+		v, ok := az.eval(n.Kids[0], false)
+		if !ok {
+			es := fmt.Sprintf("Operand of '%s' must be known at this point", n.Text)
+			az.reportErr(es, n)
+			break
+		}
+		az.applyStatus(n.Code[0], v)
+	}
+
+	az.carry = -1
+}
@@ -1,7 +1,7 @@
 // Purge: Analysis step for the Cthulhu Assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 21. May 2018
-// This version: 21. May 2018
+// This version: 19. Oct 2026
 
 // Purge is the first step of the analysis phase. It takes the Abstract
 // Syntax Tree (AST) created by the parser and removes the whitespace and other
@@ -19,16 +19,11 @@ const (
 	errPrelude = "ANALYZER"
 )
 
-var (
-	bst *node.Node
-)
-
 func Purge(mpu string, ast *node.Node) *node.Node {
 
 	// Walk AST. If node is a comment, an empty line or an EOL node, ignore
 	// it. Save the others to BST.
 
 	// Testing
-	bst = ast
-	return bst
+	return ast
 }
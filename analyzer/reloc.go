@@ -0,0 +1,306 @@
+// Relocations: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Object files have segments without an address, which the linker places,
+// and symbols from other modules, which the linker finds. We assemble as if
+// these segments start at 0 and the imported symbols are 0, and note for each
+// operand or piece of data that depends on them what it is relative to. The
+// linker then adds the real address. Only values the linker can fix this way
+// are allowed: a relocatable value plus or minus a number, the difference of
+// two values in the same segment, and the ".lsb", ".msb" and ".bank" of these.
+
+package analyzer
+
+import (
+	"fmt"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// rel is a value as the linker sees it: what it is relative to, which part of
+// it we want, and the value relative to the base
+type rel struct {
+	base  data.Base
+	kind  string
+	value int
+}
+
+// relative takes a node with a value and returns true if the value depends on
+// where the linker puts things
+func (az *analyzer) relative(n *node.Node) bool {
+
+	switch n.Type {
+
+	case token.SYMBOL:
+		k, ok := az.lookup(n.Text)
+		return ok && az.symbols[k].Base != data.Base{}
+
+	case token.DIREC, token.MINUS, token.PLUS:
+		if isOperator(n) {
+			return false
+		}
+		return az.base != data.Base{}
+
+	case token.EXPR, token.RPN:
+		for _, k := range n.Kids {
+			if az.relative(k) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// relocOf takes a node with a value and returns the value as the linker sees
+// it, or what is wrong with it
+func (az *analyzer) relocOf(n *node.Node) (rel, string) {
+
+	if !az.relative(n) {
+		v, _ := az.eval(n, false)
+		return rel{value: v}, ""
+	}
+
+	switch n.Type {
+
+	case token.SYMBOL:
+		k, _ := az.lookup(n.Text)
+		sym := az.symbols[k]
+		return rel{base: sym.Base, value: sym.Value}, ""
+
+	case token.DIREC, token.MINUS, token.PLUS:
+		v, _ := az.eval(n, false)
+		return rel{base: az.base, value: v}, ""
+
+	case token.EXPR:
+		switch len(n.Kids) {
+		case 1:
+			return az.relocOf(n.Kids[0])
+		case 2:
+			r, es := az.relocOf(n.Kids[1])
+			if es != "" {
+				return r, es
+			}
+			return az.relUnary(n.Kids[0], r)
+		case 3:
+			r1, es := az.relocOf(n.Kids[0])
+			if es != "" {
+				return r1, es
+			}
+			r2, es := az.relocOf(n.Kids[2])
+			if es != "" {
+				return r2, es
+			}
+			return az.relBinary(n.Kids[1], r1, r2)
+		}
+
+	case token.RPN:
+		return az.relocRPN(n)
+	}
+
+	return rel{}, fmt.Sprintf("Can't relocate '%s'", n.Text)
+}
+
+// relocRPN takes a RPN node that depends on where the linker puts things, and
+// runs the terms on a stack like evalRPN
+func (az *analyzer) relocRPN(n *node.Node) (rel, string) {
+	var stack []rel
+
+	for _, k := range n.Kids {
+
+		if !isOperator(k) {
+			r, es := az.relocOf(k)
+			if es != "" {
+				return r, es
+			}
+			stack = append(stack, r)
+			continue
+		}
+
+		if len(stack) < 1 || (len(stack) < 2 && !isUnaryRPN(k.Text)) {
+			return rel{}, fmt.Sprintf("RPN stack underflow at '%s'", k.Text)
+		}
+
+		tos := stack[len(stack)-1]
+
+		switch {
+		case k.Text == ".dup":
+			stack = append(stack, tos)
+
+		case k.Text == ".drop":
+			stack = stack[:len(stack)-1]
+
+		case k.Text == ".swap":
+			stack[len(stack)-2], stack[len(stack)-1] = tos, stack[len(stack)-2]
+
+		case isUnaryRPN(k.Text):
+			r, es := az.relUnary(k, tos)
+			if es != "" {
+				return r, es
+			}
+			stack[len(stack)-1] = r
+
+		default:
+			r, es := az.relBinary(k, stack[len(stack)-2], tos)
+			if es != "" {
+				return r, es
+			}
+			stack = append(stack[:len(stack)-2], r)
+		}
+	}
+
+	if len(stack) != 1 {
+		return rel{}, fmt.Sprintf("RPN term leaves %d values on the stack, must be one", len(stack))
+	}
+
+	return stack[0], ""
+}
+
+// isUnaryRPN takes an operator of a RPN term and returns true if it takes
+// only one value from the stack
+func isUnaryRPN(s string) bool {
+	switch s {
+	case ".dup", ".drop", ".lsb", ".msb", ".bank", ".not", ".invert":
+		return true
+	}
+	return false
+}
+
+// relUnary takes the node of a unary operator and a value as the linker sees
+// it, and returns the result. The linker can only take a byte of a value
+func (az *analyzer) relUnary(op *node.Node, r rel) (rel, string) {
+
+	if r.base == (data.Base{}) {
+		v, _ := az.unary(op, r.value, false)
+		return rel{value: v}, ""
+	}
+
+	if r.kind != "" || (op.Text != ".lsb" && op.Text != ".msb" && op.Text != ".bank") {
+		return rel{}, fmt.Sprintf("Operator '%s' can't be used on a relocatable value", op.Text)
+	}
+
+	return rel{base: r.base, kind: op.Text, value: r.value}, ""
+}
+
+// relBinary takes the node of a binary operator and two values as the linker
+// sees them, and returns the result
+func (az *analyzer) relBinary(op *node.Node, r1, r2 rel) (rel, string) {
+
+	abs1, abs2 := r1.base == data.Base{}, r2.base == data.Base{}
+
+	switch {
+
+	case abs1 && abs2:
+		v, _ := az.binary(op, r1.value, r2.value, false)
+		return rel{value: v}, ""
+
+	case r1.kind != "" || r2.kind != "":
+		return rel{}, fmt.Sprintf("Operator '%s' can't be used on a part of a relocatable value", op.Text)
+
+	case op.Text == "+" && abs1:
+		return rel{base: r2.base, value: r1.value + r2.value}, ""
+
+	case op.Text == "+" && abs2:
+		return rel{base: r1.base, value: r1.value + r2.value}, ""
+
+	case op.Text == "-" && abs2:
+		return rel{base: r1.base, value: r1.value - r2.value}, ""
+
+	// The distance between two labels of the same segment doesn't depend
+	// on where the segment goes
+	case op.Text == "-" && r1.base == r2.base:
+		return rel{value: r1.value - r2.value}, ""
+	}
+
+	return rel{}, fmt.Sprintf("Operator '%s' can't be used on relocatable values", op.Text)
+}
+
+// relocate takes the node of an operand or data, the address of its bytes, how
+// many there are and if they are the operand of an instruction, and adds a
+// relocation if the value depends on where the linker puts things
+func (az *analyzer) relocate(k *node.Node, at, width int, operand bool) {
+
+	if !az.object || az.seg < 0 || !az.relative(k) {
+		return
+	}
+
+	r, es := az.relocOf(k)
+	if es != "" {
+		az.reportErr(es, k)
+		return
+	}
+
+	if r.base == (data.Base{}) {
+		return
+	}
+
+	az.relocs = append(az.relocs, data.Reloc{
+		Segment: az.seg, Offset: at - az.segStart, Width: width, Kind: r.kind,
+		Operand: operand, Base: r.base, Addend: r.value,
+		File: k.File, Line: k.Line, Column: k.Index,
+	})
+}
+
+// importSymbols takes an .import directive and defines its symbols as 0
+// relative to themselves. The linker fills in their values
+func (az *analyzer) importSymbols(n *node.Node) {
+
+	if !az.object {
+		az.reportErr("Directive '.import' only works for object files", n)
+		return
+	}
+
+	for _, k := range n.Kids {
+		if az.define(k.Text, 0, "import", k) {
+			sym := az.symbols[k.Text]
+			sym.Base = data.Base{Import: k.Text}
+			az.symbols[k.Text] = sym
+		}
+	}
+}
+
+// exportSymbols takes an .export directive and marks its symbols as exported
+// for the linker. Programs that are not object files can have them as well,
+// they just don't do anything
+func (az *analyzer) exportSymbols(n *node.Node) {
+
+	for _, k := range n.Kids {
+		sym, ok := az.symbols[k.Text]
+
+		switch {
+		case !ok:
+			d := data.At(errTag, k.Token, fmt.Sprintf("Exported symbol '%s' not defined", k.Text))
+			if sug := az.suggest(k.Text); sug != "" {
+				d.Hint = fmt.Sprintf("Did you mean '%s'?", sug)
+			}
+			az.report(d)
+
+		case sym.Type == "import":
+			es := fmt.Sprintf("Symbol '%s' is imported and can't be exported", k.Text)
+			az.reportErr(es, k)
+
+		default:
+			sym.Exported, sym.Used = true, true
+			az.symbols[k.Text] = sym
+		}
+	}
+}
+
+// enterSegment takes the machine and the index of a segment, and makes it the
+// one the encode pass is in
+func (az *analyzer) enterSegment(m *data.Machine, i int) {
+	az.seg, az.segStart, az.base = i, 0, data.Base{}
+
+	if i < 0 || i >= len(m.Segments) {
+		return
+	}
+
+	s := m.Segments[i]
+	az.segStart = s.Start
+	if s.Reloc {
+		az.base = data.Base{Segment: s.Name}
+	}
+}
@@ -0,0 +1,165 @@
+// Segments: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// A program can have more than one block of code, such as the main code at
+// $8000 and the vectors at $FFE0. Each ".origin" starts a new segment at its
+// address, ".segment" does the same and gives the segment a name for the map.
+// The generator places the segments in the binary by address, so they must
+// not overlap.
+
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+
+	"cthulhu/data"
+	"cthulhu/node"
+)
+
+// startSegment takes an .origin or .segment node and the machine, ends the
+// segment we are in and starts a new one at the address of the directive
+func (az *analyzer) startSegment(n *node.Node, m *data.Machine) {
+	az.endSegment(m)
+
+	name, e := "", n.Kids[0]
+
+	if n.Text == ".segment" {
+		name = n.Kids[0].Text
+
+		for _, s := range m.Segments {
+			if s.Name == name {
+				d := data.At(errTag, n.Kids[0].Token, fmt.Sprintf("Segment '%s' already defined", name))
+				d.Related = []data.Related{{File: s.Node.File, Line: s.Node.Line, Column: s.Node.Index, Message: "First defined here"}}
+				az.report(d)
+				break
+			}
+		}
+	}
+
+	// Segments without an address are placed by the linker. We assemble
+	// them as if they start at 0, and their labels are relative to them
+	if n.Text == ".segment" && len(n.Kids) == 1 {
+		if !az.object {
+			es := fmt.Sprintf("Segment '%s' needs an address, unless this is an object file", name)
+			az.reportErr(es, n)
+		}
+
+		m.Segments = append(m.Segments, data.Segment{Name: name, Node: n, Reloc: true})
+		az.pc, az.base = 0, data.Base{Segment: name}
+		n.Addr = 0
+		return
+	}
+
+	if n.Text == ".segment" {
+		e = n.Kids[1]
+	}
+
+	// If we don't have an address, we keep going where we are so the rest
+	// of the program still gets addresses
+	v, ok := az.eval(e, true)
+	if !ok {
+		v = az.pc
+	}
+
+	m.Segments = append(m.Segments, data.Segment{Name: name, Start: v, Node: n})
+	az.pc, az.base = v, data.Base{}
+	n.Addr = v
+}
+
+// endSegment takes the machine and gives the segment we are in its size
+func (az *analyzer) endSegment(m *data.Machine) {
+	if len(m.Segments) == 0 {
+		return
+	}
+
+	s := &m.Segments[len(m.Segments)-1]
+	s.Size = az.pc - s.Start
+}
+
+// checkSegments takes the machine once all segments have their size, and
+// reports the ones that overlap
+func (az *analyzer) checkSegments(m *data.Machine) {
+	ss := append([]data.Segment{}, m.Segments...)
+
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].Start < ss[j].Start })
+
+	var prev *data.Segment // the segment that reaches highest so far
+
+	for i := range ss {
+		s := &ss[i]
+		if s.Size == 0 || s.Reloc {
+			continue
+		}
+
+		if prev != nil && s.Start < prev.Start+prev.Size {
+			es := fmt.Sprintf("Segment %s overlaps segment %s", segmentText(*s), segmentText(*prev))
+			d := data.At(errTag, s.Node.Token, es)
+			d.Related = []data.Related{{File: prev.Node.File, Line: prev.Node.Line, Column: prev.Node.Index, Message: "Other segment starts here"}}
+			az.report(d)
+		}
+
+		if prev == nil || s.Start+s.Size > prev.Start+prev.Size {
+			prev = s
+		}
+	}
+}
+
+// testsAddr takes the machine and returns the address where the code of the
+// tests goes. This is after the segment that ends highest, as long as there
+// is room in the address space of the MPU, so vectors at the very end of
+// memory don't push the tests out of it
+func testsAddr(m *data.Machine) int {
+	if len(m.Segments) == 0 {
+		return 0
+	}
+
+	limit := 0x10000
+	if m.MPU == "65816" {
+		limit = 0x1000000
+	}
+
+	last := m.Segments[len(m.Segments)-1]
+	best := -1
+
+	for _, s := range m.Segments {
+		if end := s.Start + s.Size; end < limit && end > best {
+			best = end
+		}
+	}
+
+	if best < 0 {
+		return last.Start + last.Size
+	}
+
+	return best
+}
+
+// checkTests takes the machine after the tests have been laid out, and
+// reports if their code overlaps a segment of the program
+func (az *analyzer) checkTests(m *data.Machine) {
+	if len(m.Tests) == 0 {
+		return
+	}
+
+	start, end := m.Tests[0].Addr, az.pc
+
+	for _, s := range m.Segments {
+		if s.Size > 0 && !s.Reloc && start < s.Start+s.Size && s.Start < end {
+			es := fmt.Sprintf("Code of the tests ($%04X-$%04X) overlaps segment %s", start, end-1, segmentText(s))
+			az.reportErr(es, m.Tests[0].Node)
+			return
+		}
+	}
+}
+
+// segmentText takes a segment and returns its name, if it has one, and its
+// addresses for messages
+func segmentText(s data.Segment) string {
+	r := fmt.Sprintf("$%04X-$%04X", s.Start, s.Start+s.Size-1)
+	if s.Name == "" {
+		return r
+	}
+	return fmt.Sprintf("'%s' (%s)", s.Name, r)
+}
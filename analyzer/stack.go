@@ -0,0 +1,315 @@
+// Stack balance: Analysis step for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// After the operands are known, we follow each subroutine that is called with
+// jsr or jsr.l from its first instruction along every path to rts, rts.l and
+// rti, and count the bytes that are pushed and pulled on the way. A path that
+// returns with bytes left on the stack, or with more pulled than pushed,
+// returns to the wrong address. So does a subroutine called with jsr that
+// returns with rts.l, the rtl of SAN, or the other way around.
+//
+// Subroutines that are called are taken to leave the stack as they found it,
+// since they are checked on their own. A path ends without a warning where we
+// can't follow it: at jumps through a pointer, at txs and tcs, at stp, and
+// where the code runs into data. We don't know the registers, so both ways of
+// a branch are taken. Object files are left alone, because the addresses of
+// their segments aren't known yet.
+
+package analyzer
+
+import (
+	"fmt"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// The most bytes a path can push before we give up on it, which happens with
+// loops that push
+const maxPushed = 0x100
+
+// flow is the program as a list of instructions that can be followed from one
+// to the next
+type flow struct {
+	ins    []*node.Node   // instructions, or nil where there is data
+	at     map[int]int    // index of the instruction by address
+	labels map[int]string // name of the global label at an address
+	spans  map[int]data.Span
+	ops    map[string]data.Opcode
+}
+
+// newFlow takes the machine after the encode pass and returns the flow of the
+// program. Tests are not part of it
+func newFlow(m *data.Machine) *flow {
+
+	f := &flow{
+		at: map[int]int{}, labels: map[int]string{},
+		spans: map[int]data.Span{}, ops: data.OpcodesSAN[m.MPU],
+	}
+
+	for _, s := range m.Spans {
+		f.spans[s.Addr] = s
+	}
+
+	label := ""
+
+	for _, n := range m.AST.Kids {
+		switch {
+
+		case n.Type == token.DIREC_PARA && n.Text == ".test":
+			continue
+
+		case n.Type == token.LABEL:
+			label = n.Text
+
+		case n.Type == token.OPC_0, n.Type == token.OPC_1, n.Type == token.OPC_2,
+			n.Type == token.DIREC && len(n.Code) > 0:
+			f.at[n.Addr] = len(f.ins)
+			if label != "" {
+				f.labels[n.Addr] = label
+				label = ""
+			}
+			f.ins = append(f.ins, n)
+
+		case len(n.Code) > 0:
+			f.ins = append(f.ins, nil)
+			label = ""
+		}
+	}
+
+	return f
+}
+
+// target takes a jump, call or branch and returns the address it goes to
+func target(n *node.Node) int {
+	switch {
+	case data.Relative[n.Text] && len(n.Code) == 2:
+		return n.Addr + 2 + int(int8(n.Code[1]))
+	case data.Relative[n.Text]:
+		return n.Addr + 3 + int(int16(uint16(n.Code[1])|uint16(n.Code[2])<<8))
+	case len(n.Code) == 4:
+		return int(n.Code[1]) | int(n.Code[2])<<8 | int(n.Code[3])<<16
+	}
+
+	// Absolute addresses are in the bank of the instruction
+	return n.Addr&0xff0000 | int(n.Code[1]) | int(n.Code[2])<<8
+}
+
+// isCall takes an instruction and returns true if it calls a subroutine at an
+// address we know
+func isCall(n *node.Node) bool {
+	return n.Text == "jsr" || n.Text == "jsr.l"
+}
+
+// pushed takes an instruction and returns how many bytes it pushes to the
+// stack, or pulls if negative
+func (f *flow) pushed(n *node.Node) int {
+
+	s, ok := f.spans[n.Addr]
+	a8 := !ok || s.Emulated || s.A8
+	xy8 := !ok || s.Emulated || s.XY8
+
+	size := func(is8 bool) int {
+		if is8 {
+			return 1
+		}
+		return 2
+	}
+
+	switch f.ops[n.Text].WDC {
+	case "pha":
+		return size(a8)
+	case "pla":
+		return -size(a8)
+	case "phx", "phy":
+		return size(xy8)
+	case "plx", "ply":
+		return -size(xy8)
+	case "php", "phb", "phk":
+		return 1
+	case "plp", "plb":
+		return -1
+	case "phd", "pei", "pea", "per":
+		return 2
+	case "pld":
+		return -2
+	}
+	return 0
+}
+
+// next takes the index of an instruction and returns the indices of the
+// instructions that can come after it. Returns and the ends of paths we
+// can't follow have none
+func (f *flow) next(i int) []int {
+
+	n := f.ins[i]
+
+	follow := func(addr int) []int {
+		if j, ok := f.at[addr]; ok {
+			return []int{j}
+		}
+		return nil
+	}
+
+	var after []int
+	if i+1 < len(f.ins) && f.ins[i+1] != nil {
+		after = []int{i + 1}
+	}
+
+	switch oc := f.ops[n.Text]; {
+	case oc.WDC == "rts", oc.WDC == "rtl", oc.WDC == "rti", oc.WDC == "stp",
+		oc.WDC == "txs", oc.WDC == "tcs":
+		return nil
+	case n.Text == "jmp", n.Text == "jmp.l", oc.WDC == "bra", oc.WDC == "brl":
+		return follow(target(n))
+	case oc.WDC == "jmp", oc.WDC == "jml":
+		return nil // through a pointer
+	case data.Relative[n.Text]:
+		return append(follow(target(n)), after...)
+	}
+
+	return after
+}
+
+// stackState is where we are on a path through a subroutine
+type stackState struct {
+	i     int // index of the instruction
+	depth int // bytes pushed since the start
+}
+
+// checkStack follows the subroutines of the program and reports the paths
+// that don't leave the stack as they found it
+func (az *analyzer) checkStack(m *data.Machine) {
+
+	if m.Object {
+		return
+	}
+
+	f := newFlow(m)
+
+	// The first call of each subroutine with jsr and jsr.l, by address.
+	// We keep the order of the source so the warnings are the same each
+	// time
+	type entry struct {
+		addr  int
+		calls map[string]*node.Node
+	}
+	var subs []*entry
+	byAddr := map[int]*entry{}
+
+	for _, n := range f.ins {
+		if n == nil || !isCall(n) {
+			continue
+		}
+
+		addr := target(n)
+		if _, ok := f.at[addr]; !ok {
+			continue
+		}
+
+		e, ok := byAddr[addr]
+		if !ok {
+			e = &entry{addr: addr, calls: map[string]*node.Node{}}
+			byAddr[addr] = e
+			subs = append(subs, e)
+		}
+		if _, ok := e.calls[n.Text]; !ok {
+			e.calls[n.Text] = n
+		}
+	}
+
+	for _, e := range subs {
+		az.followStack(f, e.addr, e.calls)
+	}
+}
+
+// followStack takes the flow, the address of a subroutine and its first call
+// with jsr and jsr.l, and reports each return that doesn't fit
+func (az *analyzer) followStack(f *flow, addr int, calls map[string]*node.Node) {
+
+	name, ok := f.labels[addr]
+	if !ok {
+		name = fmt.Sprintf("$%04X", addr)
+	}
+
+	// The fewest bytes left on the stack and pulled too many at each
+	// return, so loops that push are reported once
+	type balance struct{ left, pulled int }
+	rets := map[int]*balance{}
+
+	seen := map[stackState]bool{}
+	work := []stackState{{i: f.at[addr]}}
+
+	for len(work) > 0 {
+		s := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if seen[s] || s.depth > maxPushed || s.depth < -maxPushed {
+			continue
+		}
+		seen[s] = true
+
+		n := f.ins[s.i]
+
+		switch f.ops[n.Text].WDC {
+		case "rts", "rtl", "rti":
+			b, ok := rets[s.i]
+			if !ok {
+				b = &balance{}
+				rets[s.i] = b
+			}
+			if s.depth > 0 && (b.left == 0 || s.depth < b.left) {
+				b.left = s.depth
+			}
+			if s.depth < 0 && (b.pulled == 0 || -s.depth < b.pulled) {
+				b.pulled = -s.depth
+			}
+			continue
+		}
+
+		depth := s.depth + f.pushed(n)
+		for _, j := range f.next(s.i) {
+			work = append(work, stackState{i: j, depth: depth})
+		}
+	}
+
+	// Any call will do to show where the subroutine comes from
+	call := calls["jsr"]
+	if call == nil {
+		call = calls["jsr.l"]
+	}
+
+	warn := func(n *node.Node, msg string, call *node.Node) {
+		d := data.At(errTag, n.Token, msg)
+		d.Severity = data.Warning
+		d.Related = []data.Related{{
+			File: call.File, Line: call.Line, Column: call.Index,
+			Message: fmt.Sprintf("Called with '%s' here", call.Text),
+		}}
+		az.report(d)
+	}
+
+	for i, n := range f.ins {
+		b, ok := rets[i]
+		if !ok {
+			continue
+		}
+
+		if b.left > 0 {
+			warn(n, fmt.Sprintf("Subroutine '%s' returns with %d byte(s) still on the stack", name, b.left), call)
+		}
+		if b.pulled > 0 {
+			warn(n, fmt.Sprintf("Subroutine '%s' returns after pulling %d byte(s) more than it pushed", name, b.pulled), call)
+		}
+
+		// In SAN, rtl is "rts.l"
+		if c, ok := calls["jsr"]; ok && n.Text == "rts.l" {
+			warn(n, fmt.Sprintf("Subroutine '%s' is called with 'jsr', but returns with 'rts.l'", name), c)
+		}
+		if c, ok := calls["jsr.l"]; ok && n.Text == "rts" {
+			warn(n, fmt.Sprintf("Subroutine '%s' is called with 'jsr.l', but returns with 'rts'", name), c)
+		}
+	}
+}
@@ -1,18 +1,138 @@
 // Symbol Table Code for the Cthulhu Assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version 21. May 2018
-// This version 21. May 2018
+// This version 19. Oct 2026
 
 package analyzer
 
-type Symbol struct {
-	Value int    // added once defined
-	File  string // where defined
-	Line  int    // where defined
-	Type  string // "label" or "symbol"
-	Used  bool   // see if symbol defined but not used
-}
+import (
+	"fmt"
+	"sort"
+	"strings"
 
-var (
-	SymbolTable = map[string]Symbol{}
+	"cthulhu/data"
+	"cthulhu/node"
 )
+
+// LocalName returns the name a local label has in the symbol table. Since the
+// same local label can be defined in more than one scope, we add the number of
+// the scope
+func LocalName(s string, scope int) string {
+	return fmt.Sprintf("%s/%d", s, scope)
+}
+
+// define takes the name of a symbol, its value, its type and the node where it
+// is defined, which is the name for .equ, and adds it to the symbol table. Symbols can only be defined
+// once, so we return false if it already was. Labels are relative to the
+// segment they are in
+func (az *analyzer) define(s string, v int, t string, n *node.Node) bool {
+	old, ok := az.symbols[s]
+	if ok {
+		d := data.At(errTag, n.Token, fmt.Sprintf("Symbol '%s' already defined", s))
+		d.Related = []data.Related{{File: old.File, Line: old.Line, Column: old.Column, Message: "First defined here"}}
+		az.report(d)
+		return false
+	}
+
+	sym := data.Symbol{Value: v, File: n.File, Line: n.Line, Column: n.Index, Type: t}
+	if t == "label" || t == "local" {
+		sym.Base = az.base
+	}
+	az.symbols[s] = sym
+
+	return true
+}
+
+// lookup takes the name of a symbol as used in an operand and returns the name
+// it has in the symbol table, as well as a flag if it was found. Inside a
+// scope, local labels can be referenced with or without their underscore, and
+// they hide global symbols with the same name
+func (az *analyzer) lookup(s string) (string, bool) {
+	ls := s
+	if !strings.HasPrefix(ls, "_") {
+		ls = "_" + s
+	}
+
+	for i := len(az.scopes) - 1; i >= 0; i-- {
+		k := LocalName(ls, az.scopes[i])
+		_, ok := az.symbols[k]
+		if ok {
+			return k, true
+		}
+	}
+
+	_, ok := az.symbols[s]
+	return s, ok
+}
+
+// use marks the symbol as used and remembers the node that refers to it
+func (az *analyzer) use(s string, n *node.Node) {
+	sym := az.symbols[s]
+
+	for _, r := range sym.Refs {
+		if r == n {
+			return
+		}
+	}
+
+	sym.Used = true
+	sym.Refs = append(sym.Refs, n)
+	az.symbols[s] = sym
+}
+
+// suggest takes the name of a symbol that isn't defined and returns the name
+// of a symbol the user might have meant, or an empty string. We only look at
+// local labels of the scopes we are in
+func (az *analyzer) suggest(s string) string {
+	var names []string
+
+	inScope := map[string]bool{}
+	for _, sc := range az.scopes {
+		inScope[fmt.Sprint(sc)] = true
+	}
+
+	for k := range az.symbols {
+		i := strings.LastIndex(k, "/")
+		if i < 0 {
+			names = append(names, k)
+		} else if inScope[k[i+1:]] {
+			names = append(names, k[:i])
+		}
+	}
+
+	sort.Strings(names)
+
+	return data.Suggest(s, names)
+}
+
+// Entry is a symbol of the finished program as it goes into a symbol table
+type Entry struct {
+	Name  string
+	Key   string // in the symbols of the machine, such as "_loop/3"
+	Value int
+	Type  string // "label", "local" or "symbol"
+}
+
+// SymbolTable takes the machine after the analyzer is done and returns its
+// symbols sorted by value, then name. Local labels get the number of their
+// scope after an underscore, such as "_loop_3", so each name is unique.
+// Imported symbols have no value yet and are left out
+func SymbolTable(m *data.Machine) []Entry {
+	var es []Entry
+
+	for k, sym := range m.Symbols {
+		if sym.Type == "import" {
+			continue
+		}
+		es = append(es, Entry{Name: strings.Replace(k, "/", "_", 1), Key: k, Value: sym.Value, Type: sym.Type})
+	}
+
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Value != es[j].Value {
+			return es[i].Value < es[j].Value
+		}
+		return es[i].Name < es[j].Name
+	})
+
+	return es
+}
@@ -0,0 +1,249 @@
+// Assembler package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// A Session runs the lexer, parser, analyzer, and generator over a program
+// and returns the results as values instead of printing them and ending the
+// program. Each session owns all of its state, so several programs can be
+// assembled in one process at the same time, for example by a build server or
+// the language server. Sources are taken from memory, from a file system such
+// as os.DirFS, or from the disk, in that order.
+
+package assembler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"cthulhu/advisor"
+	"cthulhu/analyzer"
+	"cthulhu/data"
+	"cthulhu/generator"
+	"cthulhu/lexer"
+	"cthulhu/parser"
+)
+
+const (
+	errTag = "ASSEMBLER"
+
+	defaultMPU = "65c02"
+)
+
+// Finds the MPU of the main file, since the lexer needs it before we parse
+var mpuLine = regexp.MustCompile(`(?m)^\s*\.mpu\s+"([^"]*)"`)
+
+// Session holds the sources of a program. Files can't be added while the
+// session is assembling
+type Session struct {
+	MPU string // if empty, the .mpu directive of the main file is used
+	FS  fs.FS  // files that weren't added are read from here, or from disk if nil
+
+	// Object files have segments without an address and imported symbols
+	// for the linker. The code stays in the segments of the machine
+	Object bool
+
+	// Advise adds notes with suggestions to make the code shorter or
+	// faster, if there are no errors
+	Advise bool
+
+	files map[string][]byte
+}
+
+// Result is what we get from assembling a program. If there are errors, we
+// don't generate code, and the other fields can be incomplete
+type Result struct {
+	MPU         string
+	Files       []string               // files read, main file first
+	Machine     *data.Machine          // once the analyzer has run
+	Symbols     map[string]data.Symbol // once the analyzer has run
+	Code        []byte                 // if there were no errors
+	Diagnostics []data.Diagnostic
+
+	sources map[string][]string // lines of the files read
+}
+
+// OK returns true if the program was assembled without errors. There can
+// still be warnings
+func (r *Result) OK() bool {
+	return data.CountErrors(r.Diagnostics) == 0
+}
+
+// Source takes the name of a file and a line, and returns the text of the
+// line as it was when we read the file. This is what diagnostics need to show
+// where the problem is
+func (r *Result) Source(file string, line int) (string, bool) {
+	ls, ok := r.sources[file]
+	if !ok || line < 1 || line > len(ls) {
+		return "", false
+	}
+	return ls[line-1], true
+}
+
+// New takes the MPU, or an empty string to use the .mpu directive of the main
+// file, and returns a new session
+func New(mpu string) *Session {
+	return &Session{MPU: mpu, files: map[string][]byte{}}
+}
+
+// Add takes the name of a file and a reader with its source, and keeps the
+// source in memory. Files added this way are used before those on a file
+// system or the disk, and can be added again to change them
+func (s *Session) Add(name string, r io.Reader) error {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if s.files == nil {
+		s.files = map[string][]byte{}
+	}
+	s.files[name] = bs
+
+	return nil
+}
+
+// Remove takes the name of a file added with Add and forgets it
+func (s *Session) Remove(name string) {
+	delete(s.files, name)
+}
+
+// Assemble takes the name of the main file and assembles it. The lexer,
+// parser and analyzer all get to look at the program even if the ones before
+// them found errors, so we see as many problems as we can at once
+func (s *Session) Assemble(main string) (r *Result) {
+
+	r = &Result{MPU: s.mpu(main), sources: map[string][]string{}}
+
+	defer func() { r.Diagnostics = data.SortDiagnostics(r.Diagnostics) }()
+
+	// Errors in the assembler itself shouldn't take down whoever is using
+	// the session, so we hand them on like any other error
+	defer func() {
+		if e := recover(); e != nil {
+			r.Diagnostics = append(r.Diagnostics, data.Diagnostic{
+				Stage: errTag, File: main, Message: fmt.Sprintf("Internal error: %v", e),
+			})
+		}
+	}()
+
+	if _, ok := data.OpcodesSAN[r.MPU]; !ok {
+		r.Diagnostics = append(r.Diagnostics, data.Diagnostic{
+			Stage: errTag, File: main, Message: fmt.Sprintf("MPU '%s' not supported", r.MPU),
+		})
+		return r
+	}
+
+	// We keep the sources the lexer reads for the diagnostics
+	open := func(name string) (io.ReadCloser, error) {
+		bs, err := s.read(name)
+		if err != nil {
+			return nil, err
+		}
+		r.sources[name] = strings.Split(string(bs), "\n")
+		return io.NopCloser(bytes.NewReader(bs)), nil
+	}
+
+	tokens, ds := lexer.Scan(r.MPU, main, open)
+
+	for _, t := range tokens {
+		if !contains(r.Files, t.File) {
+			r.Files = append(r.Files, t.File)
+		}
+	}
+
+	r.Diagnostics = append(r.Diagnostics, ds...)
+
+	// Without tokens, we couldn't read the main file
+	if len(tokens) == 0 {
+		return r
+	}
+
+	ast, ds := parser.Parse(tokens)
+
+	r.Diagnostics = append(r.Diagnostics, ds...)
+
+	r.Machine = &data.Machine{MPU: r.MPU, Object: s.Object, AST: analyzer.Purge(r.MPU, ast)}
+
+	// The analyzer fills in the symbol table as it goes, so we have it
+	// even if something goes wrong
+	defer func() { r.Symbols = r.Machine.Symbols }()
+
+	r.Diagnostics = append(r.Diagnostics, analyzer.Analyze(r.Machine)...)
+	if !r.OK() {
+		return r
+	}
+
+	generator.Generator(r.Machine)
+	r.Code = r.Machine.Code
+
+	if s.Advise {
+		r.Diagnostics = append(r.Diagnostics, advisor.Advise(r.Machine)...)
+	}
+
+	return r
+}
+
+// mpu takes the name of the main file and returns the MPU to use
+func (s *Session) mpu(main string) string {
+	if s.MPU != "" {
+		return s.MPU
+	}
+
+	bs, err := s.read(main)
+	if err != nil {
+		return defaultMPU
+	}
+
+	m := mpuLine.FindSubmatch(bs)
+	if m == nil {
+		return defaultMPU
+	}
+
+	if _, ok := data.OpcodesSAN[string(m[1])]; !ok {
+		return defaultMPU
+	}
+
+	return string(m[1])
+}
+
+// open takes the name of a file and returns its source, from memory, the
+// file system, or the disk
+func (s *Session) open(name string) (io.ReadCloser, error) {
+	bs, ok := s.files[name]
+	if ok {
+		return io.NopCloser(bytes.NewReader(bs)), nil
+	}
+
+	if s.FS != nil {
+		return s.FS.Open(name)
+	}
+
+	return os.Open(name)
+}
+
+// read takes the name of a file and returns all of its source
+func (s *Session) read(name string) ([]byte, error) {
+	f, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// contains takes a list of strings and a string, and returns true if the
+// string is in the list
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+// Test file for the assembler of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package assembler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssemble(t *testing.T) {
+
+	var tests = []struct {
+		name  string
+		files map[string]string // main file is "main.asm"
+		code  []byte
+		diags []string
+	}{
+		{"simple", map[string]string{
+			"main.asm": "        .mpu \"65c02\"\n        .origin $8000\nloop:   bra loop\n        .end\n",
+		}, []byte{0x80, 0xfe}, nil},
+		{"include", map[string]string{
+			"main.asm": "        .origin $8000\n        .include \"defs.asm\"\n        lda.# char\n",
+			"defs.asm": "        .equ char $61\n",
+		}, []byte{0xa9, 0x61}, nil},
+		{"mpu from source", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        xba\n",
+		}, []byte{0xeb}, nil},
+		{"16 bits in emulated mode", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        .a16\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 3, 9): Directive '.a16' not possible in emulated mode"}},
+		{"unknown mnemonics", map[string]string{
+			"main.asm": "        .mpu \"6502\"\n        .origin $8000\n        lad\n        phx\n        ldz\n",
+		}, nil, []string{
+			"ANALYZER ERROR (main.asm, 3, 9): Unknown mnemonic 'lad'",
+			"ANALYZER ERROR (main.asm, 4, 9): Unknown mnemonic 'phx', which is an instruction of the 65c02, not the 6502",
+			"ANALYZER ERROR (main.asm, 5, 9): Unknown mnemonic 'ldz'\n    Hint: Did you mean 'lda'?",
+		}},
+		{"lexer error", map[string]string{
+			"main.asm": "        .origin $8000\n        .frob\n",
+		}, nil, []string{"LEXER ERROR (main.asm, 2, 9): Unknown directive '.frob'"}},
+		{"analyzer error", map[string]string{
+			"main.asm": "        .origin $8000\n        jmp nowhere\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 2, 13): Symbol 'nowhere' not defined"}},
+		{"missing include", map[string]string{
+			"main.asm": "        .origin $8000\n        .include \"gone.asm\"\n",
+		}, nil, []string{"LEXER ERROR (main.asm, 2, 9): open gone.asm: file does not exist"}},
+		{"escapes and encodings", map[string]string{
+			"main.asm": "        .origin $8000\n        .byte \"a\\n\\\"\\x80\"\n        .encoding \"petscii\"\n        .byte \"aA\\n\"\n        .charmap \"ab\" $10\n        lda.# \"b\"\n",
+		}, []byte{0x61, 0x0a, 0x22, 0x80, 0x41, 0xc1, 0x0d, 0xa9, 0x11}, nil},
+		{"encoding errors", map[string]string{
+			"main.asm": "        .origin $8000\n        .encoding \"petsci\"\n        .byte \"{\\q\"\n",
+		}, nil, []string{
+			"ANALYZER ERROR (main.asm, 2, 19): Unknown encoding 'petsci'\n    Hint: Did you mean 'petscii'?",
+			"ANALYZER ERROR (main.asm, 3, 17): Unknown escape '\\q'",
+		}},
+		{"unmapped character", map[string]string{
+			"main.asm": "        .origin $8000\n        .encoding \"petscii\"\n        .byte \"a{\"\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 3, 17): Character '{' has no mapping in encoding 'petscii'"}},
+		{"words and longs", map[string]string{
+			"main.asm": "        .origin $8000\nhere:   .word here, {0 1 -}, 1 ... 2\n        .long $123456, here\n",
+		}, []byte{0x00, 0x80, 0xff, 0xff, 0x01, 0x00, 0x02, 0x00, 0x56, 0x34, 0x12, 0x00, 0x80, 0x00}, nil},
+		{"word out of range", map[string]string{
+			"main.asm": "        .origin $8000\n        .word $10000\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 2, 15): Value 65536 doesn't fit in a word"}},
+		{"padding", map[string]string{
+			"main.asm": "        .origin $8000\n        nop\n        .align 4, $ff\n        .skip 3, 1, 2\n        .advance $800a\n        nop\n",
+		}, []byte{0xea, 0xff, 0xff, 0xff, 0x01, 0x02, 0x01, 0x00, 0x00, 0x00, 0xea}, nil},
+		{"advance past address", map[string]string{
+			"main.asm": "        .origin $8000\n        nop\n        .advance $8000\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 3, 9): Address $8000 of '.advance' already passed by 1 byte(s)"}},
+		{"segments", map[string]string{
+			"main.asm": "        .origin $8004\n        .byte 1\n        .segment \"low\" $8000\n        nop\n",
+		}, []byte{0xea, 0x00, 0x00, 0x00, 0x01}, nil},
+		{"overlapping segments", map[string]string{
+			"main.asm": "        .origin $8000\n        .skip 4\n        .segment \"data\" $8003\n        nop\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 3, 9): Segment 'data' ($8003-$8003) overlaps segment $8000-$8003\n    (main.asm, 1, 9): Other segment starts here"}},
+		{"string directives", map[string]string{
+			"main.asm": "        .origin $8000\n        .asciiz \"Hi\", 13\n        .pstring \"abc\"\n        .hstring \"OK\"\n",
+		}, []byte{0x48, 0x69, 0x0d, 0x00, 0x03, 0x61, 0x62, 0x63, 0x4f, 0xcb}, nil},
+		{"string directive errors", map[string]string{
+			"main.asm": "        .origin $8000\n        .pstring \"" + strings.Repeat("a", 256) + "\"\n        .hstring $80\n",
+		}, nil, []string{
+			"ANALYZER ERROR (main.asm, 2, 9): String of '.pstring' too long by 1 byte(s)",
+			"ANALYZER ERROR (main.asm, 3, 9): Last byte $80 of '.hstring' already has bit 7 set",
+		}},
+		{"import without object file", map[string]string{
+			"main.asm": "        .origin $8000\n        .import print\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 2, 9): Directive '.import' only works for object files"}},
+		{"segment without address", map[string]string{
+			"main.asm": "        .segment \"code\"\n        nop\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 1, 9): Segment 'code' needs an address, unless this is an object file"}},
+		{"direct page", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        lda.d $10\n        .dp $2000\n        lda.d $2010\n        .direct $0100\n        sta.dx $01FF\n",
+		}, []byte{0xa5, 0x10, 0xa5, 0x10, 0x95, 0xff}, nil},
+		{"outside of direct page", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        .dp $2000\n        lda.d $2100\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 4, 9): Address $2100 of 'lda.d' is outside of the direct page ($2000-$20FF)"}},
+		{"direct page without 65816", map[string]string{
+			"main.asm": "        .origin $8000\n        .dp $2000\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 2, 9): Directive '.dp' requires the 65816"}},
+		{"cycles of the direct page", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        .scope\n        .cycles 3\n        lda.d $10\n        .scend\n",
+		}, nil, []string{"ANALYZER ERROR (main.asm, 4, 9): Scope can take up to 4 cycles, limit is 3"}},
+		{"cycles of an aligned direct page", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        .dp $2000\n        .scope\n        .cycles 3\n        lda.d $2010\n        .scend\n",
+		}, []byte{0xa5, 0x10}, nil},
+		{"data bank", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        sta $7E2000\n        .databank $7E\n        sta.x $7E2000\n        jmp $018000\n",
+		}, []byte{0x8d, 0x00, 0x20, 0x9d, 0x00, 0x20, 0x4c, 0x00, 0x80}, nil},
+		{"outside of data bank", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        .databank 0\n        sta $7E2000\n        sta.y $7E2000\n",
+		}, nil, []string{
+			"ANALYZER ERROR (main.asm, 4, 9): Address $7E:2000 of 'sta' is not in the data bank $00\n    Hint: Use 'sta.l' for a long address",
+			"ANALYZER ERROR (main.asm, 5, 9): Address $7E:2000 of 'sta.y' is not in the data bank $00",
+		}},
+		{"bank 0 outside of data bank", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $00:8000\n        .equ io $00:4200\n        .equ buffer $2000\n        .databank $7E\ntable:  lda table\n        sta io\n        sta buffer\n        phe.r table\n        bra.l table\n",
+		}, nil, []string{
+			"ANALYZER ERROR (main.asm, 6, 9): Address $00:8000 of 'lda' is not in the data bank $7E\n    Hint: Use 'lda.l' for a long address",
+			"ANALYZER ERROR (main.asm, 7, 9): Address $00:4200 of 'sta' is not in the data bank $7E\n    Hint: Use 'sta.l' for a long address",
+		}},
+		{"stack balance", map[string]string{
+			"main.asm": "        .mpu \"65816\"\n        .origin $8000\n        jsr.l sub\n        stp\nsub:    pha\n        beq done\n        pla\ndone:   rts\n",
+		}, []byte{0x22, 0x05, 0x80, 0x00, 0xdb, 0x48, 0xf0, 0x01, 0x68, 0x60}, []string{
+			"ANALYZER WARNING (main.asm, 8, 9): Subroutine 'sub' returns with 1 byte(s) still on the stack\n    (main.asm, 3, 9): Called with 'jsr.l' here",
+			"ANALYZER WARNING (main.asm, 8, 9): Subroutine 'sub' is called with 'jsr.l', but returns with 'rts'\n    (main.asm, 3, 9): Called with 'jsr.l' here",
+		}},
+		{"all stages", map[string]string{
+			"main.asm": "        .origin $8000\n        jmp lop\nloop:   lda.# (\n        .bytes 1\n",
+		}, nil, []string{
+			"ANALYZER ERROR (main.asm, 2, 13): Symbol 'lop' not defined\n    Hint: Did you mean 'loop'?",
+			"PARSER ERROR (main.asm, 3, 15): Expected number, got 'LEFT_PARENS'",
+			"LEXER ERROR (main.asm, 4, 9): Unknown directive '.bytes'\n    Hint: Did you mean '.byte'?",
+		}},
+	}
+
+	for _, test := range tests {
+		fsys := fstest.MapFS{}
+		for name, src := range test.files {
+			fsys[name] = &fstest.MapFile{Data: []byte(src)}
+		}
+
+		s := New("")
+		s.FS = fsys
+		r := s.Assemble("main.asm")
+
+		var got []string
+		for _, d := range r.Diagnostics {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.diags, "\n") {
+			t.Errorf("%s: got diagnostics %q, want %q", test.name, got, test.diags)
+		}
+		if !bytes.Equal(r.Code, test.code) {
+			t.Errorf("%s: got code % x, want % x", test.name, r.Code, test.code)
+		}
+	}
+}
+
+// Several sessions must be able to run at the same time without getting in
+// each other's way
+func TestConcurrentSessions(t *testing.T) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			s := New("65c02")
+			src := "        .origin $8000\n" + strings.Repeat("        nop\n", i) + "here:   jmp here\n"
+			s.Add("main.asm", strings.NewReader(src))
+
+			r := s.Assemble("main.asm")
+
+			want := append(bytes.Repeat([]byte{0xea}, i), 0x4c, byte(i), 0x80)
+			if !r.OK() || !bytes.Equal(r.Code, want) || r.Symbols["here"].Value != 0x8000+i {
+				t.Errorf("session %d: got % x %v, want % x", i, r.Code, r.Diagnostics, want)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// Diagnostics show the line of the source with carets under the problem
+func TestExcerpt(t *testing.T) {
+	s := New("65c02")
+	s.Add("main.asm", strings.NewReader("        .origin $8000\n\tlda.# $1234\n"))
+
+	r := s.Assemble("main.asm")
+	if len(r.Diagnostics) != 1 {
+		t.Fatalf("got diagnostics %v, want one", r.Diagnostics)
+	}
+
+	want := "ANALYZER ERROR (main.asm, 2, 2): Operand 4660 of 'lda.#' out of range (-128 to 255)\n" +
+		"    2 | \tlda.# $1234\n" +
+		"      | \t^^^^^^^^^^^"
+
+	if got := r.Diagnostics[0].Format(r.Source); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// Spans point back to the line of the source, also in included files, and
+// have the status of the 65816 from before the line, with the direct page and
+// data bank if we know them
+func TestSpans(t *testing.T) {
+	s := New("65816")
+	s.Add("main.asm", strings.NewReader("        .origin $8000\n        .native\n        .include \"sub.asm\"\n"))
+	s.Add("sub.asm", strings.NewReader("        rep $20\n        .dp $0300\n        lda.# $1234\n"))
+
+	r := s.Assemble("main.asm")
+	if !r.OK() {
+		t.Fatalf("got diagnostics %v", r.Diagnostics)
+	}
+
+	want := []string{
+		"{32768 2 main.asm 2 9 true true true 0 false 0 false}",
+		"{32770 2 sub.asm 1 9 true true false 0 false 0 false}",
+		"{32772 3 sub.asm 3 9 false true false 768 true 0 false}",
+	}
+
+	var got []string
+	for _, sp := range r.Machine.Spans {
+		got = append(got, fmt.Sprint(sp))
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got spans %q, want %q", got, want)
+	}
+}
+
+// The advisor only runs if asked, and a label keeps it from looking at two
+// instructions together
+func TestAdvise(t *testing.T) {
+
+	var tests = []struct {
+		name  string
+		mpu   string
+		src   string
+		diags []string
+	}{
+		{"zero page", "6502", "        .origin $8000\n        lda $0010\n        lda.x $0010\n", []string{
+			"ADVISOR NOTE (main.asm, 2, 9): Address $0010 is in the zero page, 'lda' can be 'lda.d'\n    Hint: Saves 1 byte(s) and 1 cycle(s)",
+		}},
+		{"tail call", "65c02", "        .origin $8000\n        jsr sub\n        rts\nsub:    jsr sub\nend:    rts\n", []string{
+			"ADVISOR NOTE (main.asm, 2, 9): Tail call: 'jsr' followed by 'rts' can be 'jmp'\n    Hint: Saves 1 byte(s) and 9 cycle(s)",
+		}},
+		{"stz", "65c02", "        .origin $8000\n        lda.# 0\n        sta.x $2000\n", []string{
+			"ADVISOR NOTE (main.asm, 2, 9): 'lda.# 0' and 'sta.x' can be 'stz.x' if A isn't needed afterwards\n    Hint: Saves 2 byte(s) and 2 cycle(s)",
+		}},
+		{"no stz on 6502", "6502", "        .origin $8000\n        lda.# 0\n        sta $2000\n", nil},
+		{"inc.a", "65c02", "        .origin $8000\n        clc\n        adc.# 1\n", []string{
+			"ADVISOR NOTE (main.asm, 2, 9): 'clc' and 'adc.# 1' can be 'inc.a' if the carry isn't needed afterwards\n    Hint: Saves 2 byte(s) and 2 cycle(s)",
+		}},
+		{"status", "65816", "        .origin $8000\n        .native\n        .a16\n        rep $20\n", []string{
+			"ADVISOR NOTE (main.asm, 4, 9): Registers already have the sizes 'rep' sets\n    Hint: Saves 2 byte(s) and 3 cycle(s)",
+		}},
+	}
+
+	for _, test := range tests {
+		s := New(test.mpu)
+		s.Advise = true
+		s.Add("main.asm", strings.NewReader(test.src))
+
+		r := s.Assemble("main.asm")
+
+		var got []string
+		for _, d := range r.Diagnostics {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.diags, "\n") {
+			t.Errorf("%s: got diagnostics %q, want %q", test.name, got, test.diags)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Convert command for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// "cthulhu convert" takes a source file in traditional WDC notation and
+// produces the same program in Simpler Assembler Notation (SAN). See the
+// converter package for details.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"cthulhu/converter"
+)
+
+// convert takes the command line arguments after "convert", converts the
+// input file and saves or prints the result
+func convert(args []string) {
+
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	cInput := fs.String("i", "", "Input file in WDC notation (REQUIRED)")
+	cOutput := fs.String("o", "", "Output file for SAN source (default: standard output)")
+	cMPU := fs.String("m", "65c02", "MPU type")
+	fs.Parse(args)
+
+	if *cMPU != "6502" && *cMPU != "65c02" && *cMPU != "65816" {
+		log.Fatalf("FATAL MPU '%s' not supported", *cMPU)
+	}
+	if *cInput == "" {
+		log.Fatal("FATAL No input file provided")
+	}
+
+	inputFile, err := os.Open(*cInput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inputFile.Close()
+
+	var ls []string
+
+	scanner := bufio.NewScanner(inputFile)
+	for scanner.Scan() {
+		ls = append(ls, scanner.Text())
+	}
+
+	out, errs, warns := converter.Converter(*cMPU, *cInput, ls)
+	s := strings.Join(out, "\n") + "\n"
+
+	if *cOutput == "" {
+		fmt.Print(s)
+	} else {
+		err := os.WriteFile(*cOutput, []byte(s), 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if warns != 0 {
+		fmt.Fprintf(os.Stderr, "CONVERTER: %d line(s) converted with assumptions\n", warns)
+	}
+
+	if errs != 0 {
+		log.Fatalf("CONVERTER FATAL: Found %d line(s) that could not be converted", errs)
+	}
+}
@@ -0,0 +1,1019 @@
+// Converter package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The converter takes source code in traditional WDC notation such as
+// "lda ($10),y" and turns it into Simpler Assembler Notation (SAN) such as
+// "lda.diy $10". It works line by line and does not use the lexer or parser,
+// because those only understand SAN. Comments, labels and empty lines are
+// kept. Lines that can't be converted are kept as comments, lines that can
+// only be converted by making an assumption (usually direct page versus
+// absolute addressing) are reported as warnings.
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"cthulhu/data"
+)
+
+const (
+	errTag = "CONVERTER"
+
+	indent1 = "        "
+	indent2 = indent1 + indent1
+)
+
+// Sizes of operands, used to pick between direct page, absolute and long
+// addressing modes
+const (
+	sizeUnknown = iota
+	sizeDirect
+	sizeAbsolute
+	sizeLong
+)
+
+// Shapes of operands in WDC notation. The SAN suffixes that can go with each
+// shape are listed in shapeSuffixes
+const (
+	shapeNone  = iota // "nop"
+	shapeAcc          // "asl a"
+	shapeImm          // "lda #$10"
+	shapePlain        // "lda $10"
+	shapeX            // "lda $10,x"
+	shapeY            // "lda $10,y"
+	shapeS            // "lda $10,s"
+	shapeInd          // "lda ($10)"
+	shapeIndX         // "lda ($10,x)"
+	shapeIndY         // "lda ($10),y"
+	shapeIndSY        // "lda ($10,s),y"
+	shapeIndL         // "lda [$10]"
+	shapeIndLY        // "lda [$10],y"
+	shapeTwo          // "mvp $01,$02"
+)
+
+// converter holds the state of a run of the converter
+type converter struct {
+	errCount  int
+	warnCount int
+
+	mpu      string
+	fileName string
+	lineNum  int
+
+	// Values of symbols that were defined with a constant. We use these to
+	// decide if an operand is direct page or absolute
+	symbols map[string]int
+
+	// Status of the 65816 as far as the assembler will know it from the
+	// converted code. Traditional assemblers don't track the emulation
+	// flag, so a "rep" in code that never switches to native mode needs
+	// hints to reassemble
+	emulated bool
+	carry    int      // -1 if we don't know, otherwise 0 or 1 for "xce"
+	after    []string // lines that go after the current one
+}
+
+var (
+	// Traditional directives and their SAN equivalents. Directives that
+	// need special treatment such as ".equ" are handled in convertDirective
+	directives = map[string]string{
+		".org": ".origin", "org": ".origin", "*": ".origin",
+		".byte": ".byte", ".byt": ".byte", ".db": ".byte", "db": ".byte",
+		"dc.b": ".byte", ".text": ".byte",
+		".word": ".word", ".dw": ".word", "dw": ".word", ".addr": ".word",
+		"dc.w":  ".word",
+		".long": ".long", ".faraddr": ".long", ".dl": ".long",
+		".asciiz": ".asciiz", ".null": ".asciiz",
+		".ptext": ".pstring", ".shift": ".hstring",
+		".res": ".skip", ".ds": ".skip", "ds": ".skip",
+		".fill": ".skip", ".align": ".align",
+		".include": ".include", "include": ".include",
+		".end": ".end", "end": ".end",
+		".scope": ".scope", ".endscope": ".scend",
+		".block": ".scope", ".bend": ".scend", ".endproc": ".scend",
+		".a8": ".!a8", ".a16": ".!a16", ".i8": ".!xy8", ".i16": ".!xy16",
+		".as": ".!a8", ".al": ".!a16", ".xs": ".!xy8", ".xl": ".!xy16",
+	}
+
+	// Directives that select the MPU
+	mpuDirectives = map[string]string{
+		".p02": "6502", ".pc02": "65c02", ".p816": "65816",
+	}
+
+	// The SAN suffixes we try for each shape and size, in order of
+	// preference
+	shapeSuffixes = map[int]map[int][]string{
+		shapePlain: {
+			sizeDirect:   {"d", "", "l"},
+			sizeAbsolute: {"", "l"},
+			sizeLong:     {"l"},
+			sizeUnknown:  {"", "l"},
+		},
+		shapeX: {
+			sizeDirect:   {"dx", "x", "lx"},
+			sizeAbsolute: {"x", "lx"},
+			sizeLong:     {"lx"},
+			sizeUnknown:  {"x", "lx"},
+		},
+		shapeY: {
+			sizeDirect:   {"dy", "y"},
+			sizeAbsolute: {"y"},
+			sizeLong:     {},
+			sizeUnknown:  {"y"},
+		},
+		shapeInd: {
+			sizeDirect:   {"di", "i"},
+			sizeAbsolute: {"i"},
+			sizeLong:     {},
+			sizeUnknown:  {"i", "di"},
+		},
+		shapeIndX: {
+			sizeDirect:   {"dxi", "xi"},
+			sizeAbsolute: {"xi"},
+			sizeLong:     {},
+			sizeUnknown:  {"xi", "dxi"},
+		},
+		shapeIndL: {
+			sizeDirect:   {"dil", "il"},
+			sizeAbsolute: {"il"},
+			sizeLong:     {},
+			sizeUnknown:  {"il", "dil"},
+		},
+	}
+
+	// Shapes that only have one possible suffix, no matter the size
+	fixedSuffixes = map[int]string{
+		shapeAcc:   "a",
+		shapeImm:   "#",
+		shapeS:     "s",
+		shapeIndY:  "diy",
+		shapeIndSY: "siy",
+		shapeIndLY: "dily",
+		shapeTwo:   "",
+		shapeNone:  "",
+	}
+
+	// Shapes with a fixed suffix whose operand is a single byte, a direct
+	// page address or an offset on the stack
+	byteShapes = map[int]bool{
+		shapeS: true, shapeIndY: true, shapeIndSY: true, shapeIndLY: true,
+	}
+
+	// Indirect addressing modes in WDC notation. The first group is the
+	// expression, the second one what comes after the closing paren or
+	// bracket. If parens is set, we have to make sure the closing paren
+	// belongs to the opening one
+	indirectModes = []struct {
+		re     *regexp.Regexp
+		shape  int
+		parens bool
+	}{
+		{regexp.MustCompile(`(?i)^\((.*),\s*s\s*\)(\s*,\s*y)$`), shapeIndSY, false},
+		{regexp.MustCompile(`(?i)^\((.*),\s*x\s*\)()$`), shapeIndX, false},
+		{regexp.MustCompile(`(?i)^\((.*)\)(\s*,\s*y)$`), shapeIndY, true},
+		{regexp.MustCompile(`(?i)^\((.*)\)()$`), shapeInd, true},
+		{regexp.MustCompile(`(?i)^\[(.*)\](\s*,\s*y)$`), shapeIndLY, false},
+		{regexp.MustCompile(`(?i)^\[(.*)\]()$`), shapeIndL, false},
+	}
+
+	// Suffixes that refer to the direct page. If we have to guess the size
+	// of an operand and one of these would have been possible, we warn the
+	// user
+	directSuffixes = map[string]string{
+		"": "d", "x": "dx", "y": "dy", "i": "di", "xi": "dxi", "il": "dil",
+	}
+)
+
+// result is a single converted line. Text can contain more than one line of
+// SAN source, for instance if a label had its own line
+type result struct {
+	Text string
+	OK   bool
+}
+
+// reportErr takes a string and prints an error report for the current line to
+// the standard error output
+func (cv *converter) reportErr(s string) {
+	fmt.Fprintf(os.Stderr, "%s ERROR (%s, %d): %s\n",
+		errTag, cv.fileName, cv.lineNum, s)
+	cv.errCount++
+}
+
+// reportWarn takes a string and prints a warning for the current line to the
+// standard error output. Warnings are used for lines we converted, but had to
+// make an assumption for
+func (cv *converter) reportWarn(s string) {
+	fmt.Fprintf(os.Stderr, "%s WARNING (%s, %d): %s\n",
+		errTag, cv.fileName, cv.lineNum, s)
+	cv.warnCount++
+}
+
+// Converter takes the MPU type, the name of the file and the lines of source
+// code in traditional WDC notation. It returns the lines converted to SAN and
+// the number of errors and warnings
+func Converter(m string, fn string, ls []string) ([]string, int, int) {
+
+	var out []string
+
+	cv := &converter{mpu: m, fileName: fn, symbols: map[string]int{},
+		emulated: true, carry: -1}
+
+	// FIRST PASS: Collect the values of all symbols that are defined as
+	// constants so we can figure out the size of operands that use them
+	for _, l := range ls {
+		code, _ := splitComment(l)
+		name, value, ok := splitAssignment(code)
+		if !ok {
+			continue
+		}
+
+		v, ok := constValue(value)
+		if ok {
+			cv.symbols[name] = v
+		}
+	}
+
+	// SECOND PASS: Convert line by line
+	for i, l := range ls {
+		cv.lineNum = i + 1
+		r := cv.convertLine(l)
+
+		if !r.OK {
+			out = append(out, "; CONVERT: "+strings.TrimSpace(l))
+			continue
+		}
+
+		out = append(out, r.Text)
+	}
+
+	return out, cv.errCount, cv.warnCount
+}
+
+// convertLine takes one line of traditional source code and returns the SAN
+// version
+func (cv *converter) convertLine(l string) result {
+
+	if len(strings.TrimSpace(l)) == 0 {
+		return result{Text: "", OK: true}
+	}
+
+	code, comment := splitComment(l)
+
+	// Whole-line comments are kept just the way they are
+	if len(strings.TrimSpace(code)) == 0 {
+		return result{Text: strings.TrimRightFunc(l, unicode.IsSpace), OK: true}
+	}
+
+	var lines []string
+
+	// Assignments such as "size = 4" or "size equ 4" become ".equ"
+	name, value, ok := splitAssignment(code)
+	if ok {
+		if !cv.checkSymbol(name) {
+			return result{OK: false}
+		}
+
+		v, ok := cv.convertExpr(value)
+		if !ok {
+			return result{OK: false}
+		}
+
+		return result{Text: addComment(indent1+".equ "+name+" "+v, comment), OK: true}
+	}
+
+	// If the line doesn't start with whitespace, the first word is a
+	// label, unless it is a mnemonic or directive that the author didn't
+	// bother to indent
+	label, rest := cv.splitLabel(code)
+
+	if label != "" {
+		if !cv.checkSymbol(label) {
+			return result{OK: false}
+		}
+
+		lines = append(lines, label+":")
+	}
+
+	rest = strings.TrimSpace(rest)
+
+	if rest == "" {
+		if comment != "" {
+			lines = append(lines, indent2+comment)
+		}
+		return result{Text: strings.Join(lines, "\n"), OK: true}
+	}
+
+	var s string
+
+	w, _ := splitWord(rest)
+	lw := strings.ToLower(w)
+
+	if strings.HasPrefix(lw, ".") || strings.HasPrefix(lw, "*") || isDirective(lw) {
+		s, ok = cv.convertDirective(rest)
+	} else {
+		s, ok = cv.convertInstruction(rest)
+	}
+
+	if !ok {
+		return result{OK: false}
+	}
+
+	lines = append(lines, addComment(s, comment))
+	lines = append(lines, cv.after...)
+	cv.after = nil
+
+	return result{Text: strings.Join(lines, "\n"), OK: true}
+}
+
+// addComment takes a line of code and an in-line comment and combines them
+// with a single space
+func addComment(s, c string) string {
+	if c == "" {
+		return s
+	}
+	return s + " " + c
+}
+
+// isDirective takes a lowercase word and returns true if it is one of the
+// directives that don't start with a period such as "org" or "db"
+func isDirective(w string) bool {
+	_, ok := directives[w]
+	return ok
+}
+
+// isMnemonic takes a lowercase word and returns true if it is a WDC mnemonic
+// for the current MPU
+func (cv *converter) isMnemonic(w string) bool {
+	for _, oc := range data.OpcodesSAN[cv.mpu] {
+		if oc.WDC == w {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSymbol takes the name of a label or symbol and makes sure it is legal
+// in SAN, reporting an error if not. Names starting with an underscore are
+// local labels in SAN, so we warn about them
+func (cv *converter) checkSymbol(s string) bool {
+	rs := []rune(s)
+
+	if len(rs) == 0 {
+		cv.reportErr("Empty symbol name")
+		return false
+	}
+
+	if rs[0] == '_' {
+		cv.reportWarn(fmt.Sprintf("Symbol '%s' will be a local label in SAN", s))
+	} else if !unicode.IsLetter(rs[0]) {
+		cv.reportErr(fmt.Sprintf("Symbol '%s' must start with a letter in SAN", s))
+		return false
+	}
+
+	for _, r := range rs {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) &&
+			!strings.ContainsRune("?_!&'~#|.=^", r) {
+			cv.reportErr(fmt.Sprintf("Symbol '%s' contains illegal character '%c'", s, r))
+			return false
+		}
+	}
+
+	_, ok := data.OpcodesSAN[cv.mpu][s]
+	if ok {
+		cv.reportErr(fmt.Sprintf("Symbol '%s' is a SAN mnemonic", s))
+		return false
+	}
+
+	return true
+}
+
+// splitComment takes a line and returns the code and the comment (including
+// the semicolon) as separate strings. Semicolons in strings and character
+// constants don't count
+func splitComment(l string) (string, string) {
+	var quote rune
+
+	for i, r := range l {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ';':
+			return l[:i], strings.TrimSpace(l[i:])
+		}
+	}
+
+	return l, ""
+}
+
+// splitWord takes a string and returns the first word and the rest of the
+// string without leading whitespace
+func splitWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i == -1 {
+		return s, ""
+	}
+
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// splitLabel takes the code part of a line and returns the label, if there is
+// one, and the rest of the line
+func (cv *converter) splitLabel(code string) (string, string) {
+
+	// A label can always be recognized by its colon
+	w, rest := splitWord(code)
+	if strings.HasSuffix(w, ":") {
+		return strings.TrimSuffix(w, ":"), rest
+	}
+
+	// Without a colon, labels must start in the first column
+	if len(code) == 0 || unicode.IsSpace(rune(code[0])) {
+		return "", code
+	}
+
+	lw := strings.ToLower(w)
+	if strings.HasPrefix(lw, ".") || isDirective(lw) || cv.isMnemonic(lw) ||
+		cv.isMnemonic(strings.SplitN(lw, ".", 2)[0]) {
+		return "", code
+	}
+
+	return w, rest
+}
+
+// splitAssignment takes the code part of a line and checks if it assigns a
+// value to a symbol, such as "size = 4", "size equ 4" or ".equ size 4".
+// Returns the name, the value string and a flag for success
+func splitAssignment(code string) (string, string, bool) {
+
+	w1, rest := splitWord(code)
+	lw1 := strings.ToLower(w1)
+
+	if lw1 == ".equ" || lw1 == ".set" || lw1 == ".define" {
+		name, value := splitWord(rest)
+		return name, value, name != "" && value != ""
+	}
+
+	// "name=4" doesn't need whitespace
+	for _, op := range []string{":=", "="} {
+		i := strings.Index(code, op)
+		if i > 0 {
+			name := strings.TrimSpace(code[:i])
+			value := strings.TrimSpace(code[i+len(op):])
+
+			if name != "" && name != "*" && value != "" &&
+				!strings.ContainsAny(name, " \t") {
+				return strings.TrimSuffix(name, ":"), value, true
+			}
+		}
+	}
+
+	w2, value := splitWord(rest)
+	lw2 := strings.ToLower(w2)
+
+	if lw2 == "equ" || lw2 == ".equ" || lw2 == ".set" {
+		return strings.TrimSuffix(w1, ":"), value, value != ""
+	}
+
+	return "", "", false
+}
+
+// convertDirective takes a directive with its parameters and returns the SAN
+// version
+func (cv *converter) convertDirective(s string) (string, bool) {
+	w, para := splitWord(s)
+	lw := strings.ToLower(w)
+
+	// "*=$8000" is the traditional way to set the origin
+	if strings.HasPrefix(s, "*") {
+		para = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s[1:]), "="))
+		lw = "*"
+	}
+
+	// ca65 procedures are labels with their own scope
+	if lw == ".proc" {
+		if !cv.checkSymbol(para) {
+			return "", false
+		}
+		return para + ":\n" + indent1 + ".scope", true
+	}
+
+	// Later mnemonics are checked against the new MPU
+	m, ok := mpuDirectives[lw]
+	if ok {
+		cv.mpu = m
+		return indent1 + ".mpu \"" + m + "\"", true
+	}
+
+	if lw == ".setcpu" || lw == ".cpu" {
+		m := strings.ToLower(strings.Trim(para, "\""))
+		if m != "6502" && m != "65c02" && m != "65816" {
+			cv.reportErr(fmt.Sprintf("MPU '%s' not supported", para))
+			return "", false
+		}
+		cv.mpu = m
+		return indent1 + ".mpu \"" + m + "\"", true
+	}
+
+	sd, ok := directives[lw]
+	if !ok {
+		cv.reportErr(fmt.Sprintf("Unknown directive '%s'", w))
+		return "", false
+	}
+
+	switch sd {
+
+	// Directives without parameters. The assembler only allows 16 bit
+	// registers in native mode
+	case ".!a16", ".!xy16":
+		if cv.mpu == "65816" && cv.emulated {
+			cv.emulated = false
+			return indent1 + ".!native\n" + indent1 + sd, true
+		}
+		return indent1 + sd, true
+
+	case ".end", ".scope", ".scend", ".!a8", ".!xy8":
+		return indent1 + sd, true
+
+	case ".include":
+		return indent1 + sd + " \"" + strings.Trim(para, "\"") + "\"", true
+
+	// Data directives take a list of expressions, some of which might be
+	// strings. So do the ones that reserve space, for their fill pattern
+	case ".byte", ".word", ".long", ".asciiz", ".pstring", ".hstring",
+		".skip", ".align":
+		var ps []string
+
+		for _, p := range splitList(para) {
+			p = strings.TrimSpace(p)
+
+			if strings.HasPrefix(p, "\"") {
+				ps = append(ps, sanString(strings.TrimSuffix(p[1:], "\"")))
+				continue
+			}
+
+			v, ok := cv.convertExpr(p)
+			if !ok {
+				return "", false
+			}
+			ps = append(ps, v)
+		}
+
+		return indent1 + sd + " " + strings.Join(ps, ", "), true
+	}
+
+	// Everything else takes a single expression
+	v, ok := cv.convertExpr(para)
+	if !ok {
+		return "", false
+	}
+
+	return indent1 + sd + " " + v, true
+}
+
+// sanString takes the text of a string in WDC notation and returns it as a
+// SAN string. WDC strings have no escapes, so backslashes and quotes are
+// escaped for SAN
+func sanString(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + s + "\""
+}
+
+// splitList takes a string and splits it at the commas that are not part of a
+// string or a character constant
+func splitList(s string) []string {
+	var ps []string
+	var quote rune
+	var depth int
+
+	start := 0
+
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			depth--
+		case r == ',' && depth == 0:
+			ps = append(ps, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(ps, s[start:])
+}
+
+// convertInstruction takes a mnemonic in WDC notation with its operand and
+// returns the instruction in SAN
+func (cv *converter) convertInstruction(s string) (string, bool) {
+	w, operand := splitWord(s)
+	mn := strings.ToLower(w)
+
+	// Some assemblers let the user force the size of the operand with a
+	// suffix to the mnemonic such as "lda.l"
+	size := sizeUnknown
+
+	if i := strings.Index(mn, "."); i != -1 {
+		switch mn[i+1:] {
+		case "b", "z":
+			size = sizeDirect
+		case "w", "a":
+			size = sizeAbsolute
+		case "l", "f":
+			size = sizeLong
+		default:
+			cv.reportErr(fmt.Sprintf("Unknown mnemonic suffix in '%s'", w))
+			return "", false
+		}
+		mn = mn[:i]
+	}
+
+	shape, exprs, forced, ok := cv.parseOperand(operand)
+	if !ok {
+		return "", false
+	}
+
+	if forced != sizeUnknown {
+		size = forced
+	}
+
+	// The immediate marker is part of the mnemonic in SAN, so we don't
+	// need it for the operands of the move instructions
+	if shape == shapeTwo {
+		for i := range exprs {
+			exprs[i] = strings.TrimPrefix(strings.TrimSpace(exprs[i]), "#")
+		}
+	}
+
+	var ns []*exprNode
+
+	for _, e := range exprs {
+		n, ok := cv.parseExpr(e)
+		if !ok {
+			return "", false
+		}
+		ns = append(ns, n)
+	}
+
+	if size == sizeUnknown && len(ns) > 0 {
+		size = cv.exprSize(exprs[0], ns[0])
+	}
+
+	oc, ok := cv.findOpcode(mn, shape, size)
+	if !ok {
+		return "", false
+	}
+
+	if cv.mpu == "65816" {
+		cv.trackStatus(oc, ns)
+	}
+
+	// Only the 65816 has 16 bit registers
+	if shape == shapeImm && cv.mpu != "65816" {
+		v, ok := cv.knownValue(ns[0])
+		if ok && (v > 0xff || v < -0x80) {
+			cv.reportErr(fmt.Sprintf("Immediate operand of '%s' is larger than a byte on MPU %s",
+				mn, cv.mpu))
+			return "", false
+		}
+	}
+
+	// SAN requires a signature byte for brk
+	if oc.SAN == "brk" && len(ns) == 0 {
+		cv.reportWarn("Added signature byte 0 to brk")
+		ns = []*exprNode{{text: "0"}}
+	}
+
+	var ops []string
+
+	for _, n := range ns {
+		ops = append(ops, sanExpr(n))
+	}
+
+	if len(ops) == 0 {
+		return indent2 + oc.SAN, true
+	}
+
+	return indent2 + oc.SAN + " " + strings.Join(ops, ", "), true
+}
+
+// trackStatus takes the opcode of an instruction for the 65816 and its
+// operands, and follows the emulation flag the way the assembler does. If a
+// "rep" makes registers 16 bit in code the assembler thinks is in emulated
+// mode, we add hints for the new sizes after it
+func (cv *converter) trackStatus(oc data.Opcode, ns []*exprNode) {
+
+	switch oc.SAN {
+
+	case "clc":
+		cv.carry = 0
+		return
+
+	case "sec":
+		cv.carry = 1
+		return
+
+	case "xce":
+		switch cv.carry {
+		case 0:
+			cv.emulated = false
+		case 1:
+			cv.emulated = true
+		}
+
+	case "rep":
+		if !cv.emulated {
+			break
+		}
+
+		v, ok := cv.knownValue(ns[0])
+		if !ok {
+			cv.reportWarn("Can't tell which registers 'rep' makes 16 bit")
+			break
+		}
+
+		hint := map[int]string{0x20: ".!a16", 0x10: ".!xy16", 0x30: ".!axy16"}[v&0x30]
+		if hint == "" {
+			break
+		}
+
+		cv.reportWarn("Assumed native mode for 'rep'")
+		cv.after = append(cv.after, indent1+".!native", indent1+hint)
+		cv.emulated = false
+	}
+
+	cv.carry = -1
+}
+
+// parseOperand takes an operand in WDC notation and returns its shape, the
+// expressions it contains, the size if it was forced by a prefix such as "z:"
+// or "@w", and a flag for success
+func (cv *converter) parseOperand(s string) (int, []string, int, bool) {
+	s = strings.TrimSpace(s)
+	size := sizeUnknown
+
+	if s == "" {
+		return shapeNone, nil, size, true
+	}
+
+	if strings.ToLower(s) == "a" {
+		return shapeAcc, nil, size, true
+	}
+
+	if strings.HasPrefix(s, "#") {
+		// The move instructions are sometimes written as "mvn #1,#2"
+		ps := splitList(s)
+		if len(ps) == 2 {
+			return shapeTwo, ps, size, true
+		}
+		return shapeImm, []string{s[1:]}, size, true
+	}
+
+	// Size prefixes from ca65 ("z:", "a:", "f:") and 64tass ("@b", "@w",
+	// "@l")
+	for p, sz := range map[string]int{
+		"z:": sizeDirect, "a:": sizeAbsolute, "f:": sizeLong,
+		"@b": sizeDirect, "@w": sizeAbsolute, "@l": sizeLong,
+	} {
+		if strings.HasPrefix(strings.ToLower(s), p) {
+			size = sz
+			s = strings.TrimSpace(s[len(p):])
+			break
+		}
+	}
+
+	// Indirect modes. We have to make sure that the parens belong to the
+	// addressing mode and are not part of the expression such as in
+	// "(1+2)*3"
+	for _, im := range indirectModes {
+		ms := im.re.FindStringSubmatch(s)
+		if ms == nil {
+			continue
+		}
+
+		if im.parens && !closes(s, len(ms[0])-len(ms[2])-1) {
+			continue
+		}
+
+		return im.shape, []string{strings.TrimSpace(ms[1])}, size, true
+	}
+
+	ps := splitList(s)
+
+	switch len(ps) {
+	case 1:
+		return shapePlain, ps, size, true
+
+	case 2:
+		switch strings.ToLower(strings.TrimSpace(ps[1])) {
+		case "x":
+			return shapeX, ps[:1], size, true
+		case "y":
+			return shapeY, ps[:1], size, true
+		case "s":
+			return shapeS, ps[:1], size, true
+		}
+
+		return shapeTwo, ps, size, true
+	}
+
+	cv.reportErr(fmt.Sprintf("Can't figure out addressing mode of operand '%s'", s))
+	return 0, nil, size, false
+}
+
+// closes takes an operand that starts with a paren and the index of a
+// closing paren, and returns true if that paren closes the first one
+func closes(s string, i int) bool {
+	var quote rune
+	depth := 0
+
+	for j, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				return j == i
+			}
+		}
+	}
+	return false
+}
+
+// findOpcode takes a lowercase WDC mnemonic, the shape and the size of the
+// operand and returns the matching SAN opcode for the current MPU
+func (cv *converter) findOpcode(mn string, shape int, size int) (data.Opcode, bool) {
+
+	// family contains the opcodes with this WDC mnemonic, aliases those
+	// where the SAN mnemonic starts with the same word, such as "jmp.l"
+	// for "jmp" (WDC "jml")
+	family := map[string]data.Opcode{}
+	aliases := map[string]data.Opcode{}
+
+	for _, oc := range data.OpcodesSAN[cv.mpu] {
+		ws := strings.SplitN(oc.SAN, ".", 2)
+
+		suffix := ""
+		if len(ws) == 2 {
+			suffix = ws[1]
+		}
+
+		if oc.WDC == mn {
+			family[suffix] = oc
+		}
+
+		if ws[0] == mn {
+			aliases[suffix] = oc
+		}
+	}
+
+	if len(family) == 0 && len(aliases) == 0 {
+		cv.reportErr(fmt.Sprintf("Unknown mnemonic '%s' for MPU %s", mn, cv.mpu))
+		return data.Opcode{}, false
+	}
+
+	// Instructions such as branches and "pea" only have one form, so we
+	// don't care about the shape of the operand
+	if len(family) == 1 {
+		for _, oc := range family {
+			return oc, true
+		}
+	}
+
+	var candidates []string
+
+	suffix, ok := fixedSuffixes[shape]
+	if ok {
+		// We can't guess the byte of a direct page mode from an
+		// operand that is larger
+		if byteShapes[shape] && (size == sizeAbsolute || size == sizeLong) {
+			cv.reportErr(fmt.Sprintf("Operand of '%s' is larger than a byte, but the addressing mode needs one", mn))
+			return data.Opcode{}, false
+		}
+
+		candidates = []string{suffix}
+
+		// "asl" is the same as "asl a"
+		if shape == shapeNone {
+			candidates = append(candidates, "a")
+		}
+	} else {
+		candidates = shapeSuffixes[shape][size]
+	}
+
+	for _, fs := range []map[string]data.Opcode{family, aliases} {
+		for _, c := range candidates {
+			oc, ok := fs[c]
+			if !ok {
+				continue
+			}
+
+			// An empty suffix is also used for opcodes without
+			// operands, which we don't want for "lda label"
+			noOperand := shape == shapeNone || shape == shapeAcc
+			if noOperand != (oc.Operands == 0) {
+				continue
+			}
+
+			if size == sizeUnknown {
+				d, ok := directSuffixes[c]
+				if ok {
+					_, ok = fs[d]
+				}
+				if ok {
+					cv.reportWarn(fmt.Sprintf("Size of operand unknown, assumed absolute for '%s'",
+						oc.SAN))
+				}
+			}
+
+			return oc, true
+		}
+	}
+
+	cv.reportErr(fmt.Sprintf("No addressing mode for '%s' with this operand on MPU %s", mn, cv.mpu))
+	return data.Opcode{}, false
+}
+
+// exprSize takes an expression in traditional notation and its tree, and tries
+// to figure out if it is direct page, absolute or long. Hex numbers count by
+// number of digits, so "$0012" is absolute
+func (cv *converter) exprSize(s string, n *exprNode) int {
+	s = strings.TrimSpace(s)
+
+	// The traditional modifiers for the low, high, and bank byte always
+	// return a single byte
+	if strings.HasPrefix(s, "<") || strings.HasPrefix(s, ">") ||
+		strings.HasPrefix(s, "^") {
+		return sizeDirect
+	}
+
+	if strings.HasPrefix(s, "$") || strings.HasPrefix(strings.ToLower(s), "0x") {
+		ds := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x")
+		ds = strings.Replace(strings.Replace(ds, ":", "", -1), ".", "", -1)
+
+		_, err := strconv.ParseUint(ds, 16, 32)
+		if err == nil {
+			switch {
+			case len(ds) <= 2:
+				return sizeDirect
+			case len(ds) <= 4:
+				return sizeAbsolute
+			default:
+				return sizeLong
+			}
+		}
+	}
+
+	v, ok := cv.knownValue(n)
+	if !ok {
+		return sizeUnknown
+	}
+
+	switch {
+	case v < 0x100:
+		return sizeDirect
+	case v < 0x10000:
+		return sizeAbsolute
+	default:
+		return sizeLong
+	}
+}
+
+// constValue takes a number in traditional notation and returns its value
+// and a flag to signal if it was in fact a number
+func constValue(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+
+	n, ok := parseNumber(s)
+	if !ok {
+		return 0, false
+	}
+
+	return n.value, true
+}
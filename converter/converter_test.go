@@ -0,0 +1,210 @@
+// Test file for converter, part of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertInstruction(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"nop", "nop"},
+		{"asl", "asl.a"},
+		{"asl a", "asl.a"},
+		{"lda #$12", "lda.# $12"},
+		{"lda $12", "lda.d $12"},
+		{"lda $1234", "lda $1234"},
+		{"lda $0012", "lda $0012"},
+		{"lda $123456", "lda.l $123456"},
+		{"lda $12,x", "lda.dx $12"},
+		{"lda $1234,x", "lda.x $1234"},
+		{"lda $12,y", "lda.y $12"}, // no direct page y mode for lda
+		{"ldx $12,y", "ldx.dy $12"},
+		{"lda ($10),y", "lda.diy $10"},
+		{"lda ( $10 ) , y", "lda.diy $10"},
+		{"lda ($10,x)", "lda.dxi $10"},
+		{"lda ($10)", "lda.di $10"},
+		{"lda [$10]", "lda.dil $10"},
+		{"lda [$10],y", "lda.dily $10"},
+		{"lda 3,s", "lda.s 3"},
+		{"lda (3,s),y", "lda.siy 3"},
+		{"lda ($10+1)*2", "lda.d {$10 1 +} * 2"},
+		{"jmp ($1234)", "jmp.i $1234"},
+		{"jmp ($1234,x)", "jmp.xi $1234"},
+		{"jmp [$1234]", "jmp.il $1234"},
+		{"jml [$1234]", "jmp.il $1234"},
+		{"jmp $123456", "jmp.l $123456"},
+		{"jsl $123456", "jsr.l $123456"},
+		{"rtl", "rts.l"},
+		{"brl $8000", "bra.l $8000"},
+		{"bcc $8000", "bcc $8000"},
+		{"pea $1234", "phe.# $1234"},
+		{"pei ($12)", "phe.d $12"},
+		{"mvn #$01,#$02", "mvn $01, $02"},
+		{"lda z:$1234", "lda.d $1234"},
+		{"lda a:$12", "lda $12"},
+		{"lda.l $12", "lda.l $12"},
+		{"lda #<label", "lda.# .lsb label"},
+		{"lda #>(label+1)", "lda.# .msb {label 1 +}"},
+		{"lda #^label", "lda.# .bank label"},
+		{"lda #'a'", "lda.# \"a\""},
+		{"lda #$ff&$0f", "lda.# $ff .and $0f"},
+		{"lda #1<<4", "lda.# 1 .lshift 4"},
+		{"lda #0x12", "lda.# $12"},
+		{"jmp *", "jmp .here"},
+		{"jmp *+3", "jmp .here + 3"},
+	}
+
+	cv := &converter{mpu: "65816", symbols: map[string]int{}}
+
+	for _, test := range tests {
+		got, ok := cv.convertInstruction(test.input)
+		got = strings.TrimSpace(got)
+		if !ok || got != test.want {
+			t.Errorf("convertInstruction(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestConvertLine(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"; just a comment", "; just a comment"},
+		{"loop:", "loop:"},
+		{"loop    dex", "loop:\n" + indent2 + "dex"},
+		{"loop:   dex ; count", "loop:\n" + indent2 + "dex ; count"},
+		{"        dex", indent2 + "dex"},
+		{"size = 4", indent1 + ".equ size 4"},
+		{"size equ 4", indent1 + ".equ size 4"},
+		{"        .org $8000", indent1 + ".origin $8000"},
+		{"        *=$8000", indent1 + ".origin $8000"},
+		{"        .byte 1, \"a;b\", <x ; data", indent1 + ".byte 1, \"a;b\", .lsb x ; data"},
+		{"        .null \"C:\\\"", indent1 + ".asciiz \"C:\\\\\""},
+		{"        .a16", indent1 + ".!a16"},
+		{"        .p816", indent1 + ".mpu \"65816\""},
+	}
+
+	cv := &converter{mpu: "65816", symbols: map[string]int{}}
+
+	for _, test := range tests {
+		got := cv.convertLine(test.input)
+		if !got.OK || got.Text != test.want {
+			t.Errorf("convertLine(%q) = %q, want %q", test.input, got.Text, test.want)
+		}
+	}
+}
+
+func TestConvertFailures(t *testing.T) {
+	var tests = []string{
+		"bogus $12",
+		"lda #1 % 2",
+		"lda ($12,y)",
+		"@cheap: rts",
+		"lda ($1234),y",
+		"lda [$1234],y",
+		"lda $1234,s",
+		"lda ($1234,s),y",
+	}
+
+	cv := &converter{mpu: "65816", symbols: map[string]int{}}
+
+	for _, test := range tests {
+		got := cv.convertLine(test)
+		if got.OK {
+			t.Errorf("convertLine(%q) = %q, want failure", test, got.Text)
+		}
+	}
+}
+
+// Operands defined as constants decide the size, and the MPU directives change
+// the mnemonics we accept
+func TestConverter(t *testing.T) {
+	var tests = []struct {
+		mpu    string
+		lines  []string
+		errors int
+	}{
+		{"65c02", []string{"ptr = $20", "        lda (ptr),y"}, 0},
+		{"65c02", []string{"ptr = $2000", "        lda (ptr),y"}, 1},
+		{"6502", []string{"        .p816", "        xba"}, 0},
+		{"65816", []string{"        .setcpu \"6502\"", "        xba"}, 1},
+		{"65c02", []string{"        lda #$1234"}, 1},
+		{"65c02", []string{"size = 300", "        ldx #size"}, 1},
+		{"65c02", []string{"        lda #$0012"}, 0},
+		{"65816", []string{"        lda #$1234"}, 0},
+	}
+
+	for _, test := range tests {
+		_, errs, _ := Converter(test.mpu, "test.s", test.lines)
+		if errs != test.errors {
+			t.Errorf("%q: got %d error(s), want %d", test.lines, errs, test.errors)
+		}
+	}
+}
+
+// The assembler only makes registers 16 bit in native mode, so code that uses
+// "rep" without switching to it needs hints to reassemble
+func TestConvertStatus(t *testing.T) {
+	var tests = []struct {
+		lines []string
+		want  []string
+	}{
+		{[]string{"        rep #$30", "        lda #$1234"},
+			[]string{indent2 + "rep $30", indent1 + ".!native", indent1 + ".!axy16",
+				indent2 + "lda.# $1234"}},
+		{[]string{"        rep #$10 ; index", "        rep #$20"},
+			[]string{indent2 + "rep $10 ; index", indent1 + ".!native", indent1 + ".!xy16",
+				indent2 + "rep $20"}},
+		{[]string{"        clc", "        xce", "        rep #$20"},
+			[]string{indent2 + "clc", indent2 + "xce", indent2 + "rep $20"}},
+		{[]string{"        sep #$30"},
+			[]string{indent2 + "sep $30"}},
+		{[]string{"        .a16", "        .i16"},
+			[]string{indent1 + ".!native", indent1 + ".!a16", indent1 + ".!xy16"}},
+	}
+
+	for _, test := range tests {
+		out, errs, _ := Converter("65816", "test.s", test.lines)
+		got := strings.Join(out, "\n")
+		want := strings.Join(test.want, "\n")
+		if errs != 0 || got != want {
+			t.Errorf("%q: got %q, want %q", test.lines, got, want)
+		}
+	}
+}
+
+// Expressions with symbols defined as constants are evaluated to decide the
+// size of the operand
+func TestConvertConstants(t *testing.T) {
+	var tests = []struct {
+		lines []string
+		want  []string
+	}{
+		{[]string{"ptr = $FC", "        stx ptr+1"},
+			[]string{indent1 + ".equ ptr $FC", indent2 + "stx.d ptr + 1"}},
+		{[]string{"ptr = $FC", "        stx ptr+4"},
+			[]string{indent1 + ".equ ptr $FC", indent2 + "stx ptr + 4"}},
+		{[]string{"ptr = $FC", "        lda (ptr+2),y"},
+			[]string{indent1 + ".equ ptr $FC", indent2 + "lda.diy ptr + 2"}},
+		{[]string{"base = $1000", "        lda <(base+$34),x"},
+			[]string{indent1 + ".equ base $1000", indent2 + "lda.dx .lsb {base $34 +}"}},
+	}
+
+	for _, test := range tests {
+		out, errs, warns := Converter("65c02", "test.s", test.lines)
+		got := strings.Join(out, "\n")
+		want := strings.Join(test.want, "\n")
+		if errs != 0 || warns != 0 || got != want {
+			t.Errorf("%q: got %q, want %q", test.lines, got, want)
+		}
+	}
+}
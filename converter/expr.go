@@ -0,0 +1,497 @@
+// Expression conversion for the Cthulhu Assembler converter
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Traditional assemblers use infix math with operators such as "<" for the
+// low byte and "+" in any combination. SAN only allows a single unary or
+// binary operator outside of Reverse Polish Notation (RPN) terms, so anything
+// more complicated is converted to RPN inside curly braces.
+
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Types of the tokens in a traditional expression
+const (
+	tkNumber = iota
+	tkSymbol
+	tkHere
+	tkOperator
+	tkLParens
+	tkRParens
+)
+
+type exprToken struct {
+	kind  int
+	text  string // SAN version of the token
+	value int    // for numbers
+}
+
+// exprNode is a node in the tree we build from the expression. Leaves have no
+// kids and a SAN text, operators have one or two kids
+type exprNode struct {
+	op    string
+	kind  int // of the token for leaves
+	text  string
+	value int
+	kids  []*exprNode
+}
+
+var (
+	// SAN versions of the traditional binary operators
+	binaryOps = map[string]string{
+		"+": "+", "-": "-", "*": "*", "/": "/",
+		"&": ".and", "|": ".or", "^": ".xor",
+		"<<": ".lshift", ">>": ".rshift",
+	}
+
+	// SAN versions of the traditional unary operators. Unary minus and
+	// plus are handled separately
+	unaryOps = map[string]string{
+		"<": ".lsb", ">": ".msb", "^": ".bank", "~": ".invert",
+	}
+
+	// Binding power of the binary operators, higher binds tighter
+	precedence = map[string]int{
+		"|": 1, "^": 2, "&": 3, "<<": 4, ">>": 4,
+		"+": 5, "-": 5, "*": 6, "/": 6,
+	}
+)
+
+// parseNumber takes a string that starts with a number in traditional notation
+// and returns a token with the SAN version and the value, as well as a flag
+// for success. The whole string must be the number
+func parseNumber(s string) (exprToken, bool) {
+	var base int
+	var ds, prefix string
+
+	ls := strings.ToLower(s)
+
+	switch {
+	case strings.HasPrefix(ls, "$"):
+		base, ds, prefix = 16, s[1:], "$"
+	case strings.HasPrefix(ls, "0x"):
+		base, ds, prefix = 16, s[2:], "$"
+	case strings.HasPrefix(ls, "%"):
+		base, ds, prefix = 2, s[1:], "%"
+	case strings.HasPrefix(ls, "0b") && len(ls) > 2:
+		base, ds, prefix = 2, s[2:], "%"
+	case len(ls) > 1 && strings.HasSuffix(ls, "h") && unicode.IsDigit(rune(ls[0])):
+		base, ds, prefix = 16, s[:len(s)-1], "$"
+	default:
+		base, ds, prefix = 10, s, ""
+	}
+
+	if ds == "" {
+		return exprToken{}, false
+	}
+
+	v, err := strconv.ParseInt(ds, base, 64)
+	if err != nil {
+		return exprToken{}, false
+	}
+
+	return exprToken{kind: tkNumber, text: prefix + ds, value: int(v)}, true
+}
+
+// tokenize takes a traditional expression and splits it into tokens
+func (cv *converter) tokenize(s string) ([]exprToken, bool) {
+	var ts []exprToken
+
+	rs := []rune(s)
+
+	// operand is true if the next token is expected to be an operand, which
+	// is how we tell "*" as the current address from "*" for multiply
+	operand := true
+
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+
+		switch {
+
+		case unicode.IsSpace(r):
+			continue
+
+		case r == '(':
+			ts = append(ts, exprToken{kind: tkLParens, text: "("})
+			operand = true
+
+		case r == ')':
+			ts = append(ts, exprToken{kind: tkRParens, text: ")"})
+			operand = false
+
+		case r == '*' && operand:
+			ts = append(ts, exprToken{kind: tkHere, text: ".here"})
+			operand = false
+
+		// Character constants become single-character SAN strings
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != r {
+				j++
+			}
+
+			if j >= len(rs) || j-i != 2 {
+				cv.reportErr(fmt.Sprintf("Can't convert character constant in '%s'", s))
+				return nil, false
+			}
+
+			ts = append(ts, exprToken{kind: tkNumber, text: sanString(string(rs[i+1])),
+				value: int(rs[i+1])})
+			i = j
+			operand = false
+
+		case r == '<' || r == '>':
+			if i+1 < len(rs) && rs[i+1] == r {
+				ts = append(ts, exprToken{kind: tkOperator, text: string(r) + string(r)})
+				i++
+			} else {
+				ts = append(ts, exprToken{kind: tkOperator, text: string(r)})
+			}
+			operand = true
+
+		case strings.ContainsRune("+-*/&|^~", r):
+			ts = append(ts, exprToken{kind: tkOperator, text: string(r)})
+			operand = true
+
+		// '%' is either the start of a binary number or modulo
+		case r == '%' && !operand:
+			cv.reportErr(fmt.Sprintf("Modulo is not supported by SAN in '%s'", s))
+			return nil, false
+
+		case r == '$' || r == '%' || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+				j++
+			}
+
+			t, ok := parseNumber(string(rs[i:j]))
+			if !ok {
+				cv.reportErr(fmt.Sprintf("Can't convert number '%s'", string(rs[i:j])))
+				return nil, false
+			}
+
+			ts = append(ts, t)
+			i = j - 1
+			operand = false
+
+		case unicode.IsLetter(r) || r == '_' || r == '.' || r == '@':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) ||
+				strings.ContainsRune("_.@?!", rs[j])) {
+				j++
+			}
+
+			name := string(rs[i:j])
+			if !cv.checkName(name) {
+				return nil, false
+			}
+
+			ts = append(ts, exprToken{kind: tkSymbol, text: name})
+			i = j - 1
+			operand = false
+
+		default:
+			cv.reportErr(fmt.Sprintf("Can't convert character '%c' in '%s'", r, s))
+			return nil, false
+		}
+	}
+
+	return ts, true
+}
+
+// checkName takes the name of a symbol that is used in an expression and
+// makes sure SAN can handle it
+func (cv *converter) checkName(s string) bool {
+	rs := []rune(s)
+
+	if !unicode.IsLetter(rs[0]) && rs[0] != '_' {
+		cv.reportErr(fmt.Sprintf("Symbol '%s' must start with a letter in SAN", s))
+		return false
+	}
+
+	if strings.ContainsRune(s, '@') {
+		cv.reportErr(fmt.Sprintf("Symbol '%s' contains illegal character '@'", s))
+		return false
+	}
+
+	return true
+}
+
+// exprParser turns a list of tokens into a tree of exprNodes with precedence
+// climbing
+type exprParser struct {
+	ts     []exprToken
+	p      int
+	src    string
+	cv     *converter
+	warned bool
+	failed bool
+}
+
+// peek returns the current token and a flag if there is one
+func (ep *exprParser) peek() (exprToken, bool) {
+	if ep.p >= len(ep.ts) {
+		return exprToken{}, false
+	}
+	return ep.ts[ep.p], true
+}
+
+// fail reports an error once for the expression
+func (ep *exprParser) fail(s string) *exprNode {
+	if !ep.failed {
+		ep.cv.reportErr(fmt.Sprintf("%s in '%s'", s, ep.src))
+	}
+	ep.failed = true
+	return &exprNode{}
+}
+
+// parseBinary parses a sequence of operands and binary operators that bind
+// at least as strong as minPrec
+func (ep *exprParser) parseBinary(minPrec int) *exprNode {
+	left := ep.parseUnary()
+
+	for {
+		t, ok := ep.peek()
+		if !ok || t.kind != tkOperator {
+			return left
+		}
+
+		prec, ok := precedence[t.text]
+		if !ok {
+			return ep.fail(fmt.Sprintf("Unexpected operator '%s'", t.text))
+		}
+
+		if prec < minPrec {
+			return left
+		}
+
+		ep.p++
+		right := ep.parseBinary(prec + 1)
+		left = &exprNode{op: t.text, kids: []*exprNode{left, right}}
+	}
+}
+
+// parseUnary parses an operand with any number of unary operators in front of
+// it
+func (ep *exprParser) parseUnary() *exprNode {
+	t, ok := ep.peek()
+	if !ok {
+		return ep.fail("Missing operand")
+	}
+
+	switch t.kind {
+
+	case tkOperator:
+		if t.text != "<" && t.text != ">" && t.text != "^" && t.text != "~" &&
+			t.text != "-" && t.text != "+" {
+			return ep.fail(fmt.Sprintf("Unexpected operator '%s'", t.text))
+		}
+
+		ep.p++
+		k := ep.parseUnary()
+
+		// Traditional assemblers don't agree if "<label+1" is the low
+		// byte of label plus one or of label+1. We follow ca65, but
+		// warn the user
+		if n, ok := ep.peek(); ok && n.kind == tkOperator && !ep.warned &&
+			(t.text == "<" || t.text == ">" || t.text == "^") {
+			ep.cv.reportWarn(fmt.Sprintf("Assumed '%s' only applies to the next operand in '%s'",
+				t.text, ep.src))
+			ep.warned = true
+		}
+
+		return &exprNode{op: "u" + t.text, kids: []*exprNode{k}}
+
+	case tkLParens:
+		ep.p++
+		n := ep.parseBinary(1)
+
+		c, ok := ep.peek()
+		if !ok || c.kind != tkRParens {
+			return ep.fail("Missing closing paren")
+		}
+		ep.p++
+		return n
+
+	case tkNumber, tkSymbol, tkHere:
+		ep.p++
+		return &exprNode{kind: t.kind, text: t.text, value: t.value}
+	}
+
+	return ep.fail(fmt.Sprintf("Unexpected '%s'", t.text))
+}
+
+// convertExpr takes an expression in traditional notation and returns the SAN
+// version. Simple expressions are kept in infix notation, anything else is
+// converted to RPN
+func (cv *converter) convertExpr(s string) (string, bool) {
+	n, ok := cv.parseExpr(s)
+	if !ok {
+		return "", false
+	}
+
+	return sanExpr(n), true
+}
+
+// parseExpr takes an expression in traditional notation and returns its tree
+func (cv *converter) parseExpr(s string) (*exprNode, bool) {
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		cv.reportErr("Missing expression")
+		return nil, false
+	}
+
+	ts, ok := cv.tokenize(s)
+	if !ok {
+		return nil, false
+	}
+
+	ep := exprParser{ts: ts, src: s, cv: cv}
+	n := ep.parseBinary(1)
+
+	if ep.failed {
+		return nil, false
+	}
+
+	if ep.p != len(ep.ts) {
+		ep.fail(fmt.Sprintf("Unexpected '%s'", ep.ts[ep.p].text))
+		return nil, false
+	}
+
+	return n, true
+}
+
+// knownValue takes the tree of an expression and returns its value and true if
+// it only uses numbers and symbols defined as constants
+func (cv *converter) knownValue(n *exprNode) (int, bool) {
+
+	if n.op == "" {
+		switch n.kind {
+		case tkNumber:
+			return n.value, true
+		case tkSymbol:
+			v, ok := cv.symbols[n.text]
+			return v, ok
+		}
+		return 0, false // the current address
+	}
+
+	a, ok := cv.knownValue(n.kids[0])
+	if !ok {
+		return 0, false
+	}
+
+	switch n.op {
+	case "u-":
+		return -a, true
+	case "u+":
+		return a, true
+	case "u<":
+		return a & 0xff, true
+	case "u>":
+		return (a >> 8) & 0xff, true
+	case "u^":
+		return (a >> 16) & 0xff, true
+	case "u~":
+		return ^a, true
+	}
+
+	b, ok := cv.knownValue(n.kids[1])
+	if !ok {
+		return 0, false
+	}
+
+	switch n.op {
+	case "+":
+		return a + b, true
+	case "-":
+		return a - b, true
+	case "*":
+		return a * b, true
+	case "/":
+		if b == 0 {
+			return 0, false
+		}
+		return a / b, true
+	case "&":
+		return a & b, true
+	case "|":
+		return a | b, true
+	case "^":
+		return a ^ b, true
+	case "<<":
+		return a << uint(b), true
+	case ">>":
+		return a >> uint(b), true
+	}
+
+	return 0, false
+}
+
+// sanExpr takes the root of an expression tree and returns it as a SAN
+// expression, which is either a value, a unary operator and a value, or two
+// values with a binary operator
+func sanExpr(n *exprNode) string {
+
+	if len(n.kids) == 0 {
+		return n.text
+	}
+
+	if len(n.kids) == 1 {
+		op, ok := unaryOps[n.op[1:]]
+		if ok {
+			return op + " " + sanValue(n.kids[0])
+		}
+
+		// Unary plus doesn't do anything
+		if n.op == "u+" {
+			return sanExpr(n.kids[0])
+		}
+	}
+
+	if len(n.kids) == 2 {
+		return sanValue(n.kids[0]) + " " + binaryOps[n.op] + " " + sanValue(n.kids[1])
+	}
+
+	return sanValue(n)
+}
+
+// sanValue takes an expression tree and returns it as a SAN value, which is
+// either a single number or symbol, or a RPN term
+func sanValue(n *exprNode) string {
+	if len(n.kids) == 0 {
+		return n.text
+	}
+	return "{" + strings.Join(rpn(n), " ") + "}"
+}
+
+// rpn takes an expression tree and returns it as a list of RPN words
+func rpn(n *exprNode) []string {
+
+	if len(n.kids) == 0 {
+		return []string{n.text}
+	}
+
+	if len(n.kids) == 1 {
+		ws := rpn(n.kids[0])
+
+		switch n.op {
+		case "u+":
+			return ws
+		case "u-":
+			return append(append([]string{"0"}, ws...), "-")
+		default:
+			return append(ws, unaryOps[n.op[1:]])
+		}
+	}
+
+	ws := append(rpn(n.kids[0]), rpn(n.kids[1])...)
+	return append(ws, binaryOps[n.op])
+}
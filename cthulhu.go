@@ -1,7 +1,7 @@
 // The Cthulhu Assember for the 6502/65c02/65816
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 02. May 2018
-// This version: 07. June 2018
+// This version: 19. Oct 2026
 
 package main
 
@@ -9,32 +9,79 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"cthulhu/analyzer"
+	"cthulhu/assembler"
 	"cthulhu/data"
+	"cthulhu/exporter"
 	//	"cthulhu/formatter"
-	"cthulhu/generator"
 	"cthulhu/lexer"
 	"cthulhu/lister"
 	"cthulhu/parser"
-	"cthulhu/token"
 )
 
 var (
+	fAdvise     = flag.Bool("opt", false, "Suggest how to make the code shorter or faster")
+	fCallGraph  = flag.String("cg", "", "File name to save the call graph")
+	fCallFormat = flag.String("cgf", "dot", "Format of the call graph: \"dot\" or \"json\"")
+	fObject     = flag.Bool("c", false, "Save a relocatable object file for \"cthulhu link\" instead of a binary")
 	fDebug      = flag.Bool("d", false, "Print lots and lots of debugging information")
+	fDirect     = flag.Bool("dpr", false, "Print the direct page accesses with their addresses")
+	fDebugMap   = flag.String("dm", "", "File name to save JSON map of addresses to source lines")
+	fExport     = flag.String("e", "", "Export source in WDC syntax for \"ca65\" or \"64tass\"")
+	fExportFile = flag.String("ef", "", "File name to save exported source")
+	fExportRes  = flag.Bool("er", false, "Export with resolved operands instead of symbols")
 	fInput      = flag.String("i", "", "Input file (REQUIRED)")
 	fFormat     = flag.Bool("f", false, "Return formatted version of source")
 	fFormatFile = flag.String("ff", "", "File name to save formatted source")
 	fFormatOnly = flag.Bool("fo", false, "Only produce formatted source code")
 	fHexdump    = flag.Bool("h", false, "Add hexdump of binary in text file \"cthulhu.hex\"")
 	fVerbose    = flag.Bool("v", false, "Give verbose messages")
-	fListing    = flag.Bool("l", false, "Generate listing file")
+	fListing    = flag.Bool("l", false, "Generate listing with bytes and cycles")
+	fListFile   = flag.String("lf", "", "File name to save listing")
+	fMap        = flag.Bool("map", false, "Print map of the segments with their addresses")
+	fOutput     = flag.String("o", "cthulhu.bin", "Name of the binary file")
+	fStack      = flag.Bool("stack", false, "Print the worst-case stack depth of each interrupt vector")
 	mpu         = flag.String("m", "65c02", "MPU type")
-	fSymbols    = flag.Bool("s", false, "Generate symbol table file")
+	fSymbols    = flag.Bool("s", false, "Generate symbol table")
+	fSymFile    = flag.String("sf", "", "File name to save symbol table")
+	fSymFormat  = flag.String("st", "cthulhu", "Format of symbol table: \"cthulhu\", \"vice\", \"mame\", \"bsnes\" or \"mlb\"")
+
+	// Subcommands with their own set of flags. They are given the command
+	// line arguments that follow the name of the command
+	commands = map[string]func([]string){
+		"convert": convert,
+		"disasm":  disasm,
+		"link":    link,
+		"lint":    lint,
+		"lsp":     langServer,
+		"test":    test,
+	}
+)
 
-	tokens []token.Token
+// Exit codes of the program
+const (
+	exitErrors = 1 // the program has errors, or tests failed
 )
 
+// report takes a list of diagnostics and where to get the lines of the source
+// they are about, prints them to the standard error output and returns the
+// number of errors
+func report(ds []data.Diagnostic, src data.Source) int {
+	for _, d := range ds {
+		fmt.Fprintln(os.Stderr, d.Format(src))
+	}
+
+	errs := data.CountErrors(ds)
+	if errs > 0 {
+		fmt.Fprintf(os.Stderr, "FATAL Found %d error(s).\n", errs)
+	}
+
+	return errs
+}
+
 // Verbose prints the given string if the verbose flag is set
 func verbose(s string) {
 	if *fVerbose {
@@ -44,6 +91,18 @@ func verbose(s string) {
 
 func main() {
 
+	// ***** SUBCOMMANDS *****
+
+	// Subcommands such as "convert" don't run the assembler and are
+	// handled in their own files
+	if len(os.Args) > 1 {
+		cmd, ok := commands[os.Args[1]]
+		if ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	// ***** CONFIRM REQUIRED FLAGS *****
 
 	flag.Parse()
@@ -54,85 +113,60 @@ func main() {
 	if *fInput == "" {
 		log.Fatal("FATAL No input file provided")
 	}
-
-	// ***** LEXER *****
-
-	// The lexer takes the name of the master source file and the mpu and
-	// splits up the source into tokens.
-
-	v := fmt.Sprintf("LEXER: Scanning %s as main source file", *fInput)
-	verbose(v)
-
-	tokens := lexer.Lexer(*mpu, *fInput)
-
-	// Part of the debugging information is a list of tokens
-	if *fDebug {
-		fmt.Println("=== List of tokens after initial lexing ===\n")
-		lexer.Tokenlister(tokens)
+	if _, ok := exporter.Dialects[*fExport]; *fExport != "" && !ok {
+		log.Fatalf("FATAL Export dialect '%s' not supported", *fExport)
 	}
-
-	verbose("Lexer done.")
-
-	// ***** PARSER *****
-
-	// The parser takes a slice of tokens and returns an Abstract Syntax
-	// Tree (AST) built of node.Node elements. This AST is used as the basis
-	// for all other work.
-	parser.Init(tokens)
-	ast := parser.Parser()
-
-	// Part of the debugging information is an indented list of nodes of the
-	// AST
-	if *fDebug {
-		fmt.Println("=== AST after initial parsing: ===\n")
-		parser.Nodelister(ast)
+	if *fObject && *fDebugMap != "" {
+		log.Fatal("FATAL Debug maps are only for binaries, not object files")
+	}
+	if *fObject && (*fCallGraph != "" || *fStack) {
+		log.Fatal("FATAL Call graphs are only for binaries, not object files")
+	}
+	if _, ok := lister.CallGraphFormats[*fCallFormat]; !ok {
+		log.Fatalf("FATAL Call graph format '%s' not supported", *fCallFormat)
+	}
+	if _, ok := lister.SymbolFormats[*fSymFormat]; !ok {
+		log.Fatalf("FATAL Symbol table format '%s' not supported", *fSymFormat)
 	}
 
-	verbose("Parser done.")
-
-	// ***** FORMATTER *****
-
-	// The formatter produces a cleanly indented version of the source code,
-	// much like the gofmt program included with Go. See the file itself for
-	// more detail
-
-	// TODO move from token to AST based formatting
-	// TODO Since formatting is not related to the other parsing steps,
-	//      we should be able to do this concurrently
+	// Part of the debugging information is a list of tokens and the AST as
+	// it comes out of the parser. We get them on their own, since the
+	// assembler changes the AST as it goes
+	if *fDebug {
+		tokens, _ := lexer.Scan(*mpu, *fInput, nil)
+		fmt.Println("=== List of tokens after initial lexing ===")
+		fmt.Println()
+		lexer.Tokenlister(&tokens)
 
-	/*
-		if *fFormat {
-			formatter.Formatter(ast)
-			verbose("Formatter run.")
+		if len(tokens) > 0 {
+			ast, _ := parser.Parse(tokens)
+			fmt.Println("=== AST after initial parsing: ===")
+			fmt.Println()
+			parser.Nodelister(ast)
 		}
-	*/
+	}
 
-	// *** CONSTRUCT THE MACHINE ***
+	// ***** ASSEMBLER *****
 
-	// We are now at the point where we can construct a machine to hold the
-	// greater values
-	// TODO see if we need this
-	machine := data.Machine{MPU: *mpu, AST: ast}
+	// The lexer splits up the source into tokens, the parser builds an
+	// Abstract Syntax Tree (AST) out of them, and the analyzer works out
+	// the addresses, symbols and operands. They all report what they find,
+	// so we see all errors of the program at once.
 
-	// *** ANALYZER ***
+	v := fmt.Sprintf("Assembling %s as main source file", *fInput)
+	verbose(v)
 
-	// The analyzer doesn't modify the AST, because that is used by the
-	// formatter and other parts. Instead, it creates a second syntax tree,
-	// the "BST" (because it comes after the AST) and modifies that step by
-	// step. PURGE handles the initial creation of the BST. As the name says, it
-	// deletes whitespace, EOL nodes, and does some easy processing of other
-	// nodes
-	bst := analyzer.Purge(*mpu, ast)
+	session := assembler.New(*mpu)
+	session.Object = *fObject
+	session.Advise = *fAdvise
 
-	if *fDebug {
-		fmt.Println("=== BST after purge step: ===\n")
-		parser.Nodelister(bst)
+	res := session.Assemble(*fInput)
+
+	if report(res.Diagnostics, res.Source) > 0 {
+		os.Exit(exitErrors)
 	}
 
-	// The analyzer examens the AST provided by the parser and runs various
-	// processes on it to convert numbers, etc.
-	// TODO see about passing out symbol table(s)
-	analyzer.Analyzer(&machine)
+	machine := *res.Machine
 
 	if *fDebug {
 		fmt.Println("=== Completed nodes after analyzer ===")
@@ -148,27 +182,147 @@ func main() {
 		fmt.Println()
 	}
 
+	// *** OBJECT FILE ***
+
+	// Object files are put together with others by "cthulhu link", which
+	// places their segments and resolves the symbols they import
+	if *fObject {
+		saveObject(&machine)
+		return
+	}
+
 	// *** GENERATOR ***
 
-	// The generator takes the assembler instructions and other information
-	// and produces the actual bytes that will be saved in the final file.
-	// TODO
+	// The generator has taken the assembler instructions and other
+	// information and produced the actual bytes we save in the final file.
+	err := os.WriteFile(*fOutput, machine.Code, 0644)
+	if err != nil {
+		log.Fatalf("FATAL Can't save binary file: %v", err)
+	}
+
+	v = fmt.Sprintf("Generator: Saved %d byte(s) to %s", len(machine.Code), *fOutput)
+	verbose(v)
+
+	// *** EXPORTER ***
+
+	// The exporter writes the program in traditional WDC syntax for other
+	// assemblers such as ca65 and 64tass, so people who don't use Cthulhu
+	// can work with the code
+	if *fExport != "" {
+		ls, ds := exporter.Exporter(&machine, *fExport, *fExportRes)
+		if report(ds, res.Source) > 0 {
+			os.Exit(exitErrors)
+		}
+
+		src := strings.Join(ls, "\n") + "\n"
 
-	generator.Generator(machine.AST)
+		if *fExportFile == "" {
+			fmt.Print(src)
+		} else {
+			err := os.WriteFile(*fExportFile, []byte(src), 0644)
+			if err != nil {
+				log.Fatalf("FATAL Can't save exported source: %v", err)
+			}
+		}
+
+		verbose("Exporter run.")
+	}
 
 	// *** LISTER ***
 
 	// The lister produces a detailed listing of the code with useful
-	// information such as the actual byte stored for each instruction and
-	// the modes the 65816 was in during each instruction
+	// information such as the actual bytes stored for each instruction and
+	// the cycles it takes
 	// TODO Since this is based on the AST, we should be able to do this
 	//      concurrently
 
 	if *fListing {
-		lister.Lister(machine.AST)
+		ls := lister.Lister(&machine)
+		lst := strings.Join(ls, "\n") + "\n"
+
+		if *fListFile == "" {
+			fmt.Print(lst)
+		} else {
+			err := os.WriteFile(*fListFile, []byte(lst), 0644)
+			if err != nil {
+				log.Fatalf("FATAL Can't save listing: %v", err)
+			}
+		}
+
 		verbose("Lister run.")
 	}
 
+	// *** SYMBOL TABLE ***
+
+	// The symbol table can be given to the disassembler, or to emulators so
+	// their debuggers show our labels
+	if *fSymbols {
+		sym := strings.Join(lister.Symbols(&machine, *fSymFormat), "\n") + "\n"
+
+		if *fSymFile == "" {
+			fmt.Print(sym)
+		} else {
+			err := os.WriteFile(*fSymFile, []byte(sym), 0644)
+			if err != nil {
+				log.Fatalf("FATAL Can't save symbol table: %v", err)
+			}
+		}
+
+		verbose("Symbol table generated.")
+	}
+
+	// *** DEBUG MAP ***
+
+	// The debug map lets monitors and trace tools show the line of the
+	// source for an address
+	if *fDebugMap != "" {
+		bs, err := lister.DebugMap(&machine)
+		if err == nil {
+			err = os.WriteFile(*fDebugMap, bs, 0644)
+		}
+		if err != nil {
+			log.Fatalf("FATAL Can't save debug map: %v", err)
+		}
+
+		verbose("Debug map generated.")
+	}
+
+	// *** CALL GRAPH ***
+
+	// The call graph shows which routine calls which, and how deep the
+	// stack can get from each interrupt vector
+	if *fCallGraph != "" {
+		bs, err := lister.CallGraph(&machine, *fCallFormat)
+		if err == nil {
+			err = os.WriteFile(*fCallGraph, bs, 0644)
+		}
+		if err != nil {
+			log.Fatalf("FATAL Can't save call graph: %v", err)
+		}
+
+		verbose("Call graph generated.")
+	}
+
+	if *fStack {
+		fmt.Println(strings.Join(lister.StackDepth(&machine), "\n"))
+	}
+
+	// *** DIRECT PAGE REPORT ***
+
+	// With the direct page moving around on the 65816, it helps to see
+	// which address each access really goes to
+	if *fDirect {
+		fmt.Println(strings.Join(lister.Direct(&machine), "\n"))
+	}
+
+	// *** SEGMENT MAP ***
+
+	// The map shows where each segment of the program ends up, which is
+	// useful to see how much room is left between them
+	if *fMap {
+		fmt.Println(strings.Join(lister.Map(&machine), "\n"))
+	}
+
 	// *** HEXDUMP ***
 
 	// TODO Since this is based on the AST, we should be able to do this
@@ -2,7 +2,7 @@
 // A lot of these are used as sets since Go (golang) doesn't
 // provide that data structure by default
 // First version: 04. May 2018 (May the Force be with you!)
-// This version: 18. May 2018
+// This version: 19. Oct 2026
 
 package data
 
@@ -13,14 +13,45 @@ type Opcode struct {
 	Operands  int    // number of operands
 	Value     byte   // opcode
 	Embiggens bool   // if the opcode changes length with 8/16 switch
+	Cycles    int    // number of cycles with 8-bit registers
+	Penalties int    // extra cycles that can come on top, see below
 }
 
+// Penalties are extra cycles an instruction takes depending on the status of
+// the MPU or where the data is. They are combined as bits
+const (
+	CycM       = 1 << iota // one more with a 16-bit accumulator
+	CycRMW                 // two more with a 16-bit accumulator
+	CycX                   // one more with 16-bit index registers
+	CycDirect              // one more if the direct page isn't page-aligned
+	CycIndex               // one more if indexing crosses a page, or with 16-bit index registers
+	CycTaken               // one more if the branch is taken
+	CycCross               // one more if a taken branch crosses a page in emulated mode
+	CycNative              // one more in native mode
+	CycDecimal             // one more in decimal mode
+	CycMove                // cycles are for each byte moved
+)
+
 var OpcodesSAN = map[string]map[string](Opcode){
 	"6502":  Opcodes6502,
 	"65c02": Opcodes65c02,
 	"65816": Opcodes65816,
 }
 
+// Reverse index of the opcode tables by opcode byte for each MPU, built when
+// the program starts. Bytes that are not opcodes for the MPU are missing
+var OpcodesByValue = map[string]map[byte](Opcode){}
+
+func init() {
+	for mpu, ocs := range OpcodesSAN {
+		OpcodesByValue[mpu] = map[byte](Opcode){}
+
+		for _, oc := range ocs {
+			OpcodesByValue[mpu][oc.Value] = oc
+		}
+	}
+}
+
 // List of all directives. This map is used as a set.
 var Directives = map[string]bool{
 	".mpu": true, ".origin": true, ".equ": true, ".byte": true,
@@ -33,6 +64,15 @@ var Directives = map[string]bool{
 	".swap": true, ".drop": true, ".dup": true, ".lshift": true,
 	".rshift": true, ".not": true, ".here": true, ".include": true,
 	"...": true, ".invert": true,
+	".!a8": true, ".!a16": true, ".!xy8": true, ".!xy16": true,
+	".!axy8": true, ".!axy16": true, ".!native": true, ".!emulated": true,
+	".and": true, ".or": true, ".xor": true,
+	".test": true, ".tend": true, ".expect": true, ".cycles": true,
+	".encoding": true, ".charmap": true,
+	".asciiz": true, ".pstring": true, ".hstring": true,
+	".long": true, ".align": true, ".segment": true,
+	".import": true, ".export": true, ".dp": true, ".direct": true,
+	".databank": true,
 }
 
 // List of directives with Parameters. This map is used as a set.
@@ -42,6 +82,12 @@ var DirectivesPara = map[string]bool{
 	".bank": true, ".advance": true, ".skip": true,
 	".assert": true, ".ram": true, ".rom": true, ".include": true,
 	".lshift": true, ".rshift": true, ".not": true, ".invert": true,
+	".test": true, ".expect": true, ".cycles": true,
+	".encoding": true, ".charmap": true,
+	".asciiz": true, ".pstring": true, ".hstring": true,
+	".long": true, ".align": true, ".segment": true,
+	".import": true, ".export": true, ".dp": true, ".direct": true,
+	".databank": true,
 }
 
 // List of directives and operators that are used as operators inside
@@ -66,3 +112,18 @@ var OperatorsUnary = map[string]bool{
 	".lshift": true, ".rshift": true, ".lsb": true, ".msb": true, ".bank": true,
 	".not": true, ".invert": true,
 }
+
+// List of opcodes that take an operand relative to the address of the next
+// instruction, that is, the branches. This map is used as a set.
+var Relative = map[string]bool{
+	"bpl": true, "bmi": true, "bvc": true, "bvs": true, "bcc": true,
+	"bcs": true, "bne": true, "beq": true, "bra": true, "bra.l": true,
+	"phe.r": true,
+}
+
+// List of immediate opcodes that change length with the size of the X and Y
+// registers. All other opcodes that embiggen depend on the size of the A
+// register. This map is used as a set.
+var IndexImmediates = map[string]bool{
+	"ldx.#": true, "ldy.#": true, "cpx.#": true, "cpy.#": true,
+}
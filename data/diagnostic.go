@@ -0,0 +1,243 @@
+// Diagnostics for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// All parts of the assembler report the problems they find as diagnostics.
+// They are collected for the whole run, so the lexer, parser and analyzer
+// can complain about the same program at once, and sorted and cleaned up
+// before they are shown.
+
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cthulhu/token"
+)
+
+// Severity tells us how bad a diagnostic is. Only errors stop the assembler
+// from producing a binary
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+var severityNames = map[Severity]string{
+	Error:   "ERROR",
+	Warning: "WARNING",
+	Note:    "NOTE",
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// Diagnostic is a problem found by one of the parts of the assembler, such
+// as "LEXER". Lines and columns start with 1. A column of 0 means we only
+// know the line, an end line of 0 that we only know where it starts
+type Diagnostic struct {
+	Severity  Severity
+	Stage     string
+	File      string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int // first column after the problem
+	Message   string
+	Hint      string    // what the user might want to do about it, if we know
+	Related   []Related // other places that are part of the problem
+}
+
+// At takes the part of the assembler, a token or the token of a node, and a
+// message, and returns an error that spans the token
+func At(stage string, t token.Token, msg string) Diagnostic {
+	return Diagnostic{
+		Stage: stage, File: t.File, Line: t.Line, Column: t.Index,
+		EndLine: t.EndLine, EndColumn: t.EndIndex, Message: msg,
+	}
+}
+
+// Related is another place in the source that helps to explain a diagnostic,
+// such as where a symbol was defined first
+type Related struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Source takes the name of a file and a line, and returns the text of the
+// line, or false if we don't have it
+type Source func(file string, line int) (string, bool)
+
+// String returns the diagnostic the way the assembler prints it, with the
+// hint and related places on lines of their own
+func (d Diagnostic) String() string {
+	return d.Format(nil)
+}
+
+// Format returns the diagnostic like String, but with the line of the source
+// the diagnostic is about, if the source has it, and carets under the problem
+func (d Diagnostic) Format(src Source) string {
+	s := fmt.Sprintf("%s %s (%s, %d, %d): %s", d.Stage, d.Severity, d.File, d.Line, d.Column, d.Message)
+
+	if src != nil && d.Line > 0 {
+		if text, ok := src(d.File, d.Line); ok {
+			s += "\n" + excerpt(text, d)
+		}
+	}
+
+	if d.Hint != "" {
+		s += fmt.Sprintf("\n    Hint: %s", d.Hint)
+	}
+
+	for _, r := range d.Related {
+		s += fmt.Sprintf("\n    (%s, %d, %d): %s", r.File, r.Line, r.Column, r.Message)
+	}
+
+	return s
+}
+
+// excerpt takes the text of the line of a diagnostic and returns it with the
+// number of the line in front, and a line with carets under the span of the
+// diagnostic. Spans that go on to the next lines are marked to the end of the
+// first one. Tabs are kept so the carets line up
+func excerpt(text string, d Diagnostic) string {
+	rs := []rune(strings.TrimRight(text, "\r"))
+	prefix := fmt.Sprintf("%5d | ", d.Line)
+
+	s := prefix + string(rs)
+
+	if d.Column < 1 || d.Column > len(rs)+1 {
+		return s
+	}
+
+	end := d.EndColumn
+	if d.EndLine > d.Line || end > len(rs)+1 {
+		end = len(rs) + 1
+	}
+	if end <= d.Column {
+		end = d.Column + 1
+	}
+
+	var marks []rune
+	for _, r := range rs[:d.Column-1] {
+		if r == '\t' {
+			marks = append(marks, '\t')
+		} else {
+			marks = append(marks, ' ')
+		}
+	}
+
+	s += "\n" + strings.Repeat(" ", len(prefix)-2) + "| " + string(marks) + strings.Repeat("^", end-d.Column)
+
+	return s
+}
+
+// SortDiagnostics takes a list of diagnostics and returns them sorted by file,
+// line and column, with those that are reported more than once removed. The
+// order of diagnostics at the same place is kept
+func SortDiagnostics(ds []Diagnostic) []Diagnostic {
+	var sorted []Diagnostic
+
+	seen := map[string]bool{}
+
+	for _, d := range ds {
+		k := fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%s", d.File, d.Line, d.Column, d.Severity, d.Message)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		sorted = append(sorted, d)
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return sorted
+}
+
+// CountErrors takes a list of diagnostics and returns how many are errors
+func CountErrors(ds []Diagnostic) int {
+	c := 0
+
+	for _, d := range ds {
+		if d.Severity == Error {
+			c++
+		}
+	}
+
+	return c
+}
+
+// Suggest takes a word that wasn't found and a list of words we know, and
+// returns the known word that is closest to it, or an empty string if none is
+// close enough to be what the user meant. Case doesn't count
+func Suggest(word string, known []string) string {
+	best := ""
+	bestDist := len([]rune(word))/3 + 1 // allow about one typo for three letters
+
+	for _, k := range known {
+		d := distance(strings.ToLower(word), strings.ToLower(k))
+		if d < bestDist || (d == bestDist && best != "" && k < best) {
+			best, bestDist = k, d
+		}
+	}
+
+	return best
+}
+
+// distance takes two strings and returns the Levenshtein distance between
+// them, the number of characters that need to be added, removed or changed to
+// get from one to the other
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
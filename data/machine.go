@@ -5,8 +5,117 @@ package data
 import "cthulhu/node"
 
 type Machine struct {
-	MPU    string     // MPU as given by the user on the command line
-	Origin int        // Start address for compilation as given in the source code
-	Code   []byte     // Finished compiled data
-	AST    *node.Node // The Abstract Syntax Tree (AST)
+	MPU      string            // MPU as given by the user on the command line
+	Origin   int               // Lowest address of the program
+	Code     []byte            // Finished compiled data, the segments placed by address
+	Segments []Segment         // Blocks of code started by .origin or .segment
+	RAM      [][2]int          // First and last address of the RAM areas from .ram
+	ROM      [][2]int          // First and last address of the ROM areas from .rom
+	AST      *node.Node        // The Abstract Syntax Tree (AST)
+	Tests    []Test            // Tests from .test blocks, added by the analyzer
+	Symbols  map[string]Symbol // Labels and symbols, added by the analyzer
+	Object   bool              // Assembling a relocatable object file
+	Relocs   []Reloc           // Places the linker has to fix, for object files
+	Spans    []Span            // Where the bytes come from, added by the analyzer
+	Direct   []Access          // Instructions that use the direct page
+}
+
+// Access is an instruction that uses the direct page, with the address in
+// bank 0 it uses as far as the assembler knows where the direct page is. For
+// indexed modes, this is the address before the index is added, for indirect
+// ones where the pointer is
+type Access struct {
+	Addr   int    // address of the instruction
+	Target int    // address the instruction uses
+	Text   string // SAN mnemonic
+	File   string
+	Line   int
+}
+
+// Span is a range of addresses of the program and the line of the source its
+// bytes come from, with the status of the MPU when it gets there. The 6502 and
+// 65c02 are always emulated with 8 bit registers
+type Span struct {
+	Addr     int
+	Size     int
+	File     string
+	Line     int
+	Column   int
+	A8       bool
+	XY8      bool
+	Emulated bool
+	DP       int  // start of the direct page, if DPSet
+	DPSet    bool // from .dp
+	DBR      int  // data bank, if DBRSet
+	DBRSet   bool // from .databank
+}
+
+// Segment is a block of code at an address of its own. Each .origin starts a
+// new one, .segment does the same and gives it a name. Segments must not
+// overlap
+type Segment struct {
+	Name  string     // empty for .origin
+	Start int        // address of the first byte
+	Size  int        // number of bytes, added by the analyzer
+	Code  []byte     // added by the generator
+	Node  *node.Node // the .origin or .segment directive
+	Reloc bool       // in object files, placed by the linker and assembled at 0
+}
+
+// Base is what a value in an object file is relative to. The zero value is an
+// absolute value the linker leaves alone
+type Base struct {
+	Segment string // relocatable segment the value is an offset into
+	Import  string // imported symbol the value is an offset from
+}
+
+// Reloc is a place in the code of an object file the linker has to fix once
+// it knows where the segments go and what the imported symbols are
+type Reloc struct {
+	Segment int    // index of the segment with the place
+	Offset  int    // from the start of the segment
+	Width   int    // number of bytes, 1 to 3
+	Kind    string // "" for the whole value, or ".lsb", ".msb", ".bank"
+	Operand bool   // address of an instruction, not data such as .word
+	Base    Base
+	Addend  int // value relative to the base
+	File    string
+	Line    int
+	Column  int
+}
+
+// Symbol is an entry in the symbol table. Local labels are kept under their
+// name with the number of their scope added, see analyzer.LocalName
+type Symbol struct {
+	Value  int          // added once defined
+	File   string       // where defined
+	Line   int          // where defined
+	Column int          // where the name starts
+	Type   string       // "label", "local" or "symbol"
+	Used   bool         // see if symbol defined but not used
+	Refs   []*node.Node // nodes that refer to the symbol
+
+	Base     Base // for object files, what the value is relative to
+	Exported bool // for object files, from .export
+}
+
+// Test is a .test block. The analyzer puts the code of the tests after the
+// program, so they don't change its addresses
+type Test struct {
+	Name    string
+	Addr    int        // Address of the first byte of the test code
+	Code    []byte     // Test code, added by the generator
+	Expects []Expect   // What to check once the test is done
+	Node    *node.Node // The .test directive, with the code as kids
+}
+
+// Expect is an .expect directive of a test
+type Expect struct {
+	Target string // Register such as "a" or "dbr", "flags", "cycles", or "memory"
+	Addr   int    // Address for "memory"
+	Value  int    // Value for the registers and "cycles"
+	Bytes  []byte // Bytes for "memory"
+	Flags  string // Flags for "flags", upper case for set, lower case for clear
+	File   string
+	Line   int
 }
@@ -1,267 +1,268 @@
 // Opcode tables for the 65816 for the Cthulhu Assembler
 // First version: 06. May 2018
-// This version: 11. May 2018
+// This version: 19. Oct 2026
 
 package data
 
 // Data bank of opcodes, with mnemonics (SAN and WDC), length in bytes, number
-// of operands, the actual opcode, and a flag if the opcode is affected by
-// switches of the register size
+// of operands, the actual opcode, a flag if the opcode is affected by
+// switches of the register size, the base number of cycles, and the penalties
+// that can add to them
 var Opcodes65816 = map[string](Opcode){
-	"brk":      Opcode{"brk", "brk", 2, 1, 0x00, false}, // we require a signature byte
-	"ora.dxi":  Opcode{"ora.dxi", "ora", 2, 1, 0x01, false},
-	"cop":      Opcode{"cop", "cop", 2, 0, 0x02, false},
-	"ora.s":    Opcode{"ora.s", "ora", 2, 1, 0x03, false},
-	"tsb.d":    Opcode{"tsb.d", "tsb", 2, 1, 0x04, false},
-	"ora.d":    Opcode{"ora.d", "ora", 2, 1, 0x05, false},
-	"asl.d":    Opcode{"asl.d", "asl", 2, 1, 0x06, false},
-	"ora.dil":  Opcode{"ora.dil", "ora", 2, 1, 0x07, false},
-	"php":      Opcode{"php", "php", 1, 0, 0x08, false},
-	"ora.#":    Opcode{"ora.#", "ora", 2, 1, 0x09, false},
-	"asl.a":    Opcode{"asl.a", "asl", 1, 0, 0x0a, false},
-	"phd":      Opcode{"phd", "phd", 1, 0, 0x0b, false},
-	"tsb":      Opcode{"tsb", "tsb", 3, 0, 0x0c, false},
-	"ora":      Opcode{"ora", "ora", 3, 1, 0x0d, false},
-	"asl":      Opcode{"asl", "asl", 3, 1, 0x0e, false},
-	"ora.l":    Opcode{"ora.l", "ora", 4, 1, 0x0f, false},
-	"bpl":      Opcode{"bpl", "bpl", 2, 1, 0x10, false},
-	"ora.diy":  Opcode{"ora.diy", "ora", 2, 1, 0x11, false},
-	"ora.di":   Opcode{"ora.di", "ora", 2, 1, 0x12, false},
-	"ora.siy":  Opcode{"ora.siy", "ora", 2, 1, 0x13, false},
-	"trb.d":    Opcode{"trb.d", "trb", 2, 1, 0x14, false},
-	"ora.dx":   Opcode{"ora.dx", "ora", 2, 1, 0x15, false},
-	"asl.dx":   Opcode{"asl.dx", "asl", 2, 1, 0x16, false},
-	"ora.dily": Opcode{"ora.dily", "ora", 2, 1, 0x17, false},
-	"clc":      Opcode{"clc", "clc", 1, 0, 0x18, false},
-	"ora.y":    Opcode{"ora.y", "ora", 3, 1, 0x19, false},
-	"inc.a":    Opcode{"inc.a", "inc", 1, 0, 0x1a, false},
-	"tcs":      Opcode{"tcs", "tcs", 1, 0, 0x1b, false},
-	"trb":      Opcode{"trb", "trb", 3, 1, 0x1c, false},
-	"ora.x":    Opcode{"ora.x", "ora", 3, 1, 0x1d, false},
-	"asl.x":    Opcode{"asl.x", "asl", 3, 1, 0x1e, false},
-	"ora.lx":   Opcode{"ora.lx", "ora", 4, 1, 0x1f, false},
-	"jsr":      Opcode{"jsr", "jsr", 3, 1, 0x20, false},
-	"and.dxi":  Opcode{"and.dxi", "and", 2, 1, 0x21, false},
-	"jsr.l":    Opcode{"jsr.l", "jml", 4, 1, 0x22, false},
-	"and.s":    Opcode{"and.s", "and", 2, 1, 0x23, false},
-	"bit.d":    Opcode{"bit.d", "bit", 2, 1, 0x24, false},
-	"and.d":    Opcode{"and.d", "and", 2, 1, 0x25, false},
-	"rol.d":    Opcode{"rol.d", "rol", 2, 1, 0x26, false},
-	"and.dil":  Opcode{"and.dil", "and", 2, 1, 0x27, false},
-	"plp":      Opcode{"plp", "plp", 1, 0, 0x28, false},
-	"and.#":    Opcode{"and.#", "and", 2, 1, 0x29, false},
-	"rol.a":    Opcode{"rol.a", "rol", 1, 0, 0x2a, false},
-	"pld":      Opcode{"pld", "pld", 1, 0, 0x2b, false},
-	"bit":      Opcode{"bit", "bit", 3, 1, 0x2c, false},
-	"and":      Opcode{"and", "and", 3, 1, 0x2d, false},
-	"rol":      Opcode{"rol", "rol", 3, 1, 0x2e, false},
-	"and.l":    Opcode{"and.l", "and", 4, 1, 0x2f, false},
-	"bmi":      Opcode{"bmi", "bmi", 2, 1, 0x30, false},
-	"and.diy":  Opcode{"and.diy", "and", 2, 1, 0x31, false},
-	"and.di":   Opcode{"and.di", "and", 2, 1, 0x32, false},
-	"and.siy":  Opcode{"and.siy", "and", 2, 1, 0x33, false},
-	"bit.dx":   Opcode{"bit.dx", "bit", 2, 1, 0x34, false},
-	"and.dx":   Opcode{"and.dx", "and", 2, 1, 0x35, false},
-	"rol.dx":   Opcode{"rol.dx", "rol", 2, 1, 0x36, false},
-	"and.dily": Opcode{"and.dily", "and", 2, 1, 0x37, false},
-	"sec":      Opcode{"sec", "sec", 1, 0, 0x38, false},
-	"and.y":    Opcode{"and.y", "and", 3, 1, 0x39, false},
-	"dec.a":    Opcode{"dec.a", "dec", 1, 0, 0x3a, false},
-	"tsc":      Opcode{"tsc", "tsc", 1, 0, 0x3b, false},
-	"bit.x":    Opcode{"bit.x", "bit", 3, 1, 0x3c, false},
-	"and.x":    Opcode{"and.x", "and", 3, 1, 0x3d, false},
-	"rol.x":    Opcode{"rol.x", "rol", 3, 1, 0x3e, false},
-	"and.lx":   Opcode{"and.lx", "and", 4, 1, 0x3f, false},
-	"rti":      Opcode{"rti", "rti", 1, 0, 0x40, false},
-	"eor.dxi":  Opcode{"eor.dxi", "eor", 2, 1, 0x41, false},
-	"wdm":      Opcode{"wdm", "wdm", 2, 1, 0x42, false},
-	"eor.s":    Opcode{"eor.s", "eor", 2, 1, 0x43, false},
-	"mvp":      Opcode{"mvp", "mvp", 3, 2, 0x44, false}, // takes two operands
-	"eor.d":    Opcode{"eor.d", "eor", 2, 1, 0x45, false},
-	"lsr.d":    Opcode{"lsr.d", "lsr", 2, 1, 0x46, false},
-	"eor.dil":  Opcode{"eor.dil", "eor", 2, 1, 0x47, false},
-	"pha":      Opcode{"pha", "pha", 1, 0, 0x48, false},
-	"eor.#":    Opcode{"eor.#", "eor", 2, 1, 0x49, false},
-	"lsr.a":    Opcode{"lsr.a", "lsr", 1, 0, 0x4a, false},
-	"phk":      Opcode{"phk", "phk", 1, 0, 0x4b, false},
-	"jmp":      Opcode{"jmp", "jmp", 3, 1, 0x4c, false},
-	"eor":      Opcode{"eor", "eor", 3, 1, 0x4d, false},
-	"lsr":      Opcode{"lsr", "lsr", 3, 1, 0x4e, false},
-	"eor.l":    Opcode{"eor.l", "eor", 4, 1, 0x4f, false},
-	"bvc":      Opcode{"bvc", "bvc", 2, 1, 0x50, false},
-	"eor.diy":  Opcode{"eor.diy", "eor", 2, 1, 0x51, false},
-	"eor.di":   Opcode{"eor.di", "eor", 2, 1, 0x52, false},
-	"eor.siy":  Opcode{"eor.siy", "eor", 2, 1, 0x53, false},
-	"mvn":      Opcode{"mvn", "mvn", 3, 2, 0x54, false}, // takes two operands
-	"eor.dx":   Opcode{"eor.dx", "eor", 2, 1, 0x55, false},
-	"lsr.dx":   Opcode{"lsr.dx", "lsr", 2, 1, 0x56, false},
-	"eor.dily": Opcode{"eor.dily", "eor", 2, 1, 0x57, false},
-	"cli":      Opcode{"cli", "cli", 1, 0, 0x58, false},
-	"eor.y":    Opcode{"eor.y", "eor", 3, 1, 0x59, false},
-	"phy":      Opcode{"phy", "phy", 1, 0, 0x5a, false},
-	"tcd":      Opcode{"tcd", "tcd", 1, 0, 0x5b, false},
-	"jmp.l":    Opcode{"jmp.l", "jml", 4, 1, 0x5c, false},
-	"eor.x":    Opcode{"eor.x", "eor", 3, 1, 0x5d, false},
-	"lsr.x":    Opcode{"lsr.x", "lsr", 3, 1, 0x5e, false},
-	"eor.lx":   Opcode{"eor.lx", "eor", 4, 1, 0x5f, false},
-	"rts":      Opcode{"rts", "rts", 1, 0, 0x60, false},
-	"adc.dxi":  Opcode{"adc.dxi", "adc", 2, 1, 0x61, false},
-	"phe.r":    Opcode{"phe.r", "per", 2, 1, 0x62, false},
-	"adc.s":    Opcode{"adc.s", "adc", 2, 1, 0x63, false},
-	"stz.d":    Opcode{"stz.d", "stz", 2, 1, 0x64, false},
-	"adc.d":    Opcode{"adc.d", "adc", 2, 1, 0x65, false},
-	"ror.d":    Opcode{"ror.d", "ror", 2, 1, 0x66, false},
-	"adc.dil":  Opcode{"adc.dil", "adc", 2, 1, 0x67, false},
-	"pla":      Opcode{"pla", "pla", 1, 0, 0x68, false},
-	"adc.#":    Opcode{"adc.#", "adc", 2, 1, 0x69, false},
-	"ror.a":    Opcode{"ror.a", "ror", 1, 0, 0x6a, false},
-	"rts.l":    Opcode{"rts.l", "rtl", 1, 1, 0x6b, false},
-	"jmp.i":    Opcode{"jmp.i", "jmp", 3, 1, 0x6c, false},
-	"adc":      Opcode{"adc", "adc", 3, 1, 0x6d, false},
-	"ror":      Opcode{"ror", "ror", 3, 1, 0x6e, false},
-	"adc.l":    Opcode{"adc.l", "adv", 4, 1, 0x6f, false},
-	"bvs":      Opcode{"bvs", "bvs", 2, 1, 0x70, false},
-	"adc.diy":  Opcode{"adc.diy", "adc", 2, 1, 0x71, false},
-	"adc.di":   Opcode{"adc.di", "adc", 2, 1, 0x72, false},
-	"adc.siy":  Opcode{"adc.siy", "adc", 2, 1, 0x73, false},
-	"stz.dx":   Opcode{"stz.dx", "stz", 2, 1, 0x74, false},
-	"adc.dx":   Opcode{"adc.dx", "adc", 2, 1, 0x75, false},
-	"ror.dx":   Opcode{"ror.dx", "ror", 2, 1, 0x76, false},
-	"adc.dily": Opcode{"adc.dily", "adc", 2, 1, 0x77, false},
-	"sei":      Opcode{"sei", "sei", 1, 0, 0x78, false},
-	"adc.y":    Opcode{"adc.y", "adc", 3, 1, 0x79, false},
-	"ply":      Opcode{"ply", "ply", 1, 0, 0x7a, false},
-	"tdc":      Opcode{"tdc", "tdc", 1, 0, 0x7b, false},
-	"jmp.xi":   Opcode{"jmp.xi", "jmp", 3, 1, 0x7c, false},
-	"adc.x":    Opcode{"adc.x", "adc", 3, 1, 0x7d, false},
-	"ror.x":    Opcode{"ror.x", "ror", 3, 1, 0x7e, false},
-	"adc.lx":   Opcode{"adc.lx", "adc", 4, 1, 0x7f, false},
-	"bra":      Opcode{"bra", "bra", 2, 1, 0x80, false},
-	"sta.dxi":  Opcode{"sta.dxi", "sta", 2, 1, 0x81, false},
-	"bra.l":    Opcode{"bra.l", "brl", 3, 1, 0x82, false},
-	"sta.s":    Opcode{"sta.s", "sta", 2, 1, 0x83, false},
-	"sty.d":    Opcode{"sty.d", "sty", 2, 1, 0x84, false},
-	"sta.d":    Opcode{"sta.d", "sta", 2, 1, 0x85, false},
-	"stx.d":    Opcode{"stx.d", "stx", 2, 1, 0x86, false},
-	"sta.dil":  Opcode{"sta.dil", "sta", 2, 1, 0x87, false},
-	"dey":      Opcode{"dey", "dey", 1, 0, 0x88, false},
-	"bit.#":    Opcode{"bit.#", "bit", 2, 1, 0x89, false},
-	"txa":      Opcode{"txa", "txa", 1, 0, 0x8a, false},
-	"phb":      Opcode{"phb", "phb", 1, 0, 0x8b, false},
-	"sty":      Opcode{"sty", "sty", 3, 1, 0x8c, false},
-	"sta":      Opcode{"sta", "sta", 3, 1, 0x8d, false},
-	"stx":      Opcode{"stx", "stx", 3, 1, 0x8e, false},
-	"sta.l":    Opcode{"sta.l", "sta", 4, 1, 0x8f, false},
-	"bcc":      Opcode{"bcc", "bbc", 2, 1, 0x90, false},
-	"sta.diy":  Opcode{"sta.diy", "sta", 2, 1, 0x91, false},
-	"sta.di":   Opcode{"sta.di", "sta", 2, 1, 0x92, false},
-	"sta.siy":  Opcode{"sta.siy", "sta", 2, 1, 0x93, false},
-	"sty.dx":   Opcode{"sty.dx", "sty", 2, 1, 0x94, false},
-	"sta.dx":   Opcode{"sta.dx", "sta", 2, 1, 0x95, false},
-	"stx.dy":   Opcode{"stx.dy", "stx", 2, 1, 0x96, false},
-	"sta.dily": Opcode{"sta.dily", "sta", 2, 1, 0x97, false},
-	"tya":      Opcode{"tya", "tya", 1, 0, 0x98, false},
-	"sta.y":    Opcode{"sta.y", "sta", 3, 1, 0x99, false},
-	"txs":      Opcode{"txs", "txs", 1, 0, 0x9a, false},
-	"txy":      Opcode{"txy", "txy", 1, 0, 0x9b, false},
-	"stz":      Opcode{"stz", "stz", 3, 1, 0x9c, false},
-	"sta.x":    Opcode{"sta.x", "sta", 3, 1, 0x9d, false},
-	"stz.x":    Opcode{"stz.x", "stz", 3, 1, 0x9e, false},
-	"sta.lx":   Opcode{"sta.lx", "sta", 4, 1, 0x9f, false},
-	"ldy.#":    Opcode{"ldy.#", "ldy", 2, 1, 0xa0, false},
-	"lda.dxi":  Opcode{"lda.dxi", "lda", 2, 1, 0xa1, false},
-	"ldx.#":    Opcode{"ldx.#", "ldx", 2, 1, 0xa2, false},
-	"lda.s":    Opcode{"lda.s", "lda", 2, 1, 0xa3, false},
-	"ldy.d":    Opcode{"ldy.d", "ldy", 2, 1, 0xa4, false},
-	"lda.d":    Opcode{"lda.d", "lda", 2, 1, 0xa5, false},
-	"ldx.d":    Opcode{"ldx.d", "ldx", 2, 1, 0xa6, false},
-	"lda.dil":  Opcode{"lda.dil", "lda", 2, 1, 0xa7, false},
-	"tay":      Opcode{"tay", "tay", 1, 0, 0xa8, false},
-	"lda.#":    Opcode{"lda.#", "lda", 2, 1, 0xa9, false},
-	"tax":      Opcode{"tax", "tax", 1, 0, 0xaa, false},
-	"plb":      Opcode{"plb", "plb", 1, 0, 0xab, false},
-	"ldy":      Opcode{"ldy", "ldy", 3, 1, 0xac, false},
-	"lda":      Opcode{"lda", "lda", 3, 1, 0xad, false},
-	"ldx":      Opcode{"ldx", "ldx", 3, 1, 0xae, false},
-	"lda.l":    Opcode{"lda.l", "lda", 4, 1, 0xaf, false},
-	"bcs":      Opcode{"bcs", "bcs", 2, 1, 0xb0, false},
-	"lda.diy":  Opcode{"lda.diy", "lda", 2, 1, 0xb1, false},
-	"lda.di":   Opcode{"lda.di", "lda", 2, 1, 0xb2, false},
-	"lda.siy":  Opcode{"lda.siy", "lda", 2, 1, 0xb3, false},
-	"ldy.dx":   Opcode{"ldy.dx", "ldy", 2, 1, 0xb4, false},
-	"lda.dx":   Opcode{"lda.dx", "lda", 2, 1, 0xb5, false},
-	"ldx.dy":   Opcode{"ldx.dy", "ldx", 2, 1, 0xb6, false},
-	"lda.dily": Opcode{"lda.dily", "lda", 2, 1, 0xb7, false},
-	"clv":      Opcode{"clv", "clv", 1, 0, 0xb8, false},
-	"lda.y":    Opcode{"lda.y", "lda", 3, 1, 0xb9, false},
-	"tsx":      Opcode{"tsx", "tsx", 1, 0, 0xba, false},
-	"tyx":      Opcode{"tyx", "tyx", 1, 0, 0xbb, false},
-	"ldy.x":    Opcode{"ldy.x", "ldy", 3, 1, 0xbc, false},
-	"lda.x":    Opcode{"lda.x", "lda", 3, 1, 0xbd, false},
-	"ldx.y":    Opcode{"ldx.y", "ldx", 3, 1, 0xbe, false},
-	"lda.lx":   Opcode{"lda.lx", "lda", 4, 1, 0xbf, false},
-	"cpy.#":    Opcode{"cpy.#", "cpy", 2, 1, 0xc0, false},
-	"cmp.dxi":  Opcode{"cmp.dxi", "cmp", 2, 1, 0xc1, false},
-	"rep":      Opcode{"rep", "rep", 2, 1, 0xc2, false},
-	"cmp.s":    Opcode{"cmp.s", "cmp", 2, 1, 0xc3, false},
-	"cpy.d":    Opcode{"cpy.d", "cpy", 2, 1, 0xc4, false},
-	"cmp.d":    Opcode{"cmp.d", "cmp", 2, 1, 0xc5, false},
-	"dec.d":    Opcode{"dec.d", "dec", 2, 1, 0xc6, false},
-	"cmp.dil":  Opcode{"cmp.dil", "cmp", 2, 1, 0xc7, false},
-	"iny":      Opcode{"iny", "iny", 1, 0, 0xc8, false},
-	"cmp.#":    Opcode{"cmp.#", "cmp", 2, 1, 0xc9, false},
-	"dex":      Opcode{"dex", "dex", 1, 0, 0xca, false},
-	"wai":      Opcode{"wai", "wai", 1, 0, 0xcb, false},
-	"cpy":      Opcode{"cpy", "cpy", 3, 0, 0xcc, false},
-	"cmp":      Opcode{"cmp", "cmp", 3, 0, 0xcd, false},
-	"dec":      Opcode{"dec", "dec", 3, 0, 0xce, false},
-	"cmp.l":    Opcode{"cmp.l", "cmp", 4, 0, 0xcf, false},
-	"bne":      Opcode{"bne", "bne", 2, 1, 0xd0, false},
-	"cmp.diy":  Opcode{"cmp.diy", "cmp", 2, 1, 0xd1, false},
-	"cmp.di":   Opcode{"cmp.di", "cmp", 2, 1, 0xd2, false},
-	"cmp.siy":  Opcode{"cmp.siy", "cmp", 2, 1, 0xd3, false},
-	"phe.d":    Opcode{"phe.d", "pei", 2, 1, 0xd4, false},
-	"cmp.dx":   Opcode{"cmp.dx", "cmp", 2, 1, 0xd5, false},
-	"dec.dx":   Opcode{"dec.dx", "dec", 2, 1, 0xd6, false},
-	"cmp.dily": Opcode{"cmp.dily", "cmp", 2, 1, 0xd7, false},
-	"cld":      Opcode{"cld", "cld", 1, 0, 0xd8, false},
-	"cmp.y":    Opcode{"cmp.y", "cmp", 3, 1, 0xd9, false},
-	"phx":      Opcode{"phx", "phx", 1, 0, 0xda, false},
-	"stp":      Opcode{"stp", "stp", 1, 0, 0xdb, false},
-	"jmp.il":   Opcode{"jmp.il", "jml", 3, 1, 0xdc, false},
-	"cmp.x":    Opcode{"cmp.x", "cmp", 3, 1, 0xdd, false},
-	"dec.x":    Opcode{"dec.x", "dec", 3, 1, 0xde, false},
-	"cmp.lx":   Opcode{"cmp.lx", "cmp", 4, 1, 0xdf, false},
-	"cpx.#":    Opcode{"cpx.#", "cpx", 2, 1, 0xe0, false},
-	"sbc.dxi":  Opcode{"sbc.dxi", "sbc", 2, 1, 0xe1, false},
-	"sep":      Opcode{"sep", "sep", 2, 1, 0xe2, false},
-	"sbc.s":    Opcode{"sbc.s", "sbc", 2, 1, 0xe3, false},
-	"cpx.d":    Opcode{"cpx.d", "cpx", 2, 1, 0xe4, false},
-	"sbc.d":    Opcode{"sbc.d", "sbc", 2, 1, 0xe5, false},
-	"inc.d":    Opcode{"inc.d", "inc", 2, 1, 0xe6, false},
-	"sbc.dil":  Opcode{"sbc.dil", "sbc", 2, 1, 0xe7, false},
-	"inx":      Opcode{"inx", "inx", 1, 0, 0xe8, false},
-	"sbc.#":    Opcode{"sbc.#", "sbc", 2, 1, 0xe9, false},
-	"nop":      Opcode{"nop", "nop", 1, 0, 0xea, false},
-	"xba":      Opcode{"xba", "xba", 1, 0, 0xeb, false},
-	"cpx":      Opcode{"cpx", "cpx", 3, 1, 0xec, false},
-	"sbc":      Opcode{"sbc", "sbc", 3, 1, 0xed, false},
-	"inc":      Opcode{"inc", "inc", 3, 1, 0xee, false},
-	"sbc.l":    Opcode{"sbc.l", "sbc", 4, 1, 0xef, false},
-	"beq":      Opcode{"beq", "beq", 2, 1, 0xf0, false},
-	"sbc.diy":  Opcode{"sbc.diy", "sbc", 2, 1, 0xf1, false},
-	"sbc.di":   Opcode{"sbc.di", "sbc", 2, 1, 0xf2, false},
-	"sbc.siy":  Opcode{"sbc.siy", "sbc", 2, 1, 0xf3, false},
-	"phe.#":    Opcode{"phe.#", "pea", 3, 1, 0xf4, false},
-	"sbc.dx":   Opcode{"sbc.dx", "sbc", 2, 1, 0xf5, false},
-	"inc.dx":   Opcode{"inc.dx", "inc", 2, 1, 0xf6, false},
-	"sbc.dily": Opcode{"sbc.dily", "sbc", 2, 1, 0xf7, false},
-	"sed":      Opcode{"sed", "sed", 1, 0, 0xf8, false},
-	"sbc.y":    Opcode{"sbc.y", "sbc", 3, 1, 0xf9, false},
-	"plx":      Opcode{"plx", "plx", 1, 0, 0xfa, false},
-	"xce":      Opcode{"xce", "xce", 1, 0, 0xfb, false},
-	"jsr.xi":   Opcode{"jsr.xi", "jsr", 3, 1, 0xfc, false},
-	"sbc.x":    Opcode{"sbc.x", "sbc", 3, 1, 0xfd, false},
-	"inc.x":    Opcode{"inc.x", "inc", 3, 1, 0xfe, false},
-	"sbc.lx":   Opcode{"sbc.lx", "sbc", 4, 1, 0xff, false},
+	"brk":      Opcode{"brk", "brk", 2, 1, 0x00, false, 7, CycNative}, // we require a signature byte
+	"ora.dxi":  Opcode{"ora.dxi", "ora", 2, 1, 0x01, false, 6, CycM | CycDirect},
+	"cop":      Opcode{"cop", "cop", 2, 1, 0x02, false, 7, CycNative},
+	"ora.s":    Opcode{"ora.s", "ora", 2, 1, 0x03, false, 4, CycM},
+	"tsb.d":    Opcode{"tsb.d", "tsb", 2, 1, 0x04, false, 5, CycRMW | CycDirect},
+	"ora.d":    Opcode{"ora.d", "ora", 2, 1, 0x05, false, 3, CycM | CycDirect},
+	"asl.d":    Opcode{"asl.d", "asl", 2, 1, 0x06, false, 5, CycRMW | CycDirect},
+	"ora.dil":  Opcode{"ora.dil", "ora", 2, 1, 0x07, false, 6, CycM | CycDirect},
+	"php":      Opcode{"php", "php", 1, 0, 0x08, false, 3, 0},
+	"ora.#":    Opcode{"ora.#", "ora", 2, 1, 0x09, true, 2, CycM},
+	"asl.a":    Opcode{"asl.a", "asl", 1, 0, 0x0a, false, 2, 0},
+	"phd":      Opcode{"phd", "phd", 1, 0, 0x0b, false, 4, 0},
+	"tsb":      Opcode{"tsb", "tsb", 3, 1, 0x0c, false, 6, CycRMW},
+	"ora":      Opcode{"ora", "ora", 3, 1, 0x0d, false, 4, CycM},
+	"asl":      Opcode{"asl", "asl", 3, 1, 0x0e, false, 6, CycRMW},
+	"ora.l":    Opcode{"ora.l", "ora", 4, 1, 0x0f, false, 5, CycM},
+	"bpl":      Opcode{"bpl", "bpl", 2, 1, 0x10, false, 2, CycTaken | CycCross},
+	"ora.diy":  Opcode{"ora.diy", "ora", 2, 1, 0x11, false, 5, CycM | CycDirect | CycIndex},
+	"ora.di":   Opcode{"ora.di", "ora", 2, 1, 0x12, false, 5, CycM | CycDirect},
+	"ora.siy":  Opcode{"ora.siy", "ora", 2, 1, 0x13, false, 7, CycM},
+	"trb.d":    Opcode{"trb.d", "trb", 2, 1, 0x14, false, 5, CycRMW | CycDirect},
+	"ora.dx":   Opcode{"ora.dx", "ora", 2, 1, 0x15, false, 4, CycM | CycDirect},
+	"asl.dx":   Opcode{"asl.dx", "asl", 2, 1, 0x16, false, 6, CycRMW | CycDirect},
+	"ora.dily": Opcode{"ora.dily", "ora", 2, 1, 0x17, false, 6, CycM | CycDirect},
+	"clc":      Opcode{"clc", "clc", 1, 0, 0x18, false, 2, 0},
+	"ora.y":    Opcode{"ora.y", "ora", 3, 1, 0x19, false, 4, CycM | CycIndex},
+	"inc.a":    Opcode{"inc.a", "inc", 1, 0, 0x1a, false, 2, 0},
+	"tcs":      Opcode{"tcs", "tcs", 1, 0, 0x1b, false, 2, 0},
+	"trb":      Opcode{"trb", "trb", 3, 1, 0x1c, false, 6, CycRMW},
+	"ora.x":    Opcode{"ora.x", "ora", 3, 1, 0x1d, false, 4, CycM | CycIndex},
+	"asl.x":    Opcode{"asl.x", "asl", 3, 1, 0x1e, false, 7, CycRMW},
+	"ora.lx":   Opcode{"ora.lx", "ora", 4, 1, 0x1f, false, 5, CycM},
+	"jsr":      Opcode{"jsr", "jsr", 3, 1, 0x20, false, 6, 0},
+	"and.dxi":  Opcode{"and.dxi", "and", 2, 1, 0x21, false, 6, CycM | CycDirect},
+	"jsr.l":    Opcode{"jsr.l", "jsl", 4, 1, 0x22, false, 8, 0},
+	"and.s":    Opcode{"and.s", "and", 2, 1, 0x23, false, 4, CycM},
+	"bit.d":    Opcode{"bit.d", "bit", 2, 1, 0x24, false, 3, CycM | CycDirect},
+	"and.d":    Opcode{"and.d", "and", 2, 1, 0x25, false, 3, CycM | CycDirect},
+	"rol.d":    Opcode{"rol.d", "rol", 2, 1, 0x26, false, 5, CycRMW | CycDirect},
+	"and.dil":  Opcode{"and.dil", "and", 2, 1, 0x27, false, 6, CycM | CycDirect},
+	"plp":      Opcode{"plp", "plp", 1, 0, 0x28, false, 4, 0},
+	"and.#":    Opcode{"and.#", "and", 2, 1, 0x29, true, 2, CycM},
+	"rol.a":    Opcode{"rol.a", "rol", 1, 0, 0x2a, false, 2, 0},
+	"pld":      Opcode{"pld", "pld", 1, 0, 0x2b, false, 5, 0},
+	"bit":      Opcode{"bit", "bit", 3, 1, 0x2c, false, 4, CycM},
+	"and":      Opcode{"and", "and", 3, 1, 0x2d, false, 4, CycM},
+	"rol":      Opcode{"rol", "rol", 3, 1, 0x2e, false, 6, CycRMW},
+	"and.l":    Opcode{"and.l", "and", 4, 1, 0x2f, false, 5, CycM},
+	"bmi":      Opcode{"bmi", "bmi", 2, 1, 0x30, false, 2, CycTaken | CycCross},
+	"and.diy":  Opcode{"and.diy", "and", 2, 1, 0x31, false, 5, CycM | CycDirect | CycIndex},
+	"and.di":   Opcode{"and.di", "and", 2, 1, 0x32, false, 5, CycM | CycDirect},
+	"and.siy":  Opcode{"and.siy", "and", 2, 1, 0x33, false, 7, CycM},
+	"bit.dx":   Opcode{"bit.dx", "bit", 2, 1, 0x34, false, 4, CycM | CycDirect},
+	"and.dx":   Opcode{"and.dx", "and", 2, 1, 0x35, false, 4, CycM | CycDirect},
+	"rol.dx":   Opcode{"rol.dx", "rol", 2, 1, 0x36, false, 6, CycRMW | CycDirect},
+	"and.dily": Opcode{"and.dily", "and", 2, 1, 0x37, false, 6, CycM | CycDirect},
+	"sec":      Opcode{"sec", "sec", 1, 0, 0x38, false, 2, 0},
+	"and.y":    Opcode{"and.y", "and", 3, 1, 0x39, false, 4, CycM | CycIndex},
+	"dec.a":    Opcode{"dec.a", "dec", 1, 0, 0x3a, false, 2, 0},
+	"tsc":      Opcode{"tsc", "tsc", 1, 0, 0x3b, false, 2, 0},
+	"bit.x":    Opcode{"bit.x", "bit", 3, 1, 0x3c, false, 4, CycM | CycIndex},
+	"and.x":    Opcode{"and.x", "and", 3, 1, 0x3d, false, 4, CycM | CycIndex},
+	"rol.x":    Opcode{"rol.x", "rol", 3, 1, 0x3e, false, 7, CycRMW},
+	"and.lx":   Opcode{"and.lx", "and", 4, 1, 0x3f, false, 5, CycM},
+	"rti":      Opcode{"rti", "rti", 1, 0, 0x40, false, 6, CycNative},
+	"eor.dxi":  Opcode{"eor.dxi", "eor", 2, 1, 0x41, false, 6, CycM | CycDirect},
+	"wdm":      Opcode{"wdm", "wdm", 2, 1, 0x42, false, 2, 0},
+	"eor.s":    Opcode{"eor.s", "eor", 2, 1, 0x43, false, 4, CycM},
+	"mvp":      Opcode{"mvp", "mvp", 3, 2, 0x44, false, 7, CycMove}, // takes two operands
+	"eor.d":    Opcode{"eor.d", "eor", 2, 1, 0x45, false, 3, CycM | CycDirect},
+	"lsr.d":    Opcode{"lsr.d", "lsr", 2, 1, 0x46, false, 5, CycRMW | CycDirect},
+	"eor.dil":  Opcode{"eor.dil", "eor", 2, 1, 0x47, false, 6, CycM | CycDirect},
+	"pha":      Opcode{"pha", "pha", 1, 0, 0x48, false, 3, CycM},
+	"eor.#":    Opcode{"eor.#", "eor", 2, 1, 0x49, true, 2, CycM},
+	"lsr.a":    Opcode{"lsr.a", "lsr", 1, 0, 0x4a, false, 2, 0},
+	"phk":      Opcode{"phk", "phk", 1, 0, 0x4b, false, 3, 0},
+	"jmp":      Opcode{"jmp", "jmp", 3, 1, 0x4c, false, 3, 0},
+	"eor":      Opcode{"eor", "eor", 3, 1, 0x4d, false, 4, CycM},
+	"lsr":      Opcode{"lsr", "lsr", 3, 1, 0x4e, false, 6, CycRMW},
+	"eor.l":    Opcode{"eor.l", "eor", 4, 1, 0x4f, false, 5, CycM},
+	"bvc":      Opcode{"bvc", "bvc", 2, 1, 0x50, false, 2, CycTaken | CycCross},
+	"eor.diy":  Opcode{"eor.diy", "eor", 2, 1, 0x51, false, 5, CycM | CycDirect | CycIndex},
+	"eor.di":   Opcode{"eor.di", "eor", 2, 1, 0x52, false, 5, CycM | CycDirect},
+	"eor.siy":  Opcode{"eor.siy", "eor", 2, 1, 0x53, false, 7, CycM},
+	"mvn":      Opcode{"mvn", "mvn", 3, 2, 0x54, false, 7, CycMove}, // takes two operands
+	"eor.dx":   Opcode{"eor.dx", "eor", 2, 1, 0x55, false, 4, CycM | CycDirect},
+	"lsr.dx":   Opcode{"lsr.dx", "lsr", 2, 1, 0x56, false, 6, CycRMW | CycDirect},
+	"eor.dily": Opcode{"eor.dily", "eor", 2, 1, 0x57, false, 6, CycM | CycDirect},
+	"cli":      Opcode{"cli", "cli", 1, 0, 0x58, false, 2, 0},
+	"eor.y":    Opcode{"eor.y", "eor", 3, 1, 0x59, false, 4, CycM | CycIndex},
+	"phy":      Opcode{"phy", "phy", 1, 0, 0x5a, false, 3, CycX},
+	"tcd":      Opcode{"tcd", "tcd", 1, 0, 0x5b, false, 2, 0},
+	"jmp.l":    Opcode{"jmp.l", "jml", 4, 1, 0x5c, false, 4, 0},
+	"eor.x":    Opcode{"eor.x", "eor", 3, 1, 0x5d, false, 4, CycM | CycIndex},
+	"lsr.x":    Opcode{"lsr.x", "lsr", 3, 1, 0x5e, false, 7, CycRMW},
+	"eor.lx":   Opcode{"eor.lx", "eor", 4, 1, 0x5f, false, 5, CycM},
+	"rts":      Opcode{"rts", "rts", 1, 0, 0x60, false, 6, 0},
+	"adc.dxi":  Opcode{"adc.dxi", "adc", 2, 1, 0x61, false, 6, CycM | CycDirect},
+	"phe.r":    Opcode{"phe.r", "per", 2, 1, 0x62, false, 6, 0},
+	"adc.s":    Opcode{"adc.s", "adc", 2, 1, 0x63, false, 4, CycM},
+	"stz.d":    Opcode{"stz.d", "stz", 2, 1, 0x64, false, 3, CycM | CycDirect},
+	"adc.d":    Opcode{"adc.d", "adc", 2, 1, 0x65, false, 3, CycM | CycDirect},
+	"ror.d":    Opcode{"ror.d", "ror", 2, 1, 0x66, false, 5, CycRMW | CycDirect},
+	"adc.dil":  Opcode{"adc.dil", "adc", 2, 1, 0x67, false, 6, CycM | CycDirect},
+	"pla":      Opcode{"pla", "pla", 1, 0, 0x68, false, 4, CycM},
+	"adc.#":    Opcode{"adc.#", "adc", 2, 1, 0x69, true, 2, CycM},
+	"ror.a":    Opcode{"ror.a", "ror", 1, 0, 0x6a, false, 2, 0},
+	"rts.l":    Opcode{"rts.l", "rtl", 1, 0, 0x6b, false, 6, 0},
+	"jmp.i":    Opcode{"jmp.i", "jmp", 3, 1, 0x6c, false, 5, 0},
+	"adc":      Opcode{"adc", "adc", 3, 1, 0x6d, false, 4, CycM},
+	"ror":      Opcode{"ror", "ror", 3, 1, 0x6e, false, 6, CycRMW},
+	"adc.l":    Opcode{"adc.l", "adc", 4, 1, 0x6f, false, 5, CycM},
+	"bvs":      Opcode{"bvs", "bvs", 2, 1, 0x70, false, 2, CycTaken | CycCross},
+	"adc.diy":  Opcode{"adc.diy", "adc", 2, 1, 0x71, false, 5, CycM | CycDirect | CycIndex},
+	"adc.di":   Opcode{"adc.di", "adc", 2, 1, 0x72, false, 5, CycM | CycDirect},
+	"adc.siy":  Opcode{"adc.siy", "adc", 2, 1, 0x73, false, 7, CycM},
+	"stz.dx":   Opcode{"stz.dx", "stz", 2, 1, 0x74, false, 4, CycM | CycDirect},
+	"adc.dx":   Opcode{"adc.dx", "adc", 2, 1, 0x75, false, 4, CycM | CycDirect},
+	"ror.dx":   Opcode{"ror.dx", "ror", 2, 1, 0x76, false, 6, CycRMW | CycDirect},
+	"adc.dily": Opcode{"adc.dily", "adc", 2, 1, 0x77, false, 6, CycM | CycDirect},
+	"sei":      Opcode{"sei", "sei", 1, 0, 0x78, false, 2, 0},
+	"adc.y":    Opcode{"adc.y", "adc", 3, 1, 0x79, false, 4, CycM | CycIndex},
+	"ply":      Opcode{"ply", "ply", 1, 0, 0x7a, false, 4, CycX},
+	"tdc":      Opcode{"tdc", "tdc", 1, 0, 0x7b, false, 2, 0},
+	"jmp.xi":   Opcode{"jmp.xi", "jmp", 3, 1, 0x7c, false, 6, 0},
+	"adc.x":    Opcode{"adc.x", "adc", 3, 1, 0x7d, false, 4, CycM | CycIndex},
+	"ror.x":    Opcode{"ror.x", "ror", 3, 1, 0x7e, false, 7, CycRMW},
+	"adc.lx":   Opcode{"adc.lx", "adc", 4, 1, 0x7f, false, 5, CycM},
+	"bra":      Opcode{"bra", "bra", 2, 1, 0x80, false, 3, CycCross},
+	"sta.dxi":  Opcode{"sta.dxi", "sta", 2, 1, 0x81, false, 6, CycM | CycDirect},
+	"bra.l":    Opcode{"bra.l", "brl", 3, 1, 0x82, false, 4, 0},
+	"sta.s":    Opcode{"sta.s", "sta", 2, 1, 0x83, false, 4, CycM},
+	"sty.d":    Opcode{"sty.d", "sty", 2, 1, 0x84, false, 3, CycX | CycDirect},
+	"sta.d":    Opcode{"sta.d", "sta", 2, 1, 0x85, false, 3, CycM | CycDirect},
+	"stx.d":    Opcode{"stx.d", "stx", 2, 1, 0x86, false, 3, CycX | CycDirect},
+	"sta.dil":  Opcode{"sta.dil", "sta", 2, 1, 0x87, false, 6, CycM | CycDirect},
+	"dey":      Opcode{"dey", "dey", 1, 0, 0x88, false, 2, 0},
+	"bit.#":    Opcode{"bit.#", "bit", 2, 1, 0x89, true, 2, CycM},
+	"txa":      Opcode{"txa", "txa", 1, 0, 0x8a, false, 2, 0},
+	"phb":      Opcode{"phb", "phb", 1, 0, 0x8b, false, 3, 0},
+	"sty":      Opcode{"sty", "sty", 3, 1, 0x8c, false, 4, CycX},
+	"sta":      Opcode{"sta", "sta", 3, 1, 0x8d, false, 4, CycM},
+	"stx":      Opcode{"stx", "stx", 3, 1, 0x8e, false, 4, CycX},
+	"sta.l":    Opcode{"sta.l", "sta", 4, 1, 0x8f, false, 5, CycM},
+	"bcc":      Opcode{"bcc", "bcc", 2, 1, 0x90, false, 2, CycTaken | CycCross},
+	"sta.diy":  Opcode{"sta.diy", "sta", 2, 1, 0x91, false, 6, CycM | CycDirect},
+	"sta.di":   Opcode{"sta.di", "sta", 2, 1, 0x92, false, 5, CycM | CycDirect},
+	"sta.siy":  Opcode{"sta.siy", "sta", 2, 1, 0x93, false, 7, CycM},
+	"sty.dx":   Opcode{"sty.dx", "sty", 2, 1, 0x94, false, 4, CycX | CycDirect},
+	"sta.dx":   Opcode{"sta.dx", "sta", 2, 1, 0x95, false, 4, CycM | CycDirect},
+	"stx.dy":   Opcode{"stx.dy", "stx", 2, 1, 0x96, false, 4, CycX | CycDirect},
+	"sta.dily": Opcode{"sta.dily", "sta", 2, 1, 0x97, false, 6, CycM | CycDirect},
+	"tya":      Opcode{"tya", "tya", 1, 0, 0x98, false, 2, 0},
+	"sta.y":    Opcode{"sta.y", "sta", 3, 1, 0x99, false, 5, CycM},
+	"txs":      Opcode{"txs", "txs", 1, 0, 0x9a, false, 2, 0},
+	"txy":      Opcode{"txy", "txy", 1, 0, 0x9b, false, 2, 0},
+	"stz":      Opcode{"stz", "stz", 3, 1, 0x9c, false, 4, CycM},
+	"sta.x":    Opcode{"sta.x", "sta", 3, 1, 0x9d, false, 5, CycM},
+	"stz.x":    Opcode{"stz.x", "stz", 3, 1, 0x9e, false, 5, CycM},
+	"sta.lx":   Opcode{"sta.lx", "sta", 4, 1, 0x9f, false, 5, CycM},
+	"ldy.#":    Opcode{"ldy.#", "ldy", 2, 1, 0xa0, true, 2, CycX},
+	"lda.dxi":  Opcode{"lda.dxi", "lda", 2, 1, 0xa1, false, 6, CycM | CycDirect},
+	"ldx.#":    Opcode{"ldx.#", "ldx", 2, 1, 0xa2, true, 2, CycX},
+	"lda.s":    Opcode{"lda.s", "lda", 2, 1, 0xa3, false, 4, CycM},
+	"ldy.d":    Opcode{"ldy.d", "ldy", 2, 1, 0xa4, false, 3, CycX | CycDirect},
+	"lda.d":    Opcode{"lda.d", "lda", 2, 1, 0xa5, false, 3, CycM | CycDirect},
+	"ldx.d":    Opcode{"ldx.d", "ldx", 2, 1, 0xa6, false, 3, CycX | CycDirect},
+	"lda.dil":  Opcode{"lda.dil", "lda", 2, 1, 0xa7, false, 6, CycM | CycDirect},
+	"tay":      Opcode{"tay", "tay", 1, 0, 0xa8, false, 2, 0},
+	"lda.#":    Opcode{"lda.#", "lda", 2, 1, 0xa9, true, 2, CycM},
+	"tax":      Opcode{"tax", "tax", 1, 0, 0xaa, false, 2, 0},
+	"plb":      Opcode{"plb", "plb", 1, 0, 0xab, false, 4, 0},
+	"ldy":      Opcode{"ldy", "ldy", 3, 1, 0xac, false, 4, CycX},
+	"lda":      Opcode{"lda", "lda", 3, 1, 0xad, false, 4, CycM},
+	"ldx":      Opcode{"ldx", "ldx", 3, 1, 0xae, false, 4, CycX},
+	"lda.l":    Opcode{"lda.l", "lda", 4, 1, 0xaf, false, 5, CycM},
+	"bcs":      Opcode{"bcs", "bcs", 2, 1, 0xb0, false, 2, CycTaken | CycCross},
+	"lda.diy":  Opcode{"lda.diy", "lda", 2, 1, 0xb1, false, 5, CycM | CycDirect | CycIndex},
+	"lda.di":   Opcode{"lda.di", "lda", 2, 1, 0xb2, false, 5, CycM | CycDirect},
+	"lda.siy":  Opcode{"lda.siy", "lda", 2, 1, 0xb3, false, 7, CycM},
+	"ldy.dx":   Opcode{"ldy.dx", "ldy", 2, 1, 0xb4, false, 4, CycX | CycDirect},
+	"lda.dx":   Opcode{"lda.dx", "lda", 2, 1, 0xb5, false, 4, CycM | CycDirect},
+	"ldx.dy":   Opcode{"ldx.dy", "ldx", 2, 1, 0xb6, false, 4, CycX | CycDirect},
+	"lda.dily": Opcode{"lda.dily", "lda", 2, 1, 0xb7, false, 6, CycM | CycDirect},
+	"clv":      Opcode{"clv", "clv", 1, 0, 0xb8, false, 2, 0},
+	"lda.y":    Opcode{"lda.y", "lda", 3, 1, 0xb9, false, 4, CycM | CycIndex},
+	"tsx":      Opcode{"tsx", "tsx", 1, 0, 0xba, false, 2, 0},
+	"tyx":      Opcode{"tyx", "tyx", 1, 0, 0xbb, false, 2, 0},
+	"ldy.x":    Opcode{"ldy.x", "ldy", 3, 1, 0xbc, false, 4, CycX | CycIndex},
+	"lda.x":    Opcode{"lda.x", "lda", 3, 1, 0xbd, false, 4, CycM | CycIndex},
+	"ldx.y":    Opcode{"ldx.y", "ldx", 3, 1, 0xbe, false, 4, CycX | CycIndex},
+	"lda.lx":   Opcode{"lda.lx", "lda", 4, 1, 0xbf, false, 5, CycM},
+	"cpy.#":    Opcode{"cpy.#", "cpy", 2, 1, 0xc0, true, 2, CycX},
+	"cmp.dxi":  Opcode{"cmp.dxi", "cmp", 2, 1, 0xc1, false, 6, CycM | CycDirect},
+	"rep":      Opcode{"rep", "rep", 2, 1, 0xc2, false, 3, 0},
+	"cmp.s":    Opcode{"cmp.s", "cmp", 2, 1, 0xc3, false, 4, CycM},
+	"cpy.d":    Opcode{"cpy.d", "cpy", 2, 1, 0xc4, false, 3, CycX | CycDirect},
+	"cmp.d":    Opcode{"cmp.d", "cmp", 2, 1, 0xc5, false, 3, CycM | CycDirect},
+	"dec.d":    Opcode{"dec.d", "dec", 2, 1, 0xc6, false, 5, CycRMW | CycDirect},
+	"cmp.dil":  Opcode{"cmp.dil", "cmp", 2, 1, 0xc7, false, 6, CycM | CycDirect},
+	"iny":      Opcode{"iny", "iny", 1, 0, 0xc8, false, 2, 0},
+	"cmp.#":    Opcode{"cmp.#", "cmp", 2, 1, 0xc9, true, 2, CycM},
+	"dex":      Opcode{"dex", "dex", 1, 0, 0xca, false, 2, 0},
+	"wai":      Opcode{"wai", "wai", 1, 0, 0xcb, false, 3, 0},
+	"cpy":      Opcode{"cpy", "cpy", 3, 1, 0xcc, false, 4, CycX},
+	"cmp":      Opcode{"cmp", "cmp", 3, 1, 0xcd, false, 4, CycM},
+	"dec":      Opcode{"dec", "dec", 3, 1, 0xce, false, 6, CycRMW},
+	"cmp.l":    Opcode{"cmp.l", "cmp", 4, 1, 0xcf, false, 5, CycM},
+	"bne":      Opcode{"bne", "bne", 2, 1, 0xd0, false, 2, CycTaken | CycCross},
+	"cmp.diy":  Opcode{"cmp.diy", "cmp", 2, 1, 0xd1, false, 5, CycM | CycDirect | CycIndex},
+	"cmp.di":   Opcode{"cmp.di", "cmp", 2, 1, 0xd2, false, 5, CycM | CycDirect},
+	"cmp.siy":  Opcode{"cmp.siy", "cmp", 2, 1, 0xd3, false, 7, CycM},
+	"phe.d":    Opcode{"phe.d", "pei", 2, 1, 0xd4, false, 6, CycDirect},
+	"cmp.dx":   Opcode{"cmp.dx", "cmp", 2, 1, 0xd5, false, 4, CycM | CycDirect},
+	"dec.dx":   Opcode{"dec.dx", "dec", 2, 1, 0xd6, false, 6, CycRMW | CycDirect},
+	"cmp.dily": Opcode{"cmp.dily", "cmp", 2, 1, 0xd7, false, 6, CycM | CycDirect},
+	"cld":      Opcode{"cld", "cld", 1, 0, 0xd8, false, 2, 0},
+	"cmp.y":    Opcode{"cmp.y", "cmp", 3, 1, 0xd9, false, 4, CycM | CycIndex},
+	"phx":      Opcode{"phx", "phx", 1, 0, 0xda, false, 3, CycX},
+	"stp":      Opcode{"stp", "stp", 1, 0, 0xdb, false, 3, 0},
+	"jmp.il":   Opcode{"jmp.il", "jml", 3, 1, 0xdc, false, 6, 0},
+	"cmp.x":    Opcode{"cmp.x", "cmp", 3, 1, 0xdd, false, 4, CycM | CycIndex},
+	"dec.x":    Opcode{"dec.x", "dec", 3, 1, 0xde, false, 7, CycRMW},
+	"cmp.lx":   Opcode{"cmp.lx", "cmp", 4, 1, 0xdf, false, 5, CycM},
+	"cpx.#":    Opcode{"cpx.#", "cpx", 2, 1, 0xe0, true, 2, CycX},
+	"sbc.dxi":  Opcode{"sbc.dxi", "sbc", 2, 1, 0xe1, false, 6, CycM | CycDirect},
+	"sep":      Opcode{"sep", "sep", 2, 1, 0xe2, false, 3, 0},
+	"sbc.s":    Opcode{"sbc.s", "sbc", 2, 1, 0xe3, false, 4, CycM},
+	"cpx.d":    Opcode{"cpx.d", "cpx", 2, 1, 0xe4, false, 3, CycX | CycDirect},
+	"sbc.d":    Opcode{"sbc.d", "sbc", 2, 1, 0xe5, false, 3, CycM | CycDirect},
+	"inc.d":    Opcode{"inc.d", "inc", 2, 1, 0xe6, false, 5, CycRMW | CycDirect},
+	"sbc.dil":  Opcode{"sbc.dil", "sbc", 2, 1, 0xe7, false, 6, CycM | CycDirect},
+	"inx":      Opcode{"inx", "inx", 1, 0, 0xe8, false, 2, 0},
+	"sbc.#":    Opcode{"sbc.#", "sbc", 2, 1, 0xe9, true, 2, CycM},
+	"nop":      Opcode{"nop", "nop", 1, 0, 0xea, false, 2, 0},
+	"xba":      Opcode{"xba", "xba", 1, 0, 0xeb, false, 3, 0},
+	"cpx":      Opcode{"cpx", "cpx", 3, 1, 0xec, false, 4, CycX},
+	"sbc":      Opcode{"sbc", "sbc", 3, 1, 0xed, false, 4, CycM},
+	"inc":      Opcode{"inc", "inc", 3, 1, 0xee, false, 6, CycRMW},
+	"sbc.l":    Opcode{"sbc.l", "sbc", 4, 1, 0xef, false, 5, CycM},
+	"beq":      Opcode{"beq", "beq", 2, 1, 0xf0, false, 2, CycTaken | CycCross},
+	"sbc.diy":  Opcode{"sbc.diy", "sbc", 2, 1, 0xf1, false, 5, CycM | CycDirect | CycIndex},
+	"sbc.di":   Opcode{"sbc.di", "sbc", 2, 1, 0xf2, false, 5, CycM | CycDirect},
+	"sbc.siy":  Opcode{"sbc.siy", "sbc", 2, 1, 0xf3, false, 7, CycM},
+	"phe.#":    Opcode{"phe.#", "pea", 3, 1, 0xf4, false, 5, 0},
+	"sbc.dx":   Opcode{"sbc.dx", "sbc", 2, 1, 0xf5, false, 4, CycM | CycDirect},
+	"inc.dx":   Opcode{"inc.dx", "inc", 2, 1, 0xf6, false, 6, CycRMW | CycDirect},
+	"sbc.dily": Opcode{"sbc.dily", "sbc", 2, 1, 0xf7, false, 6, CycM | CycDirect},
+	"sed":      Opcode{"sed", "sed", 1, 0, 0xf8, false, 2, 0},
+	"sbc.y":    Opcode{"sbc.y", "sbc", 3, 1, 0xf9, false, 4, CycM | CycIndex},
+	"plx":      Opcode{"plx", "plx", 1, 0, 0xfa, false, 4, CycX},
+	"xce":      Opcode{"xce", "xce", 1, 0, 0xfb, false, 2, 0},
+	"jsr.xi":   Opcode{"jsr.xi", "jsr", 3, 1, 0xfc, false, 8, 0},
+	"sbc.x":    Opcode{"sbc.x", "sbc", 3, 1, 0xfd, false, 4, CycM | CycIndex},
+	"inc.x":    Opcode{"inc.x", "inc", 3, 1, 0xfe, false, 7, CycRMW},
+	"sbc.lx":   Opcode{"sbc.lx", "sbc", 4, 1, 0xff, false, 5, CycM},
 }
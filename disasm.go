@@ -0,0 +1,94 @@
+// Disassemble command for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// "cthulhu disasm" takes a binary file and the address it is loaded to, and
+// produces Simpler Assembler Notation (SAN) source code that assembles to the
+// same binary. See the disassembler package for details.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"cthulhu/disassembler"
+)
+
+// disasm takes the command line arguments after "disasm", disassembles the
+// input file and saves or prints the result
+func disasm(args []string) {
+
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	dInput := fs.String("i", "", "Binary input file (REQUIRED)")
+	dOutput := fs.String("o", "", "Output file for SAN source (default: standard output)")
+	dMPU := fs.String("m", "65c02", "MPU type")
+	dAddr := fs.String("a", "", "Load address of the binary, such as $8000 (REQUIRED)")
+	dSymbols := fs.String("s", "", "Symbol file with names, hints, and data areas")
+	fs.Parse(args)
+
+	if *dMPU != "6502" && *dMPU != "65c02" && *dMPU != "65816" {
+		log.Fatalf("FATAL MPU '%s' not supported", *dMPU)
+	}
+	if *dInput == "" {
+		log.Fatal("FATAL No input file provided")
+	}
+	if *dAddr == "" {
+		log.Fatal("FATAL No load address provided")
+	}
+
+	addr, err := strconv.ParseInt(strings.Replace(*dAddr, "$", "0x", 1), 0, 64)
+	if err != nil {
+		log.Fatalf("FATAL Can't convert load address '%s'", *dAddr)
+	}
+
+	code, err := os.ReadFile(*dInput)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var syms disassembler.Symbols
+
+	if *dSymbols != "" {
+		symbolFile, err := os.Open(*dSymbols)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer symbolFile.Close()
+
+		var ls []string
+
+		scanner := bufio.NewScanner(symbolFile)
+		for scanner.Scan() {
+			ls = append(ls, scanner.Text())
+		}
+
+		var errs int
+
+		syms, errs = disassembler.ReadSymbols(*dSymbols, ls)
+		if errs != 0 {
+			log.Fatalf("DISASSEMBLER FATAL: Found %d error(s) in symbol file", errs)
+		}
+	}
+
+	out, errs := disassembler.Disassembler(*dMPU, int(addr), code, syms)
+	if errs != 0 {
+		log.Fatalf("DISASSEMBLER FATAL: Found %d error(s).", errs)
+	}
+
+	s := strings.Join(out, "\n") + "\n"
+
+	if *dOutput == "" {
+		fmt.Print(s)
+	} else {
+		err := os.WriteFile(*dOutput, []byte(s), 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
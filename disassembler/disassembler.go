@@ -0,0 +1,440 @@
+// Disassembler package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The disassembler takes a binary and turns it into Simpler Assembler Notation
+// (SAN) source code that reassembles to exactly the same bytes. It uses the
+// reverse index of the opcode tables. Because the length of the immediate
+// instructions of the 65816 depends on the size of the registers, it tracks
+// the status of the MPU from "rep", "sep", and "xce" the same way the
+// assembler does. When that isn't enough, the user can give hints. Branch and
+// jump targets inside the binary get labels, and the names from the symbol
+// file are used for the addresses they stand for
+
+package disassembler
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cthulhu/data"
+)
+
+const (
+	errTag = "DISASSEMBLER"
+
+	indent1 = "        "
+	indent2 = indent1 + indent1
+	comment = 40 // column for the comments with address and bytes
+)
+
+// line is a single instruction or a bit of data in the binary
+type line struct {
+	addr   int
+	code   []byte
+	oc     data.Opcode
+	isData bool
+	hints  []string // status hints that come before this line
+}
+
+// disassembler holds the state of a run of the disassembler or of reading a
+// symbol file
+type disassembler struct {
+	errCount int
+	fileName string
+	lineNum  int
+
+	// Status of the 65816, same as in the analyzer
+	emulated bool
+	a8       bool
+	xy8      bool
+	carry    int // -1 if we don't know, otherwise 0 or 1 for "xce"
+}
+
+// reportErr takes a string and prints an error report to the standard error
+// output
+func (ds *disassembler) reportErr(s string) {
+	fmt.Fprintf(os.Stderr, "%s ERROR (%s, %d): %s\n",
+		errTag, ds.fileName, ds.lineNum, s)
+	ds.errCount++
+}
+
+// Disassembler takes the MPU, the address the binary is loaded to, the binary
+// and the information from the symbol file, and returns the source code as
+// a slice of lines, as well as the number of errors found
+func Disassembler(mpu string, origin int, code []byte, syms Symbols) ([]string, int) {
+
+	var out []string
+
+	ds := &disassembler{fileName: syms.fileName}
+
+	ls := ds.decode(mpu, origin, code, syms)
+
+	// Every line starts a place we could put a label, but hints must
+	// come before an instruction
+	starts := map[int]bool{}
+	hinted := map[int]bool{}
+
+	for _, l := range ls {
+		starts[l.addr] = true
+		hinted[l.addr] = len(l.hints) > 0
+	}
+
+	for a := range syms.Hints {
+		if hinted[a] {
+			continue
+		}
+		if a >= origin && a < origin+len(code) {
+			ds.reportErr(fmt.Sprintf("Hint for $%04X is not at the start of an instruction", a))
+		}
+	}
+
+	labels := makeLabels(ls, syms, starts)
+
+	out = append(out, "; Disassembled by the Cthulhu Assembler")
+	out = append(out, fmt.Sprintf("%s.mpu \"%s\"", indent1, mpu))
+	out = append(out, fmt.Sprintf("%s.origin $%04X", indent1, origin))
+
+	// Names that we can't use as labels become symbols
+	var equs []int
+	for _, a := range syms.Order {
+		if labels[a] != syms.Names[a] {
+			equs = append(equs, a)
+		}
+	}
+
+	if len(equs) > 0 {
+		out = append(out, "")
+		for _, a := range equs {
+			out = append(out, fmt.Sprintf("%s.equ %s $%04X", indent1, syms.Names[a], a))
+		}
+	}
+
+	out = append(out, "")
+
+	for _, l := range ls {
+
+		if name, ok := labels[l.addr]; ok {
+			out = append(out, name+":")
+		}
+
+		for _, h := range l.hints {
+			out = append(out, indent1+h)
+		}
+
+		var s string
+
+		if l.isData {
+			var bs []string
+			for _, b := range l.code {
+				bs = append(bs, fmt.Sprintf("$%02X", b))
+			}
+			s = indent1 + ".byte " + strings.Join(bs, ", ")
+		} else {
+			s = indent2 + instruction(l, syms, labels)
+		}
+
+		out = append(out, addComment(s, l))
+	}
+
+	return out, ds.errCount
+}
+
+// decode takes the binary and splits it into instructions and data
+func (ds *disassembler) decode(mpu string, origin int, code []byte, syms Symbols) []line {
+	var ls []line
+	var bad []byte // bytes that are not opcodes
+
+	ds.resetStatus()
+
+	// flush turns the bytes that are not opcodes into data
+	flush := func(a int) {
+		if len(bad) > 0 {
+			ls = append(ls, line{addr: a - len(bad), code: bad, isData: true})
+			bad = nil
+		}
+	}
+
+	for i := 0; i < len(code); {
+		a := origin + i
+
+		if end, ok := isData(a, syms); ok {
+			flush(a)
+
+			// Eight bytes per line at most
+			for i < len(code) && origin+i <= end {
+				j := i + 8
+				if j > len(code) || origin+j > end+1 {
+					j = end + 1 - origin
+					if j > len(code) {
+						j = len(code)
+					}
+				}
+				ls = append(ls, line{addr: origin + i, code: code[i:j], isData: true})
+				i = j
+			}
+			continue
+		}
+
+		hs := syms.Hints[a]
+		for _, h := range hs {
+			ds.applyHint(h, a)
+		}
+
+		oc, ok := data.OpcodesByValue[mpu][code[i]]
+		length := oc.Length
+
+		if ok && oc.Embiggens && mpu == "65816" {
+			if (data.IndexImmediates[oc.SAN] && !ds.xy8) ||
+				(!data.IndexImmediates[oc.SAN] && !ds.a8) {
+				length++
+			}
+		}
+
+		if !ok || i+length > len(code) {
+			bad = append(bad, code[i])
+			i++
+			continue
+		}
+
+		flush(a)
+
+		l := line{addr: a, code: code[i : i+length], oc: oc, hints: hs}
+		ds.trackStatus(l, mpu)
+		ls = append(ls, l)
+
+		i += length
+	}
+
+	flush(origin + len(code))
+
+	return ls
+}
+
+// isData takes an address and the symbols, and returns the end of the data
+// area and true if the address is data
+func isData(a int, syms Symbols) (int, bool) {
+	for _, r := range syms.Data {
+		if a >= r[0] && a <= r[1] {
+			return r[1], true
+		}
+	}
+	return 0, false
+}
+
+// makeLabels returns the names of all addresses that get a label. The names
+// from the symbol file are used if they are at the start of a line, targets of
+// branches and jumps get a name made up from their address
+func makeLabels(ls []line, syms Symbols, starts map[int]bool) map[int]string {
+
+	labels := map[int]string{}
+
+	for a, name := range syms.Names {
+		if starts[a] {
+			labels[a] = name
+		}
+	}
+
+	for _, l := range ls {
+		a, ok := target(l)
+		if !ok || !starts[a] {
+			continue
+		}
+
+		if _, ok := labels[a]; !ok {
+			labels[a] = fmt.Sprintf("l%04X", a)
+		}
+	}
+
+	return labels
+}
+
+// target takes a line and returns the address it branches or jumps to, and a
+// flag if there is one
+func target(l line) (int, bool) {
+
+	if l.isData {
+		return 0, false
+	}
+
+	v := operand(l)
+
+	switch {
+	case data.Relative[l.oc.SAN]:
+		return v, true
+	case l.oc.SAN == "jmp" || l.oc.SAN == "jsr":
+		return l.addr&0xff0000 | v, true
+	case l.oc.SAN == "jmp.l" || l.oc.SAN == "jsr.l":
+		return v, true
+	}
+
+	return 0, false
+}
+
+// operand takes a line with an instruction and returns the value of the
+// operand. For branches, this is the address of the target
+func operand(l line) int {
+	v := 0
+	width := len(l.code) - 1
+
+	for i := width; i > 0; i-- {
+		v = v<<8 | int(l.code[i])
+	}
+
+	if data.Relative[l.oc.SAN] {
+		if v >= 1<<uint(8*width-1) {
+			v -= 1 << uint(8*width)
+		}
+		v += l.addr + len(l.code)
+	}
+
+	return v
+}
+
+// instruction takes a line with an instruction and returns it in SAN
+func instruction(l line, syms Symbols, labels map[int]string) string {
+
+	if l.oc.Operands == 0 {
+		return l.oc.SAN
+	}
+
+	if l.oc.Operands == 2 {
+		return fmt.Sprintf("%s $%02X, $%02X", l.oc.SAN, l.code[2], l.code[1])
+	}
+
+	v := operand(l)
+	width := len(l.code) - 1
+
+	// Immediate values and signatures are never names
+	switch {
+	case strings.HasSuffix(l.oc.SAN, ".#"), l.oc.SAN == "brk", l.oc.SAN == "cop",
+		l.oc.SAN == "wdm", l.oc.SAN == "rep", l.oc.SAN == "sep":
+		return fmt.Sprintf("%s $%0*X", l.oc.SAN, 2*width, v)
+	}
+
+	if a, ok := target(l); ok {
+		if name, ok := labels[a]; ok {
+			return l.oc.SAN + " " + name
+		}
+		if data.Relative[l.oc.SAN] {
+			return fmt.Sprintf("%s $%04X", l.oc.SAN, a)
+		}
+	}
+
+	if name, ok := syms.Names[v]; ok {
+		return l.oc.SAN + " " + name
+	}
+
+	return fmt.Sprintf("%s $%0*X", l.oc.SAN, 2*width, v)
+}
+
+// addComment takes a line of source code and adds the address and bytes as a
+// comment
+func addComment(s string, l line) string {
+	var bs []string
+
+	for _, b := range l.code {
+		bs = append(bs, fmt.Sprintf("%02X", b))
+	}
+
+	if len(l.code) > 8 {
+		bs = append(bs[:8], "...")
+	}
+
+	pad := comment - len(s)
+	if pad < 1 {
+		pad = 1
+	}
+
+	return fmt.Sprintf("%s%s; %04X: %s", s, strings.Repeat(" ", pad), l.addr, strings.Join(bs, " "))
+}
+
+// resetStatus puts the MPU in the state it has after a reset
+func (ds *disassembler) resetStatus() {
+	ds.emulated = true
+	ds.a8 = true
+	ds.xy8 = true
+	ds.carry = -1
+}
+
+// applyHint takes a status hint from the symbol file and the address it is for
+// and changes the status accordingly
+func (ds *disassembler) applyHint(h string, a int) {
+
+	switch h {
+	case ".!native":
+		ds.emulated = false
+	case ".!emulated":
+		ds.emulated, ds.a8, ds.xy8 = true, true, true
+	case ".!a8", ".!xy8", ".!axy8":
+		ds.applyStatus(true, bits(h))
+	default:
+		if ds.emulated {
+			ds.reportErr(fmt.Sprintf("Hint '%s' for $%04X not possible in emulated mode", h, a))
+			return
+		}
+		ds.applyStatus(false, bits(h))
+	}
+}
+
+// bits takes a status hint and returns the bits of the status register it
+// changes, as with rep and sep
+func bits(h string) int {
+	switch {
+	case strings.HasPrefix(h, ".!axy"):
+		return 0x30
+	case strings.HasPrefix(h, ".!xy"):
+		return 0x10
+	}
+	return 0x20
+}
+
+// applyStatus takes a flag for sep (as opposed to rep) and the bits to change,
+// and sets the register sizes accordingly
+func (ds *disassembler) applyStatus(set bool, bits int) {
+
+	if ds.emulated {
+		return // registers are always 8 bit
+	}
+
+	if bits&0x20 != 0 {
+		ds.a8 = set
+	}
+	if bits&0x10 != 0 {
+		ds.xy8 = set
+	}
+}
+
+// trackStatus takes an instruction and tracks the changes it makes to the
+// status of the 65816, exactly as the assembler does
+func (ds *disassembler) trackStatus(l line, mpu string) {
+
+	if mpu != "65816" {
+		return
+	}
+
+	switch l.oc.SAN {
+
+	case "clc":
+		ds.carry = 0
+		return
+
+	case "sec":
+		ds.carry = 1
+		return
+
+	case "xce":
+		switch ds.carry {
+		case 0:
+			ds.emulated = false
+		case 1:
+			ds.emulated, ds.a8, ds.xy8 = true, true, true
+		}
+
+	case "rep", "sep":
+		ds.applyStatus(l.oc.SAN == "sep", int(l.code[1]))
+	}
+
+	ds.carry = -1
+}
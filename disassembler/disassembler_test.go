@@ -0,0 +1,51 @@
+// Test file for disassembler, part of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package disassembler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassembler(t *testing.T) {
+	var tests = []struct {
+		mpu  string
+		code []byte
+		want []string
+	}{
+		{"6502", []byte{0xea}, []string{"nop"}},
+		{"6502", []byte{0xa9, 0x12}, []string{"lda.# $12"}},
+		{"6502", []byte{0x80, 0x00}, []string{".byte $80, $00"}}, // no bra on the 6502
+		{"65c02", []byte{0x80, 0xfe}, []string{"bra l8000"}},
+		{"65816", []byte{0xa9, 0x12, 0xea}, []string{"lda.# $12", "nop"}},
+		{"65816", []byte{0x18, 0xfb, 0xc2, 0x20, 0xa9, 0x34, 0x12},
+			[]string{"clc", "xce", "rep $20", "lda.# $1234"}},
+		{"65816", []byte{0x44, 0x01, 0x02}, []string{"mvp $02, $01"}},
+		{"65816", []byte{0xb7, 0x10}, []string{"lda.dily $10"}},
+		{"65816", []byte{0xaf, 0x56, 0x34, 0x12}, []string{"lda.l $123456"}},
+		{"65816", []byte{0xa9}, []string{".byte $A9"}},
+	}
+
+	for _, test := range tests {
+		out, errs := Disassembler(test.mpu, 0x8000, test.code, Symbols{})
+
+		var got []string
+		for _, l := range out {
+			l = strings.TrimSpace(l)
+			if i := strings.Index(l, ";"); i >= 0 {
+				l = strings.TrimSpace(l[:i])
+			}
+			if l == "" || strings.HasPrefix(l, ".mpu") || strings.HasPrefix(l, ".origin") ||
+				strings.HasSuffix(l, ":") {
+				continue
+			}
+			got = append(got, l)
+		}
+
+		if errs != 0 || strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("Disassembler(%s, % X) = %q, want %q", test.mpu, test.code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Symbol files for the Cthulhu Assembler disassembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The symbol file tells the disassembler what the user knows about the binary.
+// Each line is one of the following, comments start with ";":
+//
+//	.equ name value         name of an address or constant
+//	name = value            the same in traditional notation
+//	name value              the same, as in simple symbol lists
+//	.!a16 address           status hint for the 65816, any of the ".!"
+//	                        directives of the assembler
+//	.byte start end         data, not code, from start to end inclusive
+//
+// Values are hex with "$", binary with "%", or decimal, just as in SAN
+
+package disassembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Symbols holds the information from the symbol file
+type Symbols struct {
+	Names map[int]string   // address and name, first definition wins
+	Order []int            // addresses in the order they were defined
+	Hints map[int][]string // address and the status hints for it
+	Data  [][2]int         // ranges of addresses that are data
+
+	fileName string // for errors with hints found by the disassembler
+}
+
+// Status hints the disassembler understands. These are the same as the
+// assembler directives
+var hints = map[string]bool{
+	".!native": true, ".!emulated": true, ".!a8": true, ".!a16": true,
+	".!xy8": true, ".!xy16": true, ".!axy8": true, ".!axy16": true,
+}
+
+// ReadSymbols takes the name of the symbol file and its lines, and returns the
+// information as well as the number of errors found
+func ReadSymbols(fn string, ls []string) (Symbols, int) {
+
+	syms := Symbols{Names: map[int]string{}, Hints: map[int][]string{}, fileName: fn}
+	ds := &disassembler{fileName: fn}
+
+	for i, l := range ls {
+		ds.lineNum = i + 1
+
+		if c := strings.Index(l, ";"); c >= 0 {
+			l = l[:c]
+		}
+
+		ws := strings.Fields(strings.Replace(l, "=", " = ", 1))
+		if len(ws) == 0 {
+			continue
+		}
+
+		switch {
+
+		case len(ws) == 2 && hints[ws[0]]:
+			v, ok := ds.parseValue(ws[1])
+			if ok {
+				syms.Hints[v] = append(syms.Hints[v], ws[0])
+			}
+
+		case len(ws) == 3 && ws[0] == ".byte":
+			v1, ok1 := ds.parseValue(ws[1])
+			v2, ok2 := ds.parseValue(ws[2])
+			if ok1 && ok2 {
+				syms.Data = append(syms.Data, [2]int{v1, v2})
+			}
+
+		case len(ws) == 3 && ws[0] == ".equ":
+			ds.addName(&syms, ws[1], ws[2])
+
+		case len(ws) == 3 && ws[1] == "=":
+			ds.addName(&syms, ws[0], ws[2])
+
+		case len(ws) == 2:
+			ds.addName(&syms, ws[0], ws[1])
+
+		default:
+			ds.reportErr(fmt.Sprintf("Can't understand line '%s'", strings.TrimSpace(l)))
+		}
+	}
+
+	return syms, ds.errCount
+}
+
+// addName takes the symbol table, a name and a value string, and adds the
+// name if it isn't taken yet
+func (ds *disassembler) addName(syms *Symbols, name, value string) {
+
+	v, ok := ds.parseValue(value)
+	if !ok {
+		return
+	}
+
+	if _, ok := syms.Names[v]; ok {
+		return // first definition wins
+	}
+
+	syms.Names[v] = name
+	syms.Order = append(syms.Order, v)
+}
+
+// parseValue takes a number string in SAN notation and returns the value and
+// a flag for success
+func (ds *disassembler) parseValue(s string) (int, bool) {
+	base := 10
+
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s, base = s[1:], 16
+	case strings.HasPrefix(s, "0x"):
+		s, base = s[2:], 16
+	case strings.HasPrefix(s, "%"):
+		s, base = s[1:], 2
+	}
+
+	if base != 10 {
+		s = strings.Replace(s, ":", "", -1)
+		s = strings.Replace(s, ".", "", -1)
+	}
+
+	v, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		ds.reportErr(fmt.Sprintf("Can't convert '%s' to a number", s))
+		return 0, false
+	}
+
+	return int(v), true
+}
@@ -0,0 +1,618 @@
+// Exporter package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The exporter takes the program after the analyzer is done with it and
+// writes it as traditional WDC-style assembler source, so it can be shared
+// with people who use ca65 or 64tass. Operand sizes are always forced, and the
+// register sizes of the 65816 are declared whenever an immediate operand
+// changes size, so the other assemblers produce exactly the same binary.
+// Operands are either symbolic, as in the original source, or resolved to
+// numbers. Things the other assemblers do differently -- RPN terms, anonymous
+// labels -- are always resolved
+
+package exporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+const (
+	errTag = "EXPORTER"
+
+	indent1 = "        "         // directives
+	indent2 = "                " // instructions
+)
+
+// Dialect holds the parts of the syntax that are different for each of the
+// assemblers we export to
+type Dialect struct {
+	CPU      map[string]string // names of the MPUs
+	SetCPU   string            // directive to select the MPU
+	Origin   string            // format to set the address
+	Byte     string            // directive for bytes
+	Text     string            // directive for bytes that include strings
+	Word     string            // directive for 16-bit values
+	Word24   string            // directive for 24-bit values
+	Fill     string            // format to fill a number of bytes with one
+	A8, A16  string            // register size of A
+	XY8      string            // register size of X and Y
+	XY16     string            // register size of X and Y
+	Direct   string            // prefix to force direct page addressing
+	Absolute string            // prefix to force absolute addressing
+	Long     string            // prefix to force long addressing
+	Bank     string            // format of a bank operand of mvp and mvn
+}
+
+// Dialects are the assemblers we can export to
+var Dialects = map[string]Dialect{
+	"ca65": Dialect{
+		CPU:    map[string]string{"6502": "6502", "65c02": "65C02", "65816": "65816"},
+		SetCPU: ".setcpu", Origin: ".org $%04X", Fill: ".res %d, $%02X",
+		Byte: ".byte", Text: ".byte", Word: ".word", Word24: ".faraddr",
+		A8: ".a8", A16: ".a16", XY8: ".i8", XY16: ".i16",
+		Direct: "z:", Absolute: "a:", Long: "f:",
+		Bank: "#$%02X",
+	},
+	"64tass": Dialect{
+		CPU:    map[string]string{"6502": "6502", "65c02": "65c02", "65816": "65816"},
+		SetCPU: ".cpu", Origin: "* = $%04X", Fill: ".fill %d, $%02X",
+		Byte: ".byte", Text: ".text", Word: ".word", Word24: ".long",
+		A8: ".as", A16: ".al", XY8: ".xs", XY16: ".xl",
+		Direct: "@b ", Absolute: "@w ", Long: "@l ",
+		Bank: "$%02X",
+	},
+}
+
+// Format of the operand for the SAN mode suffixes
+var modes = map[string]string{
+	"": "%s", "#": "#%s", "d": "%s", "dx": "%s,x", "dy": "%s,y",
+	"x": "%s,x", "y": "%s,y", "l": "%s", "lx": "%s,x",
+	"di": "(%s)", "dxi": "(%s,x)", "diy": "(%s),y", "dil": "[%s]",
+	"dily": "[%s],y", "s": "%s,s", "siy": "(%s,s),y",
+	"i": "(%s)", "xi": "(%s,x)", "il": "[%s]", "r": "%s",
+}
+
+// Instructions where the WDC mnemonic already tells the other assemblers
+// everything, so we don't force the size of the operand
+var unforced = map[string]string{
+	"jmp": "%s", "jsr": "%s", "jmp.l": "%s", "jsr.l": "%s", "bra.l": "%s",
+	"phe.#": "%s", "phe.d": "(%s)", "phe.r": "%s",
+}
+
+// Binary and unary operators in the syntax of the other assemblers
+var (
+	binaryOps = map[string]string{
+		"+": "+", "-": "-", "*": "*", "/": "/",
+		".and": "&", ".or": "|", ".xor": "^", ".lshift": "<<", ".rshift": ">>",
+	}
+
+	unaryOps = map[string]string{
+		".lsb": "<", ".msb": ">", ".bank": "^",
+	}
+)
+
+// exporter holds the state while we export a program
+type exporter struct {
+	diags []data.Diagnostic
+
+	dialect  Dialect
+	resolved bool
+	mpu      string
+	pc       int
+
+	symbols map[string]data.Symbol // symbol table from the analyzer
+	names   map[*node.Node]string  // symbol table names of SYMBOL nodes
+	mangled map[string]string      // names the other assemblers can handle
+	sizeA   int                    // size of A the other assembler assumes
+	sizeXY  int                    // size of X and Y the other assembler assumes
+}
+
+// reportErr takes a string and the current node and adds an error to the list
+func (ex *exporter) reportErr(s string, n *node.Node) {
+	ex.diags = append(ex.diags, data.At(errTag, n.Token, s))
+}
+
+// Exporter takes the machine after the analyzer and generator are done, the
+// name of the dialect and a flag if the operands should be resolved, and
+// returns the source code as a slice of lines and the errors found
+func Exporter(m *data.Machine, d string, r bool) ([]string, []data.Diagnostic) {
+	var ls []string
+
+	ex := &exporter{
+		dialect: Dialects[d], resolved: r, mpu: m.MPU, symbols: m.Symbols,
+		sizeA: 8, sizeXY: 8,
+	}
+
+	ex.initNames()
+
+	ls = append(ls, fmt.Sprintf("; Exported for %s by the Cthulhu Assembler", d))
+	ls = append(ls, fmt.Sprintf("%s%s \"%s\"", indent1, ex.dialect.SetCPU, ex.dialect.CPU[ex.mpu]))
+
+	for _, n := range m.AST.Kids {
+		ex.pc = n.Addr
+		ls = append(ls, ex.export(n)...)
+	}
+
+	return ls, ex.diags
+}
+
+// initNames walks the symbol table to find out which symbol each SYMBOL node
+// refers to, and gives every symbol a name that the other assemblers accept
+func (ex *exporter) initNames() {
+	var keys []string
+
+	ex.names = map[*node.Node]string{}
+	ex.mangled = map[string]string{}
+	taken := map[string]bool{}
+
+	for k, sym := range ex.symbols {
+		keys = append(keys, k)
+		for _, r := range sym.Refs {
+			ex.names[r] = k
+		}
+	}
+
+	// Sort so we get the same names every time
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := Mangle(k)
+		for taken[strings.ToLower(s)] {
+			s += "_"
+		}
+		taken[strings.ToLower(s)] = true
+		ex.mangled[k] = s
+	}
+}
+
+// Mangle takes the name of a symbol in the symbol table and returns a version
+// with only letters, digits and underscores. Local labels lose their
+// underscore and get the number of their scope, because the other assemblers
+// treat labels that start with an underscore or "@" differently. The label
+// files for emulators use the same names
+func Mangle(k string) string {
+	var b strings.Builder
+
+	scope := ""
+	if i := strings.LastIndex(k, "/"); i >= 0 {
+		scope = k[i+1:]
+		k = strings.TrimPrefix(k[:i], "_")
+	}
+
+	for _, r := range k {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "_%02x", r)
+		}
+	}
+
+	s := b.String()
+
+	if scope != "" {
+		s = fmt.Sprintf("%s__%s", s, scope)
+	}
+
+	// Names of registers and mnemonics confuse the other assemblers
+	ls := strings.ToLower(s)
+	if len(ls) == 1 || isMnemonic(ls) || strings.HasPrefix(ls, "_") {
+		s = "s_" + s
+	}
+
+	return s
+}
+
+// isMnemonic returns true if the string is a WDC mnemonic
+func isMnemonic(s string) bool {
+	for _, oc := range data.Opcodes65816 {
+		if oc.WDC == s {
+			return true
+		}
+	}
+	return false
+}
+
+// export takes a top level node and returns the lines for it
+func (ex *exporter) export(n *node.Node) []string {
+
+	switch n.Type {
+
+	case token.LABEL:
+		return []string{ex.mangled[n.Text] + ":"}
+
+	case token.LOCAL_LABEL:
+		for k, sym := range ex.symbols {
+			if sym.Type == "local" && sym.File == n.File && sym.Line == n.Line &&
+				strings.HasPrefix(k, n.Text+"/") {
+				return []string{ex.mangled[k] + ":"}
+			}
+		}
+
+	case token.DIREC:
+		// Directives that switch the status of the 65816 are exported
+		// as instructions
+		if len(n.Code) == 2 {
+			oc := data.OpcodesByValue["65816"][n.Code[0]]
+			if n.Code[1] == 0xfb {
+				return []string{indent2 + oc.WDC, indent2 + "xce"}
+			}
+			return []string{fmt.Sprintf("%s%s #$%02X", indent2, oc.WDC, n.Code[1])}
+		}
+
+	case token.DIREC_PARA:
+		switch n.Text {
+
+		case ".origin":
+			return []string{indent1 + fmt.Sprintf(ex.dialect.Origin, n.Addr)}
+
+		case ".segment":
+			return []string{indent1 + fmt.Sprintf(ex.dialect.Origin, n.Addr) + " ; " + n.Kids[0].Text}
+
+		case ".equ":
+			return []string{ex.exportEqu(n)}
+
+		case ".byte":
+			return ex.exportBytes(n)
+
+		case ".word":
+			return ex.exportWords(n, ex.dialect.Word, 2)
+
+		case ".long":
+			return ex.exportWords(n, ex.dialect.Word24, 3)
+
+		case ".asciiz", ".pstring", ".hstring":
+			return ex.exportData(n)
+
+		case ".advance", ".skip", ".align":
+			return ex.exportFill(n)
+		}
+
+	case token.OPC_0:
+		oc := data.OpcodesSAN[ex.mpu][n.Text]
+		if strings.HasSuffix(n.Text, ".a") {
+			return []string{indent2 + oc.WDC + " a"}
+		}
+		return []string{indent2 + oc.WDC}
+
+	case token.OPC_1:
+		return ex.exportInstruction(n)
+
+	case token.OPC_2:
+		oc := data.OpcodesSAN[ex.mpu][n.Text]
+		src := fmt.Sprintf(ex.dialect.Bank, n.Code[2])
+		dst := fmt.Sprintf(ex.dialect.Bank, n.Code[1])
+		return []string{fmt.Sprintf("%s%s %s,%s", indent2, oc.WDC, src, dst)}
+	}
+
+	return nil
+}
+
+// exportEqu takes a .equ directive and returns the assignment
+func (ex *exporter) exportEqu(n *node.Node) string {
+	name := n.Kids[0].Text
+	v := ex.symbols[name].Value
+
+	s, sv, ok := ex.symbolic(n.Kids[1])
+	if !ok || sv != v {
+		s = hex(v, 0)
+	}
+
+	return fmt.Sprintf("%s = %s", ex.mangled[name], s)
+}
+
+// exportBytes takes a .byte directive and returns the data. Strings and values
+// that fit in a byte are kept, everything else is taken from the binary
+func (ex *exporter) exportBytes(n *node.Node) []string {
+	var ws []string
+
+	directive := ex.dialect.Byte
+
+	for _, k := range n.Kids {
+
+		switch k.Type {
+
+		case token.STRING:
+			if !ex.resolved && printable(k.Text) && string(k.Code) == k.Text {
+				ws = append(ws, "\""+k.Text+"\"")
+				directive = ex.dialect.Text
+				continue
+			}
+
+		case token.EXPR, token.RPN:
+			s, sv, ok := ex.symbolic(k)
+			if !ex.resolved && ok && len(k.Code) == 1 && sv == int(k.Code[0]) {
+				ws = append(ws, s)
+				continue
+			}
+		}
+
+		// Everything else, including ranges, is resolved
+		for _, b := range k.Code {
+			ws = append(ws, hex(int(b), 1))
+		}
+	}
+
+	return []string{fmt.Sprintf("%s%s %s", indent1, directive, strings.Join(ws, ", "))}
+}
+
+// exportWords takes a .word or .long directive, the directive of the dialect
+// and the number of bytes of each value, and returns the data. Values that
+// fit are kept as they are, everything else is taken from the binary
+func (ex *exporter) exportWords(n *node.Node, directive string, width int) []string {
+	var ws []string
+
+	for _, k := range n.Kids {
+
+		switch k.Type {
+
+		case token.STRING:
+			for _, b := range k.Code {
+				ws = append(ws, hex(int(b), width))
+			}
+			continue
+
+		case token.EXPR, token.RPN:
+			s, sv, ok := ex.symbolic(k)
+			if !ex.resolved && ok && len(k.Code) == width && sv == littleEndian(k.Code) {
+				ws = append(ws, s)
+				continue
+			}
+		}
+
+		for i := 0; i+width <= len(k.Code); i += width {
+			ws = append(ws, hex(littleEndian(k.Code[i:i+width]), width))
+		}
+	}
+
+	return []string{fmt.Sprintf("%s%s %s", indent1, directive, strings.Join(ws, ", "))}
+}
+
+// exportFill takes an .advance, .skip or .align directive and returns the
+// bytes it fills. The addresses are already known, so this is the same for
+// all three
+func (ex *exporter) exportFill(n *node.Node) []string {
+	if len(n.Code) == 0 {
+		return nil
+	}
+
+	for _, b := range n.Code {
+		if b != n.Code[0] {
+			return ex.exportData(n)
+		}
+	}
+
+	return []string{indent1 + fmt.Sprintf(ex.dialect.Fill, len(n.Code), n.Code[0])}
+}
+
+// littleEndian takes bytes in little endian and returns their value
+func littleEndian(bs []byte) int {
+	v := 0
+	for i := len(bs) - 1; i >= 0; i-- {
+		v = v<<8 | int(bs[i])
+	}
+	return v
+}
+
+// exportData takes one of the string directives and returns its bytes as
+// they are in the binary, since the other assemblers don't agree on how to
+// write them
+func (ex *exporter) exportData(n *node.Node) []string {
+	var ws []string
+
+	for _, b := range n.Code {
+		ws = append(ws, hex(int(b), 1))
+	}
+
+	return []string{fmt.Sprintf("%s%s %s", indent1, ex.dialect.Byte, strings.Join(ws, ", "))}
+}
+
+// printable returns true if the string can be used as it is in the other
+// assemblers, which don't know our escapes
+func printable(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// exportInstruction takes an instruction with one operand and returns it in
+// WDC syntax
+func (ex *exporter) exportInstruction(n *node.Node) []string {
+	var ls []string
+
+	oc := data.OpcodesSAN[ex.mpu][n.Text]
+	width := len(n.Code) - 1
+
+	// The signature bytes are not handled the same way by all assemblers
+	switch n.Text {
+	case "brk", "cop", "wdm":
+		return []string{fmt.Sprintf("%s.byte $%02X, $%02X ; %s", indent1, n.Code[0], n.Code[1], oc.WDC)}
+	}
+
+	// The operand we find in the binary
+	v := 0
+	for i := width; i > 0; i-- {
+		v = v<<8 | int(n.Code[i])
+	}
+
+	if data.Relative[n.Text] {
+		if v >= 1<<uint(8*width-1) {
+			v -= 1 << uint(8*width)
+		}
+		v += n.Addr + len(n.Code)
+		width = 0
+	}
+
+	s, sv, ok := ex.symbolic(n.Kids[0])
+	if ex.resolved || !ok || sv != v {
+		s = hex(v, width)
+	}
+
+	suffix := ""
+	if i := strings.Index(n.Text, "."); i >= 0 {
+		suffix = n.Text[i+1:]
+	}
+
+	format, ok := unforced[n.Text]
+
+	if data.Relative[n.Text] {
+		format = "%s"
+	} else if !ok {
+		format = modes[suffix]
+
+		switch suffix {
+		case "d", "dx", "dy":
+			s = ex.dialect.Direct + s
+		case "", "x", "y":
+			s = ex.dialect.Absolute + s
+		case "l", "lx":
+			s = ex.dialect.Long + s
+		}
+	}
+
+	// Tell the other assembler the size of the registers if they changed
+	if oc.Embiggens && ex.mpu == "65816" {
+		size := 8 * (len(n.Code) - 1)
+
+		switch {
+		case data.IndexImmediates[n.Text] && size != ex.sizeXY:
+			ex.sizeXY = size
+			d := ex.dialect.XY8
+			if size == 16 {
+				d = ex.dialect.XY16
+			}
+			ls = append(ls, indent1+d)
+
+		case !data.IndexImmediates[n.Text] && size != ex.sizeA:
+			ex.sizeA = size
+			d := ex.dialect.A8
+			if size == 16 {
+				d = ex.dialect.A16
+			}
+			ls = append(ls, indent1+d)
+		}
+	}
+
+	return append(ls, indent2+oc.WDC+" "+fmt.Sprintf(format, s))
+}
+
+// symbolic takes an operand and returns it in the syntax of the other
+// assemblers, its value and a flag if that was possible. Only single values
+// and simple math terms are converted, not RPN terms or anonymous labels
+func (ex *exporter) symbolic(n *node.Node) (string, int, bool) {
+
+	switch n.Type {
+
+	case token.DEC_NUM:
+		return hex(n.Value, 1), n.Value, true
+
+	case token.STRING:
+		// Strings in other encodings than ASCII are resolved
+		if len(n.Code) != 1 || string(n.Code) != n.Text || !printable(n.Text) || n.Text == "'" {
+			return "", 0, false
+		}
+		return "'" + n.Text + "'", int(n.Code[0]), true
+
+	case token.SYMBOL:
+		k, ok := ex.names[n]
+		if !ok {
+			return "", 0, false
+		}
+		return ex.mangled[k], ex.symbols[k].Value, true
+
+	case token.DIREC:
+		if n.Text == ".here" {
+			return "*", ex.pc, true
+		}
+
+	case token.EXPR:
+		switch len(n.Kids) {
+
+		case 1:
+			return ex.symbolic(n.Kids[0])
+
+		case 2:
+			op, ok1 := unaryOps[n.Kids[0].Text]
+			s, v, ok2 := ex.symbolic(n.Kids[1])
+			if !ok1 || !ok2 {
+				return "", 0, false
+			}
+
+			switch op {
+			case "<":
+				v = v & 0xff
+			case ">":
+				v = (v >> 8) & 0xff
+			case "^":
+				v = (v >> 16) & 0xff
+			}
+
+			return op + s, v, true
+
+		case 3:
+			op, ok1 := binaryOps[n.Kids[1].Text]
+			s1, v1, ok2 := ex.symbolic(n.Kids[0])
+			s2, v2, ok3 := ex.symbolic(n.Kids[2])
+			if !ok1 || !ok2 || !ok3 {
+				return "", 0, false
+			}
+
+			var v int
+
+			switch op {
+			case "+":
+				v = v1 + v2
+			case "-":
+				v = v1 - v2
+			case "*":
+				v = v1 * v2
+			case "/":
+				if v2 == 0 {
+					return "", 0, false
+				}
+				v = v1 / v2
+			case "&":
+				v = v1 & v2
+			case "|":
+				v = v1 | v2
+			case "^":
+				v = v1 ^ v2
+			case "<<":
+				v = v1 << uint(v2)
+			case ">>":
+				v = v1 >> uint(v2)
+			}
+
+			return s1 + op + s2, v, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// hex takes a value and the number of bytes, and returns the value as a hex
+// number with a "$". If the number of bytes is zero, we use as many as we need
+func hex(v, width int) string {
+	if width == 0 {
+		switch {
+		case v > 0xffff:
+			width = 3
+		case v > 0xff:
+			width = 2
+		default:
+			width = 1
+		}
+	}
+
+	return fmt.Sprintf("$%0*X", 2*width, v)
+}
@@ -0,0 +1,68 @@
+// Test file for the exporter of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package exporter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cthulhu/assembler"
+)
+
+// The files in testdata are what ca65 and 64tass get for program.asm, and
+// must assemble to program.bin with them. A change to these files has to be
+// checked with both assemblers
+func TestExporter(t *testing.T) {
+
+	src, err := os.ReadFile(filepath.Join("testdata", "program.asm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := assembler.New("")
+	s.Add("program.asm", strings.NewReader(string(src)))
+
+	r := s.Assemble("program.asm")
+	if !r.OK() {
+		t.Fatalf("got diagnostics %v", r.Diagnostics)
+	}
+
+	bin, err := os.ReadFile(filepath.Join("testdata", "program.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.Code, bin) {
+		t.Fatalf("got code % x, want % x", r.Code, bin)
+	}
+
+	var tests = []struct {
+		dialect  string
+		resolved bool
+		file     string
+	}{
+		{"ca65", false, "program.ca65.s"},
+		{"64tass", false, "program.64tass.s"},
+		{"ca65", true, "program.resolved.ca65.s"},
+	}
+
+	for _, test := range tests {
+		want, err := os.ReadFile(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ls, ds := Exporter(r.Machine, test.dialect, test.resolved)
+		if len(ds) > 0 {
+			t.Errorf("%s: got diagnostics %v", test.file, ds)
+		}
+
+		if got := strings.Join(ls, "\n") + "\n"; got != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.file, got, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+; Exported for 64tass by the Cthulhu Assembler
+        .cpu "65816"
+        * = $8000
+io = $4200
+ptr = $10
+reset:
+                clc
+                xce
+                rep #$30
+        .al
+                lda #$1234
+        .xl
+                ldx #ptr+$02
+                sta @w io
+                sta @b ptr
+                sta @l $7E2000
+                lda (ptr),y
+                sep #$20
+        .as
+                lda #<reset
+loop__1:
+                dex
+                bne loop__1
+                bra $801C
+                jsl print
+                mvn $7E,$00
+        .byte $00, $00 ; brk
+print:
+                rtl
+text:
+        .text "Hello", $0D, ptr
+        .word reset, $0020
+        .long print
+        .byte $6F, $6B, $00
+        .fill 3, $EA
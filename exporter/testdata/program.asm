@@ -0,0 +1,32 @@
+; Test program for the exporter of the Cthulhu Assembler
+
+        .mpu "65816"
+        .origin $8000
+        .equ io $4200
+        .equ ptr $10
+
+reset:  .native
+        .axy16
+        lda.# $1234
+        ldx.# ptr+2
+        sta io
+        sta.d ptr
+        sta.l $7E2000
+        lda.diy ptr
+        .a8
+        lda.# .lsb reset
+        .scope
+_loop:  dex
+        bne _loop
+        .scend
+@       bra -
+        jsr.l print
+        mvn $7E, $00
+        brk $00
+print:  rts.l
+
+text:   .byte "Hello", 13, ptr
+        .word reset, {ptr 2 *}
+        .long print
+        .asciiz "ok"
+        .skip 3, $ea
@@ -0,0 +1,35 @@
+; Exported for ca65 by the Cthulhu Assembler
+        .setcpu "65816"
+        .org $8000
+io = $4200
+ptr = $10
+reset:
+                clc
+                xce
+                rep #$30
+        .a16
+                lda #$1234
+        .i16
+                ldx #ptr+$02
+                sta a:io
+                sta z:ptr
+                sta f:$7E2000
+                lda (ptr),y
+                sep #$20
+        .a8
+                lda #<reset
+loop__1:
+                dex
+                bne loop__1
+                bra $801C
+                jsl print
+                mvn #$7E,#$00
+        .byte $00, $00 ; brk
+print:
+                rtl
+text:
+        .byte "Hello", $0D, ptr
+        .word reset, $0020
+        .faraddr print
+        .byte $6F, $6B, $00
+        .res 3, $EA
@@ -0,0 +1,35 @@
+; Exported for ca65 by the Cthulhu Assembler
+        .setcpu "65816"
+        .org $8000
+io = $4200
+ptr = $10
+reset:
+                clc
+                xce
+                rep #$30
+        .a16
+                lda #$1234
+        .i16
+                ldx #$0012
+                sta a:$4200
+                sta z:$10
+                sta f:$7E2000
+                lda ($10),y
+                sep #$20
+        .a8
+                lda #$00
+loop__1:
+                dex
+                bne $8019
+                bra $801C
+                jsl $008027
+                mvn #$7E,#$00
+        .byte $00, $00 ; brk
+print:
+                rtl
+text:
+        .byte $48, $65, $6C, $6C, $6F, $0D, $10
+        .word $8000, $0020
+        .faraddr $008027
+        .byte $6F, $6B, $00
+        .res 3, $EA
@@ -1,23 +1,90 @@
 // Generator package for the Cthulhu Assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 12. May 2018
-// This version: 12. May 2018
+// This version: 19. Oct 2026
 
 // The generator is what turns the Abstact Syntax Tree (AST) into a binary file
 
 package generator
 
 import (
-	"fmt"
-
+	"cthulhu/data"
 	"cthulhu/node"
+	"cthulhu/token"
 )
 
-// The generator takes the Analyzed AST created by the analyzer and saves a
-// binary file
-// modifies it in various ways
-func Generator(aAst *node.Node) {
+// The generator takes the machine with the AST completed by the analyzer and
+// collects the bytes of the instructions and directives of each segment. The
+// segments are placed by address in machine.Code, which is then saved as a
+// binary file. Gaps between them are filled with zeros. The code of the tests
+// is kept apart
+func Generator(m *data.Machine) {
+
+	var ns []*node.Node
+	seg := -1
+
+	for _, n := range m.AST.Kids {
+		if n.Type == token.DIREC_PARA && (n.Text == ".origin" || n.Text == ".segment") {
+			if seg >= 0 {
+				m.Segments[seg].Code = collect(ns)
+			}
+			ns = nil
+			seg++
+			continue
+		}
+		ns = append(ns, n)
+	}
+
+	if seg >= 0 {
+		m.Segments[seg].Code = collect(ns)
+	}
+
+	// The segments of object files are placed by the linker
+	if !m.Object {
+		m.Origin, m.Code = Place(m.Segments)
+	}
+
+	for i, t := range m.Tests {
+		m.Tests[i].Code = collect(t.Node.Kids[1:])
+	}
+}
+
+// Place takes the segments and returns the lowest address and the bytes of
+// all segments at their addresses
+func Place(ss []data.Segment) (int, []byte) {
+	if len(ss) == 0 {
+		return 0, nil
+	}
+
+	low, high := ss[0].Start, ss[0].Start
+	for _, s := range ss {
+		if s.Start < low {
+			low = s.Start
+		}
+		if s.Start+len(s.Code) > high {
+			high = s.Start + len(s.Code)
+		}
+	}
+
+	bs := make([]byte, high-low)
+	for _, s := range ss {
+		copy(bs[s.Start-low:], s.Code)
+	}
+
+	return low, bs
+}
+
+// collect takes a list of nodes and returns their bytes
+func collect(ns []*node.Node) []byte {
+	var bs []byte
+
+	for _, n := range ns {
 
-	fmt.Println("(Generator not working yet)")
+		switch n.Type {
+		case token.OPC_0, token.OPC_1, token.OPC_2, token.DIREC, token.DIREC_PARA:
+			bs = append(bs, n.Code...)
+		}
+	}
 
+	return bs
 }
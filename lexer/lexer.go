@@ -1,15 +1,16 @@
 // Lexer package for the Cthulhu assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 02. May 2018
-// This version: 07. June 2018
+// This version: 19. Oct 2026
 
 package lexer
 
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -22,9 +23,21 @@ const (
 	errTag = "LEXER"
 )
 
-var (
-	errCount int
+// Opener takes the name of a file and returns its contents. This lets the
+// lexer read files from somewhere other than the disk, such as memory
+type Opener func(name string) (io.ReadCloser, error)
+
+// lexer holds the state of one run of the lexer, so that several can run at
+// the same time
+type lexer struct {
+	mpu       string
+	open      Opener
+	diags     []data.Diagnostic
+	including []string       // files we are in the middle of, the main file first
+	from      []data.Related // where each of the files after the main file was included
+}
 
+var (
 	// We can handle single-character tokens with this table and a loop.
 	// DOLLAR ('$') is not included currently because it would screw up the
 	// lexer's hex number detection; same for PERIOD ('.') because it
@@ -57,23 +70,48 @@ var (
 	}
 )
 
-// reportErr takes a string, the name of the current file, the current line and
-// character index and prints an error report to the standard error output
-func reportErr(s string, fn string, l, i int) {
-	fmt.Fprintf(os.Stderr, "%s ERROR (%s, %d, %d): %s\n",
-		errTag, fn, l+1, i+1, s)
-	errCount++
+// reportErr takes a string, the name of the current file, the current line,
+// and the character indices of the start and end of the problem, and adds an
+// error to the list
+func (lx *lexer) reportErr(s string, fn string, l, i, e int) {
+	lx.report(data.Diagnostic{
+		Stage: errTag, File: fn, Line: l + 1, Column: i + 1,
+		EndLine: l + 1, EndColumn: e + 1, Message: s,
+	})
+}
+
+// report takes a diagnostic and adds it to the list
+func (lx *lexer) report(d data.Diagnostic) {
+	lx.diags = append(lx.diags, d)
+}
+
+// dropLine takes the tokens and the index of the first token of the current
+// line, and removes the tokens of the line except for labels. We do this
+// after an error so the parser doesn't complain about what is left of the
+// line, while the labels stay defined for the analyzer
+func dropLine(tokens *[]token.Token, start int) {
+	ts := (*tokens)[:start]
+
+	for _, t := range (*tokens)[start:] {
+		if t.Type == token.LABEL || t.Type == token.LOCAL_LABEL || t.Type == token.ANON_LABEL {
+			ts = append(ts, t)
+		}
+	}
+
+	*tokens = ts
 }
 
 // addToken takes the token identifier, the actual text of the token from the
-// source code, the row and index the token was found in, and adds it to the
-// token stream. We have to pass the pointer to the slice of tokens because Go
-// doesn't allow nested functions
-func addToken(tokens *[]token.Token, ti int, s string, l int, i int, f string) {
-	s0 := strings.TrimSpace(s)
-	l0 := l + 1 // computers count line from 0, humans from 1
-	i0 := i + 1 // computers count from column 0, humans from 1
-	*tokens = append(*tokens, token.Token{Type: ti, Text: s0, Line: l0, Index: i0, File: f})
+// source code, the line, the index of the first character and of the first
+// character after the token, and the file, and adds it to the token stream.
+// Lines and indices count from 0 here, as Go does, while the token counts from
+// 1, as humans do. We have to pass the pointer to the slice of tokens because
+// Go doesn't allow nested functions
+func addToken(tokens *[]token.Token, ti int, s string, l int, i, e int, f string) {
+	*tokens = append(*tokens, token.Token{
+		Type: ti, Text: strings.TrimSpace(s), File: f,
+		Line: l + 1, Index: i + 1, EndLine: l + 1, EndIndex: e + 1,
+	})
 }
 
 // findBinEOW takes an array of runes and returns the index of the first
@@ -210,8 +248,14 @@ func findSymbolEOW(rs []rune) int {
 func findStringEOW(rs []rune) (int, bool) {
 	f := false
 	t := 0
-	for i, c := range rs {
-		if c == '"' {
+	for i := 0; i < len(rs); i++ {
+		// Escapes such as \" are resolved by the analyzer, we only
+		// make sure they don't end the string
+		if rs[i] == '\\' {
+			i++
+			continue
+		}
+		if rs[i] == '"' {
 			t = i // don't include the quote itself
 			f = true
 			break
@@ -256,6 +300,38 @@ func isCommentLine(s string) bool {
 	return f
 }
 
+// isIncluding takes the name of a file and returns true if we are already in
+// the middle of lexing it
+func (lx *lexer) isIncluding(fn string) bool {
+	for _, f := range lx.including {
+		if f == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// includedFrom returns the places the file we are lexing was included from,
+// starting with the main file
+func (lx *lexer) includedFrom() []data.Related {
+	return append([]data.Related(nil), lx.from...)
+}
+
+// directiveNames returns the names of all directives, sorted, for suggestions
+func directiveNames() []string {
+	var ds []string
+
+	for d := range data.Directives {
+		if d != "..." {
+			ds = append(ds, d)
+		}
+	}
+
+	sort.Strings(ds)
+
+	return ds
+}
+
 // isDirective takes a string and checks to see if it is a recognized
 // directive
 func isDirective(s string) bool {
@@ -351,20 +427,43 @@ func whichMne(rs []rune, mpu string) (int, bool) {
 	return oc.Operands, ok
 }
 
-// Lexer takes the mpu type and the name of a file to scan and returns a list of
-// tokens. If there are .include files in the mix, it will call itself
-func Lexer(mpu string, filename string) *[]token.Token {
+// Scan takes the mpu type, the name of a file to scan, and where to get files
+// from, and returns a list of tokens and the errors found. If the Opener is
+// nil, files are read from disk
+func Scan(mpu string, filename string, open Opener) ([]token.Token, []data.Diagnostic) {
+
+	if open == nil {
+		open = func(name string) (io.ReadCloser, error) { return os.Open(name) }
+	}
+
+	lx := lexer{mpu: mpu, open: open}
+
+	tokens, err := lx.lex(filename)
+	if err != nil {
+		lx.diags = append(lx.diags, data.Diagnostic{Stage: errTag, File: filename, Message: err.Error()})
+	}
+
+	return tokens, lx.diags
+}
+
+// lex takes the name of a file to scan and returns a list of tokens. If
+// there are .include files in the mix, it will call itself. An error is only
+// returned if the file can't be read
+func (lx *lexer) lex(filename string) ([]token.Token, error) {
 
 	var tokens []token.Token
 	var ls []string
 
-	inputFile, err := os.Open(filename)
+	input, err := lx.open(filename)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer inputFile.Close()
+	defer input.Close()
 
-	scanner := bufio.NewScanner(inputFile)
+	lx.including = append(lx.including, filename)
+	defer func() { lx.including = lx.including[:len(lx.including)-1] }()
+
+	scanner := bufio.NewScanner(input)
 	scanner.Split(bufio.ScanLines)
 
 	for scanner.Scan() {
@@ -378,22 +477,27 @@ func Lexer(mpu string, filename string) *[]token.Token {
 		// Check for empty lines. We add a token to allow
 		// formatting
 		if isEmpty(l) {
-			addToken(&tokens, token.EMPTY, "", ln, 1, filename)
-			addToken(&tokens, token.EOL, "\n", ln, 1, filename)
+			addToken(&tokens, token.EMPTY, "", ln, 0, 0, filename)
+			addToken(&tokens, token.EOL, "\n", ln, 0, 0, filename)
 			continue
 		}
 
 		// See if this is a whole-line comment, which gets a different
 		// token than the comments in-line
 		if isCommentLine(l) {
-			addToken(&tokens, token.COMMENT_LINE, l, ln, 1, filename)
-			addToken(&tokens, token.EOL, "\n", ln, 1, filename)
+			cs := []rune(l)
+			i := len(cs) - len([]rune(strings.TrimLeftFunc(l, unicode.IsSpace)))
+			e := len([]rune(strings.TrimRightFunc(l, unicode.IsSpace)))
+			addToken(&tokens, token.COMMENT_LINE, l, ln, i, e, filename)
+			addToken(&tokens, token.EOL, "\n", ln, len(cs), len(cs), filename)
 			continue
 		}
 
-		// INNER LOOP: Proceed char-by-char
+		// INNER LOOP: Proceed char-by-char. After an error, we drop what
+		// we have of the line and skip the rest
 
 		cs := []rune(l)
+		start := len(tokens)
 		for i := 0; i < len(cs); i++ {
 
 			// Skip over whitespace
@@ -404,7 +508,7 @@ func Lexer(mpu string, filename string) *[]token.Token {
 			// Single character tokenization (@ and friends).
 			t, got := isSingleCharToken(cs[i])
 			if got {
-				addToken(&tokens, t, string(cs[i]), ln, i, filename)
+				addToken(&tokens, t, string(cs[i]), ln, i, i+1, filename)
 				continue
 			}
 
@@ -412,7 +516,7 @@ func Lexer(mpu string, filename string) *[]token.Token {
 			if unicode.IsNumber(cs[i]) {
 				e := findDecEOW(cs[i:len(cs)])
 				word := cs[i : i+e]
-				addToken(&tokens, token.DEC_NUM, string(word), ln, i, filename)
+				addToken(&tokens, token.DEC_NUM, string(word), ln, i, i+e, filename)
 				i = i + e - 1 // continue adds one
 				continue
 			}
@@ -425,7 +529,7 @@ func Lexer(mpu string, filename string) *[]token.Token {
 			// In-line comments. Always run till the end of the line
 			case ';':
 				word := string(cs[i:len(cs)])
-				addToken(&tokens, token.COMMENT, word, ln, i, filename)
+				addToken(&tokens, token.COMMENT, word, ln, i, len(cs), filename)
 				i = len(cs)
 				continue
 
@@ -440,7 +544,7 @@ func Lexer(mpu string, filename string) *[]token.Token {
 					// can be used for various things such
 					// as listings of bytes
 					if word == "..." {
-						addToken(&tokens, token.ELLIPSIS, word, ln, i, filename)
+						addToken(&tokens, token.ELLIPSIS, word, ln, i, i+e, filename)
 						i = i + e - 1 // continue adds one
 						continue
 					}
@@ -453,17 +557,43 @@ func Lexer(mpu string, filename string) *[]token.Token {
 						fn, ef, ok := getIncludeFile(cs[i:len(cs)])
 						if !ok {
 							es := "Error getting .include file"
-							reportErr(es, fn, ln, i)
+							lx.reportErr(es, filename, ln, i, len(cs))
+							dropLine(&tokens, start)
+							i = len(cs)
+							continue
+						}
+
+						if lx.isIncluding(fn) {
+							es := fmt.Sprintf("File '%s' includes itself", fn)
+							lx.report(data.Diagnostic{
+								Stage: errTag, File: filename, Line: ln + 1, Column: i + 1,
+								EndLine: ln + 1, EndColumn: i + ef + 2, Message: es,
+								Related: lx.includedFrom(),
+							})
+							dropLine(&tokens, start)
+							i = len(cs)
 							continue
 						}
 
-						inclTokens := Lexer(mpu, fn)
+						lx.from = append(lx.from, data.Related{
+							File: filename, Line: ln + 1, Column: i + 1,
+							Message: fmt.Sprintf("'%s' included here", fn),
+						})
+						inclTokens, err := lx.lex(fn)
+						lx.from = lx.from[:len(lx.from)-1]
+
+						if err != nil {
+							lx.reportErr(err.Error(), filename, ln, i, i+ef+1)
+							dropLine(&tokens, start)
+							i = len(cs)
+							continue
+						}
 
 						// Remove the last token, which
 						// is an EOF
-						*inclTokens = (*inclTokens)[0 : len(*inclTokens)-1]
+						inclTokens = inclTokens[0 : len(inclTokens)-1]
 
-						tokens = append(tokens, *inclTokens...)
+						tokens = append(tokens, inclTokens...)
 
 						i = i + ef
 						continue
@@ -476,18 +606,27 @@ func Lexer(mpu string, filename string) *[]token.Token {
 					_, ok := data.DirectivesPara[word]
 
 					if ok {
-						addToken(&tokens, token.DIREC_PARA, word, ln, i, filename)
+						addToken(&tokens, token.DIREC_PARA, word, ln, i, i+e, filename)
 					} else {
 
-						addToken(&tokens, token.DIREC, word, ln, i, filename)
+						addToken(&tokens, token.DIREC, word, ln, i, i+e, filename)
 					}
 
 					i = i + e - 1 // continue adds one
 					continue
 				}
 
-				es := fmt.Sprintf("Unknown directive '%s'", word)
-				reportErr(es, filename, ln, i)
+				d := data.Diagnostic{
+					Stage: errTag, File: filename, Line: ln + 1, Column: i + 1,
+					EndLine: ln + 1, EndColumn: i + e + 1,
+					Message: fmt.Sprintf("Unknown directive '%s'", word),
+				}
+				if sug := data.Suggest(word, directiveNames()); sug != "" {
+					d.Hint = fmt.Sprintf("Did you mean '%s'?", sug)
+				}
+				lx.report(d)
+				dropLine(&tokens, start)
+				i = len(cs)
 				continue
 
 			// Binary number
@@ -495,7 +634,7 @@ func Lexer(mpu string, filename string) *[]token.Token {
 				i++ // skip '%' symbol
 				e := findBinEOW(cs[i:len(cs)])
 				word := cs[i : i+e]
-				addToken(&tokens, token.BIN_NUM, string(word), ln, i, filename)
+				addToken(&tokens, token.BIN_NUM, string(word), ln, i-1, i+e, filename)
 				i = i + e - 1 // continue adds one
 				continue
 
@@ -505,7 +644,7 @@ func Lexer(mpu string, filename string) *[]token.Token {
 				i++ // skip '$' symbol
 				e := findHexEOW(cs[i:len(cs)])
 				word := cs[i : i+e]
-				addToken(&tokens, token.HEX_NUM, string(word), ln, i, filename)
+				addToken(&tokens, token.HEX_NUM, string(word), ln, i-1, i+e, filename)
 				i = i + e - 1 // continue adds one
 				continue
 
@@ -518,9 +657,12 @@ func Lexer(mpu string, filename string) *[]token.Token {
 				// First character after the underscore must be an
 				// upper- or lowercase letter because a label is
 				// basically just a symbol
-				if !unicode.IsLetter(cs[i]) {
-					reportErr("Letter required after initial local label underscore",
-						filename, ln, i)
+				if i >= len(cs) || !unicode.IsLetter(cs[i]) {
+					lx.reportErr("Letter required after initial local label underscore",
+						filename, ln, i-1, i)
+					dropLine(&tokens, start)
+					i = len(cs)
+					continue
 				}
 
 				e := findSymbolEOW(cs[i:len(cs)])
@@ -534,14 +676,14 @@ func Lexer(mpu string, filename string) *[]token.Token {
 					nc := cs[i+e]
 
 					if nc == ':' {
-						addToken(&tokens, token.LOCAL_LABEL, string(word), ln, i, filename)
+						addToken(&tokens, token.LOCAL_LABEL, string(word), ln, i-1, i+e, filename)
 						i = i + e // continue adds one, but skip colon
 						continue
 					}
 				}
 
 				// Not a local label, just some sort of symbol
-				addToken(&tokens, token.SYMBOL, string(word), ln, i, filename)
+				addToken(&tokens, token.SYMBOL, string(word), ln, i-1, i+e, filename)
 				i = i + e - 1 // continue adds one
 				continue
 
@@ -552,12 +694,14 @@ func Lexer(mpu string, filename string) *[]token.Token {
 				i++ // skip leading quote
 				e, ok := findStringEOW(cs[i:len(cs)])
 				if !ok {
-					reportErr("Can't find closing quotation mark", filename, ln, i)
+					lx.reportErr("Can't find closing quotation mark", filename, ln, i-1, len(cs))
+					dropLine(&tokens, start)
+					i = len(cs)
 					continue
 				}
 
 				word := cs[i : i+e]
-				addToken(&tokens, token.STRING, string(word), ln, i, filename)
+				addToken(&tokens, token.STRING, string(word), ln, i-1, i+e+1, filename)
 				i = i + e // skip over final quote
 				continue
 			}
@@ -574,10 +718,10 @@ func Lexer(mpu string, filename string) *[]token.Token {
 				// the information about what kind of opcode we
 				// have -- one with zero, one, or two (65816
 				// only) operands
-				tt, e, ok = procMne(cs[i:len(cs)], mpu)
+				tt, e, ok = procMne(cs[i:len(cs)], lx.mpu)
 
 				if ok {
-					addToken(&tokens, tt, string(cs[i:i+e]), ln, i, filename)
+					addToken(&tokens, tt, string(cs[i:i+e]), ln, i, i+e, filename)
 					i = i + e - 1 // continue adds one
 					continue
 				}
@@ -592,14 +736,14 @@ func Lexer(mpu string, filename string) *[]token.Token {
 					nc := cs[i+e]
 
 					if nc == ':' {
-						addToken(&tokens, token.LABEL, string(word), ln, i, filename)
+						addToken(&tokens, token.LABEL, string(word), ln, i, i+e, filename)
 						i = i + e // continue adds one, but skip colon
 						continue
 					}
 				}
 
 				// This is just a symbol then
-				addToken(&tokens, token.SYMBOL, string(word), ln, i, filename)
+				addToken(&tokens, token.SYMBOL, string(word), ln, i, i+e, filename)
 				i = i + e - 1 // continue adds one
 				continue
 			}
@@ -607,20 +751,18 @@ func Lexer(mpu string, filename string) *[]token.Token {
 			// We don't believe in illegal tokens. If we got here,
 			// we report it immediately and attempt to continue
 			es := fmt.Sprintf("Can't process character '%s'", string(cs[i]))
-			reportErr(es, filename, ln, i)
+			lx.reportErr(es, filename, ln, i, i+1)
+			dropLine(&tokens, start)
+			i = len(cs)
 			continue
 
 		}
-		addToken(&tokens, token.EOL, "\n", ln, len(cs), filename)
+		addToken(&tokens, token.EOL, "\n", ln, len(cs), len(cs), filename)
 	}
 
 	// Add an end of file token (EOF). If this is an include file, this will
 	// be deleted by the call and only the main one will remain
-	addToken(&tokens, token.EOF, "EOF", len(ls), 0, filename)
-
-	if errCount != 0 {
-		log.Fatalf("LEXER FATAL: Found %d error(s).", errCount)
-	}
+	addToken(&tokens, token.EOF, "EOF", len(ls), 0, 0, filename)
 
-	return &tokens
+	return tokens, nil
 }
@@ -1,11 +1,17 @@
 // Test file for lexer, part of the Cthulhu Assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 11. May 2018
-// This version: 11. May 2018
+// This version: 19. Oct 2026
 
 package lexer
 
-import "testing"
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"cthulhu/token"
+)
 
 func TestFindBinEOW(t *testing.T) {
 	var tests = []struct {
@@ -86,3 +92,53 @@ func TestFindHexEOW(t *testing.T) {
 		}
 	}
 }
+
+// Spans start with the first character of the token, including prefixes and
+// quotes, and end with the first character after it
+func TestScanSpans(t *testing.T) {
+	src := "_loop:  lda.# $12\n\tlda.# %101 ; hi\n        .byte \"ab\"\n"
+
+	open := func(string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(src)), nil
+	}
+
+	ts, ds := Scan("65c02", "main.asm", open)
+	if len(ds) != 0 {
+		t.Fatalf("Scan: %v", ds)
+	}
+
+	var tests = []struct {
+		text         string
+		line, col    int
+		endLine, end int
+		typ          int
+	}{
+		{"_loop", 1, 1, 1, 6, token.LOCAL_LABEL},
+		{"12", 1, 15, 1, 18, token.HEX_NUM},
+		{"lda.#", 2, 2, 2, 7, token.OPC_1},
+		{"101", 2, 8, 2, 12, token.BIN_NUM},
+		{"; hi", 2, 13, 2, 17, token.COMMENT},
+		{"ab", 3, 15, 3, 19, token.STRING},
+	}
+
+	for _, test := range tests {
+		found := false
+
+		for _, tk := range ts {
+			if tk.Text != test.text || tk.Type != test.typ || tk.Line != test.line {
+				continue
+			}
+			found = true
+
+			if tk.Index != test.col || tk.EndLine != test.endLine || tk.EndIndex != test.end {
+				t.Errorf("%s: got %d:%d-%d:%d, want %d:%d-%d:%d", test.text,
+					tk.Line, tk.Index, tk.EndLine, tk.EndIndex,
+					test.line, test.col, test.endLine, test.end)
+			}
+		}
+
+		if !found {
+			t.Errorf("%s: token not found", test.text)
+		}
+	}
+}
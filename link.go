@@ -0,0 +1,125 @@
+// Link command for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// "cthulhu link" takes object files made with the "-c" flag, places their
+// segments in memory, resolves the symbols the modules import from each other
+// and saves the binary. See the linker package for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/linker"
+	"cthulhu/lister"
+	"cthulhu/object"
+)
+
+// link takes the command line arguments after "link", which are flags
+// followed by the object files, links them and saves the binary
+func link(args []string) {
+
+	fs := flag.NewFlagSet("link", flag.ExitOnError)
+	lOutput := fs.String("o", "cthulhu.bin", "Name of the binary file")
+	lAddr := fs.String("a", "$0000", "Address of the first relocatable segment, such as $8000")
+	lConfig := fs.String("cfg", "", "Linker configuration with the memory areas of the board")
+	lMap := fs.Bool("map", false, "Print map of the segments with their addresses")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Fatal("FATAL No object files provided")
+	}
+
+	addr, err := strconv.ParseInt(strings.Replace(*lAddr, "$", "0x", 1), 0, 64)
+	if err != nil {
+		log.Fatalf("FATAL Can't convert start address '%s'", *lAddr)
+	}
+
+	// Without a configuration, everything goes one after the other from
+	// the start address
+	cfg := linker.DefaultConfig(int(addr))
+
+	if *lConfig != "" {
+		f, err := os.Open(*lConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg, err = linker.ReadConfig(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("FATAL Can't read %s: %v", *lConfig, err)
+		}
+	}
+
+	var ms []linker.Module
+
+	for _, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		obj, err := object.Read(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("FATAL Can't read %s: %v", name, err)
+		}
+
+		ms = append(ms, linker.Module{Name: name, File: obj})
+	}
+
+	res, ds := linker.Link(ms, cfg)
+
+	// We don't have the sources of the modules, so diagnostics come
+	// without the line they are about
+	if report(ds, nil) > 0 {
+		os.Exit(exitErrors)
+	}
+
+	// If the configuration says which memory areas go into files, we save
+	// those instead of one binary for everything
+	for _, o := range res.Files {
+		err := os.WriteFile(o.File, o.Code, 0644)
+		if err != nil {
+			log.Fatalf("FATAL Can't save binary file: %v", err)
+		}
+	}
+
+	if len(res.Files) == 0 {
+		err = os.WriteFile(*lOutput, res.Code, 0644)
+		if err != nil {
+			log.Fatalf("FATAL Can't save binary file: %v", err)
+		}
+	}
+
+	if *lMap {
+		m := &data.Machine{MPU: res.MPU, Segments: res.Segments}
+		fmt.Println(strings.Join(lister.Map(m), "\n"))
+	}
+}
+
+// saveObject takes the machine of a program assembled with the "-c" flag
+// and saves it as an object file
+func saveObject(m *data.Machine) {
+
+	f, err := os.Create(*fOutput)
+	if err != nil {
+		log.Fatalf("FATAL Can't save object file: %v", err)
+	}
+	defer f.Close()
+
+	err = object.Write(f, object.FromMachine(m, *fInput))
+	if err != nil {
+		log.Fatalf("FATAL Can't save object file: %v", err)
+	}
+
+	verbose(fmt.Sprintf("Saved object file %s", *fOutput))
+}
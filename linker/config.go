@@ -0,0 +1,180 @@
+// Configuration of the linker for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The configuration describes the memory of a board: its areas of RAM, ROM
+// and I/O, which segments go into which area, and which areas are saved to
+// files. The same object files can be linked for different boards by giving
+// each board a configuration of its own. Configurations are JSON like the
+// object files, with addresses as numbers or strings such as "$8000":
+//
+//	{
+//	  "Memory": [
+//	    {"Name": "RAM", "Kind": "ram", "Start": "$0000", "End": "$7FFF"},
+//	    {"Name": "ROM", "Kind": "rom", "Start": "$8000", "End": "$FFFF",
+//	     "Fill": "$FF", "File": "rom.bin"}
+//	  ],
+//	  "Segments": [
+//	    {"Name": "code", "Memory": "ROM"},
+//	    {"Name": "vectors", "Memory": "ROM", "Start": "$FFFA"}
+//	  ]
+//	}
+
+package linker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Config is the memory of a board and where the segments go
+type Config struct {
+	Memory   []Area
+	Segments []Rule
+
+	anywhere bool // segments with an address don't have to be in an area
+}
+
+// Area is a block of memory. Kind is "ram", "rom" or "io". Code can't go into
+// I/O areas. If the area has a file, it is saved there with all its bytes,
+// those without code set to the fill value
+type Area struct {
+	Name  string
+	Kind  string
+	Start Addr
+	End   Addr // last address of the area
+	Fill  Addr
+	File  string
+}
+
+// Rule tells the linker which area a relocatable segment goes into. Without
+// a start address, the segment follows the one placed in the area before it
+type Rule struct {
+	Name   string
+	Memory string
+	Start  *Addr
+}
+
+// Addr is an address or byte in a configuration. JSON has no hex numbers, so
+// we also take strings such as "$8000" or "0x8000"
+type Addr int
+
+// UnmarshalJSON takes a number or a string and sets the address
+func (a *Addr) UnmarshalJSON(bs []byte) error {
+	var s string
+
+	if err := json.Unmarshal(bs, &s); err != nil {
+		var n int
+		if err := json.Unmarshal(bs, &n); err != nil {
+			return fmt.Errorf("'%s' is not an address", bs)
+		}
+		*a = Addr(n)
+		return nil
+	}
+
+	n, err := strconv.ParseInt(strings.Replace(s, "$", "0x", 1), 0, 64)
+	if err != nil {
+		return fmt.Errorf("can't convert address '%s'", s)
+	}
+
+	*a = Addr(n)
+	return nil
+}
+
+// DefaultConfig takes a start address and returns the configuration used
+// without a file: one area from the start address to the end of memory that
+// all relocatable segments go into, one after the other
+func DefaultConfig(start int) *Config {
+	return &Config{Memory: []Area{{Name: "MEMORY", Start: Addr(start), End: 0xffffff}}, anywhere: true}
+}
+
+// ReadConfig takes a reader and returns the configuration it has, or what is
+// wrong with it
+func ReadConfig(r io.Reader) (*Config, error) {
+	var c Config
+
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("not a linker configuration: %v", err)
+	}
+
+	if len(c.Memory) == 0 {
+		return nil, fmt.Errorf("linker configuration has no memory areas")
+	}
+
+	for i, a := range c.Memory {
+		switch {
+		case a.Name == "":
+			return nil, fmt.Errorf("memory area %d has no name", i+1)
+		case a.Kind != "ram" && a.Kind != "rom" && a.Kind != "io":
+			return nil, fmt.Errorf("memory area '%s' has kind '%s', must be \"ram\", \"rom\" or \"io\"", a.Name, a.Kind)
+		case a.Start < 0 || a.End > 0xffffff || a.End < a.Start:
+			return nil, fmt.Errorf("memory area '%s' has bad addresses $%X-$%X", a.Name, a.Start, a.End)
+		case a.Fill < 0 || a.Fill > 0xff:
+			return nil, fmt.Errorf("fill value $%X of memory area '%s' is not a byte", a.Fill, a.Name)
+		}
+
+		for _, b := range c.Memory[:i] {
+			if b.Name == a.Name {
+				return nil, fmt.Errorf("memory area '%s' defined twice", a.Name)
+			}
+			if a.Start <= b.End && b.Start <= a.End {
+				return nil, fmt.Errorf("memory area '%s' overlaps memory area '%s'", a.Name, b.Name)
+			}
+		}
+	}
+
+	for _, rl := range c.Segments {
+		a, ok := c.area(rl.Memory)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("segment '%s' goes into memory area '%s', which doesn't exist", rl.Name, rl.Memory)
+		case a.Kind == "io":
+			return nil, fmt.Errorf("segment '%s' goes into I/O area '%s'", rl.Name, a.Name)
+		case rl.Start != nil && (*rl.Start < a.Start || *rl.Start > a.End):
+			return nil, fmt.Errorf("start $%X of segment '%s' is outside of memory area '%s'", *rl.Start, rl.Name, a.Name)
+		}
+	}
+
+	return &c, nil
+}
+
+// area takes the name of a memory area and returns it
+func (c *Config) area(name string) (Area, bool) {
+	for _, a := range c.Memory {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Area{}, false
+}
+
+// rule takes the name of a segment and returns where it goes. Without rules,
+// everything goes into the first area
+func (c *Config) rule(name string) (Rule, bool) {
+	if len(c.Segments) == 0 {
+		return Rule{Name: name, Memory: c.Memory[0].Name}, true
+	}
+
+	for _, rl := range c.Segments {
+		if rl.Name == name {
+			return rl, true
+		}
+	}
+	return Rule{}, false
+}
+
+// areaAt takes an address and returns the area it is in
+func (c *Config) areaAt(addr int) (Area, bool) {
+	for _, a := range c.Memory {
+		if int(a.Start) <= addr && addr <= int(a.End) {
+			return a, true
+		}
+	}
+	return Area{}, false
+}
@@ -0,0 +1,425 @@
+// Linker package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The linker takes object files and puts them together into one binary. The
+// configuration tells it which memory area each relocatable segment goes
+// into. In an area, the segments are placed one after the other, with the
+// segments of the same name from all modules kept together in the order the
+// names first appear. Segments with an address stay where they are. Once we
+// know where everything goes, the linker finds the imported symbols in the
+// exports of the other modules and fixes the relocations.
+
+package linker
+
+import (
+	"fmt"
+	"sort"
+
+	"cthulhu/data"
+	"cthulhu/generator"
+	"cthulhu/object"
+)
+
+const errTag = "LINKER"
+
+// Module is an object file and the name of the file we read it from
+type Module struct {
+	Name string
+	File *object.File
+}
+
+// Result is the linked program. The segments have their final addresses and
+// code, so they can be shown in a map
+type Result struct {
+	MPU      string
+	Origin   int
+	Code     []byte
+	Segments []data.Segment
+	Symbols  map[string]int // exported symbols with their final values
+	Files    []Output       // memory areas of the configuration with a file
+	RAM      [][2]int       // first and last address of the RAM areas
+	ROM      [][2]int       // first and last address of the ROM areas
+}
+
+// Output is the content of a memory area that is saved to a file
+type Output struct {
+	File  string
+	Start int
+	Code  []byte
+}
+
+// linker holds the state of one run, so several can run at the same time
+type linker struct {
+	ms      []Module
+	cfg     *Config
+	mpu     string
+	diags   []data.Diagnostic
+	bases   []map[string]int // address of each relocatable segment, by module
+	exports map[string]int   // module of each exported symbol
+}
+
+// Link takes the modules and the configuration, and returns the linked program
+// and the problems found
+func Link(ms []Module, cfg *Config) (*Result, []data.Diagnostic) {
+
+	l := &linker{ms: ms, cfg: cfg, exports: map[string]int{}}
+	r := &Result{Symbols: map[string]int{}}
+
+	if len(ms) == 0 {
+		l.report(data.Diagnostic{Stage: errTag, Message: "No object files to link"})
+		return r, l.diags
+	}
+
+	r.MPU = ms[0].File.MPU
+	l.mpu = r.MPU
+	for _, m := range ms[1:] {
+		if m.File.MPU != r.MPU {
+			es := fmt.Sprintf("Module is for the %s, '%s' is for the %s", m.File.MPU, ms[0].Name, r.MPU)
+			l.report(data.Diagnostic{Stage: errTag, File: m.Name, Message: es})
+		}
+	}
+
+	r.Segments = l.place()
+	l.collectExports()
+	l.checkImports()
+
+	for i := range ms {
+		l.fix(i, r.Segments)
+	}
+
+	l.checkOverlaps(r.Segments)
+
+	for k, i := range l.exports {
+		for _, e := range ms[i].File.Exports {
+			if e.Name == k {
+				if v, ok := l.resolve(i, e.Base, e.Value, 0); ok {
+					r.Symbols[k] = v
+				}
+			}
+		}
+	}
+
+	r.Origin, r.Code = generator.Place(r.Segments)
+
+	for _, a := range cfg.Memory {
+		area := [2]int{int(a.Start), int(a.End)}
+
+		switch a.Kind {
+		case "ram":
+			r.RAM = append(r.RAM, area)
+		case "rom":
+			r.ROM = append(r.ROM, area)
+		}
+
+		if a.File != "" {
+			r.Files = append(r.Files, output(a, r.Segments))
+		}
+	}
+
+	return r, data.SortDiagnostics(l.diags)
+}
+
+// report takes a diagnostic and adds it to the list
+func (l *linker) report(d data.Diagnostic) {
+	l.diags = append(l.diags, d)
+}
+
+// place returns the segments of all modules with their final addresses, in
+// the order of the modules. The code is copied, so fixing it doesn't change
+// the object files
+func (l *linker) place() []data.Segment {
+
+	l.bases = make([]map[string]int, len(l.ms))
+
+	// Names of the relocatable segments in the order they first appear
+	var names []string
+	seen := map[string]bool{}
+
+	for i, m := range l.ms {
+		l.bases[i] = map[string]int{}
+
+		for _, s := range m.File.Segments {
+			if s.Reloc && !seen[s.Name] {
+				names = append(names, s.Name)
+				seen[s.Name] = true
+			}
+		}
+	}
+
+	// Where the next segment goes in each memory area
+	next := map[string]int{}
+	for _, a := range l.cfg.Memory {
+		next[a.Name] = int(a.Start)
+	}
+
+	for _, name := range names {
+		rl, ok := l.cfg.rule(name)
+		if !ok {
+			es := fmt.Sprintf("Segment '%s' is not in the linker configuration", name)
+			l.report(data.Diagnostic{Stage: errTag, Message: es})
+			continue
+		}
+
+		a, _ := l.cfg.area(rl.Memory)
+		addr := next[a.Name]
+
+		if rl.Start != nil {
+			if int(*rl.Start) < addr {
+				es := fmt.Sprintf("Segment '%s' can't start at $%X, memory area '%s' is used up to $%X", name, *rl.Start, a.Name, addr-1)
+				l.report(data.Diagnostic{Stage: errTag, Message: es})
+			}
+			addr = int(*rl.Start)
+		}
+
+		first := addr
+		for i, m := range l.ms {
+			for _, s := range m.File.Segments {
+				if s.Reloc && s.Name == name {
+					l.bases[i][name] = addr
+					addr += len(s.Code)
+				}
+			}
+		}
+
+		if addr-1 > int(a.End) {
+			es := fmt.Sprintf("Segment '%s' doesn't fit in memory area '%s' by %d byte(s)", name, a.Name, addr-1-int(a.End))
+			l.report(data.Diagnostic{Stage: errTag, Message: es})
+		}
+
+		if l.mpu != "65816" && addr-1 > 0xffff {
+			es := fmt.Sprintf("Segment '%s' ends at $%X, past the end of memory of the %s", name, addr-1, l.mpu)
+			l.report(data.Diagnostic{Stage: errTag, Message: es})
+		}
+
+		if l.mpu == "65816" && addr > first && first>>16 != (addr-1)>>16 {
+			es := fmt.Sprintf("Segment '%s' ($%06X-$%06X) crosses into bank $%02X", name, first, addr-1, (addr-1)>>16)
+			l.report(data.Diagnostic{Stage: errTag, Message: es})
+		}
+
+		next[a.Name] = addr
+	}
+
+	var ss []data.Segment
+
+	for i, m := range l.ms {
+		for _, s := range m.File.Segments {
+			seg := data.Segment{Name: s.Name, Start: s.Start, Size: len(s.Code), Code: append([]byte{}, s.Code...)}
+			if s.Reloc {
+				seg.Start = l.bases[i][s.Name]
+			} else {
+				l.checkArea(m, seg)
+			}
+			ss = append(ss, seg)
+		}
+	}
+
+	return ss
+}
+
+// checkArea takes a module and one of its segments with an address, and
+// reports if the segment isn't all in one memory area of the configuration
+// that can have code
+func (l *linker) checkArea(m Module, s data.Segment) {
+	if s.Size == 0 || l.cfg.anywhere {
+		return
+	}
+
+	a, ok := l.cfg.areaAt(s.Start)
+
+	switch {
+	case !ok:
+		es := fmt.Sprintf("Segment %s is outside of all memory areas", segmentText(s))
+		l.report(data.Diagnostic{Stage: errTag, File: m.Name, Message: es})
+
+	case a.Kind == "io":
+		es := fmt.Sprintf("Segment %s is in I/O area '%s'", segmentText(s), a.Name)
+		l.report(data.Diagnostic{Stage: errTag, File: m.Name, Message: es})
+
+	case s.Start+s.Size-1 > int(a.End):
+		es := fmt.Sprintf("Segment %s goes past the end of memory area '%s'", segmentText(s), a.Name)
+		l.report(data.Diagnostic{Stage: errTag, File: m.Name, Message: es})
+	}
+}
+
+// collectExports finds the module of each exported symbol. A symbol can only
+// be exported by one module
+func (l *linker) collectExports() {
+
+	for i, m := range l.ms {
+		for _, e := range m.File.Exports {
+
+			j, ok := l.exports[e.Name]
+			if !ok {
+				l.exports[e.Name] = i
+				continue
+			}
+
+			old := exportOf(l.ms[j].File, e.Name)
+			es := fmt.Sprintf("Symbol '%s' exported by '%s' and '%s'", e.Name, l.ms[j].Name, m.Name)
+			l.report(data.Diagnostic{
+				Stage: errTag, File: e.File, Line: e.Line, Column: e.Column, Message: es,
+				Related: []data.Related{{File: old.File, Line: old.Line, Column: old.Column, Message: "Also exported here"}},
+			})
+		}
+	}
+}
+
+// checkImports reports the imported symbols no module exports
+func (l *linker) checkImports() {
+
+	for _, m := range l.ms {
+		for _, name := range m.File.Imports {
+			if _, ok := l.exports[name]; !ok {
+				es := fmt.Sprintf("Symbol '%s' imported, but not exported by any module", name)
+				l.report(data.Diagnostic{Stage: errTag, File: m.Name, Message: es})
+			}
+		}
+	}
+}
+
+// resolve takes the index of a module, a base and a value relative to it, and
+// returns the final value. Exports can be relative to imports themselves, so
+// we follow them, but not forever
+func (l *linker) resolve(i int, b data.Base, v int, depth int) (int, bool) {
+
+	switch {
+
+	case b.Segment != "":
+		addr, ok := l.bases[i][b.Segment]
+		return addr + v, ok
+
+	case b.Import != "":
+		j, ok := l.exports[b.Import]
+		if !ok || depth > len(l.exports) {
+			return 0, false
+		}
+		e := exportOf(l.ms[j].File, b.Import)
+		w, ok := l.resolve(j, e.Base, e.Value, depth+1)
+		return w + v, ok
+	}
+
+	return v, true
+}
+
+// fix takes the index of a module and the placed segments, and applies the
+// relocations of the module to the code of its segments
+func (l *linker) fix(i int, ss []data.Segment) {
+
+	// The segments of the module are in the same order in the list
+	first := 0
+	for _, m := range l.ms[:i] {
+		first += len(m.File.Segments)
+	}
+
+	for _, rl := range l.ms[i].File.Relocs {
+
+		if rl.Segment < 0 || rl.Segment >= len(l.ms[i].File.Segments) {
+			l.report(data.Diagnostic{Stage: errTag, File: l.ms[i].Name, Message: "Relocation for a segment that doesn't exist"})
+			continue
+		}
+
+		v, ok := l.resolve(i, rl.Base, rl.Addend, 0)
+		if !ok {
+			continue // already reported as import that isn't exported
+		}
+
+		switch rl.Kind {
+		case ".lsb":
+			v &= 0xff
+		case ".msb":
+			v = (v >> 8) & 0xff
+		case ".bank":
+			v = (v >> 16) & 0xff
+		}
+
+		// Absolute addresses of instructions on the 65816 may include
+		// the bank byte, as when assembling. Data such as .word may not
+		max := 1<<uint(8*rl.Width) - 1
+		if rl.Width == 2 && rl.Operand && l.mpu == "65816" {
+			max = 0xffffff
+		}
+
+		if v < 0 || v > max {
+			es := fmt.Sprintf("Value $%X doesn't fit in %d byte(s) after linking", v, rl.Width)
+			l.report(data.Diagnostic{Stage: errTag, File: rl.File, Line: rl.Line, Column: rl.Column, Message: es})
+			continue
+		}
+
+		code := ss[first+rl.Segment].Code
+		if rl.Offset < 0 || rl.Offset+rl.Width > len(code) {
+			l.report(data.Diagnostic{Stage: errTag, File: l.ms[i].Name, Message: "Relocation outside of its segment"})
+			continue
+		}
+
+		for b := 0; b < rl.Width; b++ {
+			code[rl.Offset+b] = byte(v >> uint(8*b))
+		}
+	}
+}
+
+// checkOverlaps takes the placed segments and reports those that overlap
+func (l *linker) checkOverlaps(ss []data.Segment) {
+
+	sorted := append([]data.Segment{}, ss...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	var prev *data.Segment
+
+	for i := range sorted {
+		s := &sorted[i]
+		if s.Size == 0 {
+			continue
+		}
+
+		if prev != nil && s.Start < prev.Start+prev.Size {
+			es := fmt.Sprintf("Segment %s overlaps segment %s", segmentText(*s), segmentText(*prev))
+			l.report(data.Diagnostic{Stage: errTag, Message: es})
+		}
+
+		if prev == nil || s.Start+s.Size > prev.Start+prev.Size {
+			prev = s
+		}
+	}
+}
+
+// exportOf takes an object file and the name of a symbol it exports, and
+// returns the export
+func exportOf(f *object.File, name string) object.Export {
+	for _, e := range f.Exports {
+		if e.Name == name {
+			return e
+		}
+	}
+	return object.Export{}
+}
+
+// segmentText takes a segment and returns its name, if it has one, and its
+// addresses for messages
+func segmentText(s data.Segment) string {
+	r := fmt.Sprintf("$%04X-$%04X", s.Start, s.Start+s.Size-1)
+	if s.Name == "" {
+		return r
+	}
+	return fmt.Sprintf("'%s' (%s)", s.Name, r)
+}
+
+// output takes a memory area and the placed segments, and returns the bytes
+// of the area for its file
+func output(a Area, ss []data.Segment) Output {
+	o := Output{File: a.File, Start: int(a.Start), Code: make([]byte, a.End-a.Start+1)}
+
+	for i := range o.Code {
+		o.Code[i] = byte(a.Fill)
+	}
+
+	for _, s := range ss {
+		for i, b := range s.Code {
+			if addr := s.Start + i; addr >= int(a.Start) && addr <= int(a.End) {
+				o.Code[addr-int(a.Start)] = b
+			}
+		}
+	}
+
+	return o
+}
@@ -0,0 +1,158 @@
+// Test file for the linker of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package linker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"cthulhu/assembler"
+	"cthulhu/object"
+)
+
+// module takes the name and source of a module and assembles it as an object
+// file
+func module(t *testing.T, name, src string) Module {
+	s := assembler.New("65c02")
+	s.Object = true
+	s.Add(name, strings.NewReader(src))
+
+	r := s.Assemble(name)
+	if !r.OK() {
+		t.Fatalf("%s: %v", name, r.Diagnostics)
+	}
+
+	return Module{Name: name, File: object.FromMachine(r.Machine, name)}
+}
+
+func TestLink(t *testing.T) {
+
+	main := "        .import print, msg\n" +
+		"        .segment \"code\"\n" +
+		"start:  lda.# .lsb msg\n" +
+		"        ldx.# { msg 1 + .msb }\n" +
+		"        jsr print\n" +
+		"        jmp start\n"
+
+	lib := "        .export print, msg\n" +
+		"        .segment \"code\"\n" +
+		"print:  sta.d 10\n" +
+		"        rts\n" +
+		"        .segment \"data\"\n" +
+		"msg:    .byte \"hi\"\n" +
+		"        .word msg\n"
+
+	var tests = []struct {
+		name    string
+		modules map[string]string // linked in the order of the names
+		names   []string
+		code    []byte
+		diags   []string
+	}{
+		{"two modules", map[string]string{"main.asm": main, "lib.asm": lib},
+			[]string{"main.asm", "lib.asm"},
+			[]byte{
+				0xa9, 0x0d, 0xa2, 0x80, 0x20, 0x0a, 0x80, 0x4c, 0x00, 0x80, // main, code
+				0x85, 0x0a, 0x60, // lib, code
+				0x68, 0x69, 0x0d, 0x80, // lib, data
+			}, nil},
+		{"unresolved import", map[string]string{"main.asm": main},
+			[]string{"main.asm"}, nil, []string{
+				"LINKER ERROR (main.asm, 0, 0): Symbol 'msg' imported, but not exported by any module",
+				"LINKER ERROR (main.asm, 0, 0): Symbol 'print' imported, but not exported by any module",
+			}},
+		{"duplicate export", map[string]string{"main.asm": main, "lib.asm": lib, "dup.asm": lib},
+			[]string{"main.asm", "lib.asm", "dup.asm"}, nil, []string{
+				"LINKER ERROR (dup.asm, 3, 1): Symbol 'print' exported by 'lib.asm' and 'dup.asm'\n    (lib.asm, 3, 1): Also exported here",
+				"LINKER ERROR (dup.asm, 6, 1): Symbol 'msg' exported by 'lib.asm' and 'dup.asm'\n    (lib.asm, 6, 1): Also exported here",
+			}},
+		{"value too large", map[string]string{
+			"big.asm": "        .import ext\n        .segment \"code\"\n        lda ext\n        .word ext\n",
+			"ext.asm": "        .export ext\n        .equ ext $12345\n",
+		}, []string{"big.asm", "ext.asm"}, nil, []string{
+			"LINKER ERROR (big.asm, 3, 13): Value $12345 doesn't fit in 2 byte(s) after linking",
+			"LINKER ERROR (big.asm, 4, 15): Value $12345 doesn't fit in 2 byte(s) after linking",
+		}},
+	}
+
+	for _, test := range tests {
+		var ms []Module
+		for _, name := range test.names {
+			ms = append(ms, module(t, name, test.modules[name]))
+		}
+
+		r, ds := Link(ms, DefaultConfig(0x8000))
+
+		var got []string
+		for _, d := range ds {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.diags, "\n") {
+			t.Errorf("%s: got diagnostics %q, want %q", test.name, got, test.diags)
+		}
+		if test.diags == nil && !bytes.Equal(r.Code, test.code) {
+			t.Errorf("%s: got code % x, want % x", test.name, r.Code, test.code)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+
+	code := "        .export start\n" +
+		"        .segment \"code\"\n" +
+		"start:  jmp start\n" +
+		"        .segment \"vectors\"\n" +
+		"        .word start\n"
+
+	var tests = []struct {
+		name  string
+		cfg   string
+		files []Output
+		err   string
+	}{
+		{"board", `{
+			"Memory": [
+				{"Name": "RAM", "Kind": "ram", "Start": 0, "End": "$00FF"},
+				{"Name": "ROM", "Kind": "rom", "Start": "$FFF0", "End": "$FFFF", "Fill": "$FF", "File": "rom.bin"}
+			],
+			"Segments": [
+				{"Name": "code", "Memory": "ROM"},
+				{"Name": "vectors", "Memory": "ROM", "Start": "$FFFE"}
+			]}`, []Output{{"rom.bin", 0xfff0, []byte{
+			0x4c, 0xf0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xf0, 0xff,
+		}}}, ""},
+		{"bad kind", `{"Memory": [{"Name": "ROM", "Kind": "flash", "Start": 0, "End": 1}]}`,
+			nil, "memory area 'ROM' has kind 'flash', must be \"ram\", \"rom\" or \"io\""},
+		{"overlap", `{"Memory": [{"Name": "A", "Kind": "ram", "Start": 0, "End": 10}, {"Name": "B", "Kind": "rom", "Start": 10, "End": 20}]}`,
+			nil, "memory area 'B' overlaps memory area 'A'"},
+		{"missing area", `{"Memory": [{"Name": "A", "Kind": "ram", "Start": 0, "End": 10}], "Segments": [{"Name": "code", "Memory": "B"}]}`,
+			nil, "segment 'code' goes into memory area 'B', which doesn't exist"},
+	}
+
+	for _, test := range tests {
+		cfg, err := ReadConfig(strings.NewReader(test.cfg))
+		if err != nil {
+			if err.Error() != test.err {
+				t.Errorf("%s: got error %q, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+
+		r, ds := Link([]Module{module(t, "main.asm", code)}, cfg)
+		if len(ds) != 0 || len(r.Files) != len(test.files) {
+			t.Errorf("%s: got %v and %d file(s), want %d", test.name, ds, len(r.Files), len(test.files))
+			continue
+		}
+
+		for i, o := range r.Files {
+			if o.File != test.files[i].File || o.Start != test.files[i].Start || !bytes.Equal(o.Code, test.files[i].Code) {
+				t.Errorf("%s: got file %s at $%X with % x, want % x", test.name, o.File, o.Start, o.Code, test.files[i].Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Lint command for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// "cthulhu lint" assembles a source file and warns about code that is legal,
+// but probably a mistake. See the linter package for the checks.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"cthulhu/assembler"
+	"cthulhu/data"
+	"cthulhu/linter"
+)
+
+// lint takes the command line arguments after "lint", assembles the input
+// file and prints the warnings. The program exits with an error if there are
+// any, so it can be used to check code before it goes in
+func lint(args []string) {
+
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	lInput := fs.String("i", "", "Input file (REQUIRED)")
+	lMPU := fs.String("m", "", "MPU type (default: from .mpu of the input file)")
+	fs.Parse(args)
+
+	if *lMPU != "" && *lMPU != "6502" && *lMPU != "65c02" && *lMPU != "65816" {
+		log.Fatalf("FATAL MPU '%s' not supported", *lMPU)
+	}
+	if *lInput == "" {
+		log.Fatal("FATAL No input file provided")
+	}
+
+	res := assembler.New(*lMPU).Assemble(*lInput)
+
+	if report(res.Diagnostics, res.Source) > 0 {
+		os.Exit(exitErrors)
+	}
+
+	ds := linter.Lint(res.Machine, res.Source)
+	report(ds, res.Source)
+
+	warnings := 0
+	for _, d := range ds {
+		if d.Severity == data.Warning {
+			warnings++
+		}
+	}
+
+	fmt.Printf("%d warning(s)\n", warnings)
+
+	if warnings > 0 {
+		os.Exit(exitErrors)
+	}
+}
@@ -0,0 +1,271 @@
+// Linter for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The linter looks at a program that assembled without errors and warns about
+// code that is legal, but probably not what the user meant:
+//
+//	unreachable  instructions after jmp, rts, rti, bra and such without a
+//	             label the program could jump to
+//	unused       labels nothing refers to
+//	immediate    absolute addresses in the zero page written as a plain
+//	             number, such as "lda 0" for "lda.# 0"
+//	decimal      decimal mode still on at rts or rts.l
+//
+// SAN requires a signature byte for brk, so we don't have to check for that.
+// A line with a comment that has "lint:ignore" gets no warnings, one with
+// "lint:ignore unused, decimal" only none of the checks given.
+
+package linter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cthulhu/data"
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+const errTag = "LINT"
+
+// linter holds the state of one run, so several can run at the same time
+type linter struct {
+	m     *data.Machine
+	ops   map[string]data.Opcode
+	src   data.Source
+	diags []data.Diagnostic
+}
+
+// Lint takes the machine after the generator is done and where to get the
+// lines of the source for the suppression comments, and returns the warnings.
+// Without a source, nothing is suppressed
+func Lint(m *data.Machine, src data.Source) []data.Diagnostic {
+
+	l := &linter{m: m, ops: data.OpcodesSAN[m.MPU], src: src}
+
+	l.unreachable()
+	l.unused()
+	l.immediate()
+	l.decimal()
+
+	return data.SortDiagnostics(l.diags)
+}
+
+// warn takes the name of a check, a token and a message, and adds a warning
+// unless the line of the token says to ignore the check
+func (l *linter) warn(check string, t token.Token, msg string) {
+	if l.ignored(check, t.File, t.Line) {
+		return
+	}
+
+	d := data.At(errTag, t, fmt.Sprintf("%s [%s]", msg, check))
+	d.Severity = data.Warning
+	l.diags = append(l.diags, d)
+}
+
+// ignored takes the name of a check and a line of the source, and returns
+// true if the comment of the line turns the check off
+func (l *linter) ignored(check, file string, line int) bool {
+	if l.src == nil {
+		return false
+	}
+
+	text, ok := l.src(file, line)
+	if !ok {
+		return false
+	}
+
+	i := strings.Index(text, ";")
+	if i < 0 {
+		return false
+	}
+
+	j := strings.Index(text[i:], "lint:ignore")
+	if j < 0 {
+		return false
+	}
+
+	names := strings.FieldsFunc(text[i+j+len("lint:ignore"):], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(names) == 0 {
+		return true
+	}
+
+	for _, name := range names {
+		if name == check {
+			return true
+		}
+	}
+	return false
+}
+
+// program returns the nodes of the program, without the tests, which only run
+// in the simulator
+func (l *linter) program() []*node.Node {
+	var ns []*node.Node
+
+	for _, n := range l.m.AST.Kids {
+		if n.Type == token.DIREC_PARA && n.Text == ".test" {
+			continue
+		}
+		ns = append(ns, n)
+	}
+
+	return ns
+}
+
+// isLabel takes a node and returns true if the program can jump there
+func isLabel(n *node.Node) bool {
+	return n.Type == token.LABEL || n.Type == token.LOCAL_LABEL || n.Type == token.ANON_LABEL ||
+		(n.Type == token.DIREC_PARA && (n.Text == ".origin" || n.Text == ".segment"))
+}
+
+// isInstruction takes a node and returns true if it is an instruction, or a
+// directive such as .native that becomes one
+func isInstruction(n *node.Node) bool {
+	switch n.Type {
+	case token.OPC_0, token.OPC_1, token.OPC_2:
+		return true
+	case token.DIREC:
+		return len(n.Code) > 0
+	}
+	return false
+}
+
+// unreachable warns about the first instruction after one that never goes on
+// to the next, unless there is a label in between
+func (l *linter) unreachable() {
+	var after *node.Node // the jmp, rts and such we are after
+
+	for _, n := range l.program() {
+		switch {
+
+		case isLabel(n):
+			after = nil
+
+		case isInstruction(n):
+			if after != nil {
+				l.warn("unreachable", n.Token, fmt.Sprintf("Code after '%s' in line %d can't be reached", after.Text, after.Line))
+				after = nil
+			}
+
+			switch l.ops[n.Text].WDC {
+			case "jmp", "jml", "rts", "rti", "rtl", "bra", "brl":
+				after = n
+			}
+
+		case len(n.Code) > 0:
+			// Data right after a jmp is usually a table used with
+			// an offset from a label further up
+			after = nil
+		}
+	}
+}
+
+// unused warns about labels nothing refers to. Exported labels are used by
+// other modules
+func (l *linter) unused() {
+
+	// Labels by where they are defined, so we can point at them
+	labels := map[string]*node.Node{}
+
+	var walk func(ns []*node.Node)
+	walk = func(ns []*node.Node) {
+		for _, n := range ns {
+			if n.Type == token.LABEL || n.Type == token.LOCAL_LABEL {
+				labels[fmt.Sprintf("%s:%d:%s", n.File, n.Line, n.Text)] = n
+			}
+			walk(n.Kids)
+		}
+	}
+	walk(l.m.AST.Kids)
+
+	var names []string
+	for k := range l.m.Symbols {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		sym := l.m.Symbols[k]
+		if sym.Used || (sym.Type != "label" && sym.Type != "local") {
+			continue
+		}
+
+		// Local labels have the number of their scope in the table
+		name := k
+		if i := strings.LastIndex(k, "/"); i >= 0 {
+			name = k[:i]
+		}
+
+		n, ok := labels[fmt.Sprintf("%s:%d:%s", sym.File, sym.Line, name)]
+		if !ok {
+			continue
+		}
+
+		l.warn("unused", n.Token, fmt.Sprintf("Label '%s' is never used", name))
+	}
+}
+
+// immediate warns about instructions with an absolute address that is a
+// plain number in the zero page, if the instruction has an immediate mode.
+// "lda 0" loads from address 0, but was probably meant to be "lda.# 0"
+func (l *linter) immediate() {
+
+	for _, n := range l.program() {
+
+		if n.Type != token.OPC_1 || strings.Contains(n.Text, ".") || len(n.Kids) != 1 {
+			continue
+		}
+		if _, ok := l.ops[n.Text+".#"]; !ok {
+			continue
+		}
+
+		k := n.Kids[0]
+		if k.Type == token.EXPR && len(k.Kids) == 1 {
+			k = k.Kids[0]
+		}
+
+		if k.Type == token.DEC_NUM && k.Value >= 0 && k.Value < 0x100 {
+			msg := fmt.Sprintf("'%s %d' uses address %d, did you mean '%s.# %d'?", n.Text, k.Value, k.Value, n.Text, k.Value)
+			l.warn("immediate", n.Token, msg)
+		}
+	}
+}
+
+// decimal warns about returns from subroutines while decimal mode is on. The
+// caller usually expects binary mode, so this is a common source of strange
+// math bugs. rti restores the flags, so it is fine there. We only follow the
+// program in the order of the source
+func (l *linter) decimal() {
+	var sed *node.Node // where decimal mode was turned on
+
+	for _, n := range l.program() {
+
+		if n.Type == token.DIREC_PARA && (n.Text == ".origin" || n.Text == ".segment") {
+			sed = nil
+			continue
+		}
+
+		if !isInstruction(n) {
+			continue
+		}
+
+		switch {
+		case n.Text == "sed", n.Text == "sep" && n.Code[1]&0x08 != 0:
+			sed = n
+
+		case n.Text == "cld", n.Text == "rep" && n.Code[1]&0x08 != 0, n.Text == "plp", n.Text == "rti":
+			sed = nil
+
+		// In SAN, rtl is "rts.l"
+		case l.ops[n.Text].WDC == "rts" || l.ops[n.Text].WDC == "rtl":
+			if sed != nil {
+				msg := fmt.Sprintf("Decimal mode from '%s' in line %d is still on at '%s'", sed.Text, sed.Line, n.Text)
+				l.warn("decimal", n.Token, msg)
+			}
+			sed = nil
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Test file for the linter of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package linter
+
+import (
+	"strings"
+	"testing"
+
+	"cthulhu/assembler"
+)
+
+func TestLint(t *testing.T) {
+
+	var tests = []struct {
+		name  string
+		mpu   string
+		src   string
+		diags []string
+	}{
+		{"unreachable", "65c02", "        .origin $8000\nloop:   bra loop\n        nop\n", []string{
+			"LINT WARNING (main.asm, 3, 9): Code after 'bra' in line 2 can't be reached [unreachable]",
+		}},
+		{"label after jmp", "65c02", "        .origin $8000\nloop:   jmp loop\n        jmp loop\n", []string{
+			"LINT WARNING (main.asm, 3, 9): Code after 'jmp' in line 2 can't be reached [unreachable]",
+		}},
+		{"unused", "65c02", "        .origin $8000\nloop:   nop\n", []string{
+			"LINT WARNING (main.asm, 2, 1): Label 'loop' is never used [unused]",
+		}},
+		{"unused local", "65c02", "        .origin $8000\n        .scope\n_loop:  nop\n        .scend\n", []string{
+			"LINT WARNING (main.asm, 3, 1): Label '_loop' is never used [unused]",
+		}},
+		{"immediate", "65c02", "        .origin $8000\n        lda 0\n        lda $0200\n        lda.d 0\n", []string{
+			"LINT WARNING (main.asm, 2, 9): 'lda 0' uses address 0, did you mean 'lda.# 0'? [immediate]",
+		}},
+		{"decimal", "65c02", "        .origin $8000\n        sed\n        rts\n", []string{
+			"LINT WARNING (main.asm, 3, 9): Decimal mode from 'sed' in line 2 is still on at 'rts' [decimal]",
+		}},
+		{"decimal at rts.l", "65816", "        .origin $8000\n        sep $08\n        rts.l\n", []string{
+			"LINT WARNING (main.asm, 3, 9): Decimal mode from 'sep' in line 2 is still on at 'rts.l' [decimal]",
+		}},
+		{"decimal off", "65c02", "        .origin $8000\n        sed\n        cld\n        rts\n", nil},
+		{"ignore all", "65c02", "        .origin $8000\nloop:   nop             ; lint:ignore\n", nil},
+		{"ignore one", "65c02", "        .origin $8000\nloop:   lda 0           ; lint:ignore immediate\n", []string{
+			"LINT WARNING (main.asm, 2, 1): Label 'loop' is never used [unused]",
+		}},
+	}
+
+	for _, test := range tests {
+		s := assembler.New(test.mpu)
+		s.Add("main.asm", strings.NewReader(test.src))
+
+		r := s.Assemble("main.asm")
+		if !r.OK() {
+			t.Errorf("%s: got diagnostics %v", test.name, r.Diagnostics)
+			continue
+		}
+
+		var got []string
+		for _, d := range Lint(r.Machine, r.Source) {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.diags, "\n") {
+			t.Errorf("%s: got diagnostics %q, want %q", test.name, got, test.diags)
+		}
+	}
+}
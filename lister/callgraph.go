@@ -0,0 +1,175 @@
+// Call graph and stack depth for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The call graph can be saved for Graphviz as DOT, where the routines are
+// boxes with their worst-case stack depth and the interrupt vectors point to
+// their handlers, or as JSON for other tools:
+//
+//	{
+//	  "Format": "cthulhu-callgraph",
+//	  "Version": 1,
+//	  "MPU": "65c02",
+//	  "Routines": [
+//	    {"Name": "reset", "Addr": 32768,
+//	     "Calls": [{"From": 32770, "To": 32784, "Kind": "jsr",
+//	                "File": "main.asm", "Line": 4}],
+//	     "Depth": 5, "Unknown": ""}
+//	  ],
+//	  "Vectors": [
+//	    {"Name": "reset", "Addr": 65532, "Native": false, "Handler": 32768,
+//	     "Frame": 0, "Stack": 5, "Unknown": ""}
+//	  ]
+//	}
+//
+// See the analyzer for how the graph and the depths are found.
+
+package lister
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cthulhu/analyzer"
+	"cthulhu/data"
+)
+
+// callGraphVersion is the version of the JSON format of call graphs
+const callGraphVersion = 1
+
+// The stack of the 6502, and of the 65816 in emulated mode, is page 1
+const pageOne = 0x100
+
+// CallGraphFormats are the formats we can save call graphs in
+var CallGraphFormats = map[string]func(*data.Machine, analyzer.Graph) ([]byte, error){
+	"dot":  callGraphDOT,
+	"json": callGraphJSON,
+}
+
+// CallGraph takes the machine after the generator is done and the name of a
+// format, and returns the call graph of the program in that format
+func CallGraph(m *data.Machine, format string) ([]byte, error) {
+	return CallGraphFormats[format](m, analyzer.CallGraph(m))
+}
+
+type callGraph struct {
+	Format   string
+	Version  int
+	MPU      string
+	Routines []analyzer.Routine
+	Vectors  []analyzer.Vector
+}
+
+// callGraphJSON takes the machine and its call graph and returns it as JSON
+func callGraphJSON(m *data.Machine, g analyzer.Graph) ([]byte, error) {
+	cg := callGraph{
+		Format: "cthulhu-callgraph", Version: callGraphVersion, MPU: m.MPU,
+		Routines: []analyzer.Routine{}, Vectors: []analyzer.Vector{},
+	}
+
+	for _, r := range g.Routines {
+		if r.Calls == nil {
+			r.Calls = []analyzer.Call{}
+		}
+		cg.Routines = append(cg.Routines, r)
+	}
+	cg.Vectors = append(cg.Vectors, g.Vectors...)
+
+	bs, err := json.MarshalIndent(cg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(bs, '\n'), nil
+}
+
+// callGraphDOT takes the machine and its call graph and returns it for
+// Graphviz. Routines are named by their address, since local labels can
+// have the same name
+func callGraphDOT(m *data.Machine, g analyzer.Graph) ([]byte, error) {
+
+	width := addrWidth(m.MPU)
+	id := func(addr int) string { return fmt.Sprintf("\"$%0*X\"", width, addr) }
+
+	s := fmt.Sprintf("// Call graph for the %s made by the Cthulhu Assembler\n", m.MPU)
+	s += "digraph calls {\n"
+	s += "    node [shape=box, fontname=\"monospace\"];\n"
+
+	for _, r := range g.Routines {
+		s += fmt.Sprintf("    %s [label=\"%s\\n$%0*X\\nstack %s\"];\n", id(r.Addr), r.Name, width, r.Addr, depth(r.Depth, r.Unknown))
+	}
+
+	for _, v := range g.Vectors {
+		s += fmt.Sprintf("    \"%s\" [shape=ellipse];\n", vectorName(v))
+		s += fmt.Sprintf("    \"%s\" -> %s;\n", vectorName(v), id(v.Handler))
+	}
+
+	for _, r := range g.Routines {
+		for _, c := range r.Calls {
+			style := ""
+			if c.Kind != "jsr" && c.Kind != "jsr.l" {
+				style = ", style=dashed"
+			}
+			s += fmt.Sprintf("    %s -> %s [label=\"%s\"%s];\n", id(r.Addr), id(c.To), c.Kind, style)
+		}
+	}
+
+	s += "}\n"
+
+	return []byte(s), nil
+}
+
+// StackDepth takes the machine after the generator is done and returns the
+// most bytes each interrupt vector and the start of the program can put on
+// the stack, with a note where that is more than page 1 has
+func StackDepth(m *data.Machine) []string {
+
+	width := addrWidth(m.MPU)
+	g := analyzer.CallGraph(m)
+
+	names := map[int]string{}
+	for _, r := range g.Routines {
+		names[r.Addr] = r.Name
+	}
+
+	out := []string{
+		fmt.Sprintf("; Worst-case stack depth for the %s made by the Cthulhu Assembler", m.MPU),
+		"",
+		fmt.Sprintf("%-14s  %-16s  %-*s  %5s  %5s  %s", "VECTOR", "HANDLER", width, "ADDR", "FRAME", "STACK", "NOTE"),
+	}
+
+	for _, v := range g.Vectors {
+		note := ""
+		switch {
+		case v.Unknown != "":
+			note = fmt.Sprintf("unknown because of %s", v.Unknown)
+		case v.Stack > pageOne && !v.Native:
+			note = fmt.Sprintf("%d byte(s) more than page 1", v.Stack-pageOne)
+		}
+
+		line := fmt.Sprintf("%-14s  %-16s  %0*X  %5d  %5s  %s",
+			vectorName(v), names[v.Handler], width, v.Handler, v.Frame, depth(v.Stack, v.Unknown), note)
+		out = append(out, strings.TrimRight(line, " "))
+	}
+
+	return out
+}
+
+// vectorName takes an interrupt vector and returns its name, with the mode
+// for the native vectors of the 65816
+func vectorName(v analyzer.Vector) string {
+	if v.Native {
+		return v.Name + " (native)"
+	}
+	return v.Name
+}
+
+// depth takes a stack depth and why we don't know it, and returns it as we
+// print it
+func depth(d int, unknown string) string {
+	if unknown != "" {
+		return "?"
+	}
+	return fmt.Sprint(d)
+}
@@ -0,0 +1,75 @@
+// Test file for the call graph of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package lister
+
+import (
+	"strings"
+	"testing"
+
+	"cthulhu/assembler"
+)
+
+// The handlers of the vectors get the bytes the interrupt pushes on top of
+// their routines, and a routine that calls itself has no depth we can know
+func TestStackDepth(t *testing.T) {
+
+	src := `        .origin $8000
+reset:  ldx.# $ff
+        txs
+        jsr init
+loop:   jsr work
+        bra loop
+init:   pha
+        jsr clear
+        pla
+        rts
+clear:  phx
+        rts
+work:   php
+        plp
+        jmp clear
+nmi:    jsr nmi
+        rti
+        .advance $FFFA
+        .word nmi, reset, reset
+`
+
+	s := assembler.New("65c02")
+	s.Add("main.asm", strings.NewReader(src))
+
+	r := s.Assemble("main.asm")
+	if !r.OK() {
+		t.Fatalf("got diagnostics %v", r.Diagnostics)
+	}
+
+	want := []string{
+		"; Worst-case stack depth for the 65c02 made by the Cthulhu Assembler",
+		"",
+		"VECTOR          HANDLER           ADDR  FRAME  STACK  NOTE",
+		"nmi             nmi               8018      3      ?  unknown because of recursion",
+		"reset           reset             8000      0      6",
+		"irq             reset             8000      3      9",
+	}
+
+	got := StackDepth(r.Machine)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	dot, err := CallGraph(r.Machine, "dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, edge := range []string{
+		`"$8000" -> "$800B" [label="jsr"];`,
+		`"$8013" -> "$8011" [label="jmp", style=dashed];`,
+		`"$8018" -> "$8018" [label="jsr"];`,
+	} {
+		if !strings.Contains(string(dot), edge) {
+			t.Errorf("call graph has no edge %s:\n%s", edge, dot)
+		}
+	}
+}
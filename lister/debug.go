@@ -0,0 +1,71 @@
+// Debug map for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The debug map tells monitors and trace tools which line of the source the
+// bytes at an address come from, so they can show the source for a value of
+// the PC. It is JSON:
+//
+//	{
+//	  "Format": "cthulhu-debug",
+//	  "Version": 1,
+//	  "MPU": "65816",
+//	  "Spans": [
+//	    {"Start": 32768, "End": 32769, "File": "main.asm", "Line": 4,
+//	     "Column": 9, "M": true, "X": true, "E": true}
+//	  ]
+//	}
+//
+// Each span is the bytes of one line, from Start to End including both, in the
+// order of the source. Lines of included files have the name of that file.
+// M, X and E are the flags of the 65816 when it gets to the span: M and X set
+// for 8 bit registers, E set for emulated mode.
+
+package lister
+
+import (
+	"encoding/json"
+
+	"cthulhu/data"
+)
+
+// debugVersion is the version of the format of debug maps
+const debugVersion = 1
+
+type debugMap struct {
+	Format  string
+	Version int
+	MPU     string
+	Spans   []debugSpan
+}
+
+type debugSpan struct {
+	Start  int
+	End    int
+	File   string
+	Line   int
+	Column int
+	M      bool
+	X      bool
+	E      bool
+}
+
+// DebugMap takes the machine after the generator is done and returns the debug
+// map of the program
+func DebugMap(m *data.Machine) ([]byte, error) {
+	dm := debugMap{Format: "cthulhu-debug", Version: debugVersion, MPU: m.MPU, Spans: []debugSpan{}}
+
+	for _, s := range m.Spans {
+		dm.Spans = append(dm.Spans, debugSpan{
+			Start: s.Addr, End: s.Addr + s.Size - 1, File: s.File, Line: s.Line, Column: s.Column,
+			M: s.A8, X: s.XY8, E: s.Emulated,
+		})
+	}
+
+	bs, err := json.MarshalIndent(dm, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(bs, '\n'), nil
+}
@@ -0,0 +1,31 @@
+// Direct page report for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package lister
+
+import (
+	"fmt"
+
+	"cthulhu/data"
+)
+
+// Direct takes the machine after the generator is done and returns the
+// instructions that use the direct page, in the order of the source, with the
+// address each one uses. See ".dp" for where the direct page is
+func Direct(m *data.Machine) []string {
+
+	width := addrWidth(m.MPU)
+
+	out := []string{
+		fmt.Sprintf("; Direct page accesses for the %s made by the Cthulhu Assembler", m.MPU),
+		"",
+		fmt.Sprintf("%-*s  %-10s  %-6s  %s", width, "ADDR", "MNEMONIC", "TARGET", "SOURCE"),
+	}
+
+	for _, a := range m.Direct {
+		out = append(out, fmt.Sprintf("%0*X  %-10s  $%04X   %s:%d", width, a.Addr, a.Text, a.Target, a.File, a.Line))
+	}
+
+	return out
+}
@@ -1,55 +1,264 @@
 // Lister Package for the Cthulhu assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 02. May 2018
-// This version: 11. May 2018
+// This version: 19. Oct 2026
 
-// The lister will produce a detailed listing of the final
-// binary file with source code, comments and whatnot
-// Currently, this is more just a version of the formatter
+// The lister will produce a detailed listing of the final binary file with
+// source code, comments and whatnot. Each line of source code gets the
+// address, the bytes, and the cycles it takes. Where the cycles depend on
+// things we only know when the program runs, such as branches being taken,
+// the fewest and the most are given. The end of each .scope gets the totals
+// of the scope, and directives that pad get the number of bytes they added
 
 package lister
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
+	"cthulhu/data"
 	"cthulhu/node"
 	"cthulhu/token"
 )
 
-const indent = "       "
+const maxBytes = 4 // bytes shown per line
 
-func Lister(ast *node.Node) {
-	Walk(ast)
+// Directives whose bytes are all listed, so the end of the string can be seen
+var stringDirecs = map[string]bool{".asciiz": true, ".pstring": true, ".hstring": true}
+
+// line collects the nodes of one line of source code
+type line struct {
+	file  string
+	num   int
+	nodes []*node.Node
+}
+
+var (
+	sources = map[string][]string{} // lines of the source files we have read
+	done    = map[string]int{}      // last line listed for each file
+)
+
+// Lister takes the machine after the generator is done and returns the
+// listing as a slice of lines
+func Lister(m *data.Machine) []string {
+
+	var out []string
+
+	sources = map[string][]string{}
+	done = map[string]int{}
+
+	width := 4
+	if m.MPU == "65816" {
+		width = 6
+	}
+
+	out = append(out, fmt.Sprintf("; Listing for the %s made by the Cthulhu Assembler", m.MPU))
+	out = append(out, "")
+	out = append(out, fmt.Sprintf("%-*s  %-*s  %-6s  %s", width, "ADDR", 3*maxBytes-1, "BYTES", "CYCLES", "SOURCE"))
+
+	ls := lines(m)
+
+	for _, l := range ls {
+		out = append(out, gap(l.file, l.num-1, width)...)
+		out = append(out, format(l, width)...)
+		done[l.file] = l.num
+	}
+
+	// Comments and such after the last line of code
+	if len(ls) > 0 {
+		f := ls[0].file
+		out = append(out, gap(f, len(source(f)), width)...)
+	}
+
+	return out
+}
+
+// lines takes the machine and returns the nodes of the program and the tests
+// grouped by the line of source code they come from, in order
+func lines(m *data.Machine) []line {
+
+	var ns []*node.Node
+	var ls []line
+
+	for _, n := range m.AST.Kids {
+		ns = append(ns, n)
+
+		if n.Type == token.DIREC_PARA && n.Text == ".test" {
+			ns = append(ns, n.Kids[1:]...)
+		}
+	}
+
+	for _, n := range ns {
+
+		if n.Type == token.START || n.Type == token.EOF || n.File == "" || n.Line == 0 {
+			continue
+		}
+
+		last := len(ls) - 1
+		if last >= 0 && ls[last].file == n.File && ls[last].num == n.Line {
+			ls[last].nodes = append(ls[last].nodes, n)
+			continue
+		}
+
+		ls = append(ls, line{file: n.File, num: n.Line, nodes: []*node.Node{n}})
+	}
+
+	return ls
 }
 
-// Generic walking function, depth first
-func Walk(ast *node.Node) {
+// format takes a line and the width of addresses, and returns the listing of
+// the line. The end of a scope gets a second line with the totals
+func format(l line, width int) []string {
+
+	var bs []byte
+	var addr string
+	var base, min, max int
+	var all bool
+	var total *node.Node
+	var padded []int
+
+	for _, n := range l.nodes {
 
-	switch ast.Type {
+		hasAddr := len(n.Code) > 0 || n.Type == token.LABEL ||
+			n.Type == token.LOCAL_LABEL || n.Type == token.ANON_LABEL ||
+			(n.Type == token.DIREC_PARA && n.Text == ".origin")
 
-	case token.EOL:
-		fmt.Print("\n")
-	case token.EMPTY:
-		fmt.Print(" \n")
-	case token.DIREC, token.DIREC_PARA:
-		fmt.Print(indent, ast.Text, " ")
-	case token.LABEL, token.LOCAL_LABEL:
-		fmt.Print(ast.Text, ":")
-	case token.HEX_NUM:
-		fmt.Print("$", ast.Text, " ")
-	case token.BIN_NUM:
-		fmt.Print("%", ast.Text, " ")
-	case token.OPC_0, token.OPC_1:
-		fmt.Print(indent, indent, ast.Text, " ")
-	default:
-		fmt.Print(ast.Text, " ")
+		if addr == "" && hasAddr {
+			addr = fmt.Sprintf("%0*X", width, n.Addr)
+			base = n.Addr
+		}
+
+		switch n.Type {
+		case token.OPC_0, token.OPC_1, token.OPC_2:
+			min += n.Cycles
+			max += n.MaxCycles
+		case token.DIREC:
+			if n.Text == ".scend" {
+				total = n
+			}
+		case token.DIREC_PARA:
+			if n.Text == ".advance" || n.Text == ".skip" || n.Text == ".align" {
+				padded = append(padded, len(n.Code))
+			}
+			all = all || stringDirecs[n.Text]
+		}
+
+		// Test blocks keep their code in their kids
+		if n.Type != token.DIREC_PARA || n.Text != ".test" {
+			bs = append(bs, n.Code...)
+		}
 	}
 
-	if len(ast.Kids) == 0 {
-		return
+	// Strings get the bytes that don't fit on lines of their own
+	var rest []byte
+	if all && len(bs) > maxBytes {
+		bs, rest = bs[:maxBytes], bs[maxBytes:]
 	}
 
-	for _, k := range ast.Kids {
-		Walk(k)
+	text := sourceLine(l.file, l.num, l.nodes[0])
+	out := []string{fmt.Sprintf("%-*s  %-*s  %-6s  %s", width, addr, 3*maxBytes-1, hexBytes(bs), cycles(min, max), text)}
+
+	for i := 0; i < len(rest); i += maxBytes {
+		end := i + maxBytes
+		if end > len(rest) {
+			end = len(rest)
+		}
+		at := fmt.Sprintf("%0*X", width, base+maxBytes+i)
+		out = append(out, strings.TrimRight(fmt.Sprintf("%-*s  %-*s", width, at, 3*maxBytes-1, hexBytes(rest[i:end])), " "))
+	}
+
+	for _, p := range padded {
+		s := fmt.Sprintf("; Padded %d byte(s)", p)
+		out = append(out, fmt.Sprintf("%-*s  %-*s  %-6s  %s", width, "", 3*maxBytes-1, "", "", s))
+	}
+
+	if total != nil {
+		s := fmt.Sprintf("; Scope total: %s cycles", cycles(total.Cycles, total.MaxCycles))
+		if total.MaxCycles == 0 {
+			s = "; Scope total: 0 cycles"
+		}
+		out = append(out, fmt.Sprintf("%-*s  %-*s  %-6s  %s", width, "", 3*maxBytes-1, "", "", s))
+	}
+
+	return out
+}
+
+// gap takes a file, a line number and the width of addresses, and returns the
+// lines of the file that come before it and haven't been listed yet. These
+// are comments, empty lines and such
+func gap(file string, to, width int) []string {
+	var out []string
+
+	src := source(file)
+
+	for i := done[file] + 1; i <= to && i <= len(src); i++ {
+		out = append(out, strings.TrimRight(fmt.Sprintf("%-*s  %-*s  %-6s  %s", width, "", 3*maxBytes-1, "", "", src[i-1]), " "))
+	}
+
+	if to > done[file] {
+		done[file] = to
+	}
+
+	return out
+}
+
+// source takes the name of a file and returns its lines. If we can't read the
+// file, we return nothing and make do with the nodes
+func source(file string) []string {
+
+	if src, ok := sources[file]; ok {
+		return src
+	}
+
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		sources[file] = nil
+		return nil
+	}
+
+	src := strings.Split(strings.TrimRight(string(bs), "\n"), "\n")
+	sources[file] = src
+
+	return src
+}
+
+// sourceLine takes a file, a line number, and the first node of the line, and
+// returns the line of source code
+func sourceLine(file string, num int, n *node.Node) string {
+	src := source(file)
+
+	if num > len(src) {
+		return n.Text
+	}
+
+	return src[num-1]
+}
+
+// hexBytes takes a slice of bytes and returns them as hex numbers. If there
+// are too many, the rest is cut off, except for string directives, which
+// format splits up first
+func hexBytes(bs []byte) string {
+	var hs []string
+
+	for i, b := range bs {
+		if i == maxBytes-1 && len(bs) > maxBytes {
+			hs = append(hs, "..")
+			break
+		}
+		hs = append(hs, fmt.Sprintf("%02X", b))
+	}
+
+	return strings.Join(hs, " ")
+}
+
+// cycles takes the fewest and the most cycles, and returns them as a string
+func cycles(min, max int) string {
+	switch {
+	case max == 0:
+		return ""
+	case min == max:
+		return fmt.Sprintf("%d", min)
 	}
+	return fmt.Sprintf("%d-%d", min, max)
 }
@@ -0,0 +1,46 @@
+// Test file for the lister of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package lister
+
+import (
+	"strings"
+	"testing"
+
+	"cthulhu/node"
+	"cthulhu/token"
+)
+
+// Strings list all their bytes, other lines cut them off
+func TestFormat(t *testing.T) {
+
+	var tests = []struct {
+		name string
+		n    node.Node
+		want []string
+	}{
+		{"asciiz", node.Node{Type: token.DIREC_PARA, Text: ".asciiz", Addr: 0xc010, Code: []byte("Hello\x00")}, []string{
+			"C010  48 65 6C 6C          .asciiz",
+			"C014  6F 00",
+		}},
+		{"hstring", node.Node{Type: token.DIREC_PARA, Text: ".hstring", Addr: 0xc010, Code: []byte("Hello, Cth\xf5")}, []string{
+			"C010  48 65 6C 6C          .hstring",
+			"C014  6F 2C 20 43",
+			"C018  74 68 F5",
+		}},
+		{"byte", node.Node{Type: token.DIREC_PARA, Text: ".byte", Addr: 0xc010, Code: []byte("Hello")}, []string{
+			"C010  48 65 6C ..          .byte",
+		}},
+	}
+
+	for _, test := range tests {
+		n := test.n
+		n.File, n.Line = "missing.asm", 1
+
+		got := format(line{file: n.File, num: n.Line, nodes: []*node.Node{&n}}, 4)
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Segment map for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package lister
+
+import (
+	"fmt"
+	"sort"
+
+	"cthulhu/data"
+)
+
+// Map takes the machine after the generator is done and returns the segments
+// of the program sorted by address, with where they start and end and how
+// many bytes they have. Segments from .origin have no name
+func Map(m *data.Machine) []string {
+
+	width := addrWidth(m.MPU)
+
+	ss := append([]data.Segment{}, m.Segments...)
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].Start < ss[j].Start })
+
+	out := []string{
+		fmt.Sprintf("; Segment map for the %s made by the Cthulhu Assembler", m.MPU),
+		"",
+		fmt.Sprintf("%-16s  %-*s  %-*s  %s", "SEGMENT", width, "START", width, "END", "SIZE"),
+	}
+
+	for _, s := range ss {
+		name := s.Name
+		if name == "" {
+			name = "-"
+		}
+
+		end := "-"
+		if s.Size > 0 {
+			end = fmt.Sprintf("%0*X", width, s.Start+s.Size-1)
+		}
+
+		out = append(out, fmt.Sprintf("%-16s  %0*X  %-*s  %d", name, width, s.Start, width, end, s.Size))
+	}
+
+	return out
+}
@@ -0,0 +1,111 @@
+// Symbol tables for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The symbol table lists the symbols of the program with their values. Our own
+// format is the one the disassembler takes as a symbol file. The others are
+// label files for emulators and their debuggers:
+//
+//	vice   "al C:8000 .start" lines for the monitor of VICE
+//	mame   "comadd 8000,start" commands for a debugger script of MAME
+//	bsnes  "00:8000 start" lines after "[labels]", the ".sym" format that
+//	       bsnes-plus and Mesen read, with the bank for the 65816
+//	mlb    "SnesPrgRom:0000:start" lines, the ".mlb" format of Mesen for
+//	       the SNES
+//
+// The debuggers only take names made of letters, digits and underscores, so
+// names for them are changed just as for the exporter: "got_a?" is "got_a_3f",
+// the local label "_loop" in scope 3 is "loop__3".
+//
+// Mesen's .mlb files don't have addresses, but offsets into the memory the
+// label is in. We take the binary we write to be the ROM file, and the
+// memory map of the SNES for RAM and registers. Symbols that are in neither,
+// such as constants, are left out.
+
+package lister
+
+import (
+	"fmt"
+
+	"cthulhu/analyzer"
+	"cthulhu/data"
+	"cthulhu/exporter"
+)
+
+// SymbolFormats are the formats of symbol tables we can produce. Each takes
+// the machine and an entry and returns the line for it, or an empty string
+// if the entry is left out
+var SymbolFormats = map[string]func(*data.Machine, analyzer.Entry) string{
+	"cthulhu": func(m *data.Machine, e analyzer.Entry) string {
+		return fmt.Sprintf("%-24s $%0*X", e.Name, addrWidth(m.MPU), e.Value)
+	},
+	"vice": func(m *data.Machine, e analyzer.Entry) string {
+		return fmt.Sprintf("al C:%0*X .%s", addrWidth(m.MPU), e.Value, exporter.Mangle(e.Key))
+	},
+	"mame": func(m *data.Machine, e analyzer.Entry) string {
+		return fmt.Sprintf("comadd %0*X,%s", addrWidth(m.MPU), e.Value, exporter.Mangle(e.Key))
+	},
+	"bsnes": func(m *data.Machine, e analyzer.Entry) string {
+		return fmt.Sprintf("%02X:%04X %s", (e.Value>>16)&0xff, e.Value&0xffff, exporter.Mangle(e.Key))
+	},
+	"mlb": symbolMLB,
+}
+
+// Symbols takes the machine after the generator is done and the name of a
+// format, and returns the symbol table in that format
+func Symbols(m *data.Machine, format string) []string {
+	f := SymbolFormats[format]
+
+	var out []string
+
+	switch format {
+	case "cthulhu":
+		out = append(out, fmt.Sprintf("; Symbol table for the %s made by the Cthulhu Assembler", m.MPU))
+	case "bsnes":
+		out = append(out, "[labels]")
+	}
+
+	for _, e := range analyzer.SymbolTable(m) {
+		if l := f(m, e); l != "" {
+			out = append(out, l)
+		}
+	}
+
+	return out
+}
+
+// symbolMLB takes the machine and an entry and returns the line for Mesen,
+// with the offset into the ROM file, the work RAM, or the registers of the
+// SNES
+func symbolMLB(m *data.Machine, e analyzer.Entry) string {
+
+	bank, addr := (e.Value>>16)&0xff, e.Value&0xffff
+	low := bank < 0x40 || (bank >= 0x80 && bank < 0xc0) // banks that have RAM and registers
+
+	var mem string
+	var offset int
+
+	switch {
+	case e.Value >= m.Origin && e.Value < m.Origin+len(m.Code):
+		mem, offset = "SnesPrgRom", e.Value-m.Origin
+	case bank == 0x7e || bank == 0x7f:
+		mem, offset = "SnesWorkRam", e.Value-0x7e0000
+	case low && addr < 0x2000:
+		mem, offset = "SnesWorkRam", addr
+	case low && (addr >= 0x2100 && addr < 0x2200 || addr >= 0x4200 && addr < 0x4400):
+		mem, offset = "SnesRegister", addr
+	default:
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%04X:%s", mem, offset, exporter.Mangle(e.Key))
+}
+
+// addrWidth takes the MPU and returns the number of hex digits of its
+// addresses
+func addrWidth(mpu string) int {
+	if mpu == "65816" {
+		return 6
+	}
+	return 4
+}
@@ -0,0 +1,48 @@
+// Test file for the symbol tables of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package lister
+
+import (
+	"strings"
+	"testing"
+
+	"cthulhu/data"
+)
+
+func TestSymbols(t *testing.T) {
+
+	m := &data.Machine{MPU: "65816", Origin: 0x018000, Code: make([]byte, 16), Symbols: map[string]data.Symbol{
+		"inidisp": {Value: 0x2100, Type: "symbol"},
+		"start":   {Value: 0x018000, Type: "label"},
+		"_loop/2": {Value: 0x018003, Type: "local"},
+		"got_a?":  {Value: 0x018005, Type: "label"},
+		"io":      {Value: 0xd000, Type: "symbol"},
+		"print":   {Type: "import"},
+	}}
+
+	var tests = []struct {
+		format string
+		want   []string
+	}{
+		{"cthulhu", []string{"; Symbol table for the 65816 made by the Cthulhu Assembler",
+			"inidisp                  $002100", "io                       $00D000", "start                    $018000",
+			"_loop_2                  $018003", "got_a?                   $018005"}},
+		{"vice", []string{"al C:002100 .inidisp", "al C:00D000 .io", "al C:018000 .start", "al C:018003 .loop__2",
+			"al C:018005 .got_a_3f"}},
+		{"mame", []string{"comadd 002100,inidisp", "comadd 00D000,io", "comadd 018000,start", "comadd 018003,loop__2",
+			"comadd 018005,got_a_3f"}},
+		{"bsnes", []string{"[labels]", "00:2100 inidisp", "00:D000 io", "01:8000 start", "01:8003 loop__2",
+			"01:8005 got_a_3f"}},
+		{"mlb", []string{"SnesRegister:2100:inidisp", "SnesPrgRom:0000:start", "SnesPrgRom:0003:loop__2",
+			"SnesPrgRom:0005:got_a_3f"}},
+	}
+
+	for _, test := range tests {
+		got := Symbols(m, test.format)
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
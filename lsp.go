@@ -0,0 +1,39 @@
+// Language server command for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// "cthulhu lsp" runs a language server over standard input and output for
+// editors such as VS Code and Neovim. See the lsp package for details.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"cthulhu/lsp"
+)
+
+// langServer takes the command line arguments after "lsp" and runs the
+// language server until the editor is done with it
+func langServer(args []string) {
+
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	lMPU := fs.String("m", "65c02", "MPU type for files without .mpu directive")
+	fs.Parse(args)
+
+	if *lMPU != "6502" && *lMPU != "65c02" && *lMPU != "65816" {
+		log.Fatalf("FATAL MPU '%s' not supported", *lMPU)
+	}
+
+	// Standard output belongs to the protocol now, so anything else that
+	// would be printed there goes to standard error instead
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	err := lsp.NewServer(os.Stdin, out, *lMPU).Run()
+	if err != nil {
+		log.Fatalf("FATAL Language server: %v", err)
+	}
+}
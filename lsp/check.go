@@ -0,0 +1,244 @@
+// Checking source files for the language server of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// We assemble a file every time it changes. Files that are open in the editor
+// are given to the assembler as they are, saved or not
+
+package lsp
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"cthulhu/assembler"
+	"cthulhu/data"
+)
+
+// result is what we know about a main file and the files it includes after
+// the last check
+type result struct {
+	mpu     string
+	files   []string                // absolute paths, main file first
+	diags   map[string][]Diagnostic // by absolute path
+	symbols map[string]data.Symbol  // nil if we didn't get to the analyzer
+}
+
+// Finds the MPU of a file, since the lexer needs it before we can parse
+var mpuLine = regexp.MustCompile(`(?m)^\s*\.mpu\s+"([^"]*)"`)
+
+// check takes the absolute path of a main file and returns the result of
+// assembling it. The texts of the open documents are used instead of the
+// files on disk
+func (s *Server) check(main string) *result {
+
+	r := &result{
+		mpu:   s.mpu,
+		diags: map[string][]Diagnostic{},
+	}
+
+	m := mpuLine.FindStringSubmatch(s.text(main))
+	if m != nil {
+		if _, ok := data.OpcodesSAN[m[1]]; ok {
+			r.mpu = m[1]
+		}
+	}
+
+	// The assembler is given file names as they appear in .include
+	// directives, which are relative to the root of the workspace
+	ses := assembler.New(r.mpu)
+	ses.FS = rootFS(s.root)
+
+	for path, text := range s.docs {
+		ses.Add(path, strings.NewReader(text))
+		if rel, err := filepath.Rel(s.root, path); err == nil {
+			ses.Add(rel, strings.NewReader(text))
+		}
+	}
+
+	res := ses.Assemble(main)
+
+	r.files = []string{main}
+	for _, f := range res.Files {
+		if !contains(r.files, s.abs(f)) {
+			r.files = append(r.files, s.abs(f))
+		}
+	}
+
+	r.symbols = res.Symbols
+
+	for _, d := range res.Diagnostics {
+		file := main
+		if d.File != "" {
+			file = s.abs(d.File)
+		}
+		s.addDiag(r, file, d)
+	}
+
+	return r
+}
+
+// rootFS reads files from the disk, with names that aren't absolute starting
+// at the directory it is set to
+type rootFS string
+
+func (r rootFS) Open(name string) (fs.File, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(string(r), name)
+	}
+	return os.Open(name)
+}
+
+// Severities of the assembler as the protocol has them
+var severities = map[data.Severity]int{
+	data.Error:   severityError,
+	data.Warning: severityWarning,
+	data.Note:    severityInformation,
+}
+
+// addDiag takes a result, a file, and a diagnostic of the assembler, and adds
+// it to the diagnostics of the file. The range is the span of the diagnostic,
+// or the word at its column, or the whole line if we don't know better
+func (s *Server) addDiag(r *result, file string, d data.Diagnostic) {
+
+	msg := d.Message
+	if d.Hint != "" {
+		msg += "\n" + d.Hint
+	}
+
+	var rel []DiagnosticRelatedInformation
+	for _, x := range d.Related {
+		f := file
+		if x.File != "" {
+			f = s.abs(x.File)
+		}
+		rel = append(rel, DiagnosticRelatedInformation{
+			Location: Location{URI: uriFromPath(f), Range: s.span(f, x.Line, x.Column, 0, 0)},
+			Message:  x.Message,
+		})
+	}
+
+	r.diags[file] = append(r.diags[file], Diagnostic{
+		Range:              s.span(file, d.Line, d.Column, d.EndLine, d.EndColumn),
+		Severity:           severities[d.Severity],
+		Source:             "cthulhu",
+		Message:            msg,
+		RelatedInformation: rel,
+	})
+}
+
+// span takes a file, and the start and end lines and columns as the assembler
+// counts them, and returns the range. Without an end, the range covers the
+// word at the column, or the whole line if there is no column
+func (s *Server) span(file string, line, col, endLine, end int) Range {
+
+	if line < 1 {
+		line, col, endLine = 1, 0, 0
+	}
+
+	rg := Range{Start: Position{Line: line - 1}, End: Position{Line: line - 1}}
+	text := s.line(file, line)
+
+	switch {
+	case col > 0 && endLine > line:
+		rg.Start.Character = col - 1
+		rg.End = Position{Line: endLine - 1, Character: end - 1}
+		return rg
+	case col > 0 && endLine == line && end > col:
+		rg.Start.Character, rg.End.Character = col-1, end-1
+	case col > 0:
+		rg.Start.Character, rg.End.Character = wordAround(text, col-1)
+	}
+
+	if rg.End.Character <= rg.Start.Character {
+		rg.Start.Character = 0
+		rg.End.Character = len([]rune(text))
+	}
+
+	return rg
+}
+
+// contains takes a list of strings and a string, and returns true if the
+// string is in the list
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// symbolAt takes a result, a file, and a zero-based position, and returns the
+// name of the symbol at this position in the symbol table. Local labels are
+// found by the scope they are used in, since the same name can be in several
+// scopes
+func (s *Server) symbolAt(r *result, file string, pos Position) (string, bool) {
+
+	word := s.wordAt(file, pos)
+	if word == "" || r.symbols == nil {
+		return "", false
+	}
+
+	line := pos.Line + 1
+	var global string
+
+	for k, sym := range r.symbols {
+		if !sameName(k, word) {
+			continue
+		}
+
+		if sym.File != "" && s.abs(sym.File) == file && sym.Line == line {
+			return k, true
+		}
+
+		for _, n := range sym.Refs {
+			if s.abs(n.File) == file && n.Line == line && n.Text == word {
+				return k, true
+			}
+		}
+
+		if k == word {
+			global = k
+		}
+	}
+
+	return global, global != ""
+}
+
+// sameName takes the name of a symbol in the symbol table and a word from the
+// source, and returns true if the word can refer to the symbol. Local labels
+// have the number of their scope added, and can be used without their
+// underscore
+func sameName(k, word string) bool {
+	if k == word {
+		return true
+	}
+
+	i := strings.LastIndex(k, "/")
+	if i < 0 {
+		return false
+	}
+
+	return k[:i] == word || k[:i] == "_"+word
+}
+
+// location takes a file, and a line and the start and end columns as the
+// assembler counts them, and returns the location. Without a column, it is
+// the start of the line
+func (s *Server) location(file string, line, col, end int) Location {
+	if col < 1 || end < col {
+		col, end = 1, 1
+	}
+
+	return Location{
+		URI: uriFromPath(file),
+		Range: Range{
+			Start: Position{Line: line - 1, Character: col - 1},
+			End:   Position{Line: line - 1, Character: end - 1},
+		},
+	}
+}
@@ -0,0 +1,197 @@
+// Navigation, hover and completion for the language server of the Cthulhu
+// Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cthulhu/data"
+)
+
+// Descriptions of the penalties of opcodes for hover
+var penaltyText = []struct {
+	flag int
+	text string
+}{
+	{data.CycM, "+1 with 16-bit A"},
+	{data.CycRMW, "+2 with 16-bit A"},
+	{data.CycX, "+1 with 16-bit X and Y"},
+	{data.CycDirect, "+1 if the direct page isn't page-aligned"},
+	{data.CycIndex, "+1 if indexing crosses a page"},
+	{data.CycTaken, "+1 if taken"},
+	{data.CycCross, "+1 if a taken branch crosses a page"},
+	{data.CycNative, "+1 in native mode"},
+	{data.CycDecimal, "+1 in decimal mode"},
+	{data.CycMove, "for each byte moved"},
+}
+
+// definition takes a file and a position, and returns where the symbol at
+// the position is defined, or nothing
+func (s *Server) definition(file string, pos Position) interface{} {
+	r := s.results[s.mainOf(file)]
+	if r == nil {
+		return nil
+	}
+
+	k, ok := s.symbolAt(r, file, pos)
+	if !ok {
+		return nil
+	}
+
+	sym := r.symbols[k]
+	if sym.File == "" {
+		return nil
+	}
+
+	return s.location(s.abs(sym.File), sym.Line, sym.Column, sym.Column+len([]rune(k[:nameLen(k)])))
+}
+
+// references takes a file and a position, and returns all places the symbol
+// at the position is used, including where it is defined if asked to
+func (s *Server) references(file string, pos Position, decl bool) []Location {
+	ls := []Location{}
+
+	r := s.results[s.mainOf(file)]
+	if r == nil {
+		return ls
+	}
+
+	k, ok := s.symbolAt(r, file, pos)
+	if !ok {
+		return ls
+	}
+
+	sym := r.symbols[k]
+
+	if decl && sym.File != "" {
+		ls = append(ls, s.location(s.abs(sym.File), sym.Line, sym.Column, sym.Column+len([]rune(k[:nameLen(k)]))))
+	}
+
+	for _, n := range sym.Refs {
+		ls = append(ls, s.location(s.abs(n.File), n.Line, n.Index, n.EndIndex))
+	}
+
+	return ls
+}
+
+// hover takes a file and a position, and returns what we know about the word
+// at the position: The value of a symbol, or the details of an opcode or
+// directive
+func (s *Server) hover(file string, pos Position) interface{} {
+	word := s.wordAt(file, pos)
+	if word == "" {
+		return nil
+	}
+
+	mpu := s.mpu
+	r := s.results[s.mainOf(file)]
+	if r != nil {
+		mpu = r.mpu
+	}
+
+	var text string
+	var k string
+	var ok bool
+
+	if r != nil {
+		k, ok = s.symbolAt(r, file, pos)
+	}
+
+	if ok {
+		sym := r.symbols[k]
+		text = fmt.Sprintf("%s `%s` = $%X (%d)", sym.Type, k[:nameLen(k)], sym.Value, sym.Value)
+
+		if sym.File != "" {
+			text += fmt.Sprintf("\n\nDefined in %s line %d", sym.File, sym.Line)
+		}
+
+	} else if oc, isOpcode := data.OpcodesSAN[mpu][word]; isOpcode {
+		text = opcodeText(oc)
+
+	} else if data.Directives[word] {
+		text = fmt.Sprintf("Directive `%s`", word)
+		if data.DirectivesPara[word] {
+			text += " with parameters"
+		}
+
+	} else {
+		return nil
+	}
+
+	return hover{Contents: markupContent{Kind: "markdown", Value: text}}
+}
+
+// opcodeText takes an opcode and describes it for hover
+func opcodeText(oc data.Opcode) string {
+	var ps []string
+
+	for _, p := range penaltyText {
+		if oc.Penalties&p.flag != 0 {
+			ps = append(ps, p.text)
+		}
+	}
+
+	size := fmt.Sprintf("%d byte(s)", oc.Length)
+	if oc.Embiggens {
+		size += ", one more with 16-bit registers"
+	}
+
+	cycles := fmt.Sprintf("%d cycle(s)", oc.Cycles)
+	if len(ps) > 0 {
+		cycles += ", " + strings.Join(ps, ", ")
+	}
+
+	return fmt.Sprintf("`%s` (WDC `%s`) opcode $%02X\n\n%s\n\n%s", oc.SAN, oc.WDC, oc.Value, size, cycles)
+}
+
+// completion takes a file and a position, and returns the mnemonics of the
+// MPU of the file, or the directives if the word starts with a period
+func (s *Server) completion(file string, pos Position) []completionItem {
+	cs := []completionItem{}
+
+	mpu := s.mpu
+	if r := s.results[s.mainOf(file)]; r != nil {
+		mpu = r.mpu
+	}
+
+	rs := []rune(s.line(file, pos.Line+1))
+	start, _ := wordAround(string(rs), pos.Character)
+	directive := start < len(rs) && rs[start] == '.'
+
+	if directive {
+		for d := range data.Directives {
+			if d == "..." {
+				continue
+			}
+			cs = append(cs, completionItem{Label: d, Kind: kindKeyword, Detail: "directive"})
+		}
+	} else {
+		for mn, oc := range data.OpcodesSAN[mpu] {
+			cs = append(cs, completionItem{
+				Label:  mn,
+				Kind:   kindFunction,
+				Detail: fmt.Sprintf("%s, %d byte(s), %d cycle(s)", oc.WDC, oc.Length, oc.Cycles),
+			})
+		}
+	}
+
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Label < cs[j].Label })
+
+	return cs
+}
+
+// nameLen takes the name of a symbol in the symbol table and returns the
+// length of the name as it is in the source, without the number of the scope
+// of local labels
+func nameLen(k string) int {
+	i := strings.LastIndex(k, "/")
+	if i < 0 || !strings.HasPrefix(k, "_") {
+		return len(k)
+	}
+	return i
+}
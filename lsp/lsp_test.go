@@ -0,0 +1,103 @@
+// Test file for the language server of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMain = `        .mpu "65c02"
+        .origin $8000
+        .include "defs.asm"
+loop:   lda.# chrout
+        jsr loop
+        jmp nowhere
+        lda.x chrout+chrout
+        .end
+`
+
+const testDefs = `        .equ chrout $d2
+`
+
+// frame takes a message and returns it with the header of the protocol
+func frame(method string, id int, params string) string {
+	var s string
+
+	if id == 0 {
+		s = fmt.Sprintf(`{"jsonrpc":"2.0","method":"%s","params":%s}`, method, params)
+	} else {
+		s = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":%s}`, id, method, params)
+	}
+
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(s), s)
+}
+
+func TestServer(t *testing.T) {
+
+	dir, err := os.MkdirTemp("", "cthulhu-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.WriteFile(filepath.Join(dir, "defs.asm"), []byte(testDefs), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := uriFromPath(filepath.Join(dir, "main.asm"))
+	text, _ := json.Marshal(testMain)
+	pos := func(l, c int) string {
+		return fmt.Sprintf(`{"textDocument":{"uri":"%s"},"position":{"line":%d,"character":%d},"context":{"includeDeclaration":true}}`, main, l, c)
+	}
+
+	in := frame("initialize", 1, fmt.Sprintf(`{"rootUri":"%s"}`, uriFromPath(dir))) +
+		frame("initialized", 0, `{}`) +
+		frame("textDocument/didOpen", 0, fmt.Sprintf(`{"textDocument":{"uri":"%s","text":%s}}`, main, text)) +
+		frame("textDocument/definition", 2, pos(4, 14)) +
+		frame("textDocument/references", 3, pos(3, 1)) +
+		frame("textDocument/hover", 4, pos(3, 18)) +
+		frame("textDocument/hover", 5, pos(3, 10)) +
+		frame("textDocument/completion", 6, pos(7, 9)) +
+		frame("textDocument/references", 8, pos(6, 15)) +
+		frame("shutdown", 7, `null`) +
+		frame("exit", 0, `null`)
+
+	var out bytes.Buffer
+	err = NewServer(strings.NewReader(in), &out, "65c02").Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	got := out.String()
+
+	var tests = []struct {
+		name string
+		want string
+	}{
+		{"diagnostic", `"message":"Symbol 'nowhere' not defined"`},
+		{"diagnostic range", `"range":{"start":{"line":5,"character":12},"end":{"line":5,"character":19}}`},
+		{"definition", `main.asm","range":{"start":{"line":3,"character":0},"end":{"line":3,"character":4}}}}`},
+		{"references", `"range":{"start":{"line":4,"character":12},"end":{"line":4,"character":16}}}]`},
+		{"hover symbol", "symbol `chrout` = $D2 (210)"},
+		{"hover opcode", "`lda.#` (WDC `lda`) opcode $A9"},
+		{"references twice on a line", `"range":{"start":{"line":6,"character":14},"end":{"line":6,"character":20}}},{"uri":"` + main + `","range":{"start":{"line":6,"character":21},"end":{"line":6,"character":27}}}]`},
+		{"definition of .equ", `defs.asm","range":{"start":{"line":0,"character":13},"end":{"line":0,"character":19}}}`},
+		{"completion", `{"label":".origin","kind":14,"detail":"directive"}`},
+		{"shutdown", `"id":7,"jsonrpc":"2.0","result":null`},
+	}
+
+	for _, test := range tests {
+		if !strings.Contains(got, test.want) {
+			t.Errorf("%s: want %s in\n%s", test.name, test.want, got)
+		}
+	}
+}
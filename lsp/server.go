@@ -0,0 +1,397 @@
+// Language server for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The language server speaks the Language Server Protocol (LSP) over standard
+// input and output, so editors such as VS Code and Neovim can show errors
+// while typing, jump to the definitions of labels and symbols, list where they
+// are used, show their values and the details of opcodes, and complete
+// mnemonics and directives.
+//
+// Files that include others are checked as a whole. Once we have seen that a
+// file is included, changes to it check the file that includes it, so the
+// symbols of all files are known.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Server holds the documents that are open in the editor and what we found
+// out about them
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	mpu  string // used if a file doesn't have a .mpu directive
+	root string // root of the workspace, which .include file names start from
+
+	docs    map[string]string  // text of open documents by absolute path
+	mains   map[string]string  // main file of each file that is included
+	results map[string]*result // by main file
+	shown   map[string]bool    // files we have shown diagnostics for
+
+	shutdown bool
+}
+
+// NewServer takes the reader and writer to talk to the editor over, and the
+// MPU to use for files without a .mpu directive, and returns a new server
+func NewServer(in io.Reader, out io.Writer, mpu string) *Server {
+	root, _ := os.Getwd()
+
+	return &Server{
+		in:      bufio.NewReader(in),
+		out:     out,
+		mpu:     mpu,
+		root:    root,
+		docs:    map[string]string{},
+		mains:   map[string]string{},
+		results: map[string]*result{},
+		shown:   map[string]bool{},
+	}
+}
+
+// Run handles messages until the editor tells us to exit or closes the
+// connection. It returns an error if this happens without a shutdown request
+// first, as the protocol wants
+func (s *Server) Run() error {
+
+	for {
+		bs, err := s.read()
+		if err == io.EOF {
+			return fmt.Errorf("connection closed without shutdown")
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		err = json.Unmarshal(bs, &msg)
+		if err != nil {
+			s.reply(nil, nil, &responseError{codeParseError, err.Error()})
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+
+		res, rerr := s.handle(msg)
+
+		if msg.ID != nil {
+			s.reply(msg.ID, res, rerr)
+		}
+	}
+}
+
+// handle takes a message and returns the result or the error for the reply.
+// Notifications return nothing
+func (s *Server) handle(msg message) (interface{}, *responseError) {
+
+	switch msg.Method {
+
+	case "initialize":
+		var p initializeParams
+		json.Unmarshal(msg.Params, &p)
+
+		if dir := pathFromURI(p.RootURI); dir != "" {
+			s.root = dir
+		}
+
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // we always get the full text
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]string{"name": "cthulhu"},
+		}, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			file := pathFromURI(p.TextDocument.URI)
+			s.docs[file] = p.TextDocument.Text
+			s.update(file)
+		}
+		return nil, nil
+
+	case "textDocument/didChange":
+		var p didChangeParams
+		if json.Unmarshal(msg.Params, &p) == nil && len(p.ContentChanges) > 0 {
+			file := pathFromURI(p.TextDocument.URI)
+			s.docs[file] = p.ContentChanges[len(p.ContentChanges)-1].Text
+			s.update(file)
+		}
+		return nil, nil
+
+	case "textDocument/didSave":
+		var p didCloseParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			s.update(pathFromURI(p.TextDocument.URI))
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var p didCloseParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			delete(s.docs, pathFromURI(p.TextDocument.URI))
+		}
+		return nil, nil
+
+	case "textDocument/definition", "textDocument/references",
+		"textDocument/hover", "textDocument/completion":
+
+		var p positionParams
+		err := json.Unmarshal(msg.Params, &p)
+		if err != nil {
+			return nil, &responseError{codeInvalidParams, err.Error()}
+		}
+
+		file := pathFromURI(p.TextDocument.URI)
+
+		switch msg.Method {
+		case "textDocument/definition":
+			return s.definition(file, p.Position), nil
+		case "textDocument/references":
+			return s.references(file, p.Position, p.Context.IncludeDeclaration), nil
+		case "textDocument/hover":
+			return s.hover(file, p.Position), nil
+		}
+		return s.completion(file, p.Position), nil
+	}
+
+	// Notifications we don't know can be ignored, requests must be answered
+	return nil, &responseError{codeMethodNotFound, fmt.Sprintf("Method '%s' not supported", msg.Method)}
+}
+
+// update takes a file that has changed, checks it or the file it is included
+// by, and shows the errors
+func (s *Server) update(file string) {
+	if file == "" {
+		return
+	}
+
+	main := s.mainOf(file)
+
+	r := s.check(main)
+
+	// If we didn't get to the analyzer, we keep the symbols we had so we
+	// can still find our way around while typing
+	if r.symbols == nil && s.results[main] != nil {
+		r.symbols = s.results[main].symbols
+	}
+	s.results[main] = r
+
+	for _, f := range r.files[1:] {
+		s.mains[f] = main
+	}
+
+	for _, f := range r.files {
+		s.publish(f, r.diags[f])
+	}
+
+	// Files that had errors before but are no longer part of the program
+	for f := range s.shown {
+		if s.mainOf(f) == main && !contains(r.files, f) {
+			s.publish(f, nil)
+		}
+	}
+}
+
+// mainOf takes a file and returns the file that includes it, or the file
+// itself if it isn't included by anything we know about
+func (s *Server) mainOf(file string) string {
+	main, ok := s.mains[file]
+	if !ok {
+		return file
+	}
+
+	// The main file might have lost its .include since
+	if r, ok := s.results[main]; ok && !contains(r.files, file) {
+		delete(s.mains, file)
+		return file
+	}
+
+	return main
+}
+
+// publish sends the diagnostics of a file to the editor
+func (s *Server) publish(file string, ds []Diagnostic) {
+	if ds == nil {
+		ds = []Diagnostic{}
+		delete(s.shown, file)
+	} else {
+		s.shown[file] = true
+	}
+
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uriFromPath(file),
+		Diagnostics: ds,
+	})
+}
+
+// read returns the next message from the editor. Messages have headers
+// like HTTP, of which we only need the length
+func (s *Server) read() ([]byte, error) {
+	length := -1
+
+	for {
+		l, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		l = strings.TrimSpace(l)
+		if l == "" {
+			break
+		}
+
+		if strings.HasPrefix(strings.ToLower(l), "content-length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(l[len("content-length:"):]))
+			if err != nil {
+				return nil, fmt.Errorf("bad header '%s'", l)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+
+	bs := make([]byte, length)
+	_, err := io.ReadFull(s.in, bs)
+
+	return bs, err
+}
+
+// write sends a message to the editor
+func (s *Server) write(v interface{}) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LSP ERROR: Can't encode message: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(bs), bs)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err *responseError) {
+	s.write(response{ID: id, Result: result, Error: err})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// text takes an absolute path and returns the text of the file, from the
+// editor if it is open there, otherwise from disk
+func (s *Server) text(file string) string {
+	text, ok := s.docs[file]
+	if ok {
+		return text
+	}
+
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+
+	return string(bs)
+}
+
+// line takes an absolute path and a line as the assembler counts them, and
+// returns the text of the line
+func (s *Server) line(file string, line int) string {
+	ls := strings.Split(s.text(file), "\n")
+
+	if line < 1 || line > len(ls) {
+		return ""
+	}
+
+	return strings.TrimRight(ls[line-1], "\r")
+}
+
+// wordAt takes an absolute path and a zero-based position, and returns the
+// word at the position, such as a symbol, a mnemonic or a directive
+func (s *Server) wordAt(file string, pos Position) string {
+	rs := []rune(s.line(file, pos.Line+1))
+	start, end := wordAround(string(rs), pos.Character)
+
+	return string(rs[start:end])
+}
+
+// wordAround takes a line and a zero-based column, and returns the start and
+// end of the word at the column. The cursor can also be just behind the word
+func wordAround(text string, col int) (int, int) {
+	rs := []rune(text)
+
+	if col > len(rs) {
+		col = len(rs)
+	}
+	if col < 0 {
+		col = 0
+	}
+
+	start := col
+	for start > 0 && isWordChar(rs[start-1]) {
+		start--
+	}
+
+	end := col
+	for end < len(rs) && isWordChar(rs[end]) {
+		end++
+	}
+
+	return start, end
+}
+
+// isWordChar takes a rune and returns true if it can be part of a symbol,
+// mnemonic or directive. These are the characters the lexer allows in symbols
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || strings.ContainsRune("?_!&'~#|.=^", r)
+}
+
+// abs takes a file name as the assembler has it and returns the absolute path
+func (s *Server) abs(file string) string {
+	if filepath.IsAbs(file) {
+		return filepath.Clean(file)
+	}
+	return filepath.Join(s.root, file)
+}
+
+// pathFromURI takes a "file://" URI and returns the path. Other URIs give an
+// empty string
+func pathFromURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.Clean(filepath.FromSlash(u.Path))
+}
+
+// uriFromPath takes an absolute path and returns the "file://" URI
+func uriFromPath(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
@@ -1,7 +1,7 @@
 // Node types for the AST of the Cthulhu Assembler
 // Scot W. Stevenson
 // First version 07. May 2018
-// This version 13. May 2018
+// This version 19. Oct 2026
 
 // Because we have a simple assembler and are not going to use obscene amounts
 // of data, we can get away with a homogenous Abstract Syntax Tree (AST) with
@@ -26,6 +26,9 @@ type Node struct {
 	Value       int     // for numbers of all sorts
 	Code        []byte  // The final byte stream that is added at the end
 	Done        bool    // Marks if node has been completely processed
+	Addr        int     // Address of the first byte, added by the analyzer
+	Cycles      int     // Fewest cycles of an instruction or scope, added by the analyzer
+	MaxCycles   int     // Most cycles of an instruction or scope, added by the analyzer
 }
 
 // Add creates a new subnode on an existing node. This is just a nicer way of
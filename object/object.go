@@ -0,0 +1,113 @@
+// Object package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// An object file is a module of a program that was assembled on its own. Its
+// relocatable segments don't have an address yet, and it can use symbols
+// that other modules export. The linker puts the modules together. Object
+// files are JSON, so they can be looked at with the usual tools.
+
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"cthulhu/data"
+)
+
+// Version of the format. Files with another version are rejected
+const Version = 1
+
+// File is an object file
+type File struct {
+	Format   string // always "cthulhu-object"
+	Version  int
+	MPU      string
+	Source   string // main source file of the module
+	Segments []Segment
+	Relocs   []data.Reloc
+	Exports  []Export
+	Imports  []string
+}
+
+// Segment is a segment of an object file. Relocatable segments start at 0
+// until the linker places them
+type Segment struct {
+	Name  string
+	Start int
+	Reloc bool
+	Code  []byte
+}
+
+// Export is a symbol the module makes available to the others. Its value is
+// relative to its base, as with relocations
+type Export struct {
+	Name   string
+	Value  int
+	Base   data.Base
+	File   string
+	Line   int
+	Column int
+}
+
+const format = "cthulhu-object"
+
+// FromMachine takes the machine of a program assembled as an object file
+// after the generator is done, and the name of its main source file, and
+// returns the object file
+func FromMachine(m *data.Machine, source string) *File {
+
+	f := &File{Format: format, Version: Version, MPU: m.MPU, Source: source, Relocs: m.Relocs}
+
+	for _, s := range m.Segments {
+		f.Segments = append(f.Segments, Segment{Name: s.Name, Start: s.Start, Reloc: s.Reloc, Code: s.Code})
+	}
+
+	for k, sym := range m.Symbols {
+		switch {
+		case sym.Exported:
+			f.Exports = append(f.Exports, Export{Name: k, Value: sym.Value, Base: sym.Base, File: sym.File, Line: sym.Line,
+				Column: sym.Column})
+		case sym.Type == "import":
+			f.Imports = append(f.Imports, k)
+		}
+	}
+
+	// Maps have no order, but the same source should give the same file
+	sort.Slice(f.Exports, func(i, j int) bool { return f.Exports[i].Name < f.Exports[j].Name })
+	sort.Strings(f.Imports)
+
+	return f
+}
+
+// Write takes a writer and an object file, and writes the file
+func Write(w io.Writer, f *File) error {
+	bs, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(bs, '\n'))
+	return err
+}
+
+// Read takes a reader and returns the object file it has
+func Read(r io.Reader) (*File, error) {
+	var f File
+
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("not an object file: %v", err)
+	}
+
+	if f.Format != format {
+		return nil, fmt.Errorf("not an object file")
+	}
+	if f.Version != Version {
+		return nil, fmt.Errorf("object file has version %d, need %d", f.Version, Version)
+	}
+
+	return &f, nil
+}
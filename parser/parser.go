@@ -1,7 +1,7 @@
 // Parser of the Cthulhu assembler
 // Scot W. Stevenson <scot.stevenson@gmail.com>
 // First version: 02. May 2018
-// This version: 21. May 2018
+// This version: 19. Oct 2026
 
 // The Cthulhu parser has one job: To create an Abstract Syntax Tree (AST) out
 // of the list of tokens. All further processing is handled in later steps,
@@ -13,8 +13,6 @@ package parser
 
 import (
 	"fmt"
-	"log"
-	"os"
 
 	"cthulhu/data"
 	"cthulhu/node"
@@ -25,139 +23,224 @@ const (
 	errTag = "PARSER"
 )
 
-var (
-	tokens    *[]token.Token // list of tokens to parse (from lexer)
-	p         int            // index to the current token we're looking at
-	current   token.Token    // current token we're examining
-	lookahead token.Token    // one token lookahead
-	ast       node.Node      // root of the Abstract Syntax Tree (AST)
-	errCount  int
-)
+// parser holds the state of one run of the parser, so that several can run at
+// the same time
+type parser struct {
+	tokens    []token.Token // list of tokens to parse (from lexer)
+	p         int           // index to the current token we're looking at
+	current   token.Token   // current token we're examining
+	lookahead token.Token   // one token lookahead
+	ast       node.Node     // root of the Abstract Syntax Tree (AST)
+	diags     []data.Diagnostic
+	bad       map[place]bool // lines with errors
+}
+
+// place is a line in a file
+type place struct {
+	file string
+	line int
+}
+
+// bail is what we panic with after an error to give up on the statement we
+// are parsing, so the parts that are left don't cause more errors
+type bail struct{}
 
-// reportErr takes a string and the current token and prints an error report to the standard
-// error output
-func reportErr(s string, t token.Token) {
-	fmt.Fprintf(os.Stderr, "%s ERROR (%s, %d, %d): %s\n",
-		errTag, t.File, t.Line, t.Index, s)
-	errCount++
-	rescue()
+// stuck is what we panic with when we reach the end of the file while trying
+// to recover from an error, since there is nothing left to parse
+type stuck struct{}
+
+// reportErr takes a string and the current token, adds an error to the list,
+// and gives up on the statement. walk recovers from this
+func (ps *parser) reportErr(s string, t token.Token) {
+	ps.diags = append(ps.diags, data.At(errTag, t, s))
+	ps.bad[place{t.File, t.Line}] = true
+	panic(bail{})
 }
 
 // rescue attempts to recover from an error by walking through the token string
 // to find the next EOL entry
-func rescue() {
-	for lookahead.Type != token.EOL {
-		consume()
+func (ps *parser) rescue() {
+	for ps.lookahead.Type != token.EOL {
+		ps.consume()
 
-		if lookahead.Type == token.EOF {
-			log.Fatalf("PARSER FATAL: Reached end of file trying to recover from %d error(s)", errCount)
+		if ps.lookahead.Type == token.EOF {
+			panic(stuck{})
 		}
 	}
 }
 
-// Init sets up the parser for the init run, haven been given the list of tokens
-func Init(ts *[]token.Token) {
+// Parse is the actual parsing function. It takes a list of token.Tokens and
+// returns the root node.Node to the whole program and the errors found. Lines
+// with errors are left out of the tree except for their labels, so the
+// analyzer can still look at the rest of the program
+func Parse(ts []token.Token) (ast *node.Node, ds []data.Diagnostic) {
 
 	// We can't recover if we don't have any tokens at all
-	if len(*ts) == 0 {
-		log.Fatal("LEXER FATAL: Received empty token list.")
+	if len(ts) == 0 {
+		d := data.Diagnostic{Stage: errTag, Message: "Received empty token list"}
+		return nil, []data.Diagnostic{d}
 	}
 
-	tokens = ts
-	ast = node.Node{Token: token.Token{Type: token.START, Text: "Cthulhu"}}
-	lookahead = (*tokens)[0]
-	p = -1 // current will catch up with first consume()
-}
+	ps := parser{
+		tokens:    ts,
+		ast:       node.Node{Token: token.Token{Type: token.START, Text: "Cthulhu"}},
+		lookahead: ts[0],
+		p:         -1, // current will catch up with first consume()
+		bad:       map[place]bool{},
+	}
 
-// Parser is the actual parsing function. It takes a list of token.Tokens and
-// returns the root node.Node to the whole program.
-func Parser() *node.Node {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(stuck); !ok {
+				panic(r)
+			}
+			d := ps.diags[len(ps.diags)-1]
+			d.Message = fmt.Sprintf("Reached end of file trying to recover from error: %s", d.Message)
+			ds = append(ps.diags[:len(ps.diags)-1], d)
+			ps.prune(&ps.ast)
+			ast = &ps.ast
+		}
+	}()
 
 	for {
-		ast.Kids = append(ast.Kids, walk())
+		ps.ast.Kids = append(ps.ast.Kids, ps.walk())
 
 		// This is how we end the whole parser
-		if current.Type == token.EOF {
+		if ps.current.Type == token.EOF {
 			break
 		}
 	}
 
-	if errCount != 0 {
-		log.Fatalf("PARSER FATAL: Found %d error(s).", errCount)
+	ps.prune(&ps.ast)
+
+	return &ps.ast, ps.diags
+}
+
+// prune takes the root node or a .test node and removes the statements on
+// lines with errors, since they can be missing parts. Labels are kept
+func (ps *parser) prune(n *node.Node) {
+	if len(ps.bad) == 0 {
+		return
 	}
 
-	return &ast
+	var kids []*node.Node
+
+	for _, k := range n.Kids {
+		switch {
+		case k.Type == token.LABEL, k.Type == token.LOCAL_LABEL, k.Type == token.ANON_LABEL:
+		case k.Type == token.EOL, k.Type == token.EOF:
+		case ps.bad[place{k.File, k.Line}]:
+			continue
+		case k.Type == token.DIREC_PARA && k.Text == ".test":
+			ps.prune(k)
+		}
+		kids = append(kids, k)
+	}
+
+	n.Kids = kids
 }
 
 // walk is the top-level function that starts parsing
-func walk() *node.Node {
+func (ps *parser) walk() (res *node.Node) {
 
 	var n node.Node
 
-	switch lookahead.Type {
+	// After an error, we skip to the end of the line and return the token
+	// we started with, which is removed by prune later
+	start := ps.lookahead
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bail); !ok {
+				panic(r)
+			}
+			ps.rescue()
+			k := node.Create(start)
+			res = &k
+		}
+	}()
+
+	switch ps.lookahead.Type {
 
 	case token.EOL, token.EOF, token.EMPTY, token.START:
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 
 	case token.COMMENT_LINE, token.COMMENT:
 		// We keep comments and structural whitespace for the formatted output.
 		// the lexer has already done all the heavy lifting for strings
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 
 	case token.DIREC_PARA:
-		n = parseDirectPara()
+		n = ps.parseDirectPara()
 
 	case token.DIREC, token.STRING, token.SYMBOL:
 		// The lexer has already done some of the work swith strings
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 
 	case token.LABEL, token.ANON_LABEL, token.LOCAL_LABEL:
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 
 	case token.OPC_0:
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 
 	case token.OPC_1:
 		// The first one is the opcode
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 
-		consume() // current is opcode, lookahead is operand
+		ps.consume() // current is opcode, lookahead is operand
 
 		// Now comes the operand. We can also load single character
 		// values this way, so we have to test for strings as well
-		o := parseOperand()
+		o := ps.parseOperand()
 		n.Kids = append(n.Kids, o)
+		stretch(&n)
+
+	case token.OPC_2:
+		// The move instructions take two operands, source and
+		// destination, separated by a comma
+		n = node.Create(ps.lookahead)
+
+		ps.consume() // current is opcode, lookahead is first operand
+		o1 := ps.parseElement()
+		n.Kids = append(n.Kids, o1)
+
+		ps.match(token.COMMA)
+		ps.consume() // current is comma, lookahead is second operand
+
+		o2 := ps.parseElement()
+		n.Kids = append(n.Kids, o2)
+		stretch(&n)
 	}
 
-	consume()
+	ps.consume()
 
 	return &n
 }
 
 // consume moves the pointer to the current token up by one and retrieves the next
 // token from the token list. This could also be called "next"
-func consume() {
+func (ps *parser) consume() {
 
-	if p+1 < len(*tokens) {
-		p++
-		current = (*tokens)[p]
+	if ps.p+1 < len(ps.tokens) {
+		ps.p++
+		ps.current = ps.tokens[ps.p]
 
-		if p+1 < len(*tokens) {
-			lookahead = (*tokens)[p+1]
+		if ps.p+1 < len(ps.tokens) {
+			ps.lookahead = ps.tokens[ps.p+1]
 		}
 
 	} else {
-		lookahead = token.Token{Type: token.EOF}
+		ps.lookahead = token.Token{Type: token.EOF}
 	}
 }
 
 // backtrack is the reverse of consume: It move the current token back by one
 // and pretends the last step never happened. We currently only use this for
 // ranges
-func backtrack() {
-	p--
-	current = (*tokens)[p]
-	lookahead = (*tokens)[p+1]
+func (ps *parser) backtrack() {
+	ps.p--
+	ps.current = ps.tokens[ps.p]
+	ps.lookahead = ps.tokens[ps.p+1]
 }
 
 // match takes a token type and a success bool checks it against the lookahead
@@ -165,7 +248,7 @@ func backtrack() {
 // consumes the current token, making the lookahead the current one. If the
 // token type is a composite -- say, token.NUMBER -- it checks to see if it is
 // legal such as token.BIN_NUM and returns that sub_type.
-func match(tt int) bool {
+func (ps *parser) match(tt int) bool {
 
 	found := false
 	err := false
@@ -176,7 +259,7 @@ func match(tt int) bool {
 		sts := token.SubTypes(tt)
 
 		for _, t := range sts {
-			if t == lookahead.Type {
+			if t == ps.lookahead.Type {
 				found = true
 				break
 			}
@@ -184,14 +267,14 @@ func match(tt int) bool {
 
 		if !found {
 			es := fmt.Sprintf("Expected token type '%s', got '%s'",
-				token.Name[tt], token.Name[lookahead.Type])
-			reportErr(es, lookahead)
+				token.Name[tt], token.Name[ps.lookahead.Type])
+			ps.reportErr(es, ps.lookahead)
 		}
 
-	} else if lookahead.Type != tt {
+	} else if ps.lookahead.Type != tt {
 		es := fmt.Sprintf("Expected token type '%s', got '%s'",
-			token.Name[tt], token.Name[lookahead.Type])
-		reportErr(es, lookahead)
+			token.Name[tt], token.Name[ps.lookahead.Type])
+		ps.reportErr(es, ps.lookahead)
 	}
 
 	return err
@@ -205,31 +288,31 @@ func match(tt int) bool {
 // parseNumber examines the lookahead token and throws an error if it is not one
 // of the three literals  binary number, decimal number, or hex number. If the
 // token is in fact a number, a new node is generated and a link to it returned
-func parseNumber() *node.Node {
-	t := lookahead.Type
+func (ps *parser) parseNumber() *node.Node {
+	t := ps.lookahead.Type
 
 	if t != token.HEX_NUM &&
 		t != token.DEC_NUM &&
 		t != token.BIN_NUM {
-		es := fmt.Sprintf("Expected number, got '%s'", token.Name[lookahead.Type])
-		reportErr(es, lookahead)
+		es := fmt.Sprintf("Expected number, got '%s'", token.Name[ps.lookahead.Type])
+		ps.reportErr(es, ps.lookahead)
 	}
 
-	n := node.Create(lookahead)
+	n := node.Create(ps.lookahead)
 	return &n
 }
 
 // parseElement examines the lookahead token and throws an error if it is not a
 // string or an expression. Otherwise, it returns a node of one of those two
 // types
-func parseElement() *node.Node {
+func (ps *parser) parseElement() *node.Node {
 	var n node.Node
 
-	if lookahead.Type == token.STRING {
-		n = node.Create(lookahead)
-		consume()
+	if ps.lookahead.Type == token.STRING {
+		n = node.Create(ps.lookahead)
+		ps.consume()
 	} else {
-		n = *parseExpr()
+		n = *ps.parseExpr()
 	}
 
 	return &n
@@ -239,24 +322,24 @@ func parseElement() *node.Node {
 // a symbol, a number, a RPN term, or the ".here" directive that signals the
 // current PC counter. If it is one of those, a link to a new node is returned
 // that contains those structures
-func parseValue() *node.Node {
+func (ps *parser) parseValue() *node.Node {
 	var n node.Node
 
-	switch lookahead.Type {
+	switch ps.lookahead.Type {
 
 	case token.L_CURLY:
-		n = *parseRPN()
+		n = *ps.parseRPN()
 	case token.SYMBOL:
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 	case token.DIREC:
-		if lookahead.Text != ".here" {
-			es := fmt.Sprintf("Directive '%s' is not a value", lookahead.Text)
-			reportErr(es, lookahead)
+		if ps.lookahead.Text != ".here" {
+			es := fmt.Sprintf("Directive '%s' is not a value", ps.lookahead.Text)
+			ps.reportErr(es, ps.lookahead)
 		}
 
-		n = node.Create(lookahead)
+		n = node.Create(ps.lookahead)
 	default:
-		n = *parseNumber()
+		n = *ps.parseNumber()
 	}
 	return &n
 }
@@ -266,14 +349,14 @@ func parseValue() *node.Node {
 // opcode we accept strings (eg for lda.# "a") and minus and plus (eg bra -).
 // Returns a node if successful, otherwise throws an error. The opcode is
 // expected to be in the lookahead token
-func parseOperand() *node.Node {
+func (ps *parser) parseOperand() *node.Node {
 	var n node.Node
 
 	// Catch branching to local labels
-	if lookahead.Type == token.MINUS || lookahead.Type == token.PLUS {
-		n = node.Create(lookahead)
+	if ps.lookahead.Type == token.MINUS || ps.lookahead.Type == token.PLUS {
+		n = node.Create(ps.lookahead)
 	} else {
-		n = *parseElement()
+		n = *ps.parseElement()
 	}
 	return &n
 }
@@ -282,82 +365,79 @@ func parseOperand() *node.Node {
 // with the left curly brace as the lookahead token. Grammar rule is
 //	rpn = "{" value { value | prn_operator } "}"
 // Returns the RPN sequences as a node
-func parseRPN() *node.Node {
+func (ps *parser) parseRPN() *node.Node {
 
 	// create a new node of type RPN
-	rt := token.Token{
-		Type:  token.RPN,
-		Text:  "RPN",
-		Line:  lookahead.Line,
-		Index: lookahead.Index,
-	}
+	rt := ps.lookahead
+	rt.Type = token.RPN
+	rt.Text = "RPN"
 
 	rn := node.Create(rt)
 
-	consume() // current is now the left curly brace, lookahead must be value
+	ps.consume() // current is now the left curly brace, lookahead must be value
 
 	// We need to have at least one value -- a number, a symbol, another RPN
 	// term, or the ".here" directive -- in the lookahead
-	t := parseValue()
+	t := ps.parseValue()
 	rn.Kids = append(rn.Kids, t)
 
-	consume() // current is now the value, lookahead is unknown
+	ps.consume() // current is now the value, lookahead is unknown
 
 	// While we've not been told to stop, add stuff to the RPN term's
 	// children
-	for lookahead.Type != token.R_CURLY {
+	for ps.lookahead.Type != token.R_CURLY {
 
 		// We shouldn't hit an end of line without a closing curly
 		// brace
-		if lookahead.Type == token.EOL {
-			reportErr("RPN term missing closing brace", lookahead)
+		if ps.lookahead.Type == token.EOL {
+			ps.reportErr("RPN term missing closing brace", ps.lookahead)
 		}
 
 		// After the initial value, we can either have another value or
 		// an operator that is legal for the RPN
-		_, ok := data.OperatorsRPN[lookahead.Text]
+		_, ok := data.OperatorsRPN[ps.lookahead.Text]
 		if ok {
-			rn.Adopt(&rn, &lookahead)
+			rn.Adopt(&rn, &ps.lookahead)
 		} else {
-			vn := parseValue()
+			vn := ps.parseValue()
 			rn.Kids = append(rn.Kids, vn)
 		}
 
-		consume()
+		ps.consume()
 	}
+
+	// The closing brace is the end of the term
+	rn.EndLine, rn.EndIndex = ps.lookahead.EndLine, ps.lookahead.EndIndex
+
 	return &rn
 }
 
 // parseRange creates a range node.
 // We arrive here with the ellipsis token as
 // lookahead and the first value as the current token.
-func parseRange() *node.Node {
+func (ps *parser) parseRange() *node.Node {
 
 	// We insert a RANGE token as the first child of current
 	// token and add the other children to it
-	rt := token.Token{
-		Type:  token.RANGE,
-		Line:  current.Line,
-		Index: current.Type,
-		Text:  "RANGE",
-	}
+	rt := token.Token{Type: token.RANGE, Text: "RANGE"}
 
 	// Create a range node
 	rn := node.Create(rt)
 
 	// The current token is the first expression. This is bad, because we
 	// can't call parseExpr() with the current expression. So we backtrack
-	backtrack()
+	ps.backtrack()
 
 	// Get our expression
-	e1 := parseElement()
+	e1 := ps.parseElement()
 	rn.Kids = append(rn.Kids, e1)
 
-	consume() // Current token is the ellipsis, the lookahead must be a value
+	ps.consume() // Current token is the ellipsis, the lookahead must be a value
 
 	// Get our expression
-	e2 := parseElement()
+	e2 := ps.parseElement()
 	rn.Kids = append(rn.Kids, e2)
+	cover(&rn)
 
 	// After the range, we end up with current on the last value of the
 	// range and whatever is after the range in lookahead
@@ -371,73 +451,75 @@ func parseRange() *node.Node {
 // expression. The grammar specification is
 // 	expr =  value | unary_operator value | value binary_operator value
 // We arrive here with the lookahead token as the first part of the expression
-func parseExpr() *node.Node {
+func (ps *parser) parseExpr() *node.Node {
 
 	// create a new node of type EXPR
-	et := token.Token{
-		Type:  token.EXPR,
-		Text:  "EXPR",
-		Line:  current.Line,
-		Index: current.Index,
-	}
+	et := token.Token{Type: token.EXPR, Text: "EXPR"}
 
 	en := node.Create(et)
 
 	// See if we have a unary (single) operator
-	_, ok := data.OperatorsUnary[lookahead.Text]
+	_, ok := data.OperatorsUnary[ps.lookahead.Text]
 	if ok {
 
 		// Add the unary operator to slice
-		un := node.Create(lookahead)
+		un := node.Create(ps.lookahead)
 		en.Kids = append(en.Kids, &un)
 
-		consume() // uniary now current, lookahead must be value
-		vn := parseValue()
+		ps.consume() // uniary now current, lookahead must be value
+		vn := ps.parseValue()
 		en.Kids = append(en.Kids, vn)
+		ps.consume() // value now current, lookahead unknown
 
 	} else {
 		// One way or another, the lookahead must be a value
-		vn := parseValue()
+		vn := ps.parseValue()
 		en.Kids = append(en.Kids, vn)
-		consume() // value now current, lookahead unknown
+		ps.consume() // value now current, lookahead unknown
 
 		// We either are done or we have a binary operator
-		_, ok := data.OperatorsBinary[lookahead.Text]
+		_, ok := data.OperatorsBinary[ps.lookahead.Text]
 		if ok {
 			// This is a binary operation. Add the binary operator
 			// to the slice
-			bn := node.Create(lookahead)
+			bn := node.Create(ps.lookahead)
 			en.Kids = append(en.Kids, &bn)
 
-			consume() // current now operator, lookahead must be value
+			ps.consume() // current now operator, lookahead must be value
 
 			// The next one must be a value or we're in trouble
-			vn := parseValue()
+			vn := ps.parseValue()
 			en.Kids = append(en.Kids, vn)
+			ps.consume() // value now current, lookahead unknown
 		}
 	}
+
+	cover(&en)
+
+	// We always end up with the last value of the expression as the
+	// current token, just like with a single value
 	return &en
 }
 
 // parseDirectPara handles directive nodes that have parameters. The lexer has
 // taken care of making sure that we only have legal directives at this point.
 // We arrive here with the directive as the lookahead token
-func parseDirectPara() node.Node {
+func (ps *parser) parseDirectPara() node.Node {
 
 	// Save DIREC mother node
-	n := node.Create(lookahead)
+	n := node.Create(ps.lookahead)
 
-	consume() // current is now the directive, lookahead is unknown
+	ps.consume() // current is now the directive, lookahead is unknown
 
-	switch current.Text {
+	switch ps.current.Text {
 
-	case ".byte", ".word", ".long":
+	case ".byte", ".word", ".long", ".asciiz", ".pstring", ".hstring":
 		// There is a lot of code duplication with .rom and .ram here,
 		// though the difference is the string, which may not appear in
 		// a range
-		for lookahead.Type != token.EOL && lookahead.Type != token.COMMENT {
+		for ps.lookahead.Type != token.EOL && ps.lookahead.Type != token.COMMENT {
 
-			switch lookahead.Type {
+			switch ps.lookahead.Type {
 
 			case token.ELLIPSIS:
 				// If we landed here, we have to backtrack
@@ -445,47 +527,123 @@ func parseDirectPara() node.Node {
 				// from the range directive as a normal address
 				n.Kids = n.Kids[0 : len(n.Kids)-1] // shorten list
 
-				rn := parseRange() // parseRange handles backtracking
+				rn := ps.parseRange() // parseRange handles backtracking
 				n.Kids = append(n.Kids, rn)
 
 			case token.COMMA:
-				consume() // current now comma, lookahead must be expr
+				ps.consume() // current now comma, lookahead must be expr
 
 			case token.STRING:
-				s := node.Create(lookahead)
+				s := node.Create(ps.lookahead)
 				n.Kids = append(n.Kids, &s)
-				consume()
+				ps.consume()
 
 			default:
 				// Even if this turns out to be a range, the next token
 				// must be an expression
-				e := parseElement()
+				e := ps.parseElement()
 				n.Kids = append(n.Kids, e)
 			}
 		}
 
 	case ".equ":
 		// First token must be a symbol
-		match(token.SYMBOL)
-		n.Adopt(&n, &lookahead)
+		ps.match(token.SYMBOL)
+		n.Adopt(&n, &ps.lookahead)
 
-		consume() // current is symbol, lookahead must be expression
-		e := parseExpr()
+		ps.consume() // current is symbol, lookahead must be expression
+		e := ps.parseExpr()
 		n.Kids = append(n.Kids, e)
 
 	case ".include":
-		match(token.STRING)
-		n.Adopt(&n, &lookahead)
+		ps.match(token.STRING)
+		n.Adopt(&n, &ps.lookahead)
+
+	case ".test":
+		// The name of the test comes first. After that, everything up
+		// to the ".tend" directive becomes a kid of the test node, so
+		// the code of the test stays apart from the program
+		ps.match(token.STRING)
+		n.Adopt(&n, &ps.lookahead)
+		ps.consume() // current is the name
+
+		for ps.lookahead.Type != token.DIREC || ps.lookahead.Text != ".tend" {
+			if ps.lookahead.Type == token.EOF {
+				ps.reportErr("Directive '.test' without '.tend'", n.Token)
+				break
+			}
+			n.Kids = append(n.Kids, ps.walk())
+		}
+
+	case ".expect":
+		// First comes what we check, which is a register name or an
+		// address, then the value we expect
+		e := ps.parseExpr()
+		n.Kids = append(n.Kids, e)
+		n.Kids = append(n.Kids, ps.parseElement())
 
-	case ".mpu", ".assert":
-		match(token.STRING)
-		n.Adopt(&n, &lookahead)
+	case ".mpu", ".assert", ".encoding":
+		ps.match(token.STRING)
+		n.Adopt(&n, &ps.lookahead)
 
-	case ".origin", ".advance", ".skip":
+	case ".charmap", ".segment":
+		// The string comes first, the characters or the name of the
+		// segment, then the byte of the first one or the address.
+		// Segments of object files don't need an address
+		ps.match(token.STRING)
+		n.Adopt(&n, &ps.lookahead)
+
+		ps.consume() // current is the string, lookahead must be expression
+		if n.Text == ".segment" && (ps.lookahead.Type == token.EOL || ps.lookahead.Type == token.COMMENT) {
+			break
+		}
+		e := ps.parseExpr()
+		n.Kids = append(n.Kids, e)
+
+	case ".import", ".export":
+		// A list of symbols separated by commas
+		for ps.lookahead.Type != token.EOL && ps.lookahead.Type != token.COMMENT {
+
+			if ps.lookahead.Type == token.COMMA {
+				ps.consume()
+				continue
+			}
+
+			ps.match(token.SYMBOL)
+			s := node.Create(ps.lookahead)
+			n.Kids = append(n.Kids, &s)
+			ps.consume()
+		}
+
+	case ".origin", ".cycles", ".dp", ".direct", ".databank":
 		// Next token must be an expression
-		e := parseExpr()
+		e := ps.parseExpr()
 		n.Kids = append(n.Kids, e)
 
+	case ".advance", ".skip", ".align":
+		// The expression can be followed by bytes and strings that are
+		// the pattern we fill with
+		e := ps.parseExpr()
+		n.Kids = append(n.Kids, e)
+
+		for ps.lookahead.Type != token.EOL && ps.lookahead.Type != token.COMMENT {
+
+			switch ps.lookahead.Type {
+
+			case token.COMMA:
+				ps.consume()
+
+			case token.STRING:
+				s := node.Create(ps.lookahead)
+				n.Kids = append(n.Kids, &s)
+				ps.consume()
+
+			default:
+				e := ps.parseElement()
+				n.Kids = append(n.Kids, e)
+			}
+		}
+
 	case ".ram", ".rom":
 		// This has a lot of overlap with .byte and friends, but we
 		// can't use the same code because .ram and .rom don't accept
@@ -495,10 +653,11 @@ func parseDirectPara() node.Node {
 		// We basically have a series of expressions separated by either
 		// an comma, an ellipsis, or (terminally) by an EOL token. We
 		// stop when we hit an EOL. The next line means that we will
-		// accept an empty .ram or .rom statement at first
-		for lookahead.Type != token.EOL {
+		// accept an empty .ram or .rom statement at first. A comment
+		// ends the line as well
+		for ps.lookahead.Type != token.EOL && ps.lookahead.Type != token.COMMENT {
 
-			switch lookahead.Type {
+			switch ps.lookahead.Type {
 
 			case token.ELLIPSIS:
 				// If we landed here, we have to backtrack
@@ -506,19 +665,51 @@ func parseDirectPara() node.Node {
 				// from the range directive as a normal address
 				n.Kids = n.Kids[0 : len(n.Kids)-1] // shorten list
 
-				rn := parseRange() // parseRange handles backtracking
+				rn := ps.parseRange() // parseRange handles backtracking
 				n.Kids = append(n.Kids, rn)
 
 			case token.COMMA:
-				consume() // current now comma, lookahead must be expr
+				ps.consume() // current now comma, lookahead must be expr
 
 			default:
 				// Even if this turns out to be a range, the next token
 				// must be an expression
-				e := parseExpr()
+				e := ps.parseExpr()
 				n.Kids = append(n.Kids, e)
 			}
 		}
 	}
+
+	// Tests span their whole block, which is too much to point at
+	if n.Text != ".test" {
+		stretch(&n)
+	}
+
 	return n
 }
+
+// stretch takes a node and makes its span reach to the end of its last kid,
+// so an instruction covers its operand
+func stretch(n *node.Node) {
+	if len(n.Kids) == 0 {
+		return
+	}
+
+	k := n.Kids[len(n.Kids)-1]
+	if k.EndLine > n.EndLine || (k.EndLine == n.EndLine && k.EndIndex > n.EndIndex) {
+		n.EndLine, n.EndIndex = k.EndLine, k.EndIndex
+	}
+}
+
+// cover takes a node the parser made up, such as an expression, and gives it
+// the span from the start of its first kid to the end of its last kid
+func cover(n *node.Node) {
+	if len(n.Kids) == 0 {
+		return
+	}
+
+	f, l := n.Kids[0], n.Kids[len(n.Kids)-1]
+
+	n.File, n.Line, n.Index = f.File, f.Line, f.Index
+	n.EndLine, n.EndIndex = l.EndLine, l.EndIndex
+}
@@ -0,0 +1,40 @@
+// Cycle counts for the simulator of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The base number of cycles and the penalties that can come on top are part
+// of the opcode tables. Penalties for crossing pages and taking branches are
+// added while the instruction is executed, since only then do we know the
+// address
+
+package simulator
+
+import "cthulhu/data"
+
+// penalty takes an opcode and returns the number of extra cycles it takes
+// because of the status of the MPU
+func (c *CPU) penalty(oc data.Opcode) int {
+	n := 0
+	p := oc.Penalties
+
+	if p&data.CycM != 0 && c.wideM() {
+		n++
+	}
+	if p&data.CycRMW != 0 && c.wideM() {
+		n += 2
+	}
+	if p&data.CycX != 0 && c.wideX() {
+		n++
+	}
+	if p&data.CycDirect != 0 && c.D&0xff != 0 {
+		n++
+	}
+	if p&data.CycNative != 0 && !c.E {
+		n++
+	}
+	if p&data.CycDecimal != 0 && c.P&FlagD != 0 {
+		n++
+	}
+
+	return n
+}
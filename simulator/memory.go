@@ -0,0 +1,111 @@
+// Memory for the simulator of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The CPU doesn't care where its bytes come from, so anything that can be read
+// from and written to with 24-bit addresses will do. Map is the usual memory,
+// built from the ".ram" and ".rom" directives of the program
+
+package simulator
+
+import (
+	"fmt"
+
+	"cthulhu/data"
+)
+
+// maxFaults is the number of bad memory accesses Map remembers
+const maxFaults = 100
+
+// Memory is what the CPU reads from and writes to. Addresses are 24 bit, so
+// the 6502 and 65c02 only use bank 0
+type Memory interface {
+	Read(addr int) byte
+	Write(addr int, b byte)
+}
+
+// Map is memory with areas of RAM and ROM. Writes to ROM are ignored, reads
+// from addresses that are neither return zero. Both are remembered as faults.
+// If there are no areas at all, everything is RAM
+type Map struct {
+	RAM    [][2]int // first and last address of each area
+	ROM    [][2]int // first and last address of each area
+	Faults []string // bad accesses, oldest first
+
+	bytes map[int]byte
+}
+
+// NewMap takes the areas of RAM and ROM and returns empty memory
+func NewMap(ram, rom [][2]int) *Map {
+	return &Map{RAM: ram, ROM: rom, bytes: map[int]byte{}}
+}
+
+// MachineMap takes the machine after the generator is done and returns memory
+// with the RAM and ROM areas of the program and the code loaded at the origin
+func MachineMap(m *data.Machine) *Map {
+	mm := NewMap(m.RAM, m.ROM)
+	mm.Load(m.Origin, m.Code)
+	return mm
+}
+
+// Load takes an address and a slice of bytes and puts them in memory, ROM or
+// not
+func (m *Map) Load(addr int, bs []byte) {
+	for i, b := range bs {
+		m.bytes[(addr+i)&0xffffff] = b
+	}
+}
+
+// Read takes an address and returns the byte stored there
+func (m *Map) Read(addr int) byte {
+	addr &= 0xffffff
+
+	if !m.mapped(addr) {
+		m.fault(fmt.Sprintf("Read from unmapped address $%06X", addr))
+		return 0
+	}
+
+	return m.bytes[addr]
+}
+
+// Write takes an address and a byte and stores the byte if the address is RAM
+func (m *Map) Write(addr int, b byte) {
+	addr &= 0xffffff
+
+	if in(addr, m.ROM) {
+		m.fault(fmt.Sprintf("Write to ROM at $%06X", addr))
+		return
+	}
+
+	if !m.mapped(addr) {
+		m.fault(fmt.Sprintf("Write to unmapped address $%06X", addr))
+		return
+	}
+
+	m.bytes[addr] = b
+}
+
+// mapped returns true if the address is RAM or ROM
+func (m *Map) mapped(addr int) bool {
+	if len(m.RAM) == 0 && len(m.ROM) == 0 {
+		return true
+	}
+	return in(addr, m.RAM) || in(addr, m.ROM)
+}
+
+// fault remembers a bad memory access
+func (m *Map) fault(s string) {
+	if len(m.Faults) < maxFaults {
+		m.Faults = append(m.Faults, s)
+	}
+}
+
+// in returns true if the address is in one of the areas
+func in(addr int, areas [][2]int) bool {
+	for _, a := range areas {
+		if addr >= a[0] && addr <= a[1] {
+			return true
+		}
+	}
+	return false
+}
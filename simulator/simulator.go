@@ -0,0 +1,894 @@
+// Simulator package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The simulator executes the machine code the generator produces, one
+// instruction at a time, so routines can be tested without hardware or an
+// external emulator. It knows the full register set of the 65816 including
+// the E, M and X flags, the bank registers and decimal mode, and treats the
+// 6502 and 65c02 as a 65816 that never leaves emulated mode. Instructions are
+// decoded with the opcode tables of the assembler. Interrupts are not
+// simulated, so "wai" ends a run just as "stp" does
+
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cthulhu/data"
+)
+
+// Bits of the status register
+const (
+	FlagC byte = 0x01 // carry
+	FlagZ byte = 0x02 // zero
+	FlagI byte = 0x04 // interrupt disable
+	FlagD byte = 0x08 // decimal mode
+	FlagX byte = 0x10 // 8-bit index registers, break flag in emulated mode
+	FlagM byte = 0x20 // 8-bit accumulator and memory, always set in emulated mode
+	FlagV byte = 0x40 // overflow
+	FlagN byte = 0x80 // negative
+)
+
+// Vectors for the interrupt instructions in native and emulated mode
+const (
+	vectorCOPNative = 0xffe4
+	vectorBRKNative = 0xffe6
+	vectorCOP       = 0xfff4
+	vectorReset     = 0xfffc
+	vectorBRK       = 0xfffe
+)
+
+// Conditional branches with the flag they test and the value they branch on
+var conditions = map[string]struct {
+	flag byte
+	set  bool
+}{
+	"bpl": {FlagN, false}, "bmi": {FlagN, true},
+	"bvc": {FlagV, false}, "bvs": {FlagV, true},
+	"bcc": {FlagC, false}, "bcs": {FlagC, true},
+	"bne": {FlagZ, false}, "beq": {FlagZ, true},
+}
+
+// ErrCycleLimit is returned by Run if the program didn't stop in time
+var ErrCycleLimit = errors.New("Cycle limit reached")
+
+// CPU is the state of the simulated MPU
+type CPU struct {
+	MPU string // "6502", "65c02" or "65816"
+
+	A, X, Y  uint16 // registers, 8-bit registers use the lower byte
+	S, D, PC uint16 // stack pointer, direct page, program counter
+	DBR, PBR byte   // data and program bank
+	P        byte   // status register
+	E        bool   // emulated mode, always true for the 6502 and 65c02
+
+	Mem Memory
+
+	Cycles  int  // cycles used since the start
+	Steps   int  // instructions executed since the start
+	Stopped bool // after "stp"
+	Waiting bool // after "wai"
+
+	oc     data.Opcode // the current instruction
+	cycles int         // cycles of the current instruction
+}
+
+// New takes the MPU and the memory, and returns a CPU after a reset
+func New(mpu string, mem Memory) (*CPU, error) {
+
+	if _, ok := data.OpcodesByValue[mpu]; !ok {
+		return nil, fmt.Errorf("MPU '%s' not supported", mpu)
+	}
+
+	c := &CPU{MPU: mpu, Mem: mem}
+	c.Reset()
+
+	return c, nil
+}
+
+// Reset puts the CPU in the state it has after a reset and loads the program
+// counter from the reset vector. The stack pointer starts at $01FF
+func (c *CPU) Reset() {
+	c.E = true
+	c.P = FlagM | FlagX | FlagI
+	c.D, c.DBR, c.PBR = 0, 0, 0
+	c.S = 0x01ff
+	c.Stopped, c.Waiting = false, false
+	c.fixRegisters()
+	c.PC = uint16(c.read(vectorReset, true))
+}
+
+// Address returns the 24-bit address of the next instruction
+func (c *CPU) Address() int {
+	return int(c.PBR)<<16 | int(c.PC)
+}
+
+// Next returns the opcode of the next instruction and true, or false if the
+// byte there is not an opcode of the MPU
+func (c *CPU) Next() (data.Opcode, bool) {
+	oc, ok := data.OpcodesByValue[c.MPU][c.Mem.Read(c.Address())]
+	return oc, ok
+}
+
+// Run executes instructions until the MPU stops or waits. If the limit is
+// larger than zero, it stops with ErrCycleLimit once the program has used up
+// that many cycles
+func (c *CPU) Run(limit int) error {
+	for !c.Stopped && !c.Waiting {
+		if limit > 0 && c.Cycles >= limit {
+			return ErrCycleLimit
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step executes a single instruction. The block moves of the 65816 move one
+// byte per step
+func (c *CPU) Step() error {
+
+	if c.Stopped || c.Waiting {
+		return fmt.Errorf("MPU halted at $%06X", c.Address())
+	}
+
+	addr := c.Address()
+	op := c.Mem.Read(addr)
+
+	oc, ok := data.OpcodesByValue[c.MPU][op]
+	if !ok {
+		return fmt.Errorf("Illegal opcode $%02X at $%06X", op, addr)
+	}
+
+	base, mode := oc.SAN, ""
+	if i := strings.Index(oc.SAN, "."); i > 0 {
+		base, mode = oc.SAN[:i], oc.SAN[i+1:]
+	}
+
+	c.PC++
+	c.oc = oc
+	c.cycles = oc.Cycles + c.penalty(oc)
+	c.execute(base, mode)
+
+	c.Cycles += c.cycles
+	c.Steps++
+
+	return nil
+}
+
+// String returns the registers in a single line, lowercase flags are clear
+func (c *CPU) String() string {
+	var fs []byte
+
+	for i, f := range "nvmxdizc" {
+		if c.P&(0x80>>uint(i)) != 0 {
+			f -= 'a' - 'A'
+		}
+		fs = append(fs, byte(f))
+	}
+
+	e := 0
+	if c.E {
+		e = 1
+	}
+
+	return fmt.Sprintf("PC=$%02X:%04X A=$%04X X=$%04X Y=$%04X S=$%04X D=$%04X DBR=$%02X P=%s E=%d",
+		c.PBR, c.PC, c.A, c.X, c.Y, c.S, c.D, c.DBR, fs, e)
+}
+
+// execute takes the name of the instruction without the mode and the mode,
+// and executes the instruction. The program counter points to the byte after
+// the opcode
+func (c *CPU) execute(base, mode string) {
+
+	wm, wx := c.wideM(), c.wideX()
+
+	switch base {
+
+	// Loads, stores and transfers
+
+	case "lda":
+		c.setA(c.load(mode, wm), wm)
+		c.setNZ(c.getA(wm), wm)
+	case "ldx":
+		c.X = uint16(c.load(mode, wx))
+		c.setNZ(int(c.X), wx)
+	case "ldy":
+		c.Y = uint16(c.load(mode, wx))
+		c.setNZ(int(c.Y), wx)
+
+	case "sta":
+		c.store(mode, c.getA(wm), wm)
+	case "stx":
+		c.store(mode, int(c.X), wx)
+	case "sty":
+		c.store(mode, int(c.Y), wx)
+	case "stz":
+		c.store(mode, 0, wm)
+
+	case "tax":
+		c.X = uint16(c.getA(wx))
+		c.setNZ(int(c.X), wx)
+	case "tay":
+		c.Y = uint16(c.getA(wx))
+		c.setNZ(int(c.Y), wx)
+	case "txa":
+		c.setA(int(c.X), wm)
+		c.setNZ(c.getA(wm), wm)
+	case "tya":
+		c.setA(int(c.Y), wm)
+		c.setNZ(c.getA(wm), wm)
+	case "txy":
+		c.Y = c.X
+		c.setNZ(int(c.Y), wx)
+	case "tyx":
+		c.X = c.Y
+		c.setNZ(int(c.X), wx)
+	case "tsx":
+		c.X = c.S & uint16(mask(wx))
+		c.setNZ(int(c.X), wx)
+	case "txs":
+		c.setS(int(c.X))
+	case "tcs":
+		c.setS(int(c.A))
+	case "tsc":
+		c.A = c.S
+		c.setNZ(int(c.A), true)
+	case "tcd":
+		c.D = c.A
+		c.setNZ(int(c.D), true)
+	case "tdc":
+		c.A = c.D
+		c.setNZ(int(c.A), true)
+	case "xba":
+		c.A = c.A<<8 | c.A>>8
+		c.setNZ(int(c.A), false)
+
+	// Arithmetic and logic
+
+	case "ora":
+		c.setA(c.getA(wm)|c.load(mode, wm), wm)
+		c.setNZ(c.getA(wm), wm)
+	case "and":
+		c.setA(c.getA(wm)&c.load(mode, wm), wm)
+		c.setNZ(c.getA(wm), wm)
+	case "eor":
+		c.setA(c.getA(wm)^c.load(mode, wm), wm)
+		c.setNZ(c.getA(wm), wm)
+	case "adc":
+		c.adc(c.load(mode, wm), wm)
+	case "sbc":
+		c.sbc(c.load(mode, wm), wm)
+
+	case "cmp":
+		c.compare(c.getA(wm), c.load(mode, wm), wm)
+	case "cpx":
+		c.compare(int(c.X), c.load(mode, wx), wx)
+	case "cpy":
+		c.compare(int(c.Y), c.load(mode, wx), wx)
+
+	case "bit":
+		v := c.load(mode, wm)
+		c.setFlag(FlagZ, c.getA(wm)&v == 0)
+		if mode != "#" {
+			c.setFlag(FlagN, v&sign(wm) != 0)
+			c.setFlag(FlagV, v&(sign(wm)>>1) != 0)
+		}
+
+	case "asl", "lsr", "rol", "ror", "inc", "dec", "tsb", "trb":
+		c.modify(base, mode, wm)
+
+	case "inx":
+		c.X = uint16((int(c.X) + 1) & mask(wx))
+		c.setNZ(int(c.X), wx)
+	case "iny":
+		c.Y = uint16((int(c.Y) + 1) & mask(wx))
+		c.setNZ(int(c.Y), wx)
+	case "dex":
+		c.X = uint16((int(c.X) - 1) & mask(wx))
+		c.setNZ(int(c.X), wx)
+	case "dey":
+		c.Y = uint16((int(c.Y) - 1) & mask(wx))
+		c.setNZ(int(c.Y), wx)
+
+	// Branches and jumps
+
+	case "bpl", "bmi", "bvc", "bvs", "bcc", "bcs", "bne", "beq":
+		cond := conditions[base]
+		c.branch(c.P&cond.flag != 0 == cond.set, mode)
+	case "bra":
+		c.branch(true, mode)
+
+	case "jmp":
+		c.jump(mode)
+
+	case "jsr":
+		switch mode {
+		case "l":
+			t := c.fetch(3)
+			c.push(int(c.PBR), false)
+			c.push(int(c.PC)-1, true)
+			c.PBR = byte(t >> 16)
+			c.PC = uint16(t)
+		case "xi":
+			t := c.fetch(2)
+			c.push(int(c.PC)-1, true)
+			c.PC = uint16(c.read(int(c.PBR)<<16|(t+int(c.X))&0xffff, true))
+		default:
+			t := c.fetch(2)
+			c.push(int(c.PC)-1, true)
+			c.PC = uint16(t)
+		}
+
+	case "rts":
+		c.PC = uint16(c.pull(true) + 1)
+		if mode == "l" {
+			c.PBR = byte(c.pull(false))
+		}
+
+	case "rti":
+		c.P = byte(c.pull(false))
+		c.fixRegisters()
+		c.PC = uint16(c.pull(true))
+		if !c.E {
+			c.PBR = byte(c.pull(false))
+		}
+
+	case "brk":
+		c.interrupt(vectorBRKNative, vectorBRK)
+	case "cop":
+		c.interrupt(vectorCOPNative, vectorCOP)
+
+	// Stack
+
+	case "pha":
+		c.push(c.getA(wm), wm)
+	case "phx":
+		c.push(int(c.X), wx)
+	case "phy":
+		c.push(int(c.Y), wx)
+	case "php":
+		c.push(int(c.P), false)
+	case "phb":
+		c.push(int(c.DBR), false)
+	case "phd":
+		c.push(int(c.D), true)
+	case "phk":
+		c.push(int(c.PBR), false)
+
+	case "pla":
+		c.setA(c.pull(wm), wm)
+		c.setNZ(c.getA(wm), wm)
+	case "plx":
+		c.X = uint16(c.pull(wx))
+		c.setNZ(int(c.X), wx)
+	case "ply":
+		c.Y = uint16(c.pull(wx))
+		c.setNZ(int(c.Y), wx)
+	case "plp":
+		c.P = byte(c.pull(false))
+		c.fixRegisters()
+	case "plb":
+		c.DBR = byte(c.pull(false))
+		c.setNZ(int(c.DBR), false)
+	case "pld":
+		c.D = uint16(c.pull(true))
+		c.setNZ(int(c.D), true)
+
+	case "phe":
+		switch mode {
+		case "#":
+			c.push(c.fetch(2), true)
+		case "d":
+			c.push(c.readDirect(c.direct(c.fetch(1), 0)), true)
+		case "r":
+			off := int(int16(c.fetch(2)))
+			c.push(int(c.PC)+off, true)
+		}
+
+	// Status
+
+	case "clc":
+		c.P &^= FlagC
+	case "sec":
+		c.P |= FlagC
+	case "cli":
+		c.P &^= FlagI
+	case "sei":
+		c.P |= FlagI
+	case "cld":
+		c.P &^= FlagD
+	case "sed":
+		c.P |= FlagD
+	case "clv":
+		c.P &^= FlagV
+
+	case "rep":
+		c.P &^= byte(c.fetch(1))
+		c.fixRegisters()
+	case "sep":
+		c.P |= byte(c.fetch(1))
+		c.fixRegisters()
+
+	case "xce":
+		carry := c.P&FlagC != 0
+		c.setFlag(FlagC, c.E)
+		c.E = carry
+		c.fixRegisters()
+
+	// Everything else
+
+	case "mvn", "mvp":
+		c.move(base == "mvn")
+
+	case "wdm":
+		c.fetch(1) // signature byte
+	case "nop":
+	case "wai":
+		c.Waiting = true
+	case "stp":
+		c.Stopped = true
+	}
+}
+
+// wideM returns true if the accumulator and memory are 16 bit
+func (c *CPU) wideM() bool {
+	return !c.E && c.P&FlagM == 0
+}
+
+// wideX returns true if the index registers are 16 bit
+func (c *CPU) wideX() bool {
+	return !c.E && c.P&FlagX == 0
+}
+
+// fixRegisters makes the registers agree with the mode and the status flags
+// after they have changed
+func (c *CPU) fixRegisters() {
+	if c.E {
+		c.P |= FlagM | FlagX
+		c.S = 0x0100 | c.S&0xff
+	}
+	if c.P&FlagX != 0 {
+		c.X &= 0xff
+		c.Y &= 0xff
+	}
+}
+
+// getA returns the accumulator with the given width
+func (c *CPU) getA(wide bool) int {
+	return int(c.A) & mask(wide)
+}
+
+// setA takes a value and a width and stores the value in the accumulator.
+// With 8 bits, the upper byte is kept
+func (c *CPU) setA(v int, wide bool) {
+	if wide {
+		c.A = uint16(v)
+		return
+	}
+	c.A = c.A&0xff00 | uint16(v&0xff)
+}
+
+// setS takes a value and stores it in the stack pointer, which stays in page 1
+// in emulated mode
+func (c *CPU) setS(v int) {
+	c.S = uint16(v)
+	if c.E {
+		c.S = 0x0100 | c.S&0xff
+	}
+}
+
+// setFlag takes a flag and sets or clears it
+func (c *CPU) setFlag(f byte, on bool) {
+	if on {
+		c.P |= f
+		return
+	}
+	c.P &^= f
+}
+
+// setNZ takes a result and its width, and sets the negative and zero flags
+func (c *CPU) setNZ(v int, wide bool) {
+	c.setFlag(FlagZ, v&mask(wide) == 0)
+	c.setFlag(FlagN, v&sign(wide) != 0)
+}
+
+// read takes an address and a width, and returns the value stored there
+func (c *CPU) read(addr int, wide bool) int {
+	v := int(c.Mem.Read(addr & 0xffffff))
+	if wide {
+		v |= int(c.Mem.Read((addr+1)&0xffffff)) << 8
+	}
+	return v
+}
+
+// write takes an address, a value and a width, and stores the value
+func (c *CPU) write(addr, v int, wide bool) {
+	c.Mem.Write(addr&0xffffff, byte(v))
+	if wide {
+		c.Mem.Write((addr+1)&0xffffff, byte(v>>8))
+	}
+}
+
+// fetch takes a number of bytes and returns them from the instruction stream
+// as a little endian value
+func (c *CPU) fetch(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v |= int(c.Mem.Read(c.Address())) << uint(8*i)
+		c.PC++
+	}
+	return v
+}
+
+// push takes a value and a width, and puts the value on the stack
+func (c *CPU) push(v int, wide bool) {
+	if wide {
+		c.push(v>>8, false)
+	}
+	c.Mem.Write(int(c.S), byte(v))
+	c.setS(int(c.S) - 1)
+}
+
+// pull takes a width and returns a value from the stack
+func (c *CPU) pull(wide bool) int {
+	c.setS(int(c.S) + 1)
+	v := int(c.Mem.Read(int(c.S)))
+	if wide {
+		v |= c.pull(false) << 8
+	}
+	return v
+}
+
+// direct takes an offset and an index and returns the address in the direct
+// page. In emulated mode, an aligned direct page wraps around like the zero
+// page of the 6502
+func (c *CPU) direct(off, index int) int {
+	if c.E && c.D&0xff == 0 {
+		return int(c.D) | (off+index)&0xff
+	}
+	return (int(c.D) + off + index) & 0xffff
+}
+
+// readDirect takes an address in the direct page and returns the 16-bit
+// pointer stored there
+func (c *CPU) readDirect(p int) int {
+	hi := (p + 1) & 0xffff
+	if c.E && c.D&0xff == 0 {
+		hi = p&0xff00 | (p+1)&0xff
+	}
+	return int(c.Mem.Read(p)) | int(c.Mem.Read(hi))<<8
+}
+
+// address takes a mode and returns the effective address of the operand.
+// Instructions that take longer if indexing crosses a page get their extra
+// cycle here
+func (c *CPU) address(mode string) int {
+	dbr := int(c.DBR) << 16
+
+	// indexed adds the index to a base address
+	indexed := func(base int, index uint16) int {
+		a := (base + int(index)) & 0xffffff
+		if c.oc.Penalties&data.CycIndex != 0 &&
+			(a&0xffff00 != base&0xffff00 || c.wideX()) {
+			c.cycles++
+		}
+		return a
+	}
+
+	switch mode {
+	case "x":
+		return indexed(dbr|c.fetch(2), c.X)
+	case "y":
+		return indexed(dbr|c.fetch(2), c.Y)
+	case "d":
+		return c.direct(c.fetch(1), 0)
+	case "dx":
+		return c.direct(c.fetch(1), int(c.X))
+	case "dy":
+		return c.direct(c.fetch(1), int(c.Y))
+	case "di":
+		return dbr | c.readDirect(c.direct(c.fetch(1), 0))
+	case "dxi":
+		return dbr | c.readDirect(c.direct(c.fetch(1), int(c.X)))
+	case "diy":
+		return indexed(dbr|c.readDirect(c.direct(c.fetch(1), 0)), c.Y)
+	case "dil":
+		p := c.direct(c.fetch(1), 0)
+		return c.read(p, true) | c.read((p+2)&0xffff, false)<<16
+	case "dily":
+		p := c.direct(c.fetch(1), 0)
+		return indexed(c.read(p, true)|c.read((p+2)&0xffff, false)<<16, c.Y)
+	case "l":
+		return c.fetch(3)
+	case "lx":
+		return indexed(c.fetch(3), c.X)
+	case "s":
+		return (int(c.S) + c.fetch(1)) & 0xffff
+	case "siy":
+		p := (int(c.S) + c.fetch(1)) & 0xffff
+		return indexed(dbr|c.read(p, true), c.Y)
+	}
+
+	return dbr | c.fetch(2) // absolute
+}
+
+// load takes the mode and the width, and returns the operand of an
+// instruction that reads
+func (c *CPU) load(mode string, wide bool) int {
+
+	if mode == "#" {
+		if wide {
+			return c.fetch(2)
+		}
+		return c.fetch(1)
+	}
+
+	return c.read(c.address(mode), wide)
+}
+
+// store takes the mode, a value and the width, and writes the value to the
+// effective address
+func (c *CPU) store(mode string, v int, wide bool) {
+	c.write(c.address(mode), v, wide)
+}
+
+// modify executes the instructions that change a value in memory or in the
+// accumulator
+func (c *CPU) modify(base, mode string, wide bool) {
+	var a, v int
+
+	if mode == "a" {
+		v = c.getA(wide)
+	} else {
+		a = c.address(mode)
+		v = c.read(a, wide)
+	}
+
+	carry := int(c.P & FlagC)
+
+	switch base {
+	case "asl":
+		c.setFlag(FlagC, v&sign(wide) != 0)
+		v <<= 1
+	case "lsr":
+		c.setFlag(FlagC, v&1 != 0)
+		v >>= 1
+	case "rol":
+		c.setFlag(FlagC, v&sign(wide) != 0)
+		v = v<<1 | carry
+	case "ror":
+		c.setFlag(FlagC, v&1 != 0)
+		v = v>>1 | carry*sign(wide)
+	case "inc":
+		v++
+	case "dec":
+		v--
+	case "tsb":
+		c.setFlag(FlagZ, v&c.getA(wide) == 0)
+		v |= c.getA(wide)
+	case "trb":
+		c.setFlag(FlagZ, v&c.getA(wide) == 0)
+		v &^= c.getA(wide)
+	}
+
+	v &= mask(wide)
+
+	if base != "tsb" && base != "trb" {
+		c.setNZ(v, wide)
+	}
+
+	if mode == "a" {
+		c.setA(v, wide)
+		return
+	}
+	c.write(a, v, wide)
+}
+
+// adc adds a value and the carry to the accumulator, in decimal mode if the
+// flag is set
+func (c *CPU) adc(v int, wide bool) {
+	a := c.getA(wide)
+	carry := int(c.P & FlagC)
+
+	var r int
+	if c.P&FlagD != 0 {
+		r, carry = decimalAdd(a, v, carry, wide)
+	} else {
+		r = a + v + carry
+		carry = r >> uint(len16(wide))
+	}
+	r &= mask(wide)
+
+	c.setFlag(FlagV, ^(a^v)&(a^r)&sign(wide) != 0)
+	c.setFlag(FlagC, carry != 0)
+	c.setA(r, wide)
+	c.setNZ(r, wide)
+}
+
+// sbc subtracts a value and the borrow from the accumulator, in decimal mode
+// if the flag is set
+func (c *CPU) sbc(v int, wide bool) {
+	a := c.getA(wide)
+	borrow := 1 - int(c.P&FlagC)
+
+	r := a - v - borrow
+	c.setFlag(FlagV, (a^v)&(a^r)&sign(wide) != 0)
+
+	if c.P&FlagD != 0 {
+		r, borrow = decimalSub(a, v, borrow, wide)
+	} else if r < 0 {
+		borrow = 1
+	} else {
+		borrow = 0
+	}
+	r &= mask(wide)
+
+	c.setFlag(FlagC, borrow == 0)
+	c.setA(r, wide)
+	c.setNZ(r, wide)
+}
+
+// compare takes a register, a value and the width, and sets the flags as if
+// the value was subtracted from the register
+func (c *CPU) compare(reg, v int, wide bool) {
+	c.setFlag(FlagC, reg >= v)
+	c.setNZ(reg-v, wide)
+}
+
+// branch takes the condition and the mode, and branches if the condition is
+// true
+func (c *CPU) branch(taken bool, mode string) {
+	var off int
+
+	if mode == "l" {
+		off = int(int16(c.fetch(2)))
+	} else {
+		off = int(int8(c.fetch(1)))
+	}
+
+	if !taken {
+		return
+	}
+
+	t := uint16(int(c.PC) + off)
+
+	if c.oc.Penalties&data.CycTaken != 0 {
+		c.cycles++
+	}
+	if c.oc.Penalties&data.CycCross != 0 && c.E && t&0xff00 != c.PC&0xff00 {
+		c.cycles++
+	}
+
+	c.PC = t
+}
+
+// jump takes the mode of a jump and sets the program counter
+func (c *CPU) jump(mode string) {
+	t := c.fetch(2)
+
+	switch mode {
+	case "l":
+		t |= c.fetch(1) << 16
+		c.PBR = byte(t >> 16)
+	case "i":
+		// The 6502 doesn't carry into the upper byte of the pointer
+		hi := (t + 1) & 0xffff
+		if c.MPU == "6502" {
+			hi = t&0xff00 | (t+1)&0xff
+		}
+		t = int(c.Mem.Read(t)) | int(c.Mem.Read(hi))<<8
+	case "xi":
+		t = c.read(int(c.PBR)<<16|(t+int(c.X))&0xffff, true)
+	case "il":
+		p := t
+		t = c.read(p, true) | c.read((p+2)&0xffff, false)<<16
+		c.PBR = byte(t >> 16)
+	}
+
+	c.PC = uint16(t)
+}
+
+// interrupt takes the vectors for native and emulated mode and executes "brk"
+// or "cop". The 6502 doesn't clear the decimal flag
+func (c *CPU) interrupt(native, emulated int) {
+	c.fetch(1) // signature byte
+
+	vector := emulated
+	if !c.E {
+		vector = native
+		c.push(int(c.PBR), false)
+	}
+
+	c.push(int(c.PC), true)
+	c.push(int(c.P), false)
+
+	c.P |= FlagI
+	if c.MPU != "6502" {
+		c.P &^= FlagD
+	}
+
+	c.PBR = 0
+	c.PC = uint16(c.read(vector, true))
+}
+
+// move executes one step of "mvn" or "mvp". The instruction repeats until the
+// accumulator has counted down past zero
+func (c *CPU) move(next bool) {
+	dst := c.fetch(1)
+	src := c.fetch(1)
+
+	c.DBR = byte(dst)
+	c.write(dst<<16|int(c.Y), c.read(src<<16|int(c.X), false), false)
+
+	step := -1
+	if next {
+		step = 1
+	}
+
+	c.X = uint16((int(c.X) + step) & mask(c.wideX()))
+	c.Y = uint16((int(c.Y) + step) & mask(c.wideX()))
+	c.A--
+
+	if c.A != 0xffff {
+		c.PC -= 3
+	}
+}
+
+// decimalAdd takes two BCD numbers, the carry and the width, and returns the
+// sum and the new carry
+func decimalAdd(a, b, carry int, wide bool) (int, int) {
+	r := 0
+
+	for s := uint(0); s < uint(len16(wide)); s += 4 {
+		d := (a>>s)&0xf + (b>>s)&0xf + carry
+		carry = 0
+		if d > 9 {
+			d = (d + 6) & 0xf
+			carry = 1
+		}
+		r |= d << s
+	}
+
+	return r, carry
+}
+
+// decimalSub takes two BCD numbers, the borrow and the width, and returns the
+// difference and the new borrow
+func decimalSub(a, b, borrow int, wide bool) (int, int) {
+	r := 0
+
+	for s := uint(0); s < uint(len16(wide)); s += 4 {
+		d := (a>>s)&0xf - (b>>s)&0xf - borrow
+		borrow = 0
+		if d < 0 {
+			d += 10
+			borrow = 1
+		}
+		r |= (d & 0xf) << s
+	}
+
+	return r, borrow
+}
+
+// len16 takes a width flag and returns the number of bits
+func len16(wide bool) int {
+	if wide {
+		return 16
+	}
+	return 8
+}
+
+// mask takes a width flag and returns the mask for a value of that width
+func mask(wide bool) int {
+	return 1<<uint(len16(wide)) - 1
+}
+
+// sign takes a width flag and returns the sign bit of a value of that width
+func sign(wide bool) int {
+	return 1 << uint(len16(wide)-1)
+}
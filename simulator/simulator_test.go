@@ -0,0 +1,77 @@
+// Test file for the simulator of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package simulator
+
+import "testing"
+
+func TestSimulator(t *testing.T) {
+
+	var tests = []struct {
+		name   string
+		mpu    string
+		code   []byte // loaded at $8000, must end with stp
+		a      uint16
+		x      uint16
+		y      uint16
+		p      byte
+		cycles int
+	}{
+		{"load and store", "65c02",
+			[]byte{0xa9, 0x80, 0x85, 0x10, 0xa6, 0x10, 0xdb}, // lda.# $80 sta.d $10 ldx.d $10
+			0x80, 0x80, 0, 0xb4, 2 + 3 + 3},
+		{"loop", "65c02",
+			[]byte{0xa2, 0x05, 0xca, 0xd0, 0xfd, 0xdb}, // ldx.# 5 - dex bne -
+			0, 0, 0, 0x36, 2 + 5*2 + 4*3 + 2},
+		{"decimal add", "65c02",
+			[]byte{0xf8, 0x18, 0xa9, 0x19, 0x69, 0x28, 0xdb}, // sed clc lda.# $19 adc.# $28
+			0x47, 0, 0, 0x3c, 2 + 2 + 2 + 3},
+		{"decimal subtract", "65816",
+			[]byte{0xf8, 0x38, 0xa9, 0x10, 0xe9, 0x01, 0xdb}, // sed sec lda.# $10 sbc.# $01
+			0x09, 0, 0, 0x3d, 2 + 2 + 2 + 2},
+		{"native 16 bit", "65816",
+			[]byte{0x18, 0xfb, 0xc2, 0x30, 0xa9, 0x34, 0x12, 0xaa, 0xe8, 0xdb}, // .native .axy16 lda.# $1234 tax inx
+			0x1234, 0x1235, 0, 0x05, 2 + 2 + 3 + 3 + 2 + 2},
+		{"subroutine", "65816",
+			[]byte{0x20, 0x04, 0x80, 0xdb, 0xa0, 0x2a, 0x60}, // jsr $8004 stp ldy.# 42 rts
+			0, 0, 42, 0x34, 6 + 2 + 6},
+		{"block move", "65816",
+			[]byte{0xa9, 0x02, 0xa2, 0x00, 0xa0, 0x10, 0x54, 0x00, 0x00, 0xdb}, // lda.# 2 ldx.# 0 ldy.# $10 mvn 0, 0
+			0xffff, 0x03, 0x13, 0x34, 2 + 2 + 2 + 3*7},
+	}
+
+	for _, test := range tests {
+		mem := NewMap(nil, nil)
+		mem.Load(0x8000, test.code)
+		mem.Load(vectorReset, []byte{0x00, 0x80})
+
+		c, err := New(test.mpu, mem)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		err = c.Run(1000)
+		c.Cycles -= 3 // stp
+
+		if err != nil || c.A != test.a || c.X != test.x || c.Y != test.y ||
+			c.P != test.p || c.Cycles != test.cycles {
+			t.Errorf("%s: got %s cycles=%d (%v), want A=$%04X X=$%04X Y=$%04X P=$%02X cycles=%d",
+				test.name, c, c.Cycles, err, test.a, test.x, test.y, test.p, test.cycles)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	mem := NewMap([][2]int{{0x0000, 0x00ff}}, [][2]int{{0x8000, 0x80ff}})
+	mem.Load(0x8000, []byte{0x42})
+
+	mem.Write(0x0010, 0x01)
+	mem.Write(0x8000, 0x02)
+	mem.Read(0x4000)
+
+	if mem.Read(0x0010) != 0x01 || mem.Read(0x8000) != 0x42 || len(mem.Faults) != 2 {
+		t.Errorf("Map: got RAM $%02X, ROM $%02X, faults %v",
+			mem.Read(0x0010), mem.Read(0x8000), mem.Faults)
+	}
+}
@@ -0,0 +1,79 @@
+// Test command for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// "cthulhu test" assembles a source file and runs its .test blocks in the
+// simulator. Results are printed for humans and can be saved as JUnit XML for
+// continuous integration systems. See the tester package for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"cthulhu/assembler"
+	"cthulhu/tester"
+)
+
+// test takes the command line arguments after "test", assembles the input
+// file and runs the tests. The program exits with an error if a test fails
+func test(args []string) {
+
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	tInput := fs.String("i", "", "Input file (REQUIRED)")
+	tMPU := fs.String("m", "65c02", "MPU type")
+	tJUnit := fs.String("j", "", "File name to save the results as JUnit XML")
+	tLimit := fs.Int("c", tester.DefaultLimit, "Cycle limit for each test")
+	fs.Parse(args)
+
+	if *tMPU != "6502" && *tMPU != "65c02" && *tMPU != "65816" {
+		log.Fatalf("FATAL MPU '%s' not supported", *tMPU)
+	}
+	if *tInput == "" {
+		log.Fatal("FATAL No input file provided")
+	}
+
+	res := assembler.New(*tMPU).Assemble(*tInput)
+
+	if report(res.Diagnostics, res.Source) > 0 {
+		os.Exit(exitErrors)
+	}
+
+	rs := tester.Tester(res.Machine, *tLimit)
+
+	failed := 0
+
+	for _, r := range rs {
+		if r.Passed() {
+			fmt.Printf("PASS %s (%d cycles)\n", r.Name, r.Cycles)
+			continue
+		}
+
+		failed++
+		fmt.Printf("FAIL %s (%s, %d)\n", r.Name, r.File, r.Line)
+		for _, f := range r.Failures {
+			fmt.Printf("    %s\n", f)
+		}
+	}
+
+	fmt.Printf("%d test(s), %d failure(s)\n", len(rs), failed)
+
+	if *tJUnit != "" {
+		bs, err := tester.JUnit(*tInput, rs)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = os.WriteFile(*tJUnit, bs, 0644)
+		if err != nil {
+			log.Fatalf("FATAL Can't save JUnit file: %v", err)
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(exitErrors)
+	}
+}
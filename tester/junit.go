@@ -0,0 +1,68 @@
+// JUnit output for the tester of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// Continuous integration systems such as Jenkins and GitLab read test results
+// in the XML format of JUnit. Each source file is a test suite, each .test
+// block a test case. The simulated cycles go in the standard output of the
+// test case, since there is no real time to speak of
+
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit takes the name of the test suite, usually the source file, and the
+// results, and returns them as a JUnit XML document
+func JUnit(suite string, rs []Result) ([]byte, error) {
+
+	s := junitSuite{Name: suite, Tests: len(rs)}
+
+	for _, r := range rs {
+		tc := junitCase{
+			Name:      r.Name,
+			Classname: suite,
+			SystemOut: fmt.Sprintf("%d cycles", r.Cycles),
+		}
+
+		if !r.Passed() {
+			s.Failures++
+			tc.Failure = &junitFailure{
+				Message: r.Failures[0],
+				Text:    strings.Join(r.Failures, "\n"),
+			}
+		}
+
+		s.Cases = append(s.Cases, tc)
+	}
+
+	bs, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(bs, '\n')...), nil
+}
@@ -0,0 +1,225 @@
+// Tester package for the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+// The tester runs the .test blocks of a program in the simulator. Each test
+// starts with fresh memory and the MPU in the state it has after a reset, and
+// runs from the start of the test code until it reaches the end of it, or
+// until it comes to a "brk", "stp", or "wai". Then the .expect directives of
+// the test are checked. Faults of the memory such as writes to ROM make a
+// test fail as well
+
+package tester
+
+import (
+	"fmt"
+
+	"cthulhu/data"
+	"cthulhu/simulator"
+)
+
+// DefaultLimit is the number of cycles a test may take if the user doesn't
+// give a limit
+const DefaultLimit = 1000000
+
+// Result is the outcome of a single test
+type Result struct {
+	Name     string
+	File     string
+	Line     int
+	Cycles   int
+	Failures []string // empty if the test passed
+}
+
+// Passed returns true if the test didn't fail
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Tester takes the machine after the generator is done and the limit of cycles
+// for each test, and returns the results of all tests in order. An
+// "expect cycles" directive sets a lower limit for its test
+func Tester(m *data.Machine, limit int) []Result {
+	var rs []Result
+
+	for _, t := range m.Tests {
+		rs = append(rs, run(m, t, limit))
+	}
+
+	return rs
+}
+
+// run takes the machine, a test and the limit of cycles, and runs the test
+func run(m *data.Machine, t data.Test, limit int) Result {
+
+	r := Result{Name: t.Name, File: t.Node.File, Line: t.Node.Line}
+
+	fail := func(s string) {
+		r.Failures = append(r.Failures, s)
+	}
+
+	// The test code is ROM as far as the program is concerned. Programs
+	// without any memory areas get all RAM anyway
+	rom := append([][2]int{}, m.ROM...)
+	if len(m.RAM) > 0 || len(m.ROM) > 0 {
+		rom = append(rom, [2]int{t.Addr, t.Addr + len(t.Code) - 1})
+	}
+
+	mem := simulator.NewMap(m.RAM, rom)
+	mem.Load(m.Origin, m.Code)
+	mem.Load(t.Addr, t.Code)
+
+	c, err := simulator.New(m.MPU, mem)
+	if err != nil {
+		fail(err.Error())
+		return r
+	}
+
+	c.PBR = byte(t.Addr >> 16)
+	c.PC = uint16(t.Addr)
+	end := t.Addr + len(t.Code)
+
+	for _, e := range t.Expects {
+		if e.Target == "cycles" && e.Value < limit {
+			limit = e.Value
+		}
+	}
+
+	for c.Address() != end && !c.Stopped && !c.Waiting {
+
+		if oc, ok := c.Next(); ok && oc.SAN == "brk" {
+			break
+		}
+
+		if c.Cycles > limit {
+			fail(fmt.Sprintf("Cycle limit of %d reached at $%06X", limit, c.Address()))
+			r.Cycles = c.Cycles
+			return r
+		}
+
+		if err := c.Step(); err != nil {
+			fail(err.Error())
+			r.Cycles = c.Cycles
+			return r
+		}
+	}
+
+	r.Cycles = c.Cycles
+
+	for _, f := range mem.Faults {
+		fail(f)
+	}
+
+	for _, e := range t.Expects {
+		if s := check(c, mem, e); s != "" {
+			fail(fmt.Sprintf("(%s, %d) %s", e.File, e.Line, s))
+		}
+	}
+
+	return r
+}
+
+// check takes the CPU, the memory and an .expect directive, and returns an
+// empty string if the expectation is met, otherwise what went wrong
+func check(c *simulator.CPU, mem *simulator.Map, e data.Expect) string {
+
+	var got int
+	width := 4 // hex digits
+
+	switch e.Target {
+
+	case "a":
+		got = int(c.A)
+		if c.E || c.P&simulator.FlagM != 0 {
+			got &= 0xff
+			width = 2
+		}
+	case "x":
+		got = int(c.X)
+	case "y":
+		got = int(c.Y)
+	case "s":
+		got = int(c.S)
+	case "d":
+		got = int(c.D)
+	case "dbr":
+		got, width = int(c.DBR), 2
+	case "pbr":
+		got, width = int(c.PBR), 2
+	case "p":
+		got, width = int(c.P), 2
+
+	case "cycles":
+		if c.Cycles > e.Value {
+			return fmt.Sprintf("Took %d cycles, expected at most %d", c.Cycles, e.Value)
+		}
+		return ""
+
+	case "flags":
+		return checkFlags(c, e.Flags)
+
+	case "memory":
+		for i, b := range e.Bytes {
+			a := e.Addr + i
+			if got := mem.Read(a); got != b {
+				return fmt.Sprintf("Memory at $%04X is $%02X, expected $%02X", a, got, b)
+			}
+		}
+		return ""
+	}
+
+	if e.Target == "x" || e.Target == "y" {
+		if c.E || c.P&simulator.FlagX != 0 {
+			width = 2
+		}
+	}
+
+	if got != e.Value {
+		return fmt.Sprintf("Register %s is $%0*X, expected $%0*X", e.Target, width, got, width, e.Value)
+	}
+
+	return ""
+}
+
+// checkFlags takes the CPU and a string of flags, and returns an empty string
+// if the upper case flags are set and the lower case flags are clear
+func checkFlags(c *simulator.CPU, flags string) string {
+
+	bits := map[rune]byte{
+		'n': simulator.FlagN, 'v': simulator.FlagV, 'm': simulator.FlagM,
+		'x': simulator.FlagX, 'd': simulator.FlagD, 'i': simulator.FlagI,
+		'z': simulator.FlagZ, 'c': simulator.FlagC,
+	}
+
+	for _, f := range flags {
+		want := f >= 'A' && f <= 'Z'
+		lower := f | 0x20
+
+		set := c.E
+		if lower != 'e' {
+			set = c.P&bits[lower] != 0
+		}
+
+		if set != want {
+			return fmt.Sprintf("Flags are '%s', expected '%s'", flagString(c), flags)
+		}
+	}
+
+	return ""
+}
+
+// flagString returns the flags of the CPU as a string, upper case for set
+func flagString(c *simulator.CPU) string {
+	s := []byte("nvmxdizce")
+
+	for i := 0; i < 8; i++ {
+		if c.P&(0x80>>uint(i)) != 0 {
+			s[i] -= 'a' - 'A'
+		}
+	}
+	if c.E {
+		s[8] = 'E'
+	}
+
+	return string(s)
+}
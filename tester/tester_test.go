@@ -0,0 +1,59 @@
+// Test file for the tester of the Cthulhu Assembler
+// First version: 19. Oct 2026
+// This version: 19. Oct 2026
+
+package tester
+
+import (
+	"testing"
+
+	"cthulhu/data"
+	"cthulhu/node"
+)
+
+func TestTester(t *testing.T) {
+
+	var tests = []struct {
+		name    string
+		code    []byte // test code at $8002
+		expects []data.Expect
+		limit   int
+		passed  bool
+	}{
+		{"pass", []byte{0xa9, 0x15, 0x20, 0x00, 0x80}, // lda.# 21 jsr $8000
+			[]data.Expect{{Target: "a", Value: 42}, {Target: "flags", Flags: "nzcE"}},
+			100, true},
+		{"wrong value", []byte{0xa9, 0x15, 0x20, 0x00, 0x80},
+			[]data.Expect{{Target: "a", Value: 43}},
+			100, false},
+		{"memory", []byte{0xa9, 0x15, 0x85, 0x10, 0x00, 0x00}, // lda.# 21 sta.d $10 brk 0
+			[]data.Expect{{Target: "memory", Addr: 0x10, Bytes: []byte{0x15}}},
+			100, true},
+		{"too slow", []byte{0x80, 0xfe}, // bra *
+			nil, 100, false},
+		{"expected cycles", []byte{0xa9, 0x15, 0x20, 0x00, 0x80},
+			[]data.Expect{{Target: "cycles", Value: 15}},
+			100, false},
+	}
+
+	for _, test := range tests {
+		m := data.Machine{
+			MPU:    "65c02",
+			Origin: 0x8000,
+			Code:   []byte{0x0a, 0x60}, // asl.a rts
+			Tests: []data.Test{{
+				Name:    test.name,
+				Addr:    0x8002,
+				Code:    test.code,
+				Expects: test.expects,
+				Node:    &node.Node{},
+			}},
+		}
+
+		rs := Tester(&m, test.limit)
+
+		if len(rs) != 1 || rs[0].Passed() != test.passed {
+			t.Errorf("%s: got %v, want passed %t", test.name, rs, test.passed)
+		}
+	}
+}
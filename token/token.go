@@ -1,7 +1,7 @@
 // Token structure for Cthulhu Assembler
 // Scot W. Stevenson
 // First version: 02. May 2018
-// This version: 18. May 2018
+// This version: 19. Oct 2026
 
 // So here's a funny thing: The Go specs instist that you should always use
 // camel case, and not all caps, even for constants. However, if you take a look
@@ -11,12 +11,16 @@
 
 package token
 
+// Lines and columns start with 1. The end is the first column after the
+// token, so an empty token has the same start and end
 type Token struct {
-	Type  int
-	Line  int    // starts with 1
-	Index int    // starts with 1
-	File  string // name of the file the token comes from
-	Text  string // raw text
+	Type     int
+	Line     int    // line the token starts on
+	Index    int    // column the token starts in, including prefixes like '$'
+	EndLine  int    // line the token ends on
+	EndIndex int    // first column after the token
+	File     string // name of the file the token comes from
+	Text     string // raw text
 }
 
 const (